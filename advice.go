@@ -0,0 +1,67 @@
+package hget
+
+import (
+	"fmt"
+	"time"
+)
+
+// adviceMinimum is how long a download has to run with as many connections for Advice to rely on it
+var adviceMinimum = 3 * time.Second
+
+// maxAdvisedConnections is the most connections Advice recommends, beyond that servers tend to refuse them
+var maxAdvisedConnections = 32
+
+// Advice recommends a number of connections from how the throughput of a download with `connections`
+// of them changed as its connections started and ended, or returns "" when nothing stands out.
+func (c *ConnectionStats) Advice(connections int) string {
+	c.mu.Lock()
+	samples := append([]activitySample(nil), c.samples...)
+	c.mu.Unlock()
+	return adviceOf(samples, connections)
+}
+
+func adviceOf(samples []activitySample, connections int) string {
+	if connections < 2 {
+		return ""
+	}
+	bytes := make(map[int]int64)
+	elapsed := make(map[int]time.Duration)
+	for _, s := range samples {
+		bytes[s.active] += s.bytes
+		elapsed[s.active] += s.elapsed
+	}
+	rate := func(active int) (float64, bool) {
+		if elapsed[active] < adviceMinimum {
+			return 0, false
+		}
+		return float64(bytes[active]) / elapsed[active].Seconds(), true
+	}
+	full, ok := rate(connections)
+	if !ok || full <= 0 {
+		return ""
+	}
+
+	// fewer connections got about as much, the link is the limit
+	for active := 1; active < connections; active++ {
+		if r, ok := rate(active); ok && r >= 0.9*full {
+			return fmt.Sprintf("%d connections saturated your link at %s/s; %d would suffice", connections, humanBytes(int64(full)), active)
+		}
+	}
+	// each connection got as much as when fewer ran, the server limits every one of them
+	for active := connections - 1; active >= 1; active-- {
+		r, ok := rate(active)
+		if !ok {
+			continue
+		}
+		each, before := full/float64(connections), r/float64(active)
+		more := connections * 2
+		if more > maxAdvisedConnections {
+			more = maxAdvisedConnections
+		}
+		if each >= 0.8*before && each <= 1.25*before && more > connections {
+			return fmt.Sprintf("server throttles per connection at about %s/s; try -n %d", humanBytes(int64(each)), more)
+		}
+		break
+	}
+	return ""
+}
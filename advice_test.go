@@ -0,0 +1,59 @@
+package hget
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdvice(t *testing.T) {
+	// samples of `bytes` a second while `active` connections ran for 4 seconds
+	samples := func(rates map[int]int64) []activitySample {
+		var s []activitySample
+		for active, bytes := range rates {
+			s = append(s, activitySample{active: active, bytes: 4 * bytes, elapsed: 4 * time.Second})
+		}
+		return s
+	}
+	if advice := adviceOf(samples(map[int]int64{8: 10 << 20, 6: 10 << 20, 4: 10 << 20, 2: 6 << 20}), 8); !strings.Contains(advice, "8 connections saturated your link") || !strings.Contains(advice, "4 would suffice") {
+		t.Fatalf("saturated link advised %q", advice)
+	}
+	if advice := adviceOf(samples(map[int]int64{8: 8 << 20, 7: 7 << 20, 4: 4 << 20}), 8); !strings.Contains(advice, "throttles per connection") || !strings.Contains(advice, "-n 16") {
+		t.Fatalf("throttling server advised %q", advice)
+	}
+	if advice := adviceOf(samples(map[int]int64{32: 32 << 20, 16: 16 << 20}), 32); advice != "" {
+		t.Fatalf("throttling server past the most connections advised %q", advice)
+	}
+	if advice := adviceOf(samples(map[int]int64{8: 8 << 20, 7: 5 << 20}), 8); advice != "" {
+		t.Fatalf("unclear throughput advised %q", advice)
+	}
+	short := []activitySample{{active: 8, bytes: 8 << 20, elapsed: time.Second}, {active: 4, bytes: 8 << 20, elapsed: 4 * time.Second}}
+	if advice := adviceOf(short, 8); advice != "" {
+		t.Fatalf("too short a download advised %q", advice)
+	}
+}
+
+func TestConnectionStatsSamples(t *testing.T) {
+	defer func(every time.Duration) { sampleEvery = every }(sampleEvery)
+	sampleEvery = time.Hour
+	c := NewConnectionStats()
+	c.OnConnection(0, ConnectionInfo{})
+	c.OnBytes(0, 10)
+	c.OnConnection(1, ConnectionInfo{})
+	c.OnBytes(0, 5)
+	c.OnBytes(1, 5)
+	c.OnPartDone(0)
+	c.OnPartDone(1)
+	if len(c.samples) != 3 {
+		t.Fatalf("%d samples recorded", len(c.samples))
+	}
+	if s := c.samples[0]; s.active != 1 || s.bytes != 10 {
+		t.Fatalf("first sample %+v", s)
+	}
+	if s := c.samples[1]; s.active != 2 || s.bytes != 10 {
+		t.Fatalf("second sample %+v", s)
+	}
+	if s := c.samples[2]; s.active != 1 || s.bytes != 0 {
+		t.Fatalf("last sample %+v", s)
+	}
+}
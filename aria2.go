@@ -0,0 +1,167 @@
+package hget
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// aria2Flags are the aria2c flags hget understands, and the option of hget they set
+var aria2Flags = map[string]string{
+	"x":                          "n",
+	"max-connection-per-server":  "n",
+	"s":                          "n",
+	"split":                      "n",
+	"out":                        "o",
+	"d":                          "dir",
+	"i":                          "file",
+	"input-file":                 "file",
+	"max-download-limit":         "rate",
+	"max-overall-download-limit": "rate",
+	"all-proxy":                  "proxy",
+	"http-proxy":                 "proxy",
+	"https-proxy":                "proxy",
+	"U":                          "ua",
+	"user-agent":                 "ua",
+	"referer":                    "header",
+	"checksum":                   "checksum",
+	"check-certificate":          "skip-tls",
+}
+
+// aria2Args rewrites the aria2c flags of the command line `args` into the options of hget defined on
+// `fs`, so scripts built around aria2c keep working. hget resumes on its own, -c is dropped.
+func aria2Args(fs *flag.FlagSet, args []string) []string {
+	var rewritten []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			return append(rewritten, args[i:]...)
+		}
+		name := strings.TrimLeft(arg, "-")
+		value, hasValue := "", false
+		if fields := strings.SplitN(name, "=", 2); len(fields) == 2 {
+			name, value, hasValue = fields[0], fields[1], true
+		}
+		if name == "c" || name == "continue" {
+			continue
+		}
+		option, ok := aria2Flags[name]
+		if !ok {
+			rewritten = append(rewritten, arg)
+			// keep the value of an option of hget along with it
+			if f := fs.Lookup(name); f != nil && !hasValue && !isBoolFlag(f) && i+1 < len(args) {
+				i++
+				rewritten = append(rewritten, args[i])
+			}
+			continue
+		}
+		if name == "check-certificate" {
+			// a bool, only --check-certificate=false means something to hget
+			rewritten = append(rewritten, fmt.Sprintf("-skip-tls=%v", hasValue && value == "false"))
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return append(rewritten, arg)
+			}
+			i++
+			value = args[i]
+		}
+		switch name {
+		case "max-download-limit", "max-overall-download-limit":
+			value = aria2Rate(value)
+		case "referer":
+			value = "Referer: " + value
+		case "checksum":
+			value = aria2Checksum(value)
+		}
+		rewritten = append(rewritten, "-"+option, value)
+	}
+	return rewritten
+}
+
+// aria2Rate turns the 1K or 2M of aria2c, powers of 1024, into a rate hget parses.
+func aria2Rate(value string) string {
+	if strings.HasSuffix(value, "K") || strings.HasSuffix(value, "M") {
+		return value + "iB"
+	}
+	return value
+}
+
+// aria2Checksum turns the sha-256=hex of aria2c into sha256:hex.
+func aria2Checksum(value string) string {
+	fields := strings.SplitN(value, "=", 2)
+	if len(fields) != 2 {
+		return value
+	}
+	return strings.ReplaceAll(strings.ToLower(fields[0]), "-", "") + ":" + fields[1]
+}
+
+// aria2Requests reads an aria2c input file: a line per download with its urls separated by tabs, the
+// others being mirrors, followed by indented `name=value` options. Plain url lists are read as well.
+func aria2Requests(raw []byte) ([]DownloadRequest, error) {
+	var requests []DownloadRequest
+	var dirs []string
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if text[0] != ' ' && text[0] != '\t' {
+			urls := strings.Split(trimmed, "\t")
+			req := DownloadRequest{URL: urls[0]}
+			for _, url := range urls[1:] {
+				if url = strings.TrimSpace(url); url != "" && new(mirrorFlag).Set(url) == nil {
+					req.Mirrors = append(req.Mirrors, url)
+				}
+			}
+			requests = append(requests, req)
+			dirs = append(dirs, "")
+			continue
+		}
+
+		fields := strings.SplitN(trimmed, "=", 2)
+		if len(requests) == 0 || len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected an url, or an indented name=value option of the url before", line)
+		}
+		req := &requests[len(requests)-1]
+		switch name, value := fields[0], fields[1]; name {
+		case "out":
+			req.Output = value
+		case "dir":
+			dirs[len(dirs)-1] = value
+		case "checksum":
+			req.Checksum = aria2Checksum(value)
+		case "referer":
+			req.Referrer = value
+		case "header":
+			header := strings.SplitN(value, ":", 2)
+			switch {
+			case len(header) == 2 && strings.EqualFold(header[0], "Referer"):
+				req.Referrer = strings.TrimSpace(header[1])
+			case len(header) == 2 && strings.EqualFold(header[0], "Cookie"):
+				req.Cookie = strings.TrimSpace(header[1])
+			default:
+				Warnf("line %d: only the Referer and Cookie headers are supported, %s is ignored\n", line, value)
+			}
+		default:
+			Warnf("line %d: aria2 option %s is not supported, ignored\n", line, name)
+		}
+	}
+	for i, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		out := requests[i].Output
+		if out == "" {
+			out = filepath.Base(requests[i].URL)
+		}
+		requests[i].Output = filepath.Join(dir, out)
+	}
+	return requests, scanner.Err()
+}
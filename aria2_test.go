@@ -0,0 +1,54 @@
+package hget
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestAria2Args(t *testing.T) {
+	fs := flag.NewFlagSet("hget", flag.ContinueOnError)
+	RegisterOptions(fs)
+
+	args := []string{"-c", "-x", "16", "-proxy", "127.0.0.1:1080", "-skip-tls", "--max-download-limit=2M", "--check-certificate=false",
+		"--referer", "http://a.org/", "--checksum=sha-256=abcd", "-o", "out.iso", "-U", "curl", "http://a.org/1.iso", "-x"}
+	expected := []string{"-n", "16", "-proxy", "127.0.0.1:1080", "-skip-tls", "-rate", "2MiB", "-skip-tls=true",
+		"-header", "Referer: http://a.org/", "-checksum", "sha256:abcd", "-o", "out.iso", "-ua", "curl", "http://a.org/1.iso", "-x"}
+	if got := aria2Args(fs, args); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	if got := aria2Args(fs, []string{"--check-certificate", "URL"}); !reflect.DeepEqual(got, []string{"-skip-tls=false", "URL"}) {
+		t.Fatalf("--check-certificate should verify certificates, got %q", got)
+	}
+	if got := aria2Args(fs, []string{"-d", "/mnt/storage", "--dir=/srv", "URL"}); !reflect.DeepEqual(got, []string{"-dir", "/mnt/storage", "--dir=/srv", "URL"}) {
+		t.Fatalf("-d should set -dir, got %q", got)
+	}
+}
+
+func TestAria2InputFile(t *testing.T) {
+	raw := "http://a.org/1.iso\thttp://b.org/1.iso\tftp://c.org/1.iso\n" +
+		"  out=one.iso\n" +
+		"  dir=/srv\n" +
+		"  checksum=sha-1=0a0b\n" +
+		"  header=Cookie: a=b\n" +
+		"  max-tries=5\n" +
+		"# comment\n" +
+		"\n" +
+		"http://a.org/2.iso\n" +
+		"\treferer=http://a.org/\n"
+	requests, err := ParseDownloadList([]byte(raw))
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	expected := []DownloadRequest{
+		{URL: "http://a.org/1.iso", Mirrors: []string{"http://b.org/1.iso"}, Output: "/srv/one.iso", Checksum: "sha1:0a0b", Cookie: "a=b"},
+		{URL: "http://a.org/2.iso", Referrer: "http://a.org/"},
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, requests)
+	}
+
+	if _, err := ParseDownloadList([]byte("  out=orphan.iso\nhttp://a.org/1.iso\n")); err == nil {
+		t.Fatalf("options before any url should fail")
+	}
+}
@@ -0,0 +1,44 @@
+package hget
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// joiningPath returns the file the parts are joined into before it is renamed to `out`, next to it
+// so that the rename stays on the same file system and whoever watches the folder never sees a
+// partial file. Outputs such as fifos, which can not be replaced, are joined into directly.
+func joiningPath(out string) string {
+	if stat, err := os.Stat(out); err == nil && !stat.Mode().IsRegular() {
+		return out
+	}
+	return filepath.Join(filepath.Dir(out), "."+filepath.Base(out)+".hget")
+}
+
+// moveIntoPlace renames the joined file `joined` to `out` once it passed verification, synced to the
+// disk before and after unless -fsync is never.
+func moveIntoPlace(joined string, out string) error {
+	if joined == out {
+		return nil
+	}
+	if fsyncMode != fsyncNever {
+		f, err := os.OpenFile(joined, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		err = syncFile(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(joined, out); err != nil {
+		return err
+	}
+	if fsyncMode != fsyncNever {
+		syncDir(filepath.Dir(out))
+	}
+	return nil
+}
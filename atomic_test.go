@@ -0,0 +1,55 @@
+package hget
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJoinIntoPlace(t *testing.T) {
+	displayProgress = false
+	defer func(data string) { dataPath, output, checksum = data, "", "" }(dataPath)
+	dataPath = t.TempDir()
+	content := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "placed.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	output = filepath.Join(dir, "placed.bin")
+
+	checksum = "sha256:00"
+	if err := Download(server.URL + "/bad.bin"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Fatalf("a file failing verification should not be in place, got %v", err)
+	}
+
+	checksum = ""
+	if err := Download(server.URL + "/good.bin"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(output); string(got) != content {
+		t.Fatalf("unexpected content %q", got)
+	}
+	if _, err := os.Stat(joiningPath(output)); !os.IsNotExist(err) {
+		t.Fatalf("the joined file should have been renamed, got %v", err)
+	}
+}
+
+func TestJoiningPath(t *testing.T) {
+	dir := t.TempDir()
+	if got := joiningPath(filepath.Join(dir, "file.iso")); got != filepath.Join(dir, ".file.iso.hget") {
+		t.Fatalf("joined into %s", got)
+	}
+	if got := joiningPath(dir); got != dir {
+		t.Fatalf("an output which is not a regular file should be joined into directly, got %s", got)
+	}
+}
@@ -0,0 +1,187 @@
+package hget
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var detach = false
+
+// detachedEnv marks the hget -detach started in the background
+var detachedEnv = "HGET_DETACHED"
+
+// attachEvery is how often a running download sends its progress to hget attach
+var attachEvery = time.Second
+
+// detachedChild returns whether this hget is the background download of a hget -detach.
+func detachedChild() bool {
+	return os.Getenv(detachedEnv) != ""
+}
+
+// Detach starts hget again with the same arguments in the background, in its own session so that
+// closing the terminal does not stop it, and prints the task of `url` and its control socket.
+func Detach(url string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), detachedEnv+"=1")
+	cmd.SysProcAttr = detachAttr()
+	// stdin, stdout and stderr are the null device, the logs go to the task log
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	task := TaskFromURL(url)
+	Printf("Downloading %s in the background, process %d\n", url, cmd.Process.Pid)
+	fmt.Printf("task:    %s\n", task)
+	fmt.Printf("control: %s\n", filepath.Join(FolderOf(url), controlSocketName))
+	fmt.Printf("hget attach %s shows its progress, hget tasks show %s --log its logs\n", task, task)
+	return cmd.Process.Release()
+}
+
+// PartProgress is how far a part of a running download got, as sent to hget attach.
+type PartProgress struct {
+	Index int64
+	Size  int64
+	Done  int64
+	Ended bool `json:",omitempty"`
+}
+
+// AttachFrame is the progress of a running download sent to hget attach every attachEvery, its
+// parts drawn as bars on a terminal and the line written otherwise.
+type AttachFrame struct {
+	Line  string
+	Parts []PartProgress `json:",omitempty"`
+}
+
+// LiveParts is a ProgressSink keeping how far every part got, for hget attach to draw them.
+type LiveParts struct {
+	nopSink
+
+	mu    sync.Mutex
+	parts []PartProgress
+	index map[int64]int
+}
+
+// OnPartStart implements ProgressSink
+func (l *LiveParts) OnPartStart(index int64, size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.index == nil {
+		l.index = make(map[int64]int)
+	}
+	if _, ok := l.index[index]; !ok {
+		l.index[index] = len(l.parts)
+		l.parts = append(l.parts, PartProgress{Index: index, Size: size})
+	}
+}
+
+// OnBytes implements ProgressSink
+func (l *LiveParts) OnBytes(index int64, n int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i, ok := l.index[index]; ok {
+		l.parts[i].Done += n
+	}
+}
+
+// OnPartDone implements ProgressSink
+func (l *LiveParts) OnPartDone(index int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i, ok := l.index[index]; ok {
+		l.parts[i].Ended = true
+	}
+}
+
+// Parts returns a copy of the progress of the parts.
+func (l *LiveParts) Parts() []PartProgress {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]PartProgress(nil), l.parts...)
+}
+
+// Attach shows the progress of the running download of `task` on `w` until it ends, as the bars of
+// the download itself when `w` is the terminal and as a line every attachEvery otherwise.
+func Attach(task string, w io.Writer) error {
+	folder := taskFolder(task)
+	if !ExistDir(folder) {
+		return fmt.Errorf("there is no task %s", task)
+	}
+	conn, err := net.DialTimeout("unix", filepath.Join(folder, controlSocketName), 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("%s is not running: %v", task, err)
+	}
+	defer conn.Close()
+	if _, err := fmt.Fprintln(conn, "progress"); err != nil {
+		return err
+	}
+
+	var bars *attachedBars
+	if w == os.Stdout && IsTerminal(os.Stdout) {
+		bars = &attachedBars{sink: NewBarSink(task, nil), seen: make(map[int64]PartProgress)}
+	}
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		var frame AttachFrame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return fmt.Errorf("unexpected progress from %s: %v", task, err)
+		}
+		if bars != nil && len(frame.Parts) > 0 {
+			bars.update(frame.Parts)
+		} else {
+			fmt.Fprintln(w, frame.Line)
+		}
+	}
+	if bars != nil {
+		bars.sink.finish()
+	}
+	if ExistDir(folder) {
+		fmt.Fprintf(w, "%s stopped, hget resume %s continues it\n", task, task)
+	} else {
+		fmt.Fprintf(w, "%s completed\n", task)
+	}
+	return nil
+}
+
+// attachedBars replays the progress of the parts sent by a running download on the bars of a BarSink.
+type attachedBars struct {
+	sink *BarSink
+	seen map[int64]PartProgress
+}
+
+func (b *attachedBars) update(parts []PartProgress) {
+	for _, part := range parts {
+		seen, ok := b.seen[part.Index]
+		if !ok {
+			b.sink.OnPartStart(part.Index, part.Size)
+		}
+		if part.Done > seen.Done {
+			b.sink.OnBytes(part.Index, part.Done-seen.Done)
+		}
+		if part.Ended && !seen.Ended {
+			b.sink.OnPartDone(part.Index)
+		}
+		b.seen[part.Index] = part
+	}
+}
+
+// progressLine sums up the running download of `total` bytes measured by `meter` for hget attach.
+func progressLine(meter *Meter, total int64) string {
+	left := meter.Remaining()
+	line := fmt.Sprintf("%s left of %s at %s/s", humanBytes(left), humanBytes(total), humanBytes(int64(meter.Throughput().Rate())))
+	if eta, ok := meter.ETA(); ok && left > 0 {
+		line += ", about " + formatETA(eta)
+	}
+	return line
+}
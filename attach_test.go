@@ -0,0 +1,56 @@
+package hget
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttach(t *testing.T) {
+	defer func(path string, every time.Duration) { dataPath, attachEvery = path, every }(dataPath, attachEvery)
+	dataPath = t.TempDir()
+	attachEvery = 10 * time.Millisecond
+
+	folder := FolderOf("http://a.org/attached.iso")
+	os.MkdirAll(folder, 0700)
+	c, err := ListenControl(folder)
+	if err != nil {
+		t.Skipf("no unix sockets: %v", err)
+	}
+	meter := NewMeter(Throughput{})
+	live := &LiveParts{}
+	sink := MultiSink{meter, live}
+	sink.OnPartStart(0, 1024)
+	sink.OnPartStart(1, 1024)
+	sink.OnBytes(0, 1024)
+	sink.OnPartDone(0)
+	c.SetProgress(func() AttachFrame { return AttachFrame{Line: progressLine(meter, 2048), Parts: live.Parts()} })
+	if parts := live.Parts(); len(parts) != 2 || parts[0] != (PartProgress{Index: 0, Size: 1024, Done: 1024, Ended: true}) || parts[1].Done != 0 {
+		t.Fatalf("unexpected parts %+v", parts)
+	}
+
+	var out bytes.Buffer
+	attached := make(chan error)
+	go func() { attached <- Attach("attached.iso", &out) }()
+	time.Sleep(50 * time.Millisecond)
+	// as when a download completes, its folder is gone before the socket closes
+	os.RemoveAll(folder)
+	c.Close()
+
+	select {
+	case err := <-attached:
+		if err != nil {
+			t.Fatalf("err should be nil, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("attach should end with the download")
+	}
+	if !strings.Contains(out.String(), "1.0 KiB left of 2.0 KiB") || !strings.HasSuffix(out.String(), "attached.iso completed\n") {
+		t.Fatalf("unexpected progress %q", out.String())
+	}
+	if err := Attach("attached.iso", &out); err == nil {
+		t.Fatal("attaching to a missing task should fail")
+	}
+}
@@ -0,0 +1,183 @@
+package hget
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var audit = false
+
+var auditFileName = "audit.log"
+var auditReportName = "audit-report.txt"
+
+// AuditEntry is what one response delivered for a part.
+type AuditEntry struct {
+	Part         int64
+	Status       int
+	ContentRange string `json:",omitempty"`
+	// Source is the url the response came from, the origin, a mirror, a peer or an agent
+	Source string `json:",omitempty"`
+	// From is the first byte asked for, Start the first byte the response actually carried
+	From    int64
+	Start   int64
+	Written int64
+	Time    time.Time
+}
+
+// AuditLog records every response of a task in its folder, across resumes, so that the parts can be
+// checked for gaps and overlaps before they are joined.
+type AuditLog struct {
+	mu     sync.Mutex
+	folder string
+	file   *os.File
+}
+
+// OpenAudit appends to the audit log of the task in `folder`.
+func OpenAudit(folder string) (*AuditLog, error) {
+	if err := MkdirIfNotExist(folder); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(folder, auditFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{folder: folder, file: f}, nil
+}
+
+// Record logs that `written` bytes of `resp` went into `part`, starting at `start`.
+// It does nothing on a nil log, so callers do not need to care whether auditing is on.
+func (a *AuditLog) Record(part Part, resp *http.Response, start int64, written int64) {
+	if a == nil || resp == nil {
+		return
+	}
+	entry := AuditEntry{
+		Part:         part.Index,
+		Status:       resp.StatusCode,
+		ContentRange: resp.Header.Get("Content-Range"),
+		From:         part.RangeFrom,
+		Start:        start,
+		Written:      written,
+		Time:         time.Now(),
+	}
+	if resp.Request != nil {
+		entry.Source = resp.Request.URL.String()
+	}
+	line, _ := json.Marshal(entry)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		Warnf("could not write audit log: %v\n", err)
+	}
+}
+
+// Close closes the log file.
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// responseStart returns the first byte of the file carried by `resp`.
+func responseStart(resp *http.Response) int64 {
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0
+	}
+	start, err := rangeStart(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// Verify checks that the responses of every part line up without gaps or overlaps, that
+// neighbouring parts touch, and that the part files hold what was written to them.
+// Problems are written to a report in the task folder.
+func (a *AuditLog) Verify(parts []Part) error {
+	if a == nil {
+		return nil
+	}
+	entries, err := readAudit(filepath.Join(a.folder, auditFileName))
+	if err != nil {
+		return err
+	}
+	byPart := make(map[int64][]AuditEntry)
+	for _, e := range entries {
+		byPart[e.Part] = append(byPart[e.Part], e)
+	}
+
+	sorted := append([]Part(nil), parts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Index < sorted[j].Index })
+
+	var issues []string
+	var prevEnd int64 = -1
+	for _, part := range sorted {
+		log := byPart[part.Index]
+		if len(log) == 0 {
+			// e.g. downloaded before auditing got turned on
+			Warnf("part %d was not audited\n", part.Index)
+			prevEnd = -1
+			continue
+		}
+
+		first := log[0].From
+		if prevEnd >= 0 && first != prevEnd {
+			issues = append(issues, fmt.Sprintf("part %d: starts at byte %d but the previous part ends before byte %d", part.Index, first, prevEnd))
+		}
+		next := first
+		for _, e := range log {
+			if e.Written > 0 && e.Start != next {
+				issues = append(issues, fmt.Sprintf("part %d: response %d %q carried bytes from %d while the part continues at %d", part.Index, e.Status, e.ContentRange, e.Start, next))
+			}
+			next += e.Written
+		}
+		prevEnd = next
+
+		if stat, err := os.Stat(part.Path); err != nil {
+			issues = append(issues, fmt.Sprintf("part %d: %v", part.Index, err))
+		} else if stat.Size() != next-first {
+			issues = append(issues, fmt.Sprintf("part %d: file holds %d bytes but responses wrote %d", part.Index, stat.Size(), next-first))
+		}
+	}
+	if len(issues) == 0 {
+		return nil
+	}
+
+	report := filepath.Join(a.folder, auditReportName)
+	if err := ioutil.WriteFile(report, []byte(strings.Join(issues, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		Errorf("%s\n", issue)
+	}
+	return fmt.Errorf("audit found %d problems in the parts, see %s", len(issues), report)
+}
+
+func readAudit(path string) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("corrupt audit log %s: %v", path, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
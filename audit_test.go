@@ -0,0 +1,52 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditVerify(t *testing.T) {
+	folder := t.TempDir()
+	log, err := OpenAudit(folder)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	defer log.Close()
+
+	partial := func(contentRange string) *http.Response {
+		return &http.Response{StatusCode: http.StatusPartialContent, Header: http.Header{"Content-Range": {contentRange}}}
+	}
+	parts := []Part{
+		{Index: 0, Path: filepath.Join(folder, "file.part000000"), RangeFrom: 0, RangeTo: 9},
+		{Index: 1, Path: filepath.Join(folder, "file.part000001"), RangeFrom: 10, RangeTo: 19},
+	}
+	ioutil.WriteFile(parts[0].Path, []byte("0123456789"), 0600)
+	ioutil.WriteFile(parts[1].Path, []byte("0123456789"), 0600)
+
+	// the second part got interrupted and resumed
+	log.Record(parts[0], partial("bytes 0-9/20"), 0, 10)
+	log.Record(parts[1], partial("bytes 10-19/20"), 10, 4)
+	resumed := parts[1]
+	resumed.RangeFrom = 14
+	log.Record(resumed, partial("bytes 14-19/20"), 14, 6)
+
+	if err := log.Verify(parts); err != nil {
+		t.Fatalf("contiguous parts should pass, got %v", err)
+	}
+
+	// a server ignoring the range of a resumed request
+	resumed.RangeFrom = 20
+	log.Record(resumed, &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}, 0, 20)
+	if err := log.Verify(parts); err == nil {
+		t.Fatalf("response starting at the wrong offset should fail")
+	}
+	report, err := ioutil.ReadFile(filepath.Join(folder, auditReportName))
+	if err != nil || !strings.Contains(string(report), "part 1: response 200") {
+		t.Fatalf("report should name the bad response, got %q", report)
+	}
+	os.Remove(filepath.Join(folder, auditReportName))
+}
@@ -0,0 +1,165 @@
+package hget
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// throttleRetries is how many throttled (429/503) responses a part tolerates before failing
+var throttleRetries = 10
+
+// defaultThrottle is used when a 429 response does not carry a Retry-After header
+var defaultThrottle = 5 * time.Second
+
+// maxThrottle caps the pause requested by a server
+var maxThrottle = 10 * time.Minute
+
+// refusedBackoff is the first pause after a host refused or reset connections, it doubles on every
+// storm of refusals up to maxRefusedBackoff
+var refusedBackoff = time.Second
+var maxRefusedBackoff = time.Minute
+
+// refusedRetries is how many storms of refusals in a row a host gets before the requests fail
+var refusedRetries = 6
+
+// hostBackoff keeps the time until which each host must not be contacted,
+// it is shared by all parts so a throttled server is paused for every connection at once.
+type hostBackoff struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+	// refusals counts the storms of refused connections of every host since it last accepted one
+	refusals map[string]int
+}
+
+var backoff = &hostBackoff{until: make(map[string]time.Time), refusals: make(map[string]int)}
+
+// isRefused tells whether `err` is a connection refused or reset, as an overloaded server does.
+func isRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// Refused pauses every request to `host` after it refused a connection, longer on every storm of
+// refusals. The refusals of the parts waiting for the same pause are one storm. It returns how long
+// to wait, whether this refusal started the storm, and false once the host refused too many times to
+// keep trying.
+func (b *hostBackoff) Refused(host string) (wait time.Duration, first bool, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if wait := b.until[host].Sub(now); wait > 0 && b.refusals[host] > 0 {
+		return wait, false, true
+	}
+	if b.refusals[host] >= refusedRetries {
+		return 0, false, false
+	}
+	wait = refusedBackoff << uint(b.refusals[host])
+	if wait > maxRefusedBackoff {
+		wait = maxRefusedBackoff
+	}
+	b.refusals[host]++
+	if until := now.Add(wait); until.After(b.until[host]) {
+		b.until[host] = until
+	}
+	return wait, true, true
+}
+
+// Connected forgets the refusals of `host` once it accepts connections again.
+func (b *hostBackoff) Connected(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.refusals, host)
+}
+
+// countdown waits `d` after telling why, counting the seconds down on a terminal.
+func countdown(reason string, d time.Duration) {
+	if !IsTerminal(os.Stderr) {
+		Warnf("%s, retrying in %v\n", reason, d)
+		time.Sleep(d)
+		return
+	}
+	for left := d; left > 0; left -= time.Second {
+		Warnf("\r%s, retrying in %v \033[K", reason, left.Round(time.Second))
+		if left < time.Second {
+			time.Sleep(left)
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	console().Errorf("\r\033[K")
+}
+
+// Pause stops every request to `host` for `d`, it returns false if the host was already paused for longer.
+func (b *hostBackoff) Pause(host string, d time.Duration) bool {
+	if d > maxThrottle {
+		d = maxThrottle
+	}
+	until := time.Now().Add(d)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until.Before(b.until[host]) {
+		return false
+	}
+	b.until[host] = until
+	return true
+}
+
+// Wait blocks until `host` is not paused anymore, it returns false if it was interrupted meanwhile.
+func (b *hostBackoff) Wait(host string, interruptChan chan bool) bool {
+	b.mu.Lock()
+	until := b.until[host]
+	b.mu.Unlock()
+
+	wait := time.Until(until)
+	if wait <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-interruptChan:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Throttled checks if `resp` asks the client to slow down and for how long.
+func Throttled(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	if d, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		return d, true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return defaultThrottle, true
+	}
+	return 0, false
+}
+
+// ParseRetryAfter parses a Retry-After header, which is either a number of seconds or a http date.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
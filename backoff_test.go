@@ -0,0 +1,115 @@
+package hget
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	if d, ok := ParseRetryAfter("120", now); !ok || d != 2*time.Minute {
+		t.Fatalf("retry after in seconds was parsed wrong: %v", d)
+	}
+	if d, ok := ParseRetryAfter("Tue, 01 Jun 2021 10:00:30 GMT", now); !ok || d != 30*time.Second {
+		t.Fatalf("retry after date was parsed wrong: %v", d)
+	}
+	if _, ok := ParseRetryAfter("soon", now); ok {
+		t.Fatalf("invalid retry after should not be accepted")
+	}
+	if _, ok := ParseRetryAfter("", now); ok {
+		t.Fatalf("empty retry after should not be accepted")
+	}
+}
+
+func TestHostBackoff(t *testing.T) {
+	b := &hostBackoff{until: make(map[string]time.Time)}
+	if !b.Pause("foo.bar", 50*time.Millisecond) {
+		t.Fatalf("first pause should be applied")
+	}
+	if b.Pause("foo.bar", time.Millisecond) {
+		t.Fatalf("shorter pause should not override a longer one")
+	}
+
+	start := time.Now()
+	if !b.Wait("foo.bar", make(chan bool)) {
+		t.Fatalf("wait should not be interrupted")
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Fatalf("wait should block until the pause is over")
+	}
+
+	b.Pause("foo.bar", time.Minute)
+	interrupt := make(chan bool, 1)
+	interrupt <- true
+	if b.Wait("foo.bar", interrupt) {
+		t.Fatalf("wait should be interrupted")
+	}
+}
+
+func TestRefusedBackoff(t *testing.T) {
+	defer func(first time.Duration) { refusedBackoff = first }(refusedBackoff)
+	refusedBackoff = 20 * time.Millisecond
+	b := &hostBackoff{until: make(map[string]time.Time), refusals: make(map[string]int)}
+
+	if wait, first, ok := b.Refused("a.org"); !ok || !first || wait != 20*time.Millisecond {
+		t.Fatalf("the first refusal should pause the host, got %v %v %v", wait, first, ok)
+	}
+	if wait, first, ok := b.Refused("a.org"); !ok || first || wait > 20*time.Millisecond {
+		t.Fatalf("a refusal during the pause should wait for it, got %v %v %v", wait, first, ok)
+	}
+	time.Sleep(25 * time.Millisecond)
+	if wait, first, _ := b.Refused("a.org"); !first || wait != 40*time.Millisecond {
+		t.Fatalf("the next storm should wait twice as long, got %v", wait)
+	}
+	b.refusals["a.org"] = refusedRetries
+	b.until["a.org"] = time.Time{}
+	if _, _, ok := b.Refused("a.org"); ok {
+		t.Fatalf("the host should be given up on")
+	}
+	b.Connected("a.org")
+	if _, _, ok := b.Refused("a.org"); !ok {
+		t.Fatalf("a host accepting connections again should be retried")
+	}
+}
+
+func TestPartWaitsForRefusingHost(t *testing.T) {
+	defer func(first time.Duration) { refusedBackoff = first }(refusedBackoff)
+	refusedBackoff = 50 * time.Millisecond
+
+	// the server only comes up after a first connection was refused
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	if _, err := net.Dial("tcp", addr); !isRefused(err) {
+		t.Skipf("the closed port should refuse connections, got %v", err)
+	}
+	content := strings.Repeat("0123456789", 100)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+	started := make(chan struct{})
+	time.AfterFunc(20*time.Millisecond, func() {
+		defer close(started)
+		if l, err := net.Listen("tcp", addr); err == nil {
+			srv.Listener = l
+			srv.Start()
+		}
+	})
+	defer func() { <-started }()
+
+	d := &HTTPDownloader{url: "http://" + addr + "/file", par: 2, len: 1000}
+	part := Part{Index: 1, Path: filepath.Join(t.TempDir(), "file.part000001"), RangeFrom: 500, RangeTo: 1000}
+	if written, _, err := d.fetchPart(d.client(), part, make(chan bool)); err != nil || written != 500 {
+		t.Fatalf("the part should wait for the server, got %v after %d bytes", err, written)
+	}
+}
@@ -0,0 +1,354 @@
+package hget
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+)
+
+// redrawInterval is how often the bars are redrawn, however fast bytes arrive
+var redrawInterval = 150 * time.Millisecond
+
+// speedSample is how long the instantaneous speed is measured over, and speedSmoothing the time
+// constant of its moving average
+var speedSample = time.Second
+var speedSmoothing = 10 * time.Second
+
+// eighths are the partially filled cells drawn at the tip of a bar
+var eighths = []rune{' ', '▏', '▎', '▍', '▌', '▋', '▊', '▉'}
+
+// BarSink draws one terminal progress bar per part, and one while joining.
+// Bars are redrawn in place as a whole frame at a fixed interval, and when there are
+// more parts than lines in the terminal only a summary and the running parts fitting on screen are shown.
+type BarSink struct {
+	mu    sync.Mutex
+	out   io.Writer
+	file  string
+	bars  []*bar
+	index map[int64]*bar
+	join  *bar
+	total *bar
+	meter *Meter
+	// summary only shows the line summing up the parts
+	summary bool
+
+	// lengths of the lines of the last frame, to know how far up the next one starts
+	drawn []int
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+type bar struct {
+	name    string
+	total   int64
+	current int64
+	bytes   bool
+	started time.Time
+	ended   time.Time
+	eta     string
+
+	// the speed of the last speedSample, and its moving average
+	sampledAt    time.Time
+	sampledBytes int64
+	instant      float64
+	smoothed     float64
+}
+
+// NewBarSink creates the terminal bars of `file`, the remaining time is taken from `meter` if there is one.
+func NewBarSink(file string, meter *Meter) *BarSink {
+	return &BarSink{out: Stdout, file: file, index: make(map[int64]*bar), meter: meter, summary: lowMemory}
+}
+
+// OnPartStart implements ProgressSink
+func (s *BarSink) OnPartStart(index int64, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := &bar{name: fmt.Sprintf("%s-%d", s.file, index), total: size, bytes: true, started: time.Now()}
+	s.bars = append(s.bars, b)
+	s.index[index] = b
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.loop(s.stop, s.done)
+	}
+}
+
+// OnBytes implements ProgressSink
+func (s *BarSink) OnBytes(index int64, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b := s.index[index]; b != nil {
+		b.current += n
+	}
+}
+
+// OnPartDone implements ProgressSink
+func (s *BarSink) OnPartDone(index int64) {
+	s.mu.Lock()
+	if b := s.index[index]; b != nil && b.ended.IsZero() {
+		b.ended = time.Now()
+	}
+	for _, b := range s.bars {
+		if b.ended.IsZero() {
+			s.mu.Unlock()
+			return
+		}
+	}
+	s.mu.Unlock()
+	s.finish()
+}
+
+// OnConnection implements ProgressSink
+func (s *BarSink) OnConnection(index int64, info ConnectionInfo) {}
+
+// OnJoin implements ProgressSink
+func (s *BarSink) OnJoin(done int, total int) {
+	s.finish()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.join == nil {
+		Printf("Start joining \n")
+		s.join = &bar{name: "Joining", total: int64(total), started: time.Now()}
+		s.bars = []*bar{s.join}
+		s.drawn = nil
+	}
+	s.join.current = int64(done)
+	if done == total {
+		s.join.ended = time.Now()
+	}
+	s.draw()
+}
+
+// OnComplete implements ProgressSink
+func (s *BarSink) OnComplete(path string) {}
+
+// finish stops redrawing after drawing the final frame.
+func (s *BarSink) finish() {
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	s.stop = nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (s *BarSink) loop(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			s.mu.Lock()
+			s.draw()
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Lock()
+		s.draw()
+		s.mu.Unlock()
+	}
+}
+
+// draw replaces the previous frame with the current state of the bars in a single write, so it does not flicker.
+func (s *BarSink) draw() {
+	width, height := terminalSize()
+
+	// lines of the previous frame may have wrapped if the terminal got narrower
+	up := 0
+	for _, n := range s.drawn {
+		up += 1 + (n-1)/width
+	}
+
+	var frame bytes.Buffer
+	if up > 0 {
+		fmt.Fprintf(&frame, "\x1b[%dA", up)
+	}
+	s.drawn = s.drawn[:0]
+	for _, line := range s.lines(width-1, height-1) {
+		frame.WriteString("\r" + line.colored + "\x1b[K\n")
+		s.drawn = append(s.drawn, line.width)
+	}
+	frame.WriteString("\x1b[J")
+	s.out.Write(frame.Bytes())
+}
+
+type frameLine struct {
+	colored string
+	width   int
+}
+
+// lines renders the bars into at most `height` lines of `width` cells,
+// several parts get a line summing them up above them.
+func (s *BarSink) lines(width int, height int) []frameLine {
+	now := time.Now()
+	if len(s.bars) == 1 || s.join != nil {
+		s.bars[0].sample(now)
+		return []frameLine{s.bars[0].render(width)}
+	}
+	if s.summary {
+		height = 1
+	} else if height < 2 {
+		height = 2
+	}
+
+	if s.total == nil {
+		s.total = &bar{bytes: true, started: s.bars[0].started}
+	}
+	total := s.total
+	total.name = fmt.Sprintf("%s (%d parts)", s.file, len(s.bars))
+	total.total, total.current = 0, 0
+	running := make([]*bar, 0, len(s.bars))
+	finished := 0
+	for _, b := range s.bars {
+		b.sample(now)
+		total.total += b.total
+		total.current += b.current
+		if !b.ended.IsZero() {
+			finished++
+		}
+		// finished parts make room for the running ones when they do not all fit
+		if b.ended.IsZero() || len(s.bars) < height {
+			running = append(running, b)
+		}
+	}
+	total.sample(now)
+	if finished == len(s.bars) {
+		total.ended = now
+	} else if s.meter != nil {
+		if eta, ok := s.meter.ETA(); ok {
+			total.eta = formatETA(eta)
+		}
+	}
+	if len(running) > height-1 {
+		running = running[:height-1]
+	}
+
+	lines := []frameLine{total.render(width)}
+	for _, b := range running {
+		lines = append(lines, b.render(width))
+	}
+	return lines
+}
+
+// sample measures the speed of `b` once speedSample passed since the last time.
+func (b *bar) sample(now time.Time) {
+	if b.sampledAt.IsZero() {
+		b.sampledAt, b.sampledBytes = b.started, 0
+	}
+	elapsed := now.Sub(b.sampledAt)
+	if elapsed < speedSample || !b.ended.IsZero() {
+		return
+	}
+	first := b.sampledAt.Equal(b.started)
+	b.instant = float64(b.current-b.sampledBytes) / elapsed.Seconds()
+	if first {
+		b.smoothed = b.instant
+	} else {
+		b.smoothed += (1 - math.Exp(-elapsed.Seconds()/speedSmoothing.Seconds())) * (b.instant - b.smoothed)
+	}
+	b.sampledAt, b.sampledBytes = now, b.current
+}
+
+// speed renders the instantaneous and the smoothed speed of `b` while it runs, its average once it ended.
+func (b *bar) speed(end time.Time) string {
+	if b.ended.IsZero() && !b.sampledAt.IsZero() && !b.sampledAt.Equal(b.started) {
+		return fmt.Sprintf(" %s/s (%s/s avg)", humanBytes(int64(b.instant)), humanBytes(int64(b.smoothed)))
+	}
+	if elapsed := end.Sub(b.started).Seconds(); elapsed > 0 {
+		return fmt.Sprintf(" %s/s", humanBytes(int64(float64(b.current)/elapsed)))
+	}
+	return ""
+}
+
+// render draws `b` as `name [bar] percent counters speed` fitting in `width` cells.
+func (b *bar) render(width int) frameLine {
+	percent := 0.0
+	if b.total > 0 {
+		percent = float64(b.current) / float64(b.total)
+	}
+	if percent > 1 {
+		percent = 1
+	}
+
+	end := b.ended
+	if end.IsZero() {
+		end = time.Now()
+	}
+	var counters string
+	if b.bytes {
+		counters = fmt.Sprintf("%s / %s", humanBytes(b.current), humanBytes(b.total)) + b.speed(end)
+	} else {
+		counters = fmt.Sprintf("%d / %d", b.current, b.total)
+	}
+	if b.eta != "" {
+		counters += " ETA " + b.eta
+	}
+	stats := fmt.Sprintf(" %5.1f%% %s", percent*100, counters)
+	if width-utf8.RuneCountInString(stats) < 20 {
+		// narrow terminal, the percentage has to do
+		stats = fmt.Sprintf(" %5.1f%%", percent*100)
+	}
+
+	name := b.name
+	nameWidth := utf8.RuneCountInString(name)
+	barWidth := width - nameWidth - 3 - utf8.RuneCountInString(stats)
+	if barWidth < 10 {
+		// give up on the name before giving up on the bar
+		maxName := width - 13 - utf8.RuneCountInString(stats)
+		if maxName < 1 {
+			maxName = 1
+		}
+		if nameWidth > maxName {
+			name = string([]rune(name)[:maxName-1]) + "…"
+			nameWidth = maxName
+		}
+		barWidth = width - nameWidth - 3 - utf8.RuneCountInString(stats)
+	}
+	if barWidth < 1 {
+		barWidth = 1
+	}
+
+	cells := percent * float64(barWidth)
+	full := int(cells)
+	var fill strings.Builder
+	fill.WriteString(strings.Repeat("█", full))
+	if full < barWidth {
+		fill.WriteRune(eighths[int((cells-float64(full))*8)])
+		fill.WriteString(strings.Repeat(" ", barWidth-full-1))
+	}
+
+	paint := color.YellowString
+	if !b.bytes {
+		paint = color.CyanString
+	}
+	return frameLine{
+		colored: paint(name) + " [" + fill.String() + "]" + stats,
+		width:   nameWidth + 3 + barWidth + utf8.RuneCountInString(stats),
+	}
+}
+
+// humanBytes formats `n` with a binary unit.
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
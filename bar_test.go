@@ -0,0 +1,92 @@
+package hget
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestBarRender(t *testing.T) {
+	b := &bar{name: "file-0", total: 1000, current: 500, bytes: true}
+	for _, width := range []int{120, 60, 30} {
+		line := b.render(width)
+		if line.width > width {
+			t.Fatalf("line of width %d should fit in %d columns", line.width, width)
+		}
+		if !strings.Contains(line.colored, "50.0%") {
+			t.Fatalf("line should show the percentage, got %q", line.colored)
+		}
+	}
+
+	b.current = 1000
+	line := b.render(60)
+	plain := stripColor(line.colored)
+	fill := plain[strings.Index(plain, "[")+1 : strings.Index(plain, "]")]
+	if strings.Trim(fill, "█") != "" {
+		t.Fatalf("finished bar should be full, got %q", fill)
+	}
+	if got := utf8.RuneCountInString(stripColor(line.colored)); got != line.width {
+		t.Fatalf("reported width %d differs from drawn width %d", line.width, got)
+	}
+}
+
+func TestBarSinkCollapsesManyParts(t *testing.T) {
+	var out bytes.Buffer
+	sink := &BarSink{out: &out, file: "file", index: make(map[int64]*bar)}
+	for i := int64(0); i < 100; i++ {
+		sink.bars = append(sink.bars, &bar{name: "file", total: 10, bytes: true})
+	}
+
+	lines := sink.lines(79, 23)
+	if len(lines) != 23 {
+		t.Fatalf("frame should use the whole terminal height, got %d lines", len(lines))
+	}
+	if !strings.Contains(lines[0].colored, "100 parts") {
+		t.Fatalf("first line should sum up the parts, got %q", lines[0].colored)
+	}
+}
+
+func stripColor(s string) string {
+	for {
+		start := strings.Index(s, "\x1b[")
+		if start < 0 {
+			return s
+		}
+		end := strings.IndexByte(s[start:], 'm')
+		s = s[:start] + s[start+end+1:]
+	}
+}
+
+func TestBarSpeed(t *testing.T) {
+	start := time.Now().Add(-10 * time.Second)
+	b := &bar{name: "file-0", total: 100 << 20, bytes: true, started: start}
+	if speed := b.speed(start.Add(2 * time.Second)); speed != " 0 B/s" {
+		t.Fatalf("nothing downloaded yet, got %q", speed)
+	}
+
+	b.current = 4 << 20
+	b.sample(start.Add(2 * time.Second))
+	if b.instant != 2<<20 || b.smoothed != 2<<20 {
+		t.Fatalf("the first sample should set both speeds, got %v and %v", b.instant, b.smoothed)
+	}
+	b.sample(start.Add(2*time.Second + speedSample/2))
+	if b.sampledAt != start.Add(2*time.Second) {
+		t.Fatalf("samples should be at least %v apart", speedSample)
+	}
+
+	b.current += 10 << 20
+	b.sample(start.Add(3 * time.Second))
+	if b.instant != 10<<20 || b.smoothed <= 2<<20 || b.smoothed >= 10<<20 {
+		t.Fatalf("the smoothed speed should move towards the instantaneous one, got %v and %v", b.instant, b.smoothed)
+	}
+	if speed := b.speed(time.Now()); !strings.Contains(speed, "10.0 MiB/s (") || !strings.Contains(speed, "MiB/s avg)") {
+		t.Fatalf("both speeds should be shown, got %q", speed)
+	}
+
+	b.ended = start.Add(7 * time.Second)
+	if speed := b.speed(b.ended); speed != " 2.0 MiB/s" {
+		t.Fatalf("finished bars should show their average speed, got %q", speed)
+	}
+}
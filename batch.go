@@ -0,0 +1,247 @@
+package hget
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/fujiwara/shapeio"
+)
+
+// batchRanges is how many parts are requested at once with a multi range request
+var batchRanges = 1
+
+// partResult is the outcome of downloading a part, with its range moved past the written bytes.
+type partResult struct {
+	part    Part
+	stopped bool
+	err     error
+}
+
+// batches groups neighbouring parts which are requested together.
+func (d *HTTPDownloader) batches(parts []Part) [][]Part {
+	size := batchRanges
+	// uploads need every part as a request body of its own
+	if size < 1 || d.par <= 1 || d.upload != nil {
+		size = 1
+	}
+
+	var ret [][]Part
+	for len(parts) > size {
+		ret = append(ret, parts[:size])
+		parts = parts[size:]
+	}
+	if len(parts) > 0 {
+		ret = append(ret, parts)
+	}
+	return ret
+}
+
+// batchTarget is where the bytes of a part in a multi range response go.
+type batchTarget struct {
+	part    Part
+	end     int64
+	start   int64
+	written int64
+	w       io.Writer
+}
+
+// fetchBatch downloads the remaining ranges of `parts` with a single request, which the server
+// answers with a multipart/byteranges body. Parts the response does not cover are fetched on their own.
+func (d *HTTPDownloader) fetchBatch(client *http.Client, parts []Part, interruptChan chan bool) []partResult {
+	if len(parts) == 1 {
+		written, stopped, err := d.fetchPart(client, parts[0], interruptChan)
+		parts[0].RangeFrom += written
+		return []partResult{{part: parts[0], stopped: stopped, err: err}}
+	}
+
+	targets, stopped, err := d.fetchRanges(client, parts, interruptChan)
+	if err != nil {
+		Warnf("multi range request failed (%v), requesting parts %d to %d one by one\n", err, parts[0].Index, parts[len(parts)-1].Index)
+		d.log.Logf("parts %d to %d: multi range request failed: %v", parts[0].Index, parts[len(parts)-1].Index, err)
+	}
+
+	results := make([]partResult, 0, len(parts))
+	for _, t := range targets {
+		part := t.part
+		part.RangeFrom += t.written
+		if stopped || part.RangeFrom > t.end {
+			results = append(results, partResult{part: part, stopped: stopped})
+			continue
+		}
+		written, partStopped, err := d.fetchPart(client, part, interruptChan)
+		part.RangeFrom += written
+		stopped = stopped || partStopped
+		results = append(results, partResult{part: part, stopped: partStopped, err: err})
+	}
+	return results
+}
+
+// fetchRanges requests all of `parts` at once and writes whatever the response covers into them.
+func (d *HTTPDownloader) fetchRanges(client *http.Client, parts []Part, interruptChan chan bool) ([]*batchTarget, bool, error) {
+	targets := make([]*batchTarget, len(parts))
+	ranges := make([]string, len(parts))
+	for i, part := range parts {
+		end := part.RangeTo
+		if end == d.len {
+			end = d.len - 1
+		}
+		targets[i] = &batchTarget{part: part, end: end, start: -1}
+		ranges[i] = d.rangeOf(part)
+	}
+
+	req, err := d.newRequest(d.url)
+	if err != nil {
+		return targets, false, err
+	}
+	req.Header.Set("Range", "bytes="+strings.Join(ranges, ","))
+	d.setIfRange(req, d.url)
+
+	if !backoff.Wait(req.URL.Host, interruptChan) {
+		return targets, true, nil
+	}
+	var remote string
+	resp, err := client.Do(traceRemote(req, &remote))
+	if err != nil {
+		return targets, false, err
+	}
+	defer resp.Body.Close()
+	for _, t := range targets {
+		d.progress().OnConnection(t.part.Index, ConnectionInfo{Source: resp.Request.URL.String(), IP: remote})
+	}
+	defer func() {
+		for _, t := range targets {
+			d.audit.Record(t.part, resp, t.start, t.written)
+		}
+	}()
+	if err := checkRange(resp); err != nil {
+		return targets, false, err
+	}
+	if err := d.checkPinned(resp); err != nil {
+		return targets, false, err
+	}
+	if err := d.checkVersion(resp, parts[0].Index); err != nil {
+		return targets, false, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		// a full body or a throttled answer, the single part requests know how to deal with it
+		return targets, false, fmt.Errorf("unexpected response %q", resp.Status)
+	}
+
+	var reader io.Reader = resp.Body
+	if d.rate != 0 {
+		limited := shapeio.NewReader(reader)
+		limited.SetRateLimit(float64(d.rate))
+		reader = limited
+	}
+
+	var files []*partFile
+	for _, t := range targets {
+		writer, f, err := d.partWriter(t.part)
+		if err != nil {
+			return targets, false, err
+		}
+		defer f.Close()
+		t.w = writer
+		files = append(files, f)
+	}
+
+	finishDownloadChan := make(chan error)
+	go func() {
+		err := copyRanges(resp, reader, targets)
+		for _, f := range files {
+			if ferr := f.Flush(); err == nil {
+				err = ferr
+			}
+		}
+		finishDownloadChan <- err
+	}()
+
+	select {
+	case <-interruptChan:
+		// interrupt download by forcefully close the input stream
+		resp.Body.Close()
+		<-finishDownloadChan
+		return targets, true, nil
+	case err = <-finishDownloadChan:
+		return targets, false, err
+	}
+}
+
+// copyRanges splits the body of a 206 response into the targets, servers may send a single range
+// or merge neighbouring ranges, so every section is routed by its Content-Range.
+func copyRanges(resp *http.Response, body io.Reader, targets []*batchTarget) error {
+	mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "multipart/byteranges" {
+		start, err := rangeStart(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		return routeRange(start, body, targets)
+	}
+
+	sections := multipart.NewReader(body, params["boundary"])
+	for {
+		section, err := sections.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, err := rangeStart(section.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		if err := routeRange(start, section, targets); err != nil {
+			return err
+		}
+	}
+}
+
+// routeRange writes `r`, which starts at offset `start` of the file, to the targets it belongs to.
+func routeRange(start int64, r io.Reader, targets []*batchTarget) error {
+	offset := start
+	for {
+		var target *batchTarget
+		for _, t := range targets {
+			if t.part.RangeFrom <= offset && offset <= t.end {
+				target = t
+				break
+			}
+		}
+		if target == nil || offset != target.part.RangeFrom+target.written {
+			// the section may just have ended right before a range we do not expect
+			if _, err := io.ReadFull(r, make([]byte, 1)); err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("server sent range starting at %d which was not requested", offset)
+		}
+
+		if target.start < 0 {
+			target.start = offset
+		}
+		n, err := io.CopyN(target.w, r, target.end-offset+1)
+		target.written += n
+		offset += n
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// rangeStart parses the first byte of a Content-Range header such as `bytes 100-199/1000`.
+func rangeStart(contentRange string) (int64, error) {
+	var start, end int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d", &start, &end); err != nil {
+		return 0, errors.New("invalid Content-Range " + contentRange)
+	}
+	return start, nil
+}
@@ -0,0 +1,177 @@
+package hget
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// blockSize is the length of the blocks of a part file which are hashed on their own
+var blockSize int64 = 4 << 20
+
+// verifyTail is how many of the last blocks of a part file are checked before it is resumed
+var verifyTail int64 = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// PartHash is the CRC32C of every block of the first Size bytes of a part file, the last block may be partial.
+type PartHash struct {
+	Size   int64
+	Blocks []uint32
+}
+
+// blockHasher hashes what is written to a part file, block by block.
+type blockHasher struct {
+	mu   sync.Mutex
+	hash PartHash
+}
+
+func (h *blockHasher) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	written := len(p)
+	for len(p) > 0 {
+		fill := h.hash.Size % blockSize
+		if fill == 0 {
+			h.hash.Blocks = append(h.hash.Blocks, 0)
+		}
+		n := blockSize - fill
+		if n > int64(len(p)) {
+			n = int64(len(p))
+		}
+		last := len(h.hash.Blocks) - 1
+		h.hash.Blocks[last] = crc32.Update(h.hash.Blocks[last], castagnoli, p[:n])
+		h.hash.Size += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Sum returns a copy of the hash so far.
+func (h *blockHasher) Sum() *PartHash {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return &PartHash{Size: h.hash.Size, Blocks: append([]uint32(nil), h.hash.Blocks...)}
+}
+
+// hasherOf returns the hasher of `part`, whose file has `size` bytes. The hash saved with the part is
+// continued when it covers the file, the file is hashed again otherwise, e.g. for tasks saved before
+// parts were hashed.
+func (d *HTTPDownloader) hasherOf(part Part, size int64) (*blockHasher, error) {
+	d.hashMu.Lock()
+	defer d.hashMu.Unlock()
+	if d.hashes == nil {
+		d.hashes = make(map[int64]*blockHasher)
+	}
+	h := d.hashes[part.Index]
+	if h != nil && h.Sum().Size == size {
+		return h, nil
+	}
+
+	h = new(blockHasher)
+	if part.Hash != nil && part.Hash.Size == size {
+		h.hash = PartHash{Size: size, Blocks: append([]uint32(nil), part.Hash.Blocks...)}
+	} else if size > 0 {
+		f, err := os.Open(part.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if _, err := io.Copy(h, io.NewSectionReader(f, 0, size)); err != nil {
+			return nil, err
+		}
+	}
+	d.hashes[part.Index] = h
+	return h, nil
+}
+
+// hashOf returns the hash of what was written to `part`.
+func (d *HTTPDownloader) hashOf(part Part) *PartHash {
+	d.hashMu.Lock()
+	defer d.hashMu.Unlock()
+	if h := d.hashes[part.Index]; h != nil {
+		return h.Sum()
+	}
+	return part.Hash
+}
+
+// verifyPart checks the last blocks of the file of a resumed `part` against its hash. The part goes
+// back to the first block which does not match, or was cut short by a crash, instead of appending
+// to a broken file. Bytes written after the state was saved are dropped as well.
+func verifyPart(part Part) (Part, error) {
+	h := part.Hash
+	if h == nil {
+		return part, nil
+	}
+	f, err := os.OpenFile(part.Path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		part.RangeFrom -= h.Size
+		part.Hash = nil
+		return part, nil
+	}
+	if err != nil {
+		return part, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return part, err
+	}
+
+	good := h.Size
+	if stat.Size() < good {
+		// the last block is incomplete
+		good = stat.Size() / blockSize * blockSize
+	}
+	last := (good+blockSize-1)/blockSize - 1
+	buf := make([]byte, blockSize)
+	for b := last - verifyTail + 1; b <= last; b++ {
+		if b < 0 {
+			continue
+		}
+		end := (b + 1) * blockSize
+		if end > good {
+			end = good
+		}
+		n, err := f.ReadAt(buf[:end-b*blockSize], b*blockSize)
+		if err != nil && err != io.EOF {
+			return part, err
+		}
+		if b >= int64(len(h.Blocks)) || crc32.Checksum(buf[:n], castagnoli) != h.Blocks[b] {
+			good = b * blockSize
+			break
+		}
+	}
+
+	if good != h.Size {
+		Warnf("part %d is damaged after %d of %d bytes, downloading the rest again\n", part.Index, good, h.Size)
+	}
+	if stat.Size() != good {
+		if err := f.Truncate(good); err != nil {
+			return part, fmt.Errorf("could not repair part %d: %v", part.Index, err)
+		}
+	}
+	part.RangeFrom -= h.Size - good
+	part.Hash = &PartHash{Size: good, Blocks: h.Blocks[:(good+blockSize-1)/blockSize]}
+	return part, nil
+}
+
+// verifyParts checks the parts of a resumed task before they are continued.
+func (d *HTTPDownloader) verifyParts() error {
+	if d.device != "" {
+		return nil
+	}
+	for i, part := range d.parts {
+		verified, err := verifyPart(part)
+		if err != nil {
+			return err
+		}
+		if verified.RangeFrom != part.RangeFrom {
+			d.log.Logf("part %d: damaged, continuing from %d instead of %d", part.Index, verified.RangeFrom, part.RangeFrom)
+		}
+		d.parts[i] = verified
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package hget
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBlockHasher(t *testing.T) {
+	defer func(old int64) { blockSize = old }(blockSize)
+	blockSize = 4
+
+	h := new(blockHasher)
+	for _, s := range []string{"0", "1234", "567", "89"} {
+		h.Write([]byte(s))
+	}
+	sum := h.Sum()
+	expected := []uint32{crc32.Checksum([]byte("0123"), castagnoli), crc32.Checksum([]byte("4567"), castagnoli), crc32.Checksum([]byte("89"), castagnoli)}
+	if sum.Size != 10 || !reflect.DeepEqual(sum.Blocks, expected) {
+		t.Fatalf("unexpected hash %+v", sum)
+	}
+}
+
+func TestVerifyPart(t *testing.T) {
+	displayProgress = false
+	defer func(old int64) { blockSize = old }(blockSize)
+	blockSize = 4
+	dir, err := ioutil.TempDir("", "hget-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("0123456789", 4)
+	h := new(blockHasher)
+	h.Write([]byte(content[:30]))
+	// the part started at 100 and has 30 bytes on the disk
+	part := Part{Path: filepath.Join(dir, "part"), RangeFrom: 130, RangeTo: 200, Hash: h.Sum()}
+
+	cases := []struct {
+		name string
+		file string
+		from int64
+	}{
+		{"intact", content[:30], 130},
+		{"written after the state was saved", content, 130},
+		{"cut short", content[:27], 124},
+		{"damaged tail", content[:25] + "xxxxx", 124},
+		{"missing", "", 100},
+	}
+	for _, c := range cases {
+		os.Remove(part.Path)
+		if c.name != "missing" {
+			ioutil.WriteFile(part.Path, []byte(c.file), 0600)
+		}
+		verified, err := verifyPart(part)
+		if err != nil {
+			t.Fatalf("%s: err should be nil, got %v", c.name, err)
+		}
+		if verified.RangeFrom != c.from {
+			t.Fatalf("%s: part should continue from %d, got %d", c.name, c.from, verified.RangeFrom)
+		}
+		if c.name == "missing" {
+			continue
+		}
+		stat, _ := os.Stat(part.Path)
+		if stat.Size() != c.from-100 || verified.Hash.Size != stat.Size() {
+			t.Fatalf("%s: part file should have %d bytes, got %d hashed as %d", c.name, c.from-100, stat.Size(), verified.Hash.Size)
+		}
+	}
+}
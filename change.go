@@ -0,0 +1,161 @@
+package hget
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// changeMode is what a resumed task does when the remote file is no longer as long as when it started.
+type changeMode string
+
+const (
+	changeAbort    changeMode = "abort"
+	changeRestart  changeMode = "restart"
+	changeTruncate changeMode = "truncate"
+)
+
+var onChange = changeAbort
+
+func (m *changeMode) String() string {
+	return string(*m)
+}
+
+func (m *changeMode) Set(value string) error {
+	switch mode := changeMode(value); mode {
+	case changeAbort, changeRestart, changeTruncate:
+		*m = mode
+		return nil
+	}
+	return fmt.Errorf("on-change should be restart, truncate or abort, got %q", value)
+}
+
+// probe asks for the first byte of the file, if it is still the same file, to learn its length.
+func (d *HTTPDownloader) probe() (*http.Response, error) {
+	req, err := d.newRequest(d.url)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	d.setIfRange(req, d.url)
+	resp, err := d.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("unexpected response %q", resp.Status)
+	}
+	return resp, nil
+}
+
+// sizeOf returns the length of the file `resp` is a range of or the whole of, -1 when the server does not tell.
+func sizeOf(resp *http.Response) int64 {
+	if resp.StatusCode == http.StatusOK {
+		return resp.ContentLength
+	}
+	var start, end, total int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil {
+		return -1
+	}
+	return total
+}
+
+// followChange compares the remote file with the one the task was started with, by its length and
+// through If-Range, and handles a change as -on-change says rather than joining parts of two different files.
+func (d *HTTPDownloader) followChange() error {
+	// the last part ends at the length of the file
+	saved := d.parts[len(d.parts)-1].RangeTo
+	if d.window != nil {
+		// unless it ends before
+		saved = d.window.Length
+	}
+	resp, err := d.probe()
+	if err != nil {
+		Warnf("could not check whether %s changed: %v\n", d.url, err)
+		return nil
+	}
+	size := sizeOf(resp)
+	replaced := checkRange(resp) == ErrRemoteChanged
+	if !replaced && (size < 0 || size == saved) {
+		return nil
+	}
+
+	d.log.Logf("remote file changed from %d to %d bytes, %s", saved, size, onChange)
+	switch {
+	case onChange == changeRestart && size >= 0:
+		Warnf("%s changed from %s to %s, starting over\n", d.url, humanBytes(saved), humanBytes(size))
+		for _, part := range d.parts {
+			if err := os.Remove(part.Path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if d.window != nil {
+			window, err := parseWindow(fmt.Sprintf("%d-%d", d.window.From, d.window.To), size)
+			if err != nil {
+				return err
+			}
+			d.window = window
+			if d.parts, err = window.parts(d.par, d.url); err != nil {
+				return err
+			}
+		} else if d.parts, err = partCalculate(d.par, size, d.url); err != nil {
+			return err
+		}
+		d.validator = validatorOf(resp)
+		d.resetVersion(resp)
+		return nil
+	case onChange == changeTruncate && d.window != nil:
+		return causedBy(ErrRemoteChanged, "%s changed from %d to %d bytes since the task was started, the bytes of a -range download can not be kept, resume with -on-change restart", d.url, saved, size)
+	case onChange == changeTruncate && !replaced:
+		Warnf("%s changed from %s to %s, keeping the downloaded bytes\n", d.url, humanBytes(saved), humanBytes(size))
+		parts, err := fitParts(d.parts, size)
+		if err != nil {
+			return err
+		}
+		d.parts = parts
+		d.resetVersion(resp)
+		return nil
+	case replaced:
+		return causedBy(ErrRemoteChanged, "%s was replaced by another file since the task was started, resume with -on-change restart", d.url)
+	}
+	return causedBy(ErrRemoteChanged, "%s changed from %d to %d bytes since the task was started, resume with -on-change restart or truncate", d.url, saved, size)
+}
+
+// fitParts keeps what was downloaded of `parts` up to `size` and makes them end there. Parts after
+// `size` are emptied rather than dropped, their files are joined as nothing.
+func fitParts(parts []Part, size int64) ([]Part, error) {
+	par := int64(len(parts))
+	total := parts[par-1].RangeTo
+	fitted := make([]Part, par)
+	for i, part := range parts {
+		// parts are appended to, the file starts where the part started originally
+		origin := (total / par) * part.Index
+		next := total
+		if i < len(parts)-1 {
+			next = (total / par) * parts[i+1].Index
+		}
+		var keep int64
+		switch {
+		case origin >= size:
+			part.RangeFrom, part.RangeTo = size, size
+		case next >= size || i == len(parts)-1:
+			// the part holding the new end ends at the length of the file, as the last one does
+			part.RangeTo = size
+			if part.RangeFrom > size {
+				part.RangeFrom = size
+			}
+			keep = part.RangeFrom - origin
+		default:
+			fitted[i] = part
+			continue
+		}
+		if err := os.Truncate(part.Path, keep); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		// hashed again from the file when it is continued
+		part.Hash = nil
+		fitted[i] = part
+	}
+	return fitted, nil
+}
@@ -0,0 +1,90 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnChangeMode(t *testing.T) {
+	var m changeMode
+	for _, mode := range []string{"abort", "restart", "truncate"} {
+		if err := m.Set(mode); err != nil || m.String() != mode {
+			t.Fatalf("%s should be accepted, got %v", mode, err)
+		}
+	}
+	if err := m.Set("ignore"); err == nil {
+		t.Fatalf("unknown modes should be refused")
+	}
+}
+
+func TestFollowChange(t *testing.T) {
+	displayProgress = false
+	defer func(old changeMode) { onChange = old }(onChange)
+	content := strings.Repeat("0123456789", 5)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "changed.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	url := server.URL + "/changed.bin"
+	folder := FolderOf(url)
+	defer os.RemoveAll(folder)
+
+	// a task of 100 bytes in 4 parts, of which the first 10 bytes of each were downloaded
+	resumed := func() *HTTPDownloader {
+		parts, _ := partCalculate(4, 100, url)
+		for i := range parts {
+			ioutil.WriteFile(parts[i].Path, []byte(content[:10]), 0600)
+			parts[i].RangeFrom += 10
+		}
+		return &HTTPDownloader{url: url, par: 4, parts: parts}
+	}
+
+	onChange = changeAbort
+	if err := resumed().followChange(); err == nil {
+		t.Fatalf("a changed file should abort")
+	}
+
+	onChange = changeTruncate
+	d := resumed()
+	if err := d.followChange(); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	expected := []struct{ from, to, size int64 }{{10, 24, 10}, {35, 50, 10}, {50, 50, 0}, {50, 50, 0}}
+	for i, e := range expected {
+		part := d.parts[i]
+		stat, err := os.Stat(part.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.RangeFrom != e.from || part.RangeTo != e.to || stat.Size() != e.size {
+			t.Fatalf("part %d: expected %+v, got %+v with %d bytes", i, e, part, stat.Size())
+		}
+	}
+
+	onChange = changeRestart
+	d = resumed()
+	if err := d.followChange(); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if d.parts[0].RangeFrom != 0 || d.parts[3].RangeTo != 50 {
+		t.Fatalf("parts should start over for the new size, got %+v", d.parts)
+	}
+	if files, _ := filepath.Glob(filepath.Join(folder, "*.part*")); len(files) != 0 {
+		t.Fatalf("the old parts should be removed, got %v", files)
+	}
+
+	// an unchanged file is left alone
+	d = resumed()
+	d.parts, _ = partCalculate(4, 50, url)
+	d.parts[0].RangeFrom = 5
+	if err := d.followChange(); err != nil || d.parts[0].RangeFrom != 5 {
+		t.Fatalf("an unchanged task should keep its parts, got %+v, %v", d.parts, err)
+	}
+}
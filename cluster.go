@@ -0,0 +1,128 @@
+package hget
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// clusterAgents are the hget agents, as comma separated host:port, the parts are spread across
+var clusterAgents = ""
+
+// agentTokenHeader carries the token of the agents, so that Authorization stays free for the origin
+var agentTokenHeader = "X-Hget-Token"
+
+// agentHeaders are not passed on to the origin by an agent
+var agentHeaders = []string{agentTokenHeader, "Connection", "Accept-Encoding"}
+
+// agents returns the base urls of the cluster agents.
+func agents() []string {
+	var ret []string
+	for _, agent := range strings.Split(clusterAgents, ",") {
+		agent = strings.TrimSpace(agent)
+		if agent == "" {
+			continue
+		}
+		if !strings.Contains(agent, "://") {
+			agent = "http://" + agent
+		}
+		ret = append(ret, strings.TrimSuffix(agent, "/"))
+	}
+	return ret
+}
+
+// viaAgent sends the request of `part` through one of the cluster agents, which fetches the range
+// from the origin with its own bandwidth and streams it back.
+func (d *HTTPDownloader) viaAgent(req *http.Request, part Part) (*http.Request, error) {
+	all := agents()
+	if len(all) == 0 || d.par <= 1 {
+		return req, nil
+	}
+	agent := all[int(part.Index)%len(all)]
+	target, err := url.Parse(agent + "/range?url=" + url.QueryEscape(req.URL.String()))
+	if err != nil {
+		return nil, err
+	}
+	req.URL = target
+	req.Host = target.Host
+	req.Header.Set(agentTokenHeader, webhookToken)
+	return req, nil
+}
+
+// Agent fetches ranges for a coordinator, which spreads the parts of a download across several agents.
+type Agent struct {
+	token  string
+	client *http.Client
+}
+
+// NewAgent creates an agent accepting requests authenticated with `token`.
+func NewAgent(token string) (*Agent, error) {
+	if token == "" {
+		return nil, errors.New("a -token (or HGET_TOKEN) is required to run an agent")
+	}
+	return &Agent{token: token, client: ProxyAwareHTTPClient(proxyServer)}, nil
+}
+
+// Serve accepts range requests of coordinators on `addr`, or the socket systemd passed.
+func (a *Agent) Serve(addr string) error {
+	listener, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	Printf("Serving ranges on http://%s/range\n", listener.Addr())
+	sdNotify("READY=1")
+	return http.Serve(listener, a)
+}
+
+// ServeHTTP fetches the url of an authenticated GET /range?url= from the origin, passing the request
+// headers (the Range above all) on and streaming the response back.
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/range" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "only GET is accepted", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(agentTokenHeader)), []byte(a.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	origin := r.URL.Query().Get("url")
+	if err := CheckURL(origin); err != nil || !strings.HasPrefix(origin, "http") {
+		http.Error(w, fmt.Sprintf("refusing to fetch %q", origin), http.StatusForbidden)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodGet, origin, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Header = r.Header.Clone()
+	for _, name := range agentHeaders {
+		req.Header.Del(name)
+	}
+	resp, err := a.client.Do(req.WithContext(r.Context()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, name := range []string{"Content-Range", "Content-Length", "Content-Type", "Content-Encoding", "Accept-Ranges", "Retry-After"} {
+		if value := resp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		Warnf("agent: %s: %v\n", origin, err)
+	}
+}
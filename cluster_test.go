@@ -0,0 +1,98 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClusterAgents(t *testing.T) {
+	displayProgress = false
+	webhookToken = "secret"
+	defer func() { webhookToken, clusterAgents = "", "" }()
+
+	content := strings.Repeat("0123456789", 100)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "cluster.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer origin.Close()
+
+	var mu sync.Mutex
+	served := make(map[string]int)
+	var hosts []string
+	for i := 0; i < 2; i++ {
+		agent, err := NewAgent("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			served[r.Host]++
+			mu.Unlock()
+			agent.ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		hosts = append(hosts, strings.TrimPrefix(srv.URL, "http://"))
+	}
+	clusterAgents = strings.Join(hosts, ",")
+
+	url := origin.URL + "/cluster.bin"
+	defer os.RemoveAll(FolderOf(url))
+	d := NewHTTPDownloader(url, 4, true, "", "")
+
+	doneChan := make(chan bool, 1)
+	fileChan := make(chan string, 4)
+	errorChan := make(chan error, 1)
+	stateChan := make(chan Part, 4)
+	interruptChan := make(chan bool, 4)
+
+	go d.Do(doneChan, fileChan, errorChan, interruptChan, stateChan)
+
+	var files []string
+	for {
+		select {
+		case f := <-fileChan:
+			files = append(files, f)
+		case <-stateChan:
+		case err := <-errorChan:
+			t.Fatalf("err should be nil, got %v", err)
+		case <-doneChan:
+			for len(fileChan) > 0 {
+				files = append(files, <-fileChan)
+			}
+			for _, host := range hosts {
+				if served[host] != 2 {
+					t.Fatalf("4 parts should be spread over 2 agents, got %v", served)
+				}
+			}
+			out := filepath.Join(t.TempDir(), "cluster.bin")
+			if err := JoinFile(files, out, nil, nil); err != nil {
+				t.Fatalf("err should be nil, got %v", err)
+			}
+			joined, _ := ioutil.ReadFile(out)
+			if string(joined) != content {
+				t.Fatalf("joined content is different from the original")
+			}
+			return
+		}
+	}
+}
+
+func TestAgentRefusesWithoutToken(t *testing.T) {
+	agent, err := NewAgent("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/range?url=http://a.org/1.iso", nil)
+	rec := httptest.NewRecorder()
+	agent.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
@@ -0,0 +1,8 @@
+// Command hget downloads files over many connections, run hget -h for its options.
+package main
+
+import "github.com/abzcoding/hget"
+
+func main() {
+	hget.Main()
+}
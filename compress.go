@@ -0,0 +1,35 @@
+package hget
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var compress = false
+
+// acceptEncoding lists the encodings hget can decode on the fly
+var acceptEncoding = "gzip, deflate"
+
+// compressible tells whether the body of a download can be asked for compressed, which is only
+// the case for a single connection, as ranges of a compressed body do not map to ranges of the file.
+func (d *HTTPDownloader) compressible() bool {
+	return compress && d.par <= 1 && d.upload == nil
+}
+
+// decodeBody undoes the Content-Encoding of `resp`, so the stored file is never compressed.
+func decodeBody(resp *http.Response, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		return zlib.NewReader(body)
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", resp.Header.Get("Content-Encoding"))
+	}
+}
@@ -0,0 +1,46 @@
+package hget
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressedDownload(t *testing.T) {
+	content := strings.Repeat(`{"key": "value"}`+"\n", 1000)
+	gzipped := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Write([]byte(content))
+			return
+		}
+		gzipped++
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(content))
+		gz.Close()
+	}))
+	defer srv.Close()
+
+	for _, enabled := range []bool{false, true} {
+		compress = enabled
+		path := filepath.Join(t.TempDir(), "data.json.part000000")
+		d := &HTTPDownloader{url: srv.URL + "/data.json", par: 1, len: int64(len(content))}
+		written, _, err := d.fetchPart(d.client(), Part{Path: path, RangeTo: d.len}, make(chan bool))
+		if err != nil {
+			t.Fatalf("err should be nil, got %v", err)
+		}
+		stored, _ := ioutil.ReadFile(path)
+		if string(stored) != content || written != int64(len(content)) {
+			t.Fatalf("stored file should be the uncompressed content (compress %v)", enabled)
+		}
+	}
+	compress = false
+	if gzipped != 1 {
+		t.Fatalf("only the -compress download should ask for gzip, %d did", gzipped)
+	}
+}
@@ -0,0 +1,163 @@
+package hget
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var profileName = ""
+
+var configFileName = "config"
+
+// configDir is the folder of the config file and of the key state files are signed with.
+func configDir() string {
+	folder, err := os.UserConfigDir()
+	if err != nil {
+		folder = dataDir()
+	}
+	return filepath.Join(folder, "hget")
+}
+
+// configSetting is a `name = value` line of the config file.
+type configSetting struct {
+	Name  string
+	Value string
+	Line  int
+}
+
+// Config holds the options of the config file, those set for every download at its top and those of
+// each `[profile]` section.
+type Config struct {
+	Options  []configSetting
+	Profiles map[string][]configSetting
+}
+
+// ParseConfig reads a config file such as
+//
+//	n = 8
+//
+//	[metered]
+//	rate = 200kB
+//	n = 2
+//
+// Names are those of the options, comments start with # or ;.
+func ParseConfig(r io.Reader) (*Config, error) {
+	c := &Config{Profiles: make(map[string][]configSetting)}
+	profile := ""
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			profile = strings.TrimSpace(text[1 : len(text)-1])
+			if profile == "" {
+				return nil, fmt.Errorf("line %d: empty profile name", line)
+			}
+			// a profile without settings can still be selected
+			c.Profiles[profile] = c.Profiles[profile]
+			continue
+		}
+		fields := strings.SplitN(text, "=", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected name = value, got %q", line, text)
+		}
+		value := strings.TrimSpace(fields[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		setting := configSetting{Name: strings.TrimSpace(fields[0]), Value: value, Line: line}
+		if profile == "" {
+			c.Options = append(c.Options, setting)
+		} else {
+			c.Profiles[profile] = append(c.Profiles[profile], setting)
+		}
+	}
+	return c, scanner.Err()
+}
+
+// Apply sets the options of `fs` from the top of the config, and then from `profile` when it is not empty.
+func (c *Config) Apply(fs *flag.FlagSet, profile string) error {
+	settings := c.Options
+	if profile != "" {
+		p, ok := c.Profiles[profile]
+		if !ok {
+			return fmt.Errorf("profile %q is not in the config file", profile)
+		}
+		settings = append(append([]configSetting(nil), settings...), p...)
+	}
+	for _, s := range settings {
+		if s.Name == "profile" {
+			return fmt.Errorf("line %d: profiles can not select other profiles", s.Line)
+		}
+		if fs.Lookup(s.Name) == nil {
+			return fmt.Errorf("line %d: unknown option %q", s.Line, s.Name)
+		}
+		if err := fs.Set(s.Name, s.Value); err != nil {
+			return fmt.Errorf("line %d: invalid %s: %v", s.Line, s.Name, err)
+		}
+	}
+	return nil
+}
+
+// profileOf returns the -profile given in `args`, the command line of hget, or else in HGET_PROFILE.
+// The command line is looked at before it is parsed, the profile has to be applied first.
+func profileOf(fs *flag.FlagSet, args []string) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		value, hasValue := "", false
+		if fields := strings.SplitN(name, "=", 2); len(fields) == 2 {
+			name, value, hasValue = fields[0], fields[1], true
+		}
+		if name == "profile" {
+			if !hasValue && i+1 < len(args) {
+				value = args[i+1]
+			}
+			return value
+		}
+		// skip the value of other options
+		if f := fs.Lookup(name); f != nil && !hasValue && !isBoolFlag(f) {
+			i++
+		}
+	}
+	return os.Getenv(envName(Option{Name: "profile"}))
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// ApplyConfig sets the options of `fs` from the config file, if there is one, and the profile selected
+// on the command line `args`. It runs before ApplyEnvironment, the environment and flags take precedence.
+func ApplyConfig(fs *flag.FlagSet, args []string) error {
+	path := filepath.Join(configDir(), configFileName)
+	profile := profileOf(fs, args)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && profile == "" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c, err := ParseConfig(f)
+	if err == nil {
+		err = c.Apply(fs, profile)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package hget
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	c, err := ParseConfig(strings.NewReader(`
+# every download
+n = 8
+proxy = "127.0.0.1:1080"
+
+[metered]
+; slow and expensive
+rate = 200kB
+n = 2
+
+[home]
+`))
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if len(c.Options) != 2 || c.Options[1].Value != "127.0.0.1:1080" || c.Options[1].Line != 4 {
+		t.Fatalf("unexpected options %+v", c.Options)
+	}
+	if len(c.Profiles["metered"]) != 2 || c.Profiles["metered"][0].Name != "rate" {
+		t.Fatalf("unexpected profile %+v", c.Profiles["metered"])
+	}
+	if _, ok := c.Profiles["home"]; !ok {
+		t.Fatalf("empty profiles should exist")
+	}
+
+	for _, broken := range []string{"n 8", "[]\nn = 8"} {
+		if _, err := ParseConfig(strings.NewReader(broken)); err == nil {
+			t.Fatalf("%q should not parse", broken)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	defer func(n int, proxy string, rate string, profile string) {
+		connections, proxyServer, bwLimit, profileName, output = n, proxy, rate, profile, ""
+	}(connections, proxyServer, bwLimit, profileName)
+	dir, err := ioutil.TempDir("", "hget-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(home, config string) { os.Setenv("HOME", home); os.Setenv("XDG_CONFIG_HOME", config) }(os.Getenv("HOME"), os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("HOME", dir)
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	os.MkdirAll(configDir(), 0700)
+	config := "n = 8\nproxy = 127.0.0.1:1080\n\n[metered]\nrate = 200kB\nn = 2\n"
+	if err := ioutil.WriteFile(filepath.Join(configDir(), configFileName), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) error {
+		connections, proxyServer, bwLimit = 1, "", ""
+		fs := flag.NewFlagSet("hget", flag.ContinueOnError)
+		RegisterOptions(fs)
+		if err := ApplyConfig(fs, args); err != nil {
+			return err
+		}
+		if err := ApplyEnvironment(fs); err != nil {
+			return err
+		}
+		return fs.Parse(args)
+	}
+
+	if err := run("URL"); err != nil || connections != 8 || bwLimit != "" {
+		t.Fatalf("the top of the config should apply, got -n %d -rate %q, %v", connections, bwLimit, err)
+	}
+	if err := run("-skip-tls", "-o", "out", "-profile", "metered", "URL"); err != nil || connections != 2 || bwLimit != "200kB" || proxyServer != "127.0.0.1:1080" {
+		t.Fatalf("the profile should apply on top, got -n %d -rate %q -proxy %q, %v", connections, bwLimit, proxyServer, err)
+	}
+	os.Setenv("HGET_CONNECTIONS", "3")
+	defer os.Unsetenv("HGET_CONNECTIONS")
+	if err := run("-profile=metered", "URL"); err != nil || connections != 3 {
+		t.Fatalf("the environment should take precedence, got -n %d, %v", connections, err)
+	}
+	if err := run("-profile", "metered", "-n", "4", "URL"); err != nil || connections != 4 {
+		t.Fatalf("flags should take precedence, got -n %d, %v", connections, err)
+	}
+	if err := run("-profile", "work", "URL"); err == nil {
+		t.Fatalf("unknown profiles should fail")
+	}
+
+	ioutil.WriteFile(filepath.Join(configDir(), configFileName), []byte("connections = 8\n"), 0600)
+	if err := run("URL"); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("unknown options should fail with their line, got %v", err)
+	}
+}
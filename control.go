@@ -0,0 +1,261 @@
+package hget
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var controlSocketName = "control.sock"
+
+// ControlServer lets other hget processes act on a running download, through a unix socket in its
+// task folder taking a command per line.
+type ControlServer struct {
+	listener net.Listener
+	path     string
+
+	mu        sync.Mutex
+	cancelled chan struct{}
+	paused    chan struct{}
+	closed    chan struct{}
+	progress  func() AttachFrame
+	streams   sync.WaitGroup
+}
+
+// ListenControl opens the control socket of the task `folder`.
+func ListenControl(folder string) (*ControlServer, error) {
+	path := filepath.Join(folder, controlSocketName)
+	// a socket left behind by a hget which did not exit cleanly
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	c := &ControlServer{listener: listener, path: path, cancelled: make(chan struct{}), paused: make(chan struct{}), closed: make(chan struct{})}
+	go c.serve()
+	return c, nil
+}
+
+// Cancelled is closed when the download was cancelled, its task has to be removed instead of saved.
+// It never fires on a nil server.
+func (c *ControlServer) Cancelled() <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+	return c.cancelled
+}
+
+// Paused is closed when the download was paused, its task is saved as on an interrupt. It never fires
+// on a nil server.
+func (c *ControlServer) Paused() <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+	return c.paused
+}
+
+// SetProgress makes `progress` what hget attach shows, it does nothing on a nil server.
+func (c *ControlServer) SetProgress(progress func() AttachFrame) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.progress = progress
+}
+
+// Close stops accepting commands and removes the socket, the progress streamed to hget attach ends.
+func (c *ControlServer) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.fire(c.closed)
+	err := c.listener.Close()
+	// hget attach gets the last frame before hget exits
+	c.streams.Wait()
+	os.Remove(c.path)
+	return err
+}
+
+func (c *ControlServer) serve() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		go c.handle(conn)
+	}
+}
+
+func (c *ControlServer) handle(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		switch command := strings.TrimSpace(scanner.Text()); command {
+		case "cancel":
+			c.fire(c.cancelled)
+			fmt.Fprintln(conn, "ok")
+		case "pause":
+			c.fire(c.paused)
+			fmt.Fprintln(conn, "ok")
+		case "progress":
+			if c.startStream() {
+				defer c.streams.Done()
+				c.streamProgress(conn)
+			}
+			return
+		default:
+			fmt.Fprintf(conn, "error unknown command %q\n", command)
+		}
+	}
+}
+
+// startStream counts a stream of progress Close has to wait for, unless the server is closed already.
+func (c *ControlServer) startStream() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.closed:
+		return false
+	default:
+	}
+	c.streams.Add(1)
+	return true
+}
+
+// streamProgress writes the progress to `conn` as a JSON line every attachEvery until the download or
+// the connection ends.
+func (c *ControlServer) streamProgress(conn net.Conn) {
+	ticker := time.NewTicker(attachEvery)
+	defer ticker.Stop()
+	ended := false
+	for {
+		c.mu.Lock()
+		progress := c.progress
+		c.mu.Unlock()
+		frame := AttachFrame{Line: "starting"}
+		if progress != nil {
+			frame = progress()
+		}
+		raw, err := json.Marshal(frame)
+		if err != nil {
+			return
+		}
+		// an attached hget which stopped reading does not hold the download up
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(append(raw, '\n')); err != nil || ended {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-c.closed:
+			// the last frame shows where the download ended
+			ended = true
+		}
+	}
+}
+
+// fire closes `ch` unless it already was.
+func (c *ControlServer) fire(ch chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// sendControl sends `command` to the running download of the task `folder` and returns its answer.
+func sendControl(folder string, command string) error {
+	conn, err := net.DialTimeout("unix", filepath.Join(folder, controlSocketName), 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("could not reach the running download: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return err
+	}
+	answer, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if answer = strings.TrimSpace(answer); answer != "ok" {
+		return errors.New(strings.TrimPrefix(answer, "error "))
+	}
+	return nil
+}
+
+// joiningFileName marks a task being joined, it holds the path of the output
+var joiningFileName = "joining"
+
+// markJoining records that the parts of the task `folder` are being joined into `out`, which is
+// partial until the task folder is removed.
+func markJoining(folder string, out string) error {
+	abs, err := filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(folder, joiningFileName), []byte(abs), 0600)
+}
+
+// cancelWait is how long hget cancel waits for a running download to stop
+var cancelWait = time.Minute
+
+// CancelTask stops the download of `task` if it is running and removes its parts, state and the
+// partial output it may have left, after a confirmation unless -y.
+func CancelTask(task string) error {
+	folder := taskFolder(task)
+	if !ExistDir(folder) {
+		return fmt.Errorf("there is no task %s", task)
+	}
+
+	if TaskLocked(folder) {
+		if !Confirm(fmt.Sprintf("Stop downloading %s and remove what was downloaded?", task)) {
+			return errors.New("cancelled nothing")
+		}
+		if err := sendControl(folder, "cancel"); err != nil {
+			return err
+		}
+		for deadline := time.Now().Add(cancelWait); ExistDir(folder); time.Sleep(100 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("%s did not stop within %v", task, cancelWait)
+			}
+		}
+		Printf("Cancelled %s\n", task)
+		return nil
+	}
+
+	var output string
+	if out, err := ioutil.ReadFile(filepath.Join(folder, joiningFileName)); err == nil {
+		if stat, err := os.Stat(string(out)); err == nil && stat.Mode().IsRegular() {
+			output = string(out)
+		}
+	}
+	question := fmt.Sprintf("Remove task %s and its downloaded parts in %s?", task, folder)
+	if output != "" {
+		question = fmt.Sprintf("Remove task %s, its downloaded parts in %s and the partial output %s?", task, folder, output)
+	}
+	if !Confirm(question) {
+		return errors.New("cancelled nothing")
+	}
+	if output != "" {
+		if err := os.Remove(output); err != nil {
+			return err
+		}
+	}
+	if err := removeTask(task); err != nil {
+		return err
+	}
+	Printf("Removed %s\n", task)
+	return nil
+}
@@ -0,0 +1,75 @@
+package hget
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestControlCancel(t *testing.T) {
+	folder := t.TempDir()
+	c, err := ListenControl(folder)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	defer c.Close()
+
+	if err := sendControl(folder, "resume"); err == nil {
+		t.Fatalf("unknown commands should fail")
+	}
+	if err := sendControl(folder, "pause"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	select {
+	case <-c.Paused():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the download should be paused")
+	}
+	if err := sendControl(folder, "cancel"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	select {
+	case <-c.Cancelled():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the download should be cancelled")
+	}
+	if err := sendControl(folder, "cancel"); err != nil {
+		t.Fatalf("cancelling twice should be fine, got %v", err)
+	}
+
+	c.Close()
+	if _, err := os.Stat(filepath.Join(folder, controlSocketName)); !os.IsNotExist(err) {
+		t.Fatalf("the socket should be removed, got %v", err)
+	}
+	var none *ControlServer
+	if none.Cancelled() != nil || none.Close() != nil {
+		t.Fatalf("a nil server should do nothing")
+	}
+}
+
+func TestCancelSavedTask(t *testing.T) {
+	defer func(path string, yes bool) { dataPath, assumeYes = path, yes }(dataPath, assumeYes)
+	dataPath = t.TempDir()
+	assumeYes = true
+
+	folder := FolderOf("http://a.org/1.iso")
+	os.MkdirAll(folder, 0700)
+	ioutil.WriteFile(filepath.Join(folder, "1.iso.part000000"), []byte("part"), 0600)
+	out := filepath.Join(t.TempDir(), "1.iso")
+	ioutil.WriteFile(out, []byte("partial"), 0600)
+	if err := markJoining(folder, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CancelTask("1.iso"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if ExistDir(folder) || ExistDir(out) {
+		t.Fatalf("the task and its partial output should be removed")
+	}
+	if err := CancelTask("1.iso"); err == nil {
+		t.Fatalf("cancelling a missing task should fail")
+	}
+}
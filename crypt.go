@@ -0,0 +1,115 @@
+package hget
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/term"
+)
+
+var encrypt = false
+
+// keyIterations is the PBKDF2 work factor used to turn a passphrase into a key
+var keyIterations = 200000
+
+// Encryption is what gets stored in the state of an encrypted task, never the key itself.
+type Encryption struct {
+	Salt  []byte
+	Check string
+}
+
+// NewEncryption derives a key from `passphrase` with a fresh salt.
+func NewEncryption(passphrase string) (*Encryption, []byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, err
+	}
+	key := deriveKey(passphrase, salt)
+	return &Encryption{Salt: salt, Check: keyCheck(key)}, key, nil
+}
+
+// Key derives the key of an existing task, failing if `passphrase` is not the one it was created with.
+func (e *Encryption) Key(passphrase string) ([]byte, error) {
+	key := deriveKey(passphrase, e.Salt)
+	if !hmac.Equal([]byte(keyCheck(key)), []byte(e.Check)) {
+		return nil, errors.New("wrong passphrase for encrypted task")
+	}
+	return key, nil
+}
+
+// Passphrase reads the passphrase from HGET_PASSPHRASE, or asks for it without echoing it.
+// A new passphrase is asked for twice when `confirm` is set, so a typo does not lock the parts away.
+func Passphrase(confirm bool) (string, error) {
+	if p := os.Getenv("HGET_PASSPHRASE"); p != "" {
+		return p, nil
+	}
+	passphrase, err := readPassphrase("Passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("passphrase should not be empty")
+	}
+	if confirm && IsTerminal(os.Stdin) {
+		again, err := readPassphrase("Confirm passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if IsTerminal(os.Stdin) {
+		line, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(line), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// partStream returns the AES-CTR key stream of part `index` positioned at byte `offset` of its file,
+// so resumed parts can keep appending without re-reading what is already on disk.
+func partStream(key []byte, index int64, offset int64) cipher.Stream {
+	block, err := aes.NewCipher(key)
+	FatalCheck(err)
+
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[:8], uint64(index))
+	binary.BigEndian.PutUint64(iv[8:], uint64(offset/aes.BlockSize))
+	stream := cipher.NewCTR(block, iv)
+
+	skip := make([]byte, offset%aes.BlockSize)
+	stream.XORKeyStream(skip, skip)
+	return stream
+}
+
+func keyCheck(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("hget key check"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deriveKey turns a passphrase into an AES-256 key with PBKDF2-HMAC-SHA256
+func deriveKey(passphrase string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, keyIterations, 32, sha256.New)
+}
@@ -0,0 +1,70 @@
+package hget
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	// test vector from RFC 7914 section 11, cut to the 32 bytes of an AES-256 key
+	keyIterations = 1
+	key := deriveKey("passwd", []byte("salt"))
+	expected := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"
+	if hex.EncodeToString(key) != expected {
+		t.Fatalf("derived key was wrong: %x", key)
+	}
+}
+
+func TestEncryptionKey(t *testing.T) {
+	keyIterations = 10
+	e, key, err := NewEncryption("secret")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	again, err := e.Key("secret")
+	if err != nil || !bytes.Equal(key, again) {
+		t.Fatalf("same passphrase should derive the same key")
+	}
+	if _, err := e.Key("wrong"); err == nil {
+		t.Fatalf("wrong passphrase should be rejected")
+	}
+}
+
+func TestEncryptedJoin(t *testing.T) {
+	displayProgress = false
+	keyIterations = 10
+	_, key, _ := NewEncryption("secret")
+	dir := t.TempDir()
+
+	// parts are written in two sessions, like an interrupted and resumed download
+	plain := []string{"first part, resumed", "second part"}
+	var files []string
+	for i, content := range plain {
+		path := filepath.Join(dir, "file.part00000"+string(rune('0'+i)))
+		files = append(files, path)
+		for _, chunk := range []string{content[:5], content[5:]} {
+			f, _ := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+			stat, _ := f.Stat()
+			w := cipher.StreamWriter{S: partStream(key, int64(i), stat.Size()), W: f}
+			w.Write([]byte(chunk))
+			f.Close()
+		}
+		if onDisk, _ := ioutil.ReadFile(path); bytes.Contains(onDisk, []byte(content)) {
+			t.Fatalf("part should not be stored in plain text")
+		}
+	}
+
+	out := filepath.Join(dir, "file")
+	if err := JoinFile(files, out, key, nil); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	joined, _ := ioutil.ReadFile(out)
+	if string(joined) != plain[0]+plain[1] {
+		t.Fatalf("joined content was wrong: %q", joined)
+	}
+}
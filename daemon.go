@@ -0,0 +1,413 @@
+package hget
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var listenAddress = "127.0.0.1:8080"
+var webhookToken = ""
+
+// daemonCert and daemonKey make hget daemon serve https, and gRPC over HTTP/2
+var daemonCert = ""
+var daemonKey = ""
+
+// daemonQueueSize is how many downloads can wait for their turn
+var daemonQueueSize = 64
+
+// DownloadRequest is the body of a webhook POST asking the daemon to download a url.
+type DownloadRequest struct {
+	URL      string `json:"url"`
+	Checksum string `json:"checksum,omitempty"`
+	// Output is the name of the file in the download folder, the file name of the url if empty
+	Output  string   `json:"output,omitempty"`
+	Mirrors []string `json:"mirrors,omitempty"`
+	// Referrer and Cookie are sent along, for downloads taken over from a browser
+	Referrer string `json:"referrer,omitempty"`
+	Cookie   string `json:"cookie,omitempty"`
+	// Connections and Rate replace -n and -rate, within the caps of the daemon
+	Connections int    `json:"connections,omitempty"`
+	Rate        string `json:"rate,omitempty"`
+	// User is who asked for the download with -users, from their token
+	User string `json:"-"`
+}
+
+// task returns the name of the task of the request.
+func (r DownloadRequest) task() string {
+	return taskOf(r.URL, r.Output)
+}
+
+// apply puts the checksum, output, mirrors, headers, connections and rate of the request in place of
+// those of the command line, until the returned func restores them.
+func (r DownloadRequest) apply() func() {
+	c, o, m, h, n, l := checksum, output, mirrorURLs, extraHeaders.header, connections, bwLimit
+	checksum, output, mirrorURLs = r.Checksum, r.Output, r.Mirrors
+	if r.Connections > 0 {
+		connections = r.Connections
+	}
+	if r.Rate != "" {
+		bwLimit = r.Rate
+	}
+	if r.Referrer != "" || r.Cookie != "" {
+		extraHeaders.header = h.Clone()
+		if r.Referrer != "" {
+			extraHeaders.header.Set("Referer", r.Referrer)
+		}
+		if r.Cookie != "" {
+			extraHeaders.header.Set("Cookie", r.Cookie)
+		}
+	}
+	return func() { checksum, output, mirrorURLs, extraHeaders.header, connections, bwLimit = c, o, m, h, n, l }
+}
+
+// download downloads the request with its checksum, output and mirrors, it returns true when the download got interrupted.
+func (r DownloadRequest) download() (bool, error) {
+	defer r.apply()()
+	return downloadQueued(r.URL)
+}
+
+// Daemon downloads the urls pushed to its webhook one after another, until it gets interrupted. With
+// -users, every user has tasks of their own, which the others can neither see nor cancel.
+type Daemon struct {
+	token  string
+	users  map[string]string
+	root   string
+	queue  chan DownloadRequest
+	limits TaskLimits
+
+	mu      sync.Mutex
+	current string
+	task    string
+	owner   string
+	stats   *ConnectionStats
+	// waiting counts the queued downloads by user/task, skip are those cancelled before their turn
+	waiting map[string]int
+	skip    map[string]bool
+	// paused tells the current download was interrupted by a client rather than a signal
+	paused bool
+	events eventHub
+}
+
+// errQueueFull is returned when a download can not be queued until others are done
+var errQueueFull = errors.New("too many queued downloads")
+
+// DaemonStatus is the answer to GET /downloads.
+type DaemonStatus struct {
+	Queued      int         `json:"queued"`
+	Limits      TaskLimits  `json:"limits"`
+	Current     string      `json:"current,omitempty"`
+	Connections []PartStats `json:"connections,omitempty"`
+}
+
+// NewDaemon creates a daemon accepting requests authenticated with `token`, or with the token of one of
+// the users of -users.
+func NewDaemon(token string) (*Daemon, error) {
+	var users map[string]string
+	if daemonUsers != "" {
+		var err error
+		if users, err = readUsers(daemonUsers); err != nil {
+			return nil, err
+		}
+	}
+	if token == "" && len(users) == 0 {
+		return nil, errors.New("a -token (or HGET_TOKEN) or -users is required to accept webhooks")
+	}
+	if (daemonCert == "") != (daemonKey == "") {
+		return nil, errors.New("-tls-cert and -tls-key go together")
+	}
+	limits, err := daemonLimits()
+	if err != nil {
+		return nil, err
+	}
+	return &Daemon{token: token, users: users, root: dataDir(), queue: make(chan DownloadRequest, daemonQueueSize), limits: limits,
+		waiting: make(map[string]int), skip: make(map[string]bool)}, nil
+}
+
+// Serve accepts webhooks on `addr`, or the socket systemd passed, and downloads what they ask for.
+func (d *Daemon) Serve(addr string) error {
+	listener, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: d}
+	serveErr := make(chan error, 1)
+	scheme := "http"
+	go func() {
+		if daemonCert == "" {
+			serveErr <- server.Serve(listener)
+		} else {
+			// HTTP/2, which gRPC needs, comes with TLS
+			serveErr <- server.ServeTLS(listener, daemonCert, daemonKey)
+		}
+	}()
+	if daemonCert != "" {
+		scheme = "https"
+	}
+	defer server.Close()
+	defer sdNotify("STOPPING=1")
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sig)
+
+	Printf("Accepting downloads on %s://%s/downloads\n", scheme, listener.Addr())
+	sdNotify("READY=1\nSTATUS=Waiting for downloads")
+	for {
+		select {
+		case err := <-serveErr:
+			return err
+		case <-sig:
+			return nil
+		case req := <-d.queue:
+			if d.dequeue(req) {
+				continue
+			}
+			if d.run(req) && !d.takePaused() {
+				// the interrupted download is resumed when the url is pushed again
+				return nil
+			}
+		}
+	}
+}
+
+// dequeue takes `req` off the queue, it returns true when it was cancelled in the meantime.
+func (d *Daemon) dequeue(req DownloadRequest) bool {
+	key := req.User + "/" + req.task()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.waiting[key]--; d.waiting[key] <= 0 {
+		delete(d.waiting, key)
+		defer delete(d.skip, key)
+	}
+	return d.skip[key]
+}
+
+// takePaused tells whether the last download was paused by a client, the daemon goes on with the next one then.
+func (d *Daemon) takePaused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	paused := d.paused
+	d.paused = false
+	return paused
+}
+
+// run downloads `req`, it returns true when the download got interrupted.
+func (d *Daemon) run(req DownloadRequest) bool {
+	Printf("Downloading %s\n", req.URL)
+	restore, err := d.namespace(&req)
+	if err != nil {
+		Errorf("%s: %v\n", req.URL, err)
+		return false
+	}
+	defer restore()
+	stats := NewConnectionStats()
+	d.mu.Lock()
+	d.current, d.task, d.owner, d.stats = req.URL, req.task(), req.User, stats
+	d.mu.Unlock()
+	progressStats = MultiSink{stats, d.events.sinkOf(req)}
+	defer func() {
+		progressStats = nil
+		d.mu.Lock()
+		d.current, d.task, d.owner, d.stats = "", "", "", nil
+		d.mu.Unlock()
+	}()
+
+	sdNotify("STATUS=Downloading " + req.URL)
+	defer d.limits.apply()()
+	defer sdNotify("STATUS=Waiting for downloads")
+
+	interrupted, err := req.download()
+	if err != nil {
+		Errorf("%s: %v\n", req.URL, err)
+	}
+	return interrupted
+}
+
+// ServeHTTP enqueues the download of an authenticated POST to /downloads, and answers a GET with the
+// status of the current download. GET /tasks lists the tasks of the user and DELETE /tasks/NAME cancels one.
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isGRPC(r) {
+		d.serveGRPC(w, r)
+		return
+	}
+	allowed := map[string]string{"/": http.MethodGet, "/downloads": http.MethodGet + ", " + http.MethodPost, "/tasks": http.MethodGet,
+		"/events": http.MethodGet}
+	path := r.URL.Path
+	if strings.HasPrefix(path, "/tasks/") {
+		path = "/tasks/"
+		allowed[path] = http.MethodDelete + ", " + http.MethodPost
+	}
+	allow, ok := allowed[path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	accepted := false
+	for _, method := range strings.Split(allow, ", ") {
+		accepted = accepted || method == r.Method
+	}
+	if !accepted {
+		w.Header().Set("Allow", allow)
+		http.Error(w, "only "+allow+" are accepted", http.StatusMethodNotAllowed)
+		return
+	}
+	if path == "/" {
+		serveDashboard(w)
+		return
+	}
+	user, ok := d.userOf(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if !ok {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case path == "/tasks":
+		tasks, err := d.listTasks(user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tasks)
+		return
+	case path == "/events":
+		d.serveEvents(w, r, user)
+		return
+	case path == "/tasks/" && r.Method == http.MethodPost:
+		name := strings.TrimPrefix(r.URL.Path, "/tasks/")
+		if !strings.HasSuffix(name, "/pause") {
+			http.NotFound(w, r)
+			return
+		}
+		name = strings.TrimSuffix(name, "/pause")
+		var e *grpcError
+		if err := d.pause(user, name); errors.As(err, &e) && e.code == grpcNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "paused %s\n", name)
+		return
+	case path == "/tasks/":
+		name := strings.TrimPrefix(r.URL.Path, "/tasks/")
+		found, err := d.cancelTask(user, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "no task "+name, http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, "cancelled %s\n", name)
+		return
+	case r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.status(user))
+		return
+	}
+
+	var req DownloadRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch err := d.enqueue(user, req); err {
+	case nil:
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "queued %s\n", req.URL)
+	case errQueueFull:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// enqueue queues the download `req` of `user`, within the caps of the daemon.
+func (d *Daemon) enqueue(user string, req DownloadRequest) error {
+	if err := req.validate(); err != nil {
+		return err
+	}
+	if err := d.limits.clamp(&req); err != nil {
+		return err
+	}
+
+	req.User = user
+	key := user + "/" + req.task()
+	d.mu.Lock()
+	d.waiting[key]++
+	delete(d.skip, key)
+	d.mu.Unlock()
+	select {
+	case d.queue <- req:
+		return nil
+	default:
+		d.dequeue(req)
+		return errQueueFull
+	}
+}
+
+// status tells `user` what the daemon is downloading for them, with the stats of every connection. The
+// daemon itself sees the downloads of everyone.
+func (d *Daemon) status(user string) DaemonStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := DaemonStatus{Queued: len(d.queue), Limits: d.limits}
+	if user != "" {
+		status.Queued = 0
+		for key, n := range d.waiting {
+			if strings.HasPrefix(key, user+"/") {
+				status.Queued += n
+			}
+		}
+	}
+	if user != "" && d.owner != user {
+		return status
+	}
+	status.Current = d.current
+	if d.stats != nil {
+		status.Connections = d.stats.Snapshot()
+	}
+	return status
+}
+
+// validate refuses requests hget would not download, or which would write outside of the download folder.
+func (r *DownloadRequest) validate() error {
+	if r.URL == "" || !IsURL(r.URL) {
+		return fmt.Errorf("invalid url %q", r.URL)
+	}
+	if err := CheckURL(r.URL); err != nil {
+		return err
+	}
+	if r.Checksum != "" {
+		fields := strings.SplitN(r.Checksum, ":", 2)
+		if _, ok := hashes[strings.ToLower(fields[0])]; len(fields) != 2 || !ok {
+			return fmt.Errorf("unsupported checksum %q", r.Checksum)
+		}
+	}
+	for _, mirror := range r.Mirrors {
+		if err := new(mirrorFlag).Set(mirror); err != nil {
+			return err
+		}
+		if err := CheckURL(mirror); err != nil {
+			return err
+		}
+	}
+	if strings.ContainsAny(r.Referrer+r.Cookie, "\r\n") {
+		return errors.New("referrer and cookie must be a single line")
+	}
+	if r.Output != "" && (r.Output != filepath.Base(r.Output) || strings.HasPrefix(r.Output, ".")) {
+		return fmt.Errorf("output %q must be a plain file name", r.Output)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package hget
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDaemonWebhook(t *testing.T) {
+	if _, err := NewDaemon(""); err == nil {
+		t.Fatalf("a daemon without token should be refused")
+	}
+	d, err := NewDaemon("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(token string, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/downloads", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	cases := []struct {
+		token string
+		body  string
+		code  int
+	}{
+		{"", `{"url": "http://a.org/1.iso"}`, http.StatusUnauthorized},
+		{"wrong", `{"url": "http://a.org/1.iso"}`, http.StatusUnauthorized},
+		{"secret", `{"url": ""}`, http.StatusBadRequest},
+		{"secret", `{"url": "http://a.org/1.iso", "checksum": "crc32:00"}`, http.StatusBadRequest},
+		{"secret", `{"url": "http://a.org/1.iso", "output": "../../etc/passwd"}`, http.StatusBadRequest},
+		{"secret", `{"url": "http://a.org/1.iso", "mirrors": ["ftp://b.org/1.iso"]}`, http.StatusBadRequest},
+		{"secret", `{"url": "http://a.org/1.iso", "checksum": "sha256:00", "output": "a.iso", "mirrors": ["http://b.org/1.iso"]}`, http.StatusAccepted},
+	}
+	for i, c := range cases {
+		if code := post(c.token, c.body); code != c.code {
+			t.Fatalf("case %d: expected %d, got %d", i, c.code, code)
+		}
+	}
+
+	queued := <-d.queue
+	if !reflect.DeepEqual(queued, DownloadRequest{URL: "http://a.org/1.iso", Checksum: "sha256:00", Output: "a.iso", Mirrors: []string{"http://b.org/1.iso"}}) {
+		t.Fatalf("unexpected queued request %+v", queued)
+	}
+	if len(d.queue) != 0 {
+		t.Fatalf("refused requests should not be queued")
+	}
+
+	d.stats = NewConnectionStats()
+	d.current = "http://a.org/1.iso"
+	d.stats.OnConnection(0, ConnectionInfo{Source: "http://b.org/1.iso", IP: "10.0.0.2:80"})
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/downloads", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("the status should need the token, got %d", rec.Code)
+	}
+	var status DaemonStatus
+	if err := json.NewDecoder(get("secret").Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Current != "http://a.org/1.iso" || len(status.Connections) != 1 || status.Connections[0].IP != "10.0.0.2:80" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
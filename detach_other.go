@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package hget
+
+import "syscall"
+
+// detachAttr starts the background download as any other process, sessions are a unix thing.
+func detachAttr() *syscall.SysProcAttr {
+	return nil
+}
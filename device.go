@@ -0,0 +1,99 @@
+package hget
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var output = ""
+var assumeYes = false
+
+// outputOption is -o or its long form --output, both set the output file. It keeps what it was given
+// so that the two can not name different files.
+type outputOption struct {
+	given string
+}
+
+// shortOutput and longOutput are -o and --output
+var shortOutput, longOutput outputOption
+
+func (o *outputOption) String() string {
+	return output
+}
+
+func (o *outputOption) Set(value string) error {
+	o.given, output = value, value
+	return nil
+}
+
+// outputOf returns where the download of `url` is written to, -o or the file name of the url, in -dir
+// when it is given.
+func outputOf(url string) string {
+	if output != "" {
+		return inOutputDir(output)
+	}
+	return inOutputDir(filepath.Base(url))
+}
+
+// IsDevice checks if `path` is a block or character device, like /dev/sdb or /dev/null.
+func IsDevice(path string) bool {
+	stat, err := os.Stat(path)
+	return err == nil && stat.Mode()&os.ModeDevice != 0
+}
+
+// PrepareDevice makes sure `path` can take `size` bytes and that the user really wants to overwrite it,
+// character devices such as /dev/null are not asked about.
+func PrepareDevice(path string, size int64) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if stat.Mode()&os.ModeCharDevice != 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	capacity, err := f.Seek(0, io.SeekEnd)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if capacity < size {
+		return fmt.Errorf("%s holds %d bytes, download needs %d", path, capacity, size)
+	}
+
+	if !Confirm(fmt.Sprintf("Everything on %s will be overwritten, continue?", path)) {
+		return fmt.Errorf("writing to %s was not confirmed", path)
+	}
+	return nil
+}
+
+// Confirm asks a yes/no question on the terminal, -y answers yes to all of them.
+func Confirm(question string) bool {
+	if assumeYes {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// offsetWriter writes sequentially into a file starting at a fixed offset.
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.offset)
+	o.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,37 @@
+package hget
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsDevice(t *testing.T) {
+	if _, err := os.Stat("/dev/null"); err == nil && !IsDevice("/dev/null") {
+		t.Fatalf("/dev/null should be a device")
+	}
+	if IsDevice(t.TempDir()) {
+		t.Fatalf("a directory is not a device")
+	}
+	if err := PrepareDevice(os.DevNull, 1<<40); err != nil && IsDevice(os.DevNull) {
+		t.Fatalf("character devices should not need confirmation, got %v", err)
+	}
+}
+
+func TestOffsetWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "device")
+	f, _ := os.Create(path)
+	defer f.Close()
+
+	second := &offsetWriter{w: f, offset: 5}
+	second.Write([]byte("world"))
+	first := &offsetWriter{w: f, offset: 0}
+	first.Write([]byte("hel"))
+	first.Write([]byte("lo"))
+
+	content, _ := ioutil.ReadFile(path)
+	if string(content) != "helloworld" {
+		t.Fatalf("parts should land at their offsets, got %q", content)
+	}
+}
@@ -0,0 +1,129 @@
+package hget
+
+import (
+	"context"
+	"net"
+	stdurl "net/url"
+	"sync"
+	"time"
+)
+
+var raceIPs = false
+var raceTimeout = 5 * time.Second
+
+var noDNSCache = false
+var dnsTTL = 5 * time.Minute
+
+// dnsCache keeps the addresses of the hosts we download from, so parts and retries
+// do not resolve the same name over and over again.
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+var resolved = &dnsCache{entries: make(map[string]dnsEntry)}
+
+// LookupIP resolves `host`, answering from the cache while its entry is fresh.
+func (c *dnsCache) LookupIP(host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	if !noDNSCache {
+		c.mu.Lock()
+		entry, ok := c.entries[host]
+		c.mu.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.ips, nil
+		}
+	}
+
+	ips, err := lookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	if !noDNSCache {
+		c.mu.Lock()
+		c.entries[host] = dnsEntry{ips: ips, expires: time.Now().Add(dnsTTL)}
+		c.mu.Unlock()
+	}
+	return ips, nil
+}
+
+// DialContext connects to the first reachable cached address of the requested host.
+func (c *dnsCache) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := c.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := newDialer()
+	for _, ip := range ips {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// FastestIP dials every ip on the given port concurrently and returns the first one that answers.
+func FastestIP(ips []net.IP, port string, timeout time.Duration) (string, error) {
+	type result struct {
+		ip  string
+		err error
+	}
+
+	results := make(chan result, len(ips))
+	for _, ip := range ips {
+		go func(ip string) {
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, port), timeout)
+			if err == nil {
+				conn.Close()
+			}
+			results <- result{ip: ip, err: err}
+		}(ip.String())
+	}
+
+	var err error = &net.AddrError{Err: "no ip to race", Addr: port}
+	for range ips {
+		r := <-results
+		if r.err == nil {
+			return r.ip, nil
+		}
+		err = r.err
+	}
+	return "", err
+}
+
+// PortOf returns the port of `u`, falling back to the default port of its scheme.
+func PortOf(u *stdurl.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// pinnedDial returns a dial function which always connects to `ip`, keeping the requested port.
+func pinnedDial(ip string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := newDialer()
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+	}
+}
@@ -0,0 +1,73 @@
+package hget
+
+import (
+	"context"
+	"net"
+	stdurl "net/url"
+	"testing"
+	"time"
+)
+
+func TestFastestIP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen should not fail: %v", err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	// 192.0.2.0/24 is reserved for documentation, nothing answers there
+	ips := []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("127.0.0.1")}
+	ip, err := FastestIP(ips, port, time.Second)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if ip != "127.0.0.1" {
+		t.Fatalf("fastest ip should be 127.0.0.1, got %s", ip)
+	}
+}
+
+func TestPortOf(t *testing.T) {
+	for raw, port := range map[string]string{
+		"http://foo.bar/file":       "80",
+		"https://foo.bar/file":      "443",
+		"https://foo.bar:8443/file": "8443",
+	} {
+		u, _ := stdurl.Parse(raw)
+		if PortOf(u) != port {
+			t.Fatalf("port of %s should be %s", raw, port)
+		}
+	}
+}
+
+func TestDNSCache(t *testing.T) {
+	c := &dnsCache{entries: make(map[string]dnsEntry)}
+	c.entries["cached.invalid"] = dnsEntry{ips: []net.IP{net.ParseIP("127.0.0.1")}, expires: time.Now().Add(time.Minute)}
+
+	ips, err := c.LookupIP("cached.invalid")
+	if err != nil || len(ips) != 1 || !ips[0].Equal(net.ParseIP("127.0.0.1")) {
+		t.Fatalf("cached entry should be used, got %v %v", ips, err)
+	}
+
+	c.entries["cached.invalid"] = dnsEntry{ips: ips, expires: time.Now().Add(-time.Minute)}
+	if _, err := c.LookupIP("cached.invalid"); err == nil {
+		t.Fatalf("expired entry should be resolved again")
+	}
+
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("ipv6 loopback is not available: %v", err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	// nothing listens on the ipv4 loopback with this port, the dial has to move on to the next address
+	c.entries["cached.invalid"] = dnsEntry{ips: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}, expires: time.Now().Add(time.Minute)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, err := c.DialContext(ctx, "tcp", net.JoinHostPort("cached.invalid", port))
+	if err != nil {
+		t.Fatalf("dial should fall through to the reachable address, got %v", err)
+	}
+	conn.Close()
+}
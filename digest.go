@@ -0,0 +1,122 @@
+package hget
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+var noDigest = false
+
+// errDigestMismatch is returned when the bytes of a response do not match the digest the server sent with it.
+var errDigestMismatch = errors.New("corrupted response")
+
+// contentDigestFields tell the digest of the bytes of a response, reprDigestFields the one of the whole
+// file, which only a response carrying all of it can be checked against
+var contentDigestFields = []string{"Content-Digest", "Content-MD5"}
+var reprDigestFields = []string{"Repr-Digest", "Digest"}
+
+// digestAlgorithms are the algorithms of the digest fields hget checks, by their lower case name
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha":     sha1.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// parseDigests returns the digests of the field `name` by algorithm, e.g. sha-256=:BASE64: for
+// Content-Digest and Repr-Digest, SHA-256=BASE64 for Digest. Unknown algorithms are left out.
+func parseDigests(name string, value string) map[string][]byte {
+	digests := make(map[string][]byte)
+	if strings.EqualFold(name, "Content-MD5") {
+		value = "md5=" + value
+	}
+	for _, item := range strings.Split(value, ",") {
+		i := strings.Index(item, "=")
+		if i < 0 {
+			continue
+		}
+		algo := strings.ToLower(strings.TrimSpace(item[:i]))
+		if digestAlgorithms[algo] == nil {
+			continue
+		}
+		sum, err := base64.StdEncoding.DecodeString(strings.Trim(strings.TrimSpace(item[i+1:]), ":"))
+		if err == nil && len(sum) == digestAlgorithms[algo]().Size() {
+			digests[algo] = sum
+		}
+	}
+	return digests
+}
+
+// bodyDigest hashes the body of a response to check it against the digests the server sent in its
+// headers or its trailers.
+type bodyDigest struct {
+	resp   *http.Response
+	fields []string
+	hashes map[string]hash.Hash
+}
+
+// newBodyDigest returns the digest of the body of `resp`, nil when the server tells none. The fields of
+// the whole file are checked when `whole`.
+func newBodyDigest(resp *http.Response, whole bool) *bodyDigest {
+	if noDigest {
+		return nil
+	}
+	d := &bodyDigest{resp: resp, fields: contentDigestFields, hashes: make(map[string]hash.Hash)}
+	if whole {
+		d.fields = append(append([]string(nil), contentDigestFields...), reprDigestFields...)
+	}
+	for _, field := range d.fields {
+		for algo := range parseDigests(field, resp.Header.Get(field)) {
+			d.hashes[algo] = digestAlgorithms[algo]()
+		}
+		if _, ok := resp.Trailer[http.CanonicalHeaderKey(field)]; ok {
+			// the algorithm is only known at the end
+			for algo, newHash := range digestAlgorithms {
+				if d.hashes[algo] == nil {
+					d.hashes[algo] = newHash()
+				}
+			}
+		}
+	}
+	if len(d.hashes) == 0 {
+		return nil
+	}
+	return d
+}
+
+func (d *bodyDigest) Write(b []byte) (int, error) {
+	for _, h := range d.hashes {
+		h.Write(b)
+	}
+	return len(b), nil
+}
+
+// verify checks the body, once read to the end, against every digest the server sent.
+func (d *bodyDigest) verify() error {
+	for _, field := range d.fields {
+		value := d.resp.Header.Get(field)
+		if value == "" {
+			value = d.resp.Trailer.Get(field)
+		}
+		for algo, want := range parseDigests(field, value) {
+			h := d.hashes[algo]
+			if h == nil {
+				continue
+			}
+			if got := h.Sum(nil); !bytes.Equal(got, want) {
+				return fmt.Errorf("%w: %s %s is %s, the bytes received are %s", errDigestMismatch, field, algo,
+					base64.StdEncoding.EncodeToString(want), base64.StdEncoding.EncodeToString(got))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package hget
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseDigests(t *testing.T) {
+	sum := sha256.Sum256([]byte("hget"))
+	encoded := base64.StdEncoding.EncodeToString(sum[:])
+	for name, value := range map[string]string{
+		"Content-Digest": "sha-512=:AAAA:, sha-256=:" + encoded + ":",
+		"Digest":         "SHA-256=" + encoded + ",unixsum=30637",
+	} {
+		digests := parseDigests(name, value)
+		if len(digests) != 1 || string(digests["sha-256"]) != string(sum[:]) {
+			t.Fatalf("unexpected digests of %s: %v", value, digests)
+		}
+	}
+	if digests := parseDigests("Content-MD5", "Q2hlY2sgSW50ZWdyaXR5IQ=="); len(digests["md5"]) != 16 {
+		t.Fatalf("Content-MD5 should be a md5 digest, got %v", digests)
+	}
+}
+
+func TestPartDigest(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var from, to int
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &from, &to)
+		body := content[from : to+1]
+		sum := sha256.Sum256([]byte(body))
+		digest := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", from, to, len(content)))
+		n := atomic.AddInt32(&requests, 1)
+		if n == 1 || n == 3 {
+			// a bit flipped on the way
+			body = "X" + body[1:]
+		}
+		if n <= 2 {
+			w.Header().Set("Content-Digest", digest)
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte(body))
+			return
+		}
+		w.Header().Set("Trailer", "Content-Digest")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(body))
+		w.Header().Set("Content-Digest", digest)
+	}))
+	defer srv.Close()
+
+	d := &HTTPDownloader{url: srv.URL + "/file", par: 2, len: 1000}
+	part := Part{Index: 0, Path: filepath.Join(t.TempDir(), "file.part000000"), RangeTo: 499}
+	written, _, err := d.fetchPart(d.client(), part, make(chan bool))
+	if !errors.Is(err, errDigestMismatch) || written != 0 {
+		t.Fatalf("the corrupted response should be refused, got %v after %d bytes", err, written)
+	}
+	if stored, _ := ioutil.ReadFile(part.Path); len(stored) != 0 {
+		t.Fatalf("the corrupted bytes should be cut off the part, got %d bytes", len(stored))
+	}
+
+	written, _, err = d.fetchPart(d.client(), Part{Index: 0, Path: part.Path, RangeTo: 249}, make(chan bool))
+	if err != nil || written != 250 {
+		t.Fatalf("the retry should be accepted, got %v after %d bytes", err, written)
+	}
+	rest := Part{Index: 0, Path: part.Path, RangeFrom: 250, RangeTo: 499}
+	if _, _, err = d.fetchPart(d.client(), rest, make(chan bool)); !errors.Is(err, errDigestMismatch) {
+		t.Fatalf("a digest in the trailers should be checked too, got %v", err)
+	}
+	if _, _, err = d.fetchPart(d.client(), rest, make(chan bool)); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if stored, _ := ioutil.ReadFile(part.Path); string(stored) != content[:500] {
+		t.Fatalf("expected the first half of the file, got %q", stored)
+	}
+
+	noDigest = true
+	defer func() { noDigest = false }()
+	if resp := (&http.Response{Header: http.Header{"Content-Digest": {"sha-256=:AAAA:"}}}); newBodyDigest(resp, false) != nil {
+		t.Fatalf("-no-digest should not check the responses")
+	}
+}
+
+func TestPartDigestWithRate(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	sum := sha256.Sum256([]byte(content))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	// -rate must not take the body away from the digest
+	d := &HTTPDownloader{url: srv.URL + "/file", par: 1, len: 1000, rate: 1 << 20}
+	part := Part{Index: 0, Path: filepath.Join(t.TempDir(), "file.part000000"), RangeTo: 999}
+	written, _, err := d.fetchPart(d.client(), part, make(chan bool))
+	if err != nil || written != 1000 {
+		t.Fatalf("the limited response should match its digest, got %v after %d bytes", err, written)
+	}
+}
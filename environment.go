@@ -0,0 +1,99 @@
+package hget
+
+import (
+	"flag"
+	"net/url"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// secretOptions are options whose value is not recorded in the environment of a task
+var secretOptions = map[string]bool{"token": true}
+
+// Environment is what a task was started with, kept in its state so that a failed or disputed
+// download can be reproduced later with the same hget and options.
+type Environment struct {
+	Version  string
+	Platform string
+	// Args are the options given, on the command line, in the config or as HGET_* variables
+	Args []string `json:",omitempty"`
+	// FinalURL is where the url redirected to when the task started
+	FinalURL string
+}
+
+// hgetVersion returns the version of this hget.
+func hgetVersion() string {
+	if GitCommit == "" {
+		return "dev"
+	}
+	return GitCommit
+}
+
+// currentEnvironment returns the environment of this hget downloading from `finalURL`, secrets
+// such as tokens, credentials of proxies and sensitive headers left out.
+func currentEnvironment(fs *flag.FlagSet, finalURL string) *Environment {
+	env := &Environment{Version: hgetVersion(), Platform: runtime.GOOS + "/" + runtime.GOARCH, FinalURL: redactURL(finalURL)}
+	fs.Visit(func(f *flag.Flag) {
+		switch {
+		case f.Name == "header":
+			env.Args = append(env.Args, headerArgs()...)
+		case secretOptions[f.Name]:
+			env.Args = append(env.Args, "-"+f.Name+"=REDACTED")
+		default:
+			value := f.Value.String()
+			if f.Name == "proxy" || f.Name == "upload" || f.Name == "mirror" {
+				value = redactURL(value)
+			}
+			env.Args = append(env.Args, "-"+f.Name+"="+value)
+		}
+	})
+	return env
+}
+
+// headerArgs returns the -header options given, sensitive values redacted.
+func headerArgs() []string {
+	var args []string
+	for name, values := range extraHeaders.header {
+		for _, value := range values {
+			for _, sensitive := range sensitiveHeaders {
+				if strings.EqualFold(name, sensitive) {
+					value = "REDACTED"
+				}
+			}
+			args = append(args, "-header="+name+": "+value)
+		}
+	}
+	sort.Strings(args)
+	return args
+}
+
+// redactURL hides the password of `raw`, other values are kept as they are.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// finalURL returns where the url of `d` redirected to, the url itself without redirects.
+func (d *HTTPDownloader) finalURL() string {
+	if len(d.redirects) > 0 {
+		return d.redirects[len(d.redirects)-1]
+	}
+	return d.url
+}
+
+// String sums up the environment on one line, as the completion summary shows it.
+func (e *Environment) String() string {
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = shellQuote(arg)
+	}
+	summary := "hget " + e.Version + " on " + e.Platform
+	if len(args) > 0 {
+		summary += " with " + strings.Join(args, " ")
+	}
+	return summary + ", from " + e.FinalURL
+}
@@ -0,0 +1,42 @@
+package hget
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors Download fails with, wrapped with the details of the download, so that applications
+// embedding hget can tell them apart with errors.Is.
+var (
+	// ErrRangeNotSupported is returned when what was asked for needs ranges the server does not answer.
+	ErrRangeNotSupported = errors.New("the server does not answer ranges")
+	// ErrChecksumMismatch is returned when the downloaded file does not match its checksum.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrRemoteChanged is returned when the file is no longer the one the download started with.
+	ErrRemoteChanged = errors.New("the file changed on the server since the download started")
+	// ErrInterrupted is returned when the download stopped before completing, saved to be resumed
+	// unless it was cancelled or is not resumable.
+	ErrInterrupted = errors.New("interrupted")
+	// ErrTemporary is returned when the download failed for a reason likely to go away, such as a
+	// network outage or an overloaded server, saved to be resumed later.
+	ErrTemporary = errors.New("temporary failure")
+)
+
+// causedError is an error of its own message which errors.Is still matches with its cause.
+type causedError struct {
+	cause   error
+	message string
+}
+
+func (e *causedError) Error() string {
+	return e.message
+}
+
+func (e *causedError) Unwrap() error {
+	return e.cause
+}
+
+// causedBy returns the error of the message formatted from `format`, matched by errors.Is as `cause`.
+func causedBy(cause error, format string, a ...interface{}) error {
+	return &causedError{cause: cause, message: fmt.Sprintf(format, a...)}
+}
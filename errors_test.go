@@ -0,0 +1,49 @@
+package hget
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadErrors(t *testing.T) {
+	displayProgress = false
+	defer func(data string) { dataPath, output, checksum, rangeSpec = data, "", "", "" }(dataPath)
+	dataPath = t.TempDir()
+	content := strings.Repeat("0123456789", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/plain/") {
+			w.Write([]byte(content))
+			return
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	output = filepath.Join(t.TempDir(), "file.bin")
+
+	if err := Download(server.URL + "/ok/file.bin"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(output); string(got) != content {
+		t.Fatalf("unexpected content %q", got)
+	}
+
+	checksum = "sha256:00"
+	url := server.URL + "/mismatch.bin"
+	if err := Download(url); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	checksum = ""
+
+	rangeSpec = "10-20"
+	url = server.URL + "/plain/window.bin"
+	err := Download(url)
+	if !errors.Is(err, ErrRangeNotSupported) || err.Error() != "-range needs a server answering ranges and telling the length of the file" {
+		t.Fatalf("expected ranges not to be supported, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package hget
+
+import (
+	"sync"
+	"time"
+)
+
+// Throughput is how fast a task got downloaded so far, kept in its state so that the
+// remaining time is known right after a resume instead of being measured from zero again.
+type Throughput struct {
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+// Rate returns the measured bytes per second, zero when nothing was measured yet.
+func (t Throughput) Rate() float64 {
+	if t.Bytes <= 0 || t.Elapsed <= 0 {
+		return 0
+	}
+	return float64(t.Bytes) / t.Elapsed.Seconds()
+}
+
+// ETA estimates how long `remaining` bytes take at the measured rate, or returns false if it is unknown.
+func (t Throughput) ETA(remaining int64) (time.Duration, bool) {
+	rate := t.Rate()
+	if rate == 0 {
+		return 0, false
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Second)), true
+}
+
+// Meter is a ProgressSink measuring the running download on top of the throughput of earlier runs.
+type Meter struct {
+	mu      sync.Mutex
+	prior   Throughput
+	total   int64
+	bytes   int64
+	started time.Time
+}
+
+// NewMeter continues measuring from `prior`.
+func NewMeter(prior Throughput) *Meter {
+	return &Meter{prior: prior}
+}
+
+// Throughput returns everything measured until now, including earlier runs.
+func (m *Meter) Throughput() Throughput {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.prior
+	if !m.started.IsZero() {
+		t.Bytes += m.bytes
+		t.Elapsed += time.Since(m.started)
+	}
+	return t
+}
+
+// Remaining returns the bytes the running download has left.
+func (m *Meter) Remaining() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total - m.bytes
+}
+
+// ETA estimates the remaining time of the running download.
+func (m *Meter) ETA() (time.Duration, bool) {
+	m.mu.Lock()
+	remaining := m.total - m.bytes
+	m.mu.Unlock()
+	return m.Throughput().ETA(remaining)
+}
+
+// OnPartStart implements ProgressSink
+func (m *Meter) OnPartStart(index int64, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started.IsZero() {
+		m.started = time.Now()
+	}
+	m.total += size
+}
+
+// OnBytes implements ProgressSink
+func (m *Meter) OnBytes(index int64, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytes += n
+}
+
+// OnPartDone implements ProgressSink
+func (m *Meter) OnPartDone(index int64) {}
+
+// OnConnection implements ProgressSink
+func (m *Meter) OnConnection(index int64, info ConnectionInfo) {}
+
+// OnJoin implements ProgressSink
+func (m *Meter) OnJoin(done int, total int) {}
+
+// OnComplete implements ProgressSink
+func (m *Meter) OnComplete(path string) {}
+
+// Remaining returns how many bytes of the task are still missing.
+func (s *State) Remaining() int64 {
+	var remaining int64
+	for _, part := range s.Parts {
+		if part.RangeTo > part.RangeFrom {
+			remaining += part.RangeTo - part.RangeFrom
+		}
+	}
+	return remaining
+}
+
+// TaskETA prints the remaining time of a stopped task based on the speed it was downloaded with before.
+func TaskETA(task string) error {
+	s, err := Read(task)
+	if err != nil {
+		return err
+	}
+	remaining := s.Remaining()
+	var measured Throughput
+	if s.Throughput != nil {
+		measured = *s.Throughput
+	}
+	eta, ok := measured.ETA(remaining)
+	if !ok {
+		Printf("%s: %s left, no speed measured yet\n", task, humanBytes(remaining))
+		return nil
+	}
+	Printf("%s: %s left, about %s at %s/s\n", task, humanBytes(remaining), formatETA(eta), humanBytes(int64(measured.Rate())))
+	return nil
+}
+
+// formatETA rounds `d` to what is worth showing to a human.
+func formatETA(d time.Duration) string {
+	if d > time.Minute {
+		return d.Round(time.Minute).String()
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,34 @@
+package hget
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThroughputETA(t *testing.T) {
+	if _, ok := (Throughput{}).ETA(100); ok {
+		t.Fatalf("nothing measured should not give an ETA")
+	}
+
+	measured := Throughput{Bytes: 1000, Elapsed: 10 * time.Second}
+	eta, ok := measured.ETA(500)
+	if !ok || eta != 5*time.Second {
+		t.Fatalf("500 bytes at 100 B/s should take 5s, got %v", eta)
+	}
+}
+
+func TestMeterContinuesPriorThroughput(t *testing.T) {
+	meter := NewMeter(Throughput{Bytes: 1000, Elapsed: 10 * time.Second})
+	meter.OnPartStart(0, 1000)
+
+	// right after resuming the speed of the earlier run is used
+	eta, ok := meter.ETA()
+	if !ok || eta < 9*time.Second || eta > 11*time.Second {
+		t.Fatalf("ETA should come from the prior speed, got %v", eta)
+	}
+
+	meter.OnBytes(0, 500)
+	if got := meter.Throughput().Bytes; got != 1500 {
+		t.Fatalf("throughput should add up both runs, got %d bytes", got)
+	}
+}
@@ -0,0 +1,102 @@
+package hget
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ExportTask writes the state and part files of `task` as a tar archive to `w`.
+func ExportTask(task string, w io.Writer) error {
+	folder := filepath.Join(dataDir(), task)
+	if _, err := os.Stat(filepath.Join(folder, stateFileName)); err != nil {
+		return fmt.Errorf("%s is not a saved task: %v", task, err)
+	}
+
+	entries, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	for _, entry := range entries {
+		// the signature only holds with the key of this machine, the importing one signs again
+		if !entry.Mode().IsRegular() || entry.Name() == lockFileName || entry.Name() == stateFileName+stateSigSuffix {
+			continue
+		}
+		hdr, err := tar.FileInfoHeader(entry, "")
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err := copy(filepath.Join(folder, entry.Name()), tw); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// ImportTask unpacks a task exported by ExportTask into the data folder and returns its name,
+// part paths are rewritten since the archive may come from another machine.
+func ImportTask(r io.Reader) (string, error) {
+	root := dataDir()
+	if err := MkdirIfNotExist(root); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(root, ".import-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Name != filepath.Base(hdr.Name) || hdr.Name == ".." {
+			return "", fmt.Errorf("unexpected entry %q in task archive", hdr.Name)
+		}
+		f, err := os.OpenFile(filepath.Join(tmp, hdr.Name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	bytes, err := ioutil.ReadFile(filepath.Join(tmp, stateFileName))
+	if err != nil {
+		return "", errors.New("task archive does not contain a state file")
+	}
+	s := new(State)
+	if err := json.Unmarshal(bytes, s); err != nil {
+		return "", err
+	}
+
+	folder := taskFolder(s.task())
+	if ExistDir(folder) {
+		return "", fmt.Errorf("task %s already exists, remove it first", s.task())
+	}
+	if err := os.Rename(tmp, folder); err != nil {
+		return "", err
+	}
+	for i := range s.Parts {
+		s.Parts[i].Path = filepath.Join(folder, filepath.Base(s.Parts[i].Path))
+	}
+	return s.task(), s.write(folder)
+}
@@ -0,0 +1,54 @@
+package hget
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportImportTask(t *testing.T) {
+	displayProgress = false
+	url := "http://foo.bar/exported.bin"
+	folder := FolderOf(url)
+	defer os.RemoveAll(folder)
+
+	if err := MkdirIfNotExist(folder); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	part := filepath.Join(folder, "exported.bin.part000000")
+	ioutil.WriteFile(part, []byte("half"), 0600)
+	s := &State{URL: url, Parts: []Part{{Index: 0, URL: url, Path: "/elsewhere/exported.bin.part000000", RangeFrom: 4, RangeTo: 8}}}
+	if err := s.write(folder); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+
+	var archive bytes.Buffer
+	if err := ExportTask("exported.bin", &archive); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if _, err := ImportTask(bytes.NewReader(archive.Bytes())); err == nil {
+		t.Fatalf("importing over an existing task should fail")
+	}
+
+	os.RemoveAll(folder)
+	task, err := ImportTask(&archive)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if task != "exported.bin" {
+		t.Fatalf("task name was wrong: %s", task)
+	}
+
+	imported, err := Read(task)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if imported.Parts[0].Path != part {
+		t.Fatalf("part path should be rewritten, got %s", imported.Parts[0].Path)
+	}
+	if content, _ := ioutil.ReadFile(part); string(content) != "half" {
+		t.Fatalf("part content was wrong")
+	}
+}
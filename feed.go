@@ -0,0 +1,219 @@
+package hget
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var feedMatch = ""
+
+// FeedEntry is an item of a RSS feed or an entry of an Atom feed with something to download.
+type FeedEntry struct {
+	GUID  string
+	Title string
+	URL   string
+}
+
+// Feed polls the RSS or Atom feed at `url` and downloads the enclosures of entries it has not seen
+// before, remembering them in the data folder so that they are only downloaded once.
+func Feed(url string) error {
+	var match *regexp.Regexp
+	if feedMatch != "" {
+		var err error
+		if match, err = regexp.Compile(feedMatch); err != nil {
+			return fmt.Errorf("invalid -match: %v", err)
+		}
+	}
+	if err := CheckURL(url); err != nil {
+		return err
+	}
+
+	interval := pollInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sig)
+
+	Printf("Polling %s every %s\n", url, interval)
+	for {
+		stop, err := feedOnce(url, match, sig)
+		if stop {
+			return nil
+		}
+		if err != nil {
+			// the feed may just be unreachable for a while
+			Errorf("%s: %v\n", url, err)
+		}
+		select {
+		case <-sig:
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// feedOnce downloads the new entries of the feed, it returns true when hget should stop polling.
+func feedOnce(url string, match *regexp.Regexp, sig chan os.Signal) (bool, error) {
+	var raw bytes.Buffer
+	if err := download(ProxyAwareHTTPClient(proxyServer), url, &raw); err != nil {
+		return false, err
+	}
+	entries, err := ParseFeed(raw.Bytes())
+	if err != nil {
+		return false, err
+	}
+	seen, err := readSeen(url)
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		if seen[entry.GUID] {
+			continue
+		}
+		if match != nil && !match.MatchString(entry.Title) && !match.MatchString(entry.URL) {
+			continue
+		}
+
+		Printf("New entry %q: %s\n", entry.Title, entry.URL)
+		interrupted, err := downloadQueued(entry.URL)
+		if interrupted {
+			return true, nil
+		}
+		if err != nil {
+			// not marked as seen, so it is tried again on the next poll
+			Errorf("%s: %v\n", entry.URL, err)
+			continue
+		}
+		seen[entry.GUID] = true
+		if err := writeSeen(url, seen); err != nil {
+			return false, err
+		}
+
+		select {
+		case <-sig:
+			return true, nil
+		default:
+		}
+	}
+	return false, nil
+}
+
+// ParseFeed returns the entries with an enclosure, or at least a link, of a RSS 2.0 or Atom feed.
+func ParseFeed(raw []byte) ([]FeedEntry, error) {
+	var doc struct {
+		XMLName xml.Name
+		Items   []struct {
+			GUID      string `xml:"guid"`
+			Title     string `xml:"title"`
+			Link      string `xml:"link"`
+			Enclosure struct {
+				URL string `xml:"url,attr"`
+			} `xml:"enclosure"`
+		} `xml:"channel>item"`
+		Entries []struct {
+			ID    string `xml:"id"`
+			Title string `xml:"title"`
+			Links []struct {
+				Rel  string `xml:"rel,attr"`
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	var entries []FeedEntry
+	switch doc.XMLName.Local {
+	case "rss":
+		for _, item := range doc.Items {
+			url := strings.TrimSpace(item.Enclosure.URL)
+			if url == "" {
+				url = strings.TrimSpace(item.Link)
+			}
+			entries = append(entries, FeedEntry{GUID: strings.TrimSpace(item.GUID), Title: strings.TrimSpace(item.Title), URL: url})
+		}
+	case "feed":
+		for _, e := range doc.Entries {
+			var url string
+			for _, link := range e.Links {
+				if link.Rel == "enclosure" || (url == "" && (link.Rel == "" || link.Rel == "alternate")) {
+					url = link.Href
+				}
+			}
+			entries = append(entries, FeedEntry{GUID: strings.TrimSpace(e.ID), Title: strings.TrimSpace(e.Title), URL: strings.TrimSpace(url)})
+		}
+	default:
+		return nil, fmt.Errorf("not a RSS or Atom feed: <%s>", doc.XMLName.Local)
+	}
+
+	ret := entries[:0]
+	for _, e := range entries {
+		if e.URL == "" {
+			continue
+		}
+		if e.GUID == "" {
+			e.GUID = e.URL
+		}
+		ret = append(ret, e)
+	}
+	return ret, nil
+}
+
+// seenFile is where the guids of the entries of the feed at `url` which were downloaded are kept,
+// it is a file so that it is not listed among the tasks.
+func seenFile(url string) string {
+	sum := sha1.Sum([]byte(url))
+	return filepath.Join(dataDir(), "feed-"+hex.EncodeToString(sum[:])+".json")
+}
+
+func readSeen(url string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	raw, err := ioutil.ReadFile(seenFile(url))
+	if os.IsNotExist(err) {
+		return seen, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var guids []string
+	if err := json.Unmarshal(raw, &guids); err != nil {
+		return nil, err
+	}
+	for _, guid := range guids {
+		seen[guid] = true
+	}
+	return seen, nil
+}
+
+func writeSeen(url string, seen map[string]bool) error {
+	guids := make([]string, 0, len(seen))
+	for guid := range seen {
+		guids = append(guids, guid)
+	}
+	sort.Strings(guids)
+	raw, err := json.Marshal(guids)
+	if err != nil {
+		return err
+	}
+	if err := MkdirIfNotExist(dataDir()); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(seenFile(url), raw, 0644)
+}
@@ -0,0 +1,85 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+)
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>pod</title>
+<item><title>Episode 2</title><guid>ep-2</guid><enclosure url="http://a.org/ep2.mp3" type="audio/mpeg"/></item>
+<item><title>Notes</title><link>http://a.org/notes.html</link></item>
+<item><title>Nothing</title><guid>empty</guid></item>
+</channel></rss>`
+
+const testAtom = `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>data</title>
+<entry><id>tag:a.org,2020:1</id><title>Dump</title><link href="http://a.org/page"/><link rel="enclosure" href="http://a.org/dump.tar"/></entry>
+</feed>`
+
+func TestParseFeed(t *testing.T) {
+	entries, err := ParseFeed([]byte(testRSS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries with a link, got %v", entries)
+	}
+	if entries[0] != (FeedEntry{GUID: "ep-2", Title: "Episode 2", URL: "http://a.org/ep2.mp3"}) {
+		t.Fatalf("unexpected rss entry %+v", entries[0])
+	}
+	if entries[1].GUID != "http://a.org/notes.html" {
+		t.Fatalf("entries without guid should be known by their link, got %+v", entries[1])
+	}
+
+	entries, err = ParseFeed([]byte(testAtom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].URL != "http://a.org/dump.tar" || entries[0].GUID != "tag:a.org,2020:1" {
+		t.Fatalf("unexpected atom entries %+v", entries)
+	}
+
+	if _, err := ParseFeed([]byte("<html></html>")); err == nil {
+		t.Fatalf("html should not be taken for a feed")
+	}
+}
+
+func TestFeedSkipsSeenAndUnmatched(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hget-feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(old string) { dataPath = old }(dataPath)
+	dataPath = dir
+
+	requested := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feed" {
+			requested = true
+		}
+		w.Write([]byte(testRSS))
+	}))
+	defer srv.Close()
+
+	if err := writeSeen(srv.URL+"/feed", map[string]bool{"ep-2": true}); err != nil {
+		t.Fatal(err)
+	}
+	stop, err := feedOnce(srv.URL+"/feed", regexp.MustCompile(`\.mp3$`), make(chan os.Signal))
+	if err != nil || stop {
+		t.Fatalf("expected to keep polling, got %v %v", stop, err)
+	}
+	if requested {
+		t.Fatalf("seen or unmatched entries should not be downloaded")
+	}
+
+	seen, err := readSeen(srv.URL + "/feed")
+	if err != nil || !seen["ep-2"] || len(seen) != 1 {
+		t.Fatalf("unexpected seen entries %v %v", seen, err)
+	}
+}
@@ -0,0 +1,97 @@
+package hget
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+var follow = false
+
+// followTail appends what is added to the remote file to `out` once it is downloaded, as tail -f does,
+// until a signal or hget cancel. A file which got shorter, such as a rotated log, is followed from its start.
+func (d *HTTPDownloader) followTail(out string, signals <-chan os.Signal, cancelled <-chan struct{}) error {
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	interval := growPoll
+	if pollInterval > 0 {
+		interval = pollInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-signals:
+		case <-cancelled:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	Printf("Following %s into %s, interrupt to stop\n", d.url, out)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		n, err := d.tail(ctx, f, stat.Size())
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			// the next poll tries again
+			Warnf("could not follow %s: %v\n", d.url, err)
+		case n > 0:
+			d.log.Logf("followed %d more bytes", n)
+		}
+	}
+}
+
+// tail requests the bytes of the file after `size` and appends them to `f`.
+func (d *HTTPDownloader) tail(ctx context.Context, f *os.File, size int64) (int64, error) {
+	req, err := d.newRequest(d.url)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", size))
+	resp, err := d.client().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		return io.Copy(f, resp.Body)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		var total int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes */%d", &total); err == nil && total < size {
+			Warnf("%s got shorter, following it from its start\n", d.url)
+			return 0, f.Truncate(0)
+		}
+		// nothing new
+		return 0, nil
+	case resp.StatusCode == http.StatusOK && resp.ContentLength >= 0 && resp.ContentLength < size:
+		Warnf("%s got shorter, following it from its start\n", d.url)
+		if err := f.Truncate(0); err != nil {
+			return 0, err
+		}
+		return io.Copy(f, resp.Body)
+	case resp.StatusCode == http.StatusOK:
+		return 0, fmt.Errorf("%w, the file can not be followed", ErrRangeNotSupported)
+	}
+	return 0, fmt.Errorf("unexpected response %q", resp.Status)
+}
@@ -0,0 +1,72 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	displayProgress = false
+	defer func(poll time.Duration) { growPoll = poll }(growPoll)
+	growPoll = time.Millisecond
+	var mu sync.Mutex
+	content := "line 1\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		http.ServeContent(w, r, "app.log", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	write := func(s string) {
+		mu.Lock()
+		content = s
+		mu.Unlock()
+	}
+
+	url := server.URL + "/app.log"
+	defer os.RemoveAll(FolderOf(url))
+	d := NewHTTPDownloader(url, 1, true, "", "")
+	out := filepath.Join(t.TempDir(), "app.log")
+	if err := ioutil.WriteFile(out, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- d.followTail(out, signals, nil) }()
+	wait := func(expected string) {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if got, _ := ioutil.ReadFile(out); string(got) == expected {
+				return
+			}
+		}
+		got, _ := ioutil.ReadFile(out)
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+
+	write("line 1\nline 2\n")
+	wait("line 1\nline 2\n")
+	// rotated
+	write("new\n")
+	wait("new\n")
+	write("new\nmore\n")
+	wait("new\nmore\n")
+
+	signals <- syscall.SIGINT
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("err should be nil, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("following should stop on a signal")
+	}
+}
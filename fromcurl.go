@@ -0,0 +1,477 @@
+package hget
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Translation is a curl or wget command line turned into the url and the options of hget.
+type Translation struct {
+	URL     string
+	Options []TranslatedOption
+
+	data     []string
+	get      bool
+	user     string
+	password string
+}
+
+// TranslatedOption is an option of hget set by a translated command, Value is empty for bool options.
+type TranslatedOption struct {
+	Name  string
+	Value string
+}
+
+// commandFlag is a flag of curl or wget: whether it takes a value, and what it sets in the translation.
+type commandFlag struct {
+	value bool
+	apply func(t *Translation, value string) error
+}
+
+// ignored flags have no equivalent, or hget does the same on its own
+var ignoredFlag = commandFlag{apply: func(*Translation, string) error { return nil }}
+var ignoredValueFlag = commandFlag{value: true, apply: func(*Translation, string) error { return nil }}
+
+func setsOption(name string) commandFlag {
+	return commandFlag{value: true, apply: func(t *Translation, value string) error { return t.set(name, value) }}
+}
+
+func setsBool(name string) commandFlag {
+	return commandFlag{apply: func(t *Translation, _ string) error { return t.set(name, "") }}
+}
+
+func setsHeader(name string) commandFlag {
+	return commandFlag{value: true, apply: func(t *Translation, value string) error { return t.header(name + ": " + value) }}
+}
+
+// limitRate takes the 1k or 2M of curl and wget, powers of 1024 as in aria2c
+var limitRate = commandFlag{value: true, apply: func(t *Translation, value string) error {
+	return t.set("rate", aria2Rate(strings.ToUpper(value)))
+}}
+
+var uploadFlag = commandFlag{value: true, apply: func(*Translation, string) error {
+	return errors.New("hget only downloads with GET, the command uploads a body")
+}}
+
+var curlFlags = map[string]commandFlag{
+	"H":                  {value: true, apply: (*Translation).header},
+	"header":             {value: true, apply: (*Translation).header},
+	"b":                  {value: true, apply: (*Translation).cookie},
+	"cookie":             {value: true, apply: (*Translation).cookie},
+	"A":                  setsOption("ua"),
+	"user-agent":         setsOption("ua"),
+	"e":                  setsHeader("Referer"),
+	"referer":            setsHeader("Referer"),
+	"o":                  setsOption("o"),
+	"output":             setsOption("o"),
+	"x":                  setsOption("proxy"),
+	"proxy":              setsOption("proxy"),
+	"limit-rate":         limitRate,
+	"k":                  setsBool("skip-tls"),
+	"insecure":           setsBool("skip-tls"),
+	"u":                  {value: true, apply: (*Translation).credentials},
+	"user":               {value: true, apply: (*Translation).credentials},
+	"X":                  {value: true, apply: (*Translation).method},
+	"request":            {value: true, apply: (*Translation).method},
+	"url":                {value: true, apply: (*Translation).url},
+	"G":                  {apply: func(t *Translation, _ string) error { t.get = true; return nil }},
+	"get":                {apply: func(t *Translation, _ string) error { t.get = true; return nil }},
+	"d":                  {value: true, apply: (*Translation).body},
+	"data":               {value: true, apply: (*Translation).body},
+	"data-raw":           {value: true, apply: (*Translation).body},
+	"data-ascii":         {value: true, apply: (*Translation).body},
+	"data-binary":        {value: true, apply: (*Translation).body},
+	"data-urlencode":     {value: true, apply: (*Translation).body},
+	"F":                  uploadFlag,
+	"form":               uploadFlag,
+	"T":                  uploadFlag,
+	"upload-file":        uploadFlag,
+	"L":                  ignoredFlag,
+	"location":           ignoredFlag,
+	"O":                  ignoredFlag,
+	"remote-name":        ignoredFlag,
+	"J":                  ignoredFlag,
+	"remote-header-name": ignoredFlag,
+	"compressed":         ignoredFlag,
+	"s":                  ignoredFlag,
+	"silent":             ignoredFlag,
+	"S":                  ignoredFlag,
+	"show-error":         ignoredFlag,
+	"v":                  ignoredFlag,
+	"verbose":            ignoredFlag,
+	"#":                  ignoredFlag,
+	"progress-bar":       ignoredFlag,
+	"f":                  ignoredFlag,
+	"fail":               ignoredFlag,
+	"g":                  ignoredFlag,
+	"globoff":            ignoredFlag,
+	"http1.1":            ignoredFlag,
+	"http2":              ignoredFlag,
+	"C":                  ignoredValueFlag,
+	"continue-at":        ignoredValueFlag,
+	"retry":              ignoredValueFlag,
+	"connect-timeout":    ignoredValueFlag,
+	"m":                  ignoredValueFlag,
+	"max-time":           ignoredValueFlag,
+}
+
+var wgetFlags = map[string]commandFlag{
+	"header":               {value: true, apply: (*Translation).header},
+	"U":                    setsOption("ua"),
+	"user-agent":           setsOption("ua"),
+	"referer":              setsHeader("Referer"),
+	"O":                    setsOption("o"),
+	"output-document":      setsOption("o"),
+	"no-check-certificate": setsBool("skip-tls"),
+	"limit-rate":           limitRate,
+	"user":                 {value: true, apply: func(t *Translation, value string) error { t.user = value; return nil }},
+	"http-user":            {value: true, apply: func(t *Translation, value string) error { t.user = value; return nil }},
+	"password":             {value: true, apply: func(t *Translation, value string) error { t.password = value; return nil }},
+	"http-password":        {value: true, apply: func(t *Translation, value string) error { t.password = value; return nil }},
+	"method":               {value: true, apply: (*Translation).method},
+	"post-data":            uploadFlag,
+	"post-file":            uploadFlag,
+	"body-data":            uploadFlag,
+	"load-cookies": {value: true, apply: func(*Translation, string) error {
+		return errors.New("cookie files are not supported, pass the cookies with --header 'Cookie: ...'")
+	}},
+	"c":                        ignoredFlag,
+	"continue":                 ignoredFlag,
+	"q":                        ignoredFlag,
+	"quiet":                    ignoredFlag,
+	"v":                        ignoredFlag,
+	"verbose":                  ignoredFlag,
+	"nv":                       ignoredFlag,
+	"no-verbose":               ignoredFlag,
+	"content-disposition":      ignoredFlag,
+	"trust-server-names":       ignoredFlag,
+	"no-cookies":               ignoredFlag,
+	"e":                        ignoredValueFlag,
+	"execute":                  ignoredValueFlag,
+	"t":                        ignoredValueFlag,
+	"tries":                    ignoredValueFlag,
+	"T":                        ignoredValueFlag,
+	"timeout":                  ignoredValueFlag,
+	"show-progress":            ignoredFlag,
+	"progress":                 ignoredValueFlag,
+	"no-hsts":                  ignoredFlag,
+	"auth-no-challenge":        ignoredFlag,
+	"keep-session-cookies":     ignoredFlag,
+	"save-cookies":             ignoredValueFlag,
+	"secure-protocol":          ignoredValueFlag,
+	"https-only":               setsBool("https-only"),
+	"max-redirect":             setsOption("max-redirects"),
+	"no-http-keep-alive":       ignoredFlag,
+	"ignore-length":            ignoredFlag,
+	"no-dns-cache":             setsBool("no-dns-cache"),
+	"restrict-file-names":      ignoredValueFlag,
+	"no-use-server-timestamps": ignoredFlag,
+}
+
+// dropped headers are set by hget itself, sending those of the browser would break the ranged requests
+var droppedHeaders = map[string]bool{"Accept-Encoding": true, "Range": true, "If-Range": true, "Content-Length": true, "Host": true}
+
+func (t *Translation) set(name string, value string) error {
+	t.Options = append(t.Options, TranslatedOption{Name: name, Value: value})
+	return nil
+}
+
+func (t *Translation) header(value string) error {
+	fields := strings.SplitN(value, ":", 2)
+	name := strings.TrimSpace(fields[0])
+	if len(fields) != 2 || name == "" {
+		return fmt.Errorf("header should look like 'Name: value', got %q", value)
+	}
+	value = strings.TrimSpace(fields[1])
+	switch name = http.CanonicalHeaderKey(name); {
+	case droppedHeaders[name] || value == "":
+		return nil
+	case name == "User-Agent":
+		return t.set("ua", value)
+	}
+	return t.set("header", name+": "+value)
+}
+
+// cookie takes the cookies of curl -b, which reads them from a file when there is no = in it.
+func (t *Translation) cookie(value string) error {
+	if !strings.Contains(value, "=") {
+		return errors.New("cookie files are not supported, pass the cookies with -b 'name=value'")
+	}
+	return t.header("Cookie: " + value)
+}
+
+func (t *Translation) credentials(value string) error {
+	fields := strings.SplitN(value, ":", 2)
+	if len(fields) != 2 {
+		return errors.New("the password of -u is prompted by curl, give it as user:password")
+	}
+	t.user, t.password = fields[0], fields[1]
+	return nil
+}
+
+func (t *Translation) method(value string) error {
+	if method := strings.ToUpper(value); method != "GET" {
+		return fmt.Errorf("hget only downloads with GET, the command sends %s", method)
+	}
+	return nil
+}
+
+func (t *Translation) body(value string) error {
+	t.data = append(t.data, value)
+	return nil
+}
+
+func (t *Translation) url(value string) error {
+	if t.URL != "" {
+		return errors.New("the command downloads more than one url, hget -file downloads lists")
+	}
+	t.URL = value
+	return nil
+}
+
+// finish adds what depends on several flags, credentials and data sent in the query by curl -G.
+func (t *Translation) finish() error {
+	if t.URL == "" {
+		return errors.New("the command has no url")
+	}
+	if len(t.data) > 0 {
+		if !t.get {
+			return errors.New("hget only downloads with GET, the command uploads a body")
+		}
+		separator := "?"
+		if strings.Contains(t.URL, "?") {
+			separator = "&"
+		}
+		t.URL += separator + strings.Join(t.data, "&")
+	}
+	if t.user != "" || t.password != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(t.user + ":" + t.password))
+		t.set("header", "Authorization: Basic "+auth)
+	}
+	if u, err := url.Parse(t.URL); err != nil || u.Host == "" {
+		return fmt.Errorf("%q is not an url", t.URL)
+	}
+	return nil
+}
+
+// TranslateCommand turns a curl or wget command line, as browsers copy it, into the url and the options
+// of hget. `words` are the arguments of the command, which is the first of them.
+func TranslateCommand(words []string) (*Translation, error) {
+	if len(words) == 0 {
+		return nil, errors.New("the command is empty")
+	}
+	flags := curlFlags
+	switch tool := strings.TrimSuffix(words[0][strings.LastIndexAny(words[0], `/\`)+1:], ".exe"); tool {
+	case "curl":
+	case "wget":
+		flags = wgetFlags
+	default:
+		return nil, fmt.Errorf("%s is neither curl nor wget", tool)
+	}
+
+	t := &Translation{}
+	args := words[1:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			for _, u := range args[i+1:] {
+				if err := t.url(u); err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if err := t.url(arg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// long flags, and the short ones of wget such as -nv, are whole; curl bundles its short flags as in -sSL
+		var names []string
+		value, hasValue := "", false
+		if strings.HasPrefix(arg, "--") || flags[arg[1:]].apply != nil {
+			name := strings.TrimLeft(arg, "-")
+			if fields := strings.SplitN(name, "=", 2); len(fields) == 2 && strings.HasPrefix(arg, "--") {
+				name, value, hasValue = fields[0], fields[1], true
+			}
+			names = []string{name}
+		} else {
+			for j, c := range arg[1:] {
+				names = append(names, string(c))
+				if f := flags[string(c)]; f.value && j+2 < len(arg) {
+					// the rest of the word is the value, as in -o/tmp/out.iso
+					value, hasValue = arg[j+2:], true
+					break
+				}
+			}
+		}
+
+		for _, name := range names {
+			f, ok := flags[name]
+			if !ok {
+				Warnf("%s: %s is not supported, ignoredFlag\n", words[0], name)
+				continue
+			}
+			v := value
+			if f.value && !hasValue {
+				if i+1 == len(args) {
+					return nil, fmt.Errorf("%s expects a value", arg)
+				}
+				i++
+				v = args[i]
+			}
+			if err := f.apply(t, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return t, t.finish()
+}
+
+// CommandLine returns the command line of hget downloading the translated command, quoted for a shell.
+func (t *Translation) CommandLine() string {
+	words := []string{"hget"}
+	for _, o := range t.Options {
+		words = append(words, "-"+o.Name)
+		if o.Value != "" {
+			words = append(words, shellQuote(o.Value))
+		}
+	}
+	return strings.Join(append(words, shellQuote(t.URL)), " ")
+}
+
+// Config returns the options of the translated command as a profile of the config file, named after
+// the host of the url.
+func (t *Translation) Config() string {
+	profile := "download"
+	if u, err := url.Parse(t.URL); err == nil && u.Hostname() != "" {
+		profile = u.Hostname()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# hget -profile %s %s\n[%s]\n", profile, shellQuote(t.URL), profile)
+	for _, o := range t.Options {
+		value := o.Value
+		if value == "" {
+			value = "true"
+		} else if strings.ContainsAny(value, `"#;`) || strings.TrimSpace(value) != value {
+			quote := `"`
+			if strings.Contains(value, `"`) {
+				quote = "'"
+			}
+			value = quote + value + quote
+		}
+		fmt.Fprintf(&b, "%s = %s\n", o.Name, value)
+	}
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:@%+,=") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// SplitCommand splits a command line pasted from a browser into words the way a POSIX shell does,
+// with its line continuations, single and double quotes and the $'...' strings of bash.
+func SplitCommand(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line) && (line[i+1] == '\n' || line[i+1] == '\r'):
+			// a line continuation
+			i++
+			if line[i] == '\r' && i+1 < len(line) && line[i+1] == '\n' {
+				i++
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			if i+1 < len(line) {
+				i++
+				word.WriteByte(line[i])
+			}
+			inWord = true
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated ' quote")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '$' && i+1 < len(line) && line[i+1] == '\'':
+			n, err := ansiQuoted(line[i+2:], &word)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 2
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("\\\"$`\n", line[i+1]) >= 0 {
+					i++
+					if line[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(line[i])
+			}
+			if i == len(line) {
+				return nil, errors.New(`unterminated " quote`)
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// ansiQuoted writes the $'...' string starting `s` into `word` and returns the length read, closing
+// quote included.
+func ansiQuoted(s string, word *strings.Builder) (int, error) {
+	escapes := map[byte]byte{'n': '\n', 't': '\t', 'r': '\r', '\\': '\\', '\'': '\'', '"': '"'}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\'':
+			return i, nil
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			if e, ok := escapes[s[i]]; ok {
+				word.WriteByte(e)
+			} else if s[i] == 'u' && i+4 < len(s) {
+				var r rune
+				if _, err := fmt.Sscanf(s[i+1:i+5], "%04x", &r); err != nil {
+					return 0, fmt.Errorf("invalid escape \\u%s", s[i+1:i+5])
+				}
+				word.WriteRune(r)
+				i += 4
+			} else {
+				word.WriteByte('\\')
+				word.WriteByte(s[i])
+			}
+		default:
+			word.WriteByte(s[i])
+		}
+	}
+	return 0, errors.New("unterminated $' quote")
+}
@@ -0,0 +1,64 @@
+package hget
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	line := "curl 'https://a.org/1.iso?x=1' \\\n  -H $'Cookie: a=\\'b\\'' \\\r\n  -H \"X-Name: \\\"quoted\\\" \\$HOME\" --compressed plain\\ word"
+	expected := []string{"curl", "https://a.org/1.iso?x=1", "-H", "Cookie: a='b'", "-H", `X-Name: "quoted" $HOME`, "--compressed", "plain word"}
+	words, err := SplitCommand(line)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if !reflect.DeepEqual(words, expected) {
+		t.Fatalf("expected %q, got %q", expected, words)
+	}
+	for _, broken := range []string{"curl 'url", `curl "url`, "curl $'url"} {
+		if _, err := SplitCommand(broken); err == nil {
+			t.Fatalf("%s should not split", broken)
+		}
+	}
+}
+
+func TestTranslateCommand(t *testing.T) {
+	words, _ := SplitCommand(`curl 'https://a.org/1.iso' -H 'accept-encoding: gzip, deflate' -H 'user-agent: Mozilla/5.0' ` +
+		`-b 'session=s3cret' -e https://a.org/ -sSLko /tmp/one.iso --limit-rate 2m -u me:pw --fancy`)
+	tr, err := TranslateCommand(words)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	expected := "hget -ua Mozilla/5.0 -header 'Cookie: session=s3cret' -header 'Referer: https://a.org/' -skip-tls -o /tmp/one.iso -rate 2MiB " +
+		"-header 'Authorization: Basic bWU6cHc=' https://a.org/1.iso"
+	if got := tr.CommandLine(); got != expected {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	if config := tr.Config(); !strings.HasPrefix(config, "# hget -profile a.org https://a.org/1.iso\n[a.org]\nua = Mozilla/5.0\n") || !strings.Contains(config, "skip-tls = true\n") {
+		t.Fatalf("unexpected config %s", config)
+	}
+
+	tr, err = TranslateCommand([]string{"wget", "--header=Cookie: a=b", "-O", "one.iso", "-c", "-e", "robots=off", "https://a.org/1.iso"})
+	if err != nil || tr.CommandLine() != "hget -header 'Cookie: a=b' -o one.iso https://a.org/1.iso" {
+		t.Fatalf("unexpected translation %+v, %v", tr, err)
+	}
+	tr, err = TranslateCommand([]string{"curl", "-G", "-d", "q=1", "https://a.org/get?a=2"})
+	if err != nil || tr.URL != "https://a.org/get?a=2&q=1" {
+		t.Fatalf("data of -G should go into the query, got %+v, %v", tr, err)
+	}
+
+	for _, broken := range [][]string{
+		{"curl", "-X", "POST", "https://a.org/"},
+		{"curl", "--data-raw", "{}", "https://a.org/"},
+		{"curl", "-b", "cookies.txt", "https://a.org/"},
+		{"curl", "https://a.org/1", "https://a.org/2"},
+		{"curl", "-H"},
+		{"curl", "-s"},
+		{"http", "https://a.org/"},
+	} {
+		if _, err := TranslateCommand(broken); err == nil {
+			t.Fatalf("%q should not translate", broken)
+		}
+	}
+}
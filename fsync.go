@@ -0,0 +1,75 @@
+package hget
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// fsyncPolicy is when part files and the state are synced to the disk.
+type fsyncPolicy string
+
+const (
+	fsyncNever  fsyncPolicy = "never"
+	fsyncParts  fsyncPolicy = "parts"
+	fsyncAlways fsyncPolicy = "always"
+)
+
+var fsyncMode = fsyncNever
+
+func (p *fsyncPolicy) String() string {
+	return string(*p)
+}
+
+func (p *fsyncPolicy) Set(value string) error {
+	switch policy := fsyncPolicy(value); policy {
+	case fsyncNever, fsyncParts, fsyncAlways:
+		*p = policy
+		return nil
+	}
+	return fmt.Errorf("fsync should be never, parts or always, got %q", value)
+}
+
+// syncFile syncs `f` to the disk, the crash tests replace it to know what survives a power loss
+var syncFile = (*os.File).Sync
+
+// writeFileSynced writes `data` to `path` as ioutil.WriteFile does. Unless -fsync is never, it goes
+// through a synced temporary file renamed over `path`, so a crash leaves either the old or the new file.
+func writeFileSynced(path string, data []byte, perm os.FileMode) error {
+	if fsyncMode == fsyncNever {
+		return ioutil.WriteFile(path, data, perm)
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = syncFile(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// syncDir syncs the entries of `dir`, for renamed files to survive a crash. Folders can not be synced
+// on windows, where renames are durable on their own.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -0,0 +1,159 @@
+package hget
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stallingServer serves `content`, only the first `stallAfter` bytes of longer ranges while `stalling` is set.
+func stallingServer(content string, stallAfter int, stalling *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		from, to := 0, len(content)-1
+		if spec := r.Header.Get("Range"); spec != "" {
+			if _, err := fmt.Sscanf(spec, "bytes=%d-%d", &from, &to); err != nil {
+				fmt.Sscanf(spec, "bytes=%d-", &from)
+			}
+			if to >= len(content) {
+				to = len(content) - 1
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", from, to, len(content)))
+			w.Header().Set("Content-Length", fmt.Sprint(to-from+1))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		}
+		body := content[from : to+1]
+		if atomic.LoadInt32(stalling) == 1 && r.Header.Get("Range") != "" && len(body) > stallAfter {
+			w.Write([]byte(body[:stallAfter]))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+// TestCrashResume interrupts a download, loses what a power loss would of the part files under every
+// -fsync policy, and resumes it.
+func TestCrashResume(t *testing.T) {
+	displayProgress = false
+	defer func(size int64, sync func(*os.File) error, mode fsyncPolicy, data string) {
+		blockSize, syncFile, fsyncMode, dataPath = size, sync, mode, data
+	}(blockSize, syncFile, fsyncMode, dataPath)
+	dataPath = t.TempDir()
+	blockSize = 16
+	content := strings.Repeat("0123456789abcdef", 64)
+	var stalling int32
+	server := stallingServer(content, 100, &stalling)
+	defer server.Close()
+
+	var mu sync.Mutex
+	synced := make(map[string]int64)
+	syncs := 0
+	syncFile = func(f *os.File) error {
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		synced[f.Name()], syncs = stat.Size(), syncs+1
+		return f.Sync()
+	}
+
+	for _, mode := range []fsyncPolicy{fsyncNever, fsyncParts, fsyncAlways} {
+		fsyncMode, synced, syncs = mode, make(map[string]int64), 0
+		atomic.StoreInt32(&stalling, 1)
+		url := server.URL + "/crash-" + string(mode) + ".bin"
+		d := NewHTTPDownloader(url, 4, true, "", "")
+
+		doneChan := make(chan bool, 1)
+		fileChan := make(chan string, 4)
+		errorChan := make(chan error, 1)
+		stateChan := make(chan Part, 4)
+		interruptChan := make(chan bool, 4)
+		go d.Do(doneChan, fileChan, errorChan, interruptChan, stateChan)
+		// every part got the first bytes of its range
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+			received := 0
+			for _, part := range d.parts {
+				if stat, err := os.Stat(part.Path); err == nil && stat.Size() == 100 {
+					received++
+				}
+			}
+			if received == len(d.parts) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: the parts did not start", mode)
+			}
+		}
+		interruptAll(interruptChan, 4)
+		var parts []Part
+		for done := false; !done; {
+			select {
+			case part := <-stateChan:
+				parts = append(parts, part)
+			case <-fileChan:
+			case err := <-errorChan:
+				t.Fatalf("%s: err should be nil, got %v", mode, err)
+			case <-doneChan:
+				done = true
+			}
+		}
+		for len(stateChan) > 0 {
+			parts = append(parts, <-stateChan)
+		}
+		sort.Slice(parts, func(i, j int) bool { return parts[i].Index < parts[j].Index })
+
+		// the power goes off, what was not synced is lost
+		mu.Lock()
+		for _, part := range parts {
+			stat, _ := os.Stat(part.Path)
+			if mode != fsyncNever && synced[part.Path] != stat.Size() {
+				t.Fatalf("%s: part %d should be synced whole when it stops, %d of %d bytes were", mode, part.Index, synced[part.Path], stat.Size())
+			}
+			os.Truncate(part.Path, synced[part.Path])
+		}
+		if mode == fsyncAlways && syncs <= len(parts) {
+			t.Fatalf("%s: every write should be synced, got %d syncs", mode, syncs)
+		}
+		mu.Unlock()
+
+		atomic.StoreInt32(&stalling, 0)
+		resumed := &HTTPDownloader{url: url, file: d.file, par: int64(len(parts)), parts: parts, resumable: true}
+		if err := resumed.verifyParts(); err != nil {
+			t.Fatalf("%s: err should be nil, got %v", mode, err)
+		}
+		if got := downloadJoined(t, resumed); got != content {
+			t.Fatalf("%s: the resumed download is corrupted, got %q", mode, got)
+		}
+	}
+}
+
+func TestWriteFileSynced(t *testing.T) {
+	defer func(mode fsyncPolicy) { fsyncMode = mode }(fsyncMode)
+	for _, mode := range []fsyncPolicy{fsyncNever, fsyncParts} {
+		fsyncMode = mode
+		path := t.TempDir() + "/state.json"
+		if err := writeFileSynced(path, []byte("{}"), 0644); err != nil {
+			t.Fatalf("err should be nil, got %v", err)
+		}
+		if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+			t.Fatalf("%s: the temporary file should be gone, got %v", mode, err)
+		}
+	}
+	var mode fsyncPolicy
+	if mode.Set("sometimes") == nil || mode.Set("parts") != nil || mode != fsyncParts {
+		t.Fatalf("expected never, parts or always only, got %q", mode)
+	}
+}
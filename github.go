@@ -0,0 +1,130 @@
+package hget
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	stdurl "net/url"
+	"os"
+	"strings"
+)
+
+// githubAPI is where the releases of GitHub repositories are looked up
+var githubAPI = "https://api.github.com"
+
+// githubRelease is what the GitHub API tells of a release.
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name               string `json:"name"`
+		BrowserDownloadURL string `json:"browser_download_url"`
+		// Digest is the sha256:HEX of the asset, published for assets uploaded since mid 2025
+		Digest string `json:"digest"`
+	} `json:"assets"`
+}
+
+// githubToken returns the Authorization of the GitHub API, the one of -header or GITHUB_TOKEN.
+func githubToken(header http.Header) string {
+	if auth := header.Get("Authorization"); auth != "" {
+		return auth
+	}
+	for _, name := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if token := os.Getenv(name); token != "" {
+			return "Bearer " + token
+		}
+	}
+	return ""
+}
+
+// lookupGitHubRelease returns the release `tag` of the repository `owner`/`repo`, the latest one
+// when `tag` is latest.
+func lookupGitHubRelease(owner, repo, tag string, header http.Header) (*githubRelease, error) {
+	endpoint := githubAPI + "/repos/" + owner + "/" + repo + "/releases/latest"
+	if tag != "latest" {
+		endpoint = githubAPI + "/repos/" + owner + "/" + repo + "/releases/tags/" + stdurl.PathEscape(tag)
+	}
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if auth := githubToken(header); auth != "" {
+		// the releases of private repositories
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := resolverClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not look up the %s release of %s/%s: %s", tag, owner, repo, resp.Status)
+	}
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, err
+	}
+	if release.TagName == "" {
+		return nil, fmt.Errorf("the %s release of %s/%s has no tag", tag, owner, repo)
+	}
+	return &release, nil
+}
+
+// resolveGitHubLatest rewrites an asset of the latest release of a GitHub repository,
+// https://github.com/OWNER/REPO/releases/latest/download/ASSET, to the asset of the release it is
+// now, so that a task resumes from the same release after a newer one is published.
+func resolveGitHubLatest(r *Resolution) error {
+	parsed, err := stdurl.Parse(r.URL)
+	if err != nil {
+		return err
+	}
+	fields := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(fields) != 6 || fields[2] != "releases" || fields[3] != "latest" || fields[4] != "download" {
+		return nil
+	}
+	owner, repo, asset := fields[0], fields[1], fields[5]
+
+	release, err := lookupGitHubRelease(owner, repo, "latest", r.Header)
+	if err != nil {
+		return err
+	}
+	Printf("Latest release of %s/%s is %s\n", owner, repo, release.TagName)
+	parsed.Path = "/" + strings.Join([]string{owner, repo, "releases", "download", release.TagName, asset}, "/")
+	r.URL = parsed.String()
+	return nil
+}
+
+// resolveGitHubAsset resolves gh:OWNER/REPO@TAG:ASSET to the asset of the release, verified with
+// the digest GitHub published for it.
+func resolveGitHubAsset(r *Resolution) error {
+	asset, err := parseReleaseAsset(r.URL)
+	if err != nil {
+		return err
+	}
+	owner, repo := asset.project, ""
+	if slash := strings.IndexByte(asset.project, '/'); slash > 0 && !strings.Contains(asset.project[slash+1:], "/") {
+		owner, repo = asset.project[:slash], asset.project[slash+1:]
+	}
+	if repo == "" {
+		return fmt.Errorf("%s should name a repository as OWNER/REPO", r.URL)
+	}
+	release, err := lookupGitHubRelease(owner, repo, asset.tag, r.Header)
+	if err != nil {
+		return err
+	}
+	for _, a := range release.Assets {
+		if a.Name != asset.name {
+			continue
+		}
+		r.URL = a.BrowserDownloadURL
+		if auth := githubToken(r.Header); auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		if a.Digest != "" && r.Checksum == "" {
+			r.Checksum = a.Digest
+		}
+		Printf("Release %s of %s/%s has %s\n", release.TagName, owner, repo, a.Name)
+		return nil
+	}
+	return fmt.Errorf("release %s of %s/%s has no asset %s", release.TagName, owner, repo, asset.name)
+}
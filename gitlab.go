@@ -0,0 +1,72 @@
+package hget
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	stdurl "net/url"
+	"os"
+)
+
+// gitlabAPI is where the releases of GitLab projects are looked up
+var gitlabAPI = "https://gitlab.com/api/v4"
+
+// gitlabRelease is what the GitLab API tells of a release.
+type gitlabRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  struct {
+		Links []struct {
+			Name           string `json:"name"`
+			URL            string `json:"url"`
+			DirectAssetURL string `json:"direct_asset_url"`
+		} `json:"links"`
+	} `json:"assets"`
+}
+
+// resolveGitLabAsset resolves gl:GROUP/PROJECT@TAG:ASSET to the link of the release named ASSET,
+// GITLAB_TOKEN is sent as the PRIVATE-TOKEN of private projects.
+func resolveGitLabAsset(r *Resolution) error {
+	asset, err := parseReleaseAsset(r.URL)
+	if err != nil {
+		return err
+	}
+	endpoint := gitlabAPI + "/projects/" + stdurl.PathEscape(asset.project) + "/releases/permalink/latest"
+	if asset.tag != "latest" {
+		endpoint = gitlabAPI + "/projects/" + stdurl.PathEscape(asset.project) + "/releases/" + stdurl.PathEscape(asset.tag)
+	}
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	token := os.Getenv("GITLAB_TOKEN")
+	if token != "" {
+		req.Header.Set("PRIVATE-TOKEN", token)
+	}
+	resp, err := resolverClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not look up the %s release of %s: %s", asset.tag, asset.project, resp.Status)
+	}
+	var release gitlabRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return err
+	}
+	for _, link := range release.Assets.Links {
+		if link.Name != asset.name {
+			continue
+		}
+		r.URL = link.DirectAssetURL
+		if r.URL == "" {
+			r.URL = link.URL
+		}
+		if token != "" {
+			r.Header.Set("PRIVATE-TOKEN", token)
+		}
+		Printf("Release %s of %s has %s\n", release.TagName, asset.project, link.Name)
+		return nil
+	}
+	return fmt.Errorf("release %s of %s has no asset %s", release.TagName, asset.project, asset.name)
+}
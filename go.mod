@@ -4,12 +4,14 @@ go 1.16
 
 require (
 	github.com/alecthomas/units v0.0.0-20210208195552-ff826a37aa15
+	github.com/dop251/goja v0.0.0-20230806174421-c933cf95e127
 	github.com/fatih/color v1.12.0
 	github.com/fujiwara/shapeio v1.0.0
 	github.com/imkira/go-task v1.0.0
 	github.com/mattn/go-colorable v0.1.8
 	github.com/mattn/go-isatty v0.0.13
-	github.com/mattn/go-runewidth v0.0.13 // indirect
-	golang.org/x/net v0.0.0-20210614182718-04defd469f4e
-	gopkg.in/cheggaaa/pb.v1 v1.0.28
+	golang.org/x/crypto v0.11.0
+	golang.org/x/net v0.12.0
+	golang.org/x/term v0.10.0
+	golang.org/x/text v0.13.0 // indirect
 )
@@ -0,0 +1,78 @@
+package hget
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// growTimeout is how long a file still being generated may stop growing before it is taken as complete
+var growTimeout = time.Minute
+
+// growPoll is how often a file still being generated is probed for new bytes
+var growPoll = 5 * time.Second
+
+// lengthUnknown tells whether `resp` is a range of a file whose length the server does not know yet,
+// e.g. Content-Range: bytes 0-0/*, as servers streaming a file which is still being generated answer.
+func lengthUnknown(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusPartialContent && strings.HasSuffix(resp.Header.Get("Content-Range"), "/*")
+}
+
+// probeLength asks for a range to learn the length of the file when a response without Content-Length
+// did not tell it. It returns -1 when the server does not tell, and whether the file is still growing.
+func (d *HTTPDownloader) probeLength() (int64, bool) {
+	resp, err := d.probe()
+	if err != nil {
+		return -1, false
+	}
+	if lengthUnknown(resp) {
+		return -1, true
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return -1, false
+	}
+	return sizeOf(resp), false
+}
+
+// followGrowth fetches `part` of a growing file from `url`: every response carries the bytes the server
+// has so far, the file is then probed again until its length is known and reached, or until it stops
+// growing for -grow-timeout.
+func (d *HTTPDownloader) followGrowth(client *http.Client, url string, part Part, interruptChan chan bool) (int64, bool, error) {
+	var total int64
+	grew := time.Now()
+	for {
+		written, stopped, err := d.requestPart(client, url, part, interruptChan)
+		total += written
+		part.RangeFrom += written
+		if err != nil || stopped {
+			return total, stopped, err
+		}
+		if written > 0 {
+			grew = time.Now()
+		}
+
+		resp, err := d.probe()
+		if err != nil {
+			return total, false, err
+		}
+		size := sizeOf(resp)
+		switch {
+		case size >= 0 && part.RangeFrom >= size:
+			d.log.Logf("part %d: the file is complete at %d bytes", part.Index, size)
+			return total, false, nil
+		case size >= 0:
+			// the length is known, the rest is there already
+			continue
+		case time.Since(grew) >= growTimeout:
+			Warnf("%s did not grow for %v, taking it as complete at %s\n", url, growTimeout, humanBytes(part.RangeFrom))
+			d.log.Logf("part %d: no new bytes for %v, complete at %d bytes", part.Index, growTimeout, part.RangeFrom)
+			return total, false, nil
+		}
+		d.log.Logf("part %d: %d bytes so far, the file is still growing", part.Index, part.RangeFrom)
+		select {
+		case <-interruptChan:
+			return total, true, nil
+		case <-time.After(growPoll):
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package hget
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// growingServer serves a file which gets a chunk longer with every range asked for, its length is
+// only told once all `chunks` are there and `finish` is set.
+func growingServer(chunks []string, finish bool) *httptest.Server {
+	var mu sync.Mutex
+	content := chunks[0]
+	added := 1
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		total := "*"
+		if finish && added == len(chunks) {
+			total = fmt.Sprint(len(content))
+		}
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Last-Modified", time.Now().Add(time.Duration(len(content))*time.Second).Format(http.TimeFormat))
+		var from int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &from); err != nil {
+			// streamed without a length
+			w.(http.Flusher).Flush()
+			w.Write([]byte(content))
+			return
+		}
+		to := len(content) - 1
+		if r.Header.Get("Range") == "bytes=0-0" {
+			to = 0
+		} else if added < len(chunks) {
+			defer func() { content += chunks[added]; added++ }()
+		}
+		if from >= len(content) {
+			w.Header().Set("Content-Range", "bytes */"+total)
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%s", from, to, total))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(content[from : to+1]))
+	}))
+}
+
+func downloadJoined(t *testing.T, d *HTTPDownloader) string {
+	doneChan := make(chan bool, 1)
+	fileChan := make(chan string, 2)
+	errorChan := make(chan error, 1)
+	stateChan := make(chan Part, 2)
+	interruptChan := make(chan bool, 2)
+	go d.Do(doneChan, fileChan, errorChan, interruptChan, stateChan)
+
+	var files []string
+	for {
+		select {
+		case f := <-fileChan:
+			files = append(files, f)
+		case <-stateChan:
+		case err := <-errorChan:
+			t.Fatalf("err should be nil, got %v", err)
+		case <-doneChan:
+			for len(fileChan) > 0 {
+				files = append(files, <-fileChan)
+			}
+			out := filepath.Join(t.TempDir(), "growing.bin")
+			if err := JoinFile(files, out, nil, nil); err != nil {
+				t.Fatalf("err should be nil, got %v", err)
+			}
+			joined, _ := ioutil.ReadFile(out)
+			return string(joined)
+		}
+	}
+}
+
+func TestGrowingFile(t *testing.T) {
+	displayProgress = false
+	defer func(poll time.Duration) { growPoll = poll }(growPoll)
+	growPoll = time.Millisecond
+	chunks := []string{"first ", "second ", "third ", "last"}
+
+	server := growingServer(chunks, true)
+	defer server.Close()
+	url := server.URL + "/growing.bin"
+	defer os.RemoveAll(FolderOf(url))
+	d := NewHTTPDownloader(url, 2, true, "", "")
+	if !d.growing || d.validator != "" {
+		t.Fatalf("a length of * should follow the file as it grows, without If-Range")
+	}
+	if got := downloadJoined(t, d); got != strings.Join(chunks, "") {
+		t.Fatalf("the file should be complete once its length is known, got %q", got)
+	}
+}
+
+func TestGrowingFileStops(t *testing.T) {
+	displayProgress = false
+	defer func(poll time.Duration, timeout time.Duration) { growPoll, growTimeout = poll, timeout }(growPoll, growTimeout)
+	growPoll, growTimeout = time.Millisecond, 20*time.Millisecond
+	chunks := []string{"first ", "second "}
+
+	server := growingServer(chunks, false)
+	defer server.Close()
+	url := server.URL + "/stops.bin"
+	defer os.RemoveAll(FolderOf(url))
+	d := NewHTTPDownloader(url, 2, true, "", "")
+	if got := downloadJoined(t, d); got != strings.Join(chunks, "") {
+		t.Fatalf("the file should be taken as complete once it stops growing, got %q", got)
+	}
+}
+
+func TestLengthFromRange(t *testing.T) {
+	displayProgress = false
+	server := growingServer([]string{"0123456789"}, true)
+	defer server.Close()
+	url := server.URL + "/chunked.bin"
+	defer os.RemoveAll(FolderOf(url))
+	d := NewHTTPDownloader(url, 2, true, "", "")
+	if d.growing || d.len != 10 || d.par != 2 {
+		t.Fatalf("the length of a range should be used when the response has no Content-Length, got %d bytes in %d parts", d.len, d.par)
+	}
+}
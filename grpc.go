@@ -0,0 +1,381 @@
+package hget
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// grpcService is the service of contrib/grpc/hget.proto, served by hget daemon next to its REST endpoints
+var grpcService = "/hget.Hget/"
+
+// grpcMaxMessage is the largest request a client may send
+var grpcMaxMessage = 1 << 16
+
+// gRPC status codes
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcNotFound        = 5
+	grpcExhausted       = 8
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+	grpcUnauthenticated = 16
+)
+
+// grpcError is a failed call with its status code.
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string {
+	return e.message
+}
+
+// isGRPC tells whether `r` is a gRPC call rather than a REST request.
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// serveGRPC answers the gRPC call `r`, its status goes in the trailers.
+func (d *Daemon) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+	err := d.callGRPC(w, r)
+	code, message := grpcOK, ""
+	if err != nil {
+		code, message = grpcInternal, err.Error()
+		var e *grpcError
+		if errors.As(err, &e) {
+			code = e.code
+		}
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", message)
+	}
+}
+
+func (d *Daemon) callGRPC(w http.ResponseWriter, r *http.Request) error {
+	user, ok := d.userOf(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if !ok {
+		return &grpcError{grpcUnauthenticated, "invalid token"}
+	}
+	request, err := readGRPCMessage(r.Body)
+	if err != nil {
+		return &grpcError{grpcInvalidArgument, err.Error()}
+	}
+	fields, err := parseProto(request)
+	if err != nil {
+		return &grpcError{grpcInvalidArgument, err.Error()}
+	}
+
+	switch method := strings.TrimPrefix(r.URL.Path, grpcService); method {
+	case "AddDownload":
+		req := DownloadRequest{URL: fields.string(1), Checksum: fields.string(2), Output: fields.string(3), Mirrors: fields.strings(4),
+			Referrer: fields.string(5), Cookie: fields.string(6), Connections: int(fields.varint(7)), Rate: fields.string(8)}
+		if err := d.enqueue(user, req); err == errQueueFull {
+			return &grpcError{grpcExhausted, err.Error()}
+		} else if err != nil {
+			return &grpcError{grpcInvalidArgument, err.Error()}
+		}
+		return writeGRPCMessage(w, new(protoMessage).string(1, req.task()))
+	case "Pause":
+		task := fields.string(1)
+		if err := d.pause(user, task); err != nil {
+			return err
+		}
+		return writeGRPCMessage(w, new(protoMessage).string(1, task))
+	case "Cancel":
+		task := fields.string(1)
+		found, err := d.cancelTask(user, task)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return &grpcError{grpcNotFound, "no task " + task}
+		}
+		return writeGRPCMessage(w, new(protoMessage).string(1, task))
+	case "List":
+		tasks, err := d.listTasks(user)
+		if err != nil {
+			return err
+		}
+		status := d.status(user)
+		reply := new(protoMessage)
+		for _, task := range tasks {
+			reply.string(1, task)
+		}
+		return writeGRPCMessage(w, reply.string(2, status.Current).varint(3, uint64(status.Queued)))
+	case "Watch":
+		return d.watch(w, r, user, fields.string(1))
+	default:
+		return &grpcError{grpcUnimplemented, "unknown method " + method}
+	}
+}
+
+// watch streams the progress events of the downloads of `user`, those of `task` only if not empty,
+// until the client goes away.
+func (d *Daemon) watch(w http.ResponseWriter, r *http.Request, user string, task string) error {
+	events := d.events.subscribe(user, task)
+	defer d.events.unsubscribe(events)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case e := <-events.ch:
+			if err := writeGRPCMessage(w, e.proto()); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// readGRPCMessage reads the single length prefixed message of a unary or server streaming call.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("could not read the request: %v", err)
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed requests are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > uint32(grpcMaxMessage) {
+		return nil, fmt.Errorf("request of %d bytes is too large", size)
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, fmt.Errorf("could not read the request: %v", err)
+	}
+	io.Copy(ioutil.Discard, r)
+	return message, nil
+}
+
+// writeGRPCMessage writes `m` with its length prefix.
+func writeGRPCMessage(w io.Writer, m *protoMessage) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(*m)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(*m)
+	return err
+}
+
+// protoMessage encodes the few protobuf types of hget.proto, zero values are left out as in proto3.
+type protoMessage []byte
+
+func (m *protoMessage) key(field int, wire int) {
+	*m = appendVarint(*m, uint64(field<<3|wire))
+}
+
+func (m *protoMessage) varint(field int, v uint64) *protoMessage {
+	if v != 0 {
+		m.key(field, 0)
+		*m = appendVarint(*m, v)
+	}
+	return m
+}
+
+func (m *protoMessage) string(field int, s string) *protoMessage {
+	if s != "" {
+		m.key(field, 2)
+		*m = appendVarint(*m, uint64(len(s)))
+		*m = append(*m, s...)
+	}
+	return m
+}
+
+func (m *protoMessage) double(field int, f float64) *protoMessage {
+	if f != 0 {
+		m.key(field, 1)
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+		*m = append(*m, b[:]...)
+	}
+	return m
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// protoFields are the fields of a decoded message by number, varints as uint64 and the others as bytes.
+type protoFields map[int][]interface{}
+
+func (f protoFields) string(field int) string {
+	values := f.strings(field)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+func (f protoFields) strings(field int) []string {
+	var values []string
+	for _, v := range f[field] {
+		if b, ok := v.([]byte); ok {
+			values = append(values, string(b))
+		}
+	}
+	return values
+}
+
+func (f protoFields) varint(field int) uint64 {
+	var value uint64
+	for _, v := range f[field] {
+		if n, ok := v.(uint64); ok {
+			value = n
+		}
+	}
+	return value
+}
+
+// parseProto decodes the fields of the protobuf message `b`.
+func parseProto(b []byte) (protoFields, error) {
+	fields := make(protoFields)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("invalid protobuf message")
+		}
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errors.New("invalid protobuf varint")
+			}
+			fields[field] = append(fields[field], v)
+			b = b[n:]
+		case 1, 5:
+			size := 8
+			if key&7 == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return nil, errors.New("truncated protobuf message")
+			}
+			b = b[size:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, errors.New("truncated protobuf message")
+			}
+			fields[field] = append(fields[field], b[n:n+int(size)])
+			b = b[n+int(size):]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+	}
+	return fields, nil
+}
+
+// taskEvent is a progress event of the download of `task` for `user`.
+type taskEvent struct {
+	progressEvent
+	user string
+	task string
+	url  string
+}
+
+func (e taskEvent) proto() *protoMessage {
+	m := new(protoMessage).string(1, e.task).string(2, e.url).string(3, e.Event)
+	if e.Part != nil {
+		// part 0 has to be told from no part
+		m.key(4, 0)
+		*m = appendVarint(*m, uint64(*e.Part))
+	}
+	return m.varint(5, uint64(e.Size)).varint(6, uint64(e.Bytes)).varint(7, uint64(e.Done)).varint(8, uint64(e.Total)).
+		string(9, e.Path).string(10, e.Source).string(11, e.IP).varint(12, uint64(e.Retries)).double(13, e.Rate)
+}
+
+// eventHub passes the progress of the downloads of a daemon to the clients watching them.
+type eventHub struct {
+	mu       sync.Mutex
+	watchers map[*watcher]bool
+}
+
+type watcher struct {
+	user string
+	task string
+	ch   chan taskEvent
+}
+
+func (h *eventHub) subscribe(user string, task string) *watcher {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.watchers == nil {
+		h.watchers = make(map[*watcher]bool)
+	}
+	w := &watcher{user: user, task: task, ch: make(chan taskEvent, 64)}
+	h.watchers[w] = true
+	return w
+}
+
+func (h *eventHub) unsubscribe(w *watcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.watchers, w)
+}
+
+// sinkOf returns the sink publishing the progress of `req` to the watchers of its user and task, and to
+// those of the daemon itself.
+func (h *eventHub) sinkOf(req DownloadRequest) ProgressSink {
+	task := req.task()
+	return newEventSink(func(e progressEvent) {
+		h.publish(taskEvent{progressEvent: e, user: req.User, task: task, url: req.URL})
+	})
+}
+
+// publish sends `e` to its watchers, a watcher too slow to keep up misses events rather than
+// slowing the download down.
+func (h *eventHub) publish(e taskEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		if (w.user != "" && w.user != e.user) || (w.task != "" && w.task != e.task) {
+			continue
+		}
+		select {
+		case w.ch <- e:
+		default:
+		}
+	}
+}
+
+// pause interrupts the running download of `task` for `user`, which keeps its parts.
+func (d *Daemon) pause(user string, task string) error {
+	d.mu.Lock()
+	running := d.current != "" && d.owner == user && d.task == task
+	if running {
+		d.paused = true
+	}
+	d.mu.Unlock()
+	if !running {
+		return &grpcError{grpcNotFound, task + " is not being downloaded"}
+	}
+	return sendControl(filepath.Join(d.tasksOf(user), task), "pause")
+}
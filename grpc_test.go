@@ -0,0 +1,96 @@
+package hget
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProtoMessage(t *testing.T) {
+	m := new(protoMessage).string(1, "https://a.org/1.iso").string(4, "m1").string(4, "m2").varint(7, 300).string(8, "")
+	fields, err := parseProto(*m)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if fields.string(1) != "https://a.org/1.iso" || len(fields.strings(4)) != 2 || fields.varint(7) != 300 || fields.string(8) != "" {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+	if _, err := parseProto((*m)[:len(*m)-1]); err == nil {
+		t.Fatalf("a truncated message should be refused")
+	}
+}
+
+func TestDaemonGRPC(t *testing.T) {
+	defer func(data string) { dataPath = data }(dataPath)
+	dataPath = t.TempDir()
+	d, err := NewDaemon("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(d)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	client := srv.Client()
+
+	call := func(method string, token string, m *protoMessage) *http.Response {
+		var body bytes.Buffer
+		writeGRPCMessage(&body, m)
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+grpcService+method, &body)
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s failed: %v", method, err)
+		}
+		return resp
+	}
+	unary := func(method string, token string, m *protoMessage) (protoFields, string) {
+		resp := call(method, token, m)
+		defer resp.Body.Close()
+		raw, _ := ioutil.ReadAll(resp.Body)
+		var fields protoFields
+		if len(raw) >= 5 {
+			fields, _ = parseProto(raw[5:])
+		}
+		return fields, resp.Trailer.Get("Grpc-Status")
+	}
+
+	if _, status := unary("List", "wrong", new(protoMessage)); status != "16" {
+		t.Fatalf("a wrong token should be unauthenticated, got %q", status)
+	}
+	fields, status := unary("AddDownload", "secret", new(protoMessage).string(1, "http://a.org/1.iso"))
+	if status != "0" || fields.string(1) != "1.iso" {
+		t.Fatalf("the download should be queued, got %q %v", status, fields)
+	}
+	if fields, status = unary("List", "secret", new(protoMessage)); status != "0" || fields.varint(3) != 1 {
+		t.Fatalf("one download should be queued, got %q %v", status, fields)
+	}
+	if _, status = unary("Pause", "secret", new(protoMessage).string(1, "1.iso")); status != "5" {
+		t.Fatalf("a queued download can not be paused, got %q", status)
+	}
+	if _, status = unary("Cancel", "secret", new(protoMessage).string(1, "1.iso")); status != "0" {
+		t.Fatalf("the queued download should be cancelled, got %q", status)
+	}
+	if _, status = unary("Resume", "secret", new(protoMessage)); status != "12" {
+		t.Fatalf("unknown methods should be unimplemented, got %q", status)
+	}
+
+	resp := call("Watch", "secret", new(protoMessage).string(1, "1.iso"))
+	defer resp.Body.Close()
+	d.events.publish(taskEvent{progressEvent: progressEvent{Event: "start"}, task: "2.iso"})
+	d.events.publish(taskEvent{progressEvent: progressEvent{Event: "complete", Size: 42}, task: "1.iso"})
+	var prefix [5]byte
+	if _, err := io.ReadFull(resp.Body, prefix[:]); err != nil {
+		t.Fatalf("an event should be streamed, got %v", err)
+	}
+	event := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	io.ReadFull(resp.Body, event)
+	if fields, _ = parseProto(event); fields.string(1) != "1.iso" || fields.string(3) != "complete" || fields.varint(5) != 42 {
+		t.Fatalf("only the events of 1.iso should be streamed, got %v", fields)
+	}
+}
@@ -0,0 +1,156 @@
+package hget
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hangupAction is what a download does when its terminal hangs up.
+type hangupAction string
+
+const (
+	hangupStop   hangupAction = "stop"
+	hangupDetach hangupAction = "detach"
+)
+
+var onHangup = hangupStop
+
+func (a *hangupAction) String() string {
+	return string(*a)
+}
+
+func (a *hangupAction) Set(value string) error {
+	switch action := hangupAction(value); action {
+	case hangupStop, hangupDetach:
+		*a = action
+		return nil
+	}
+	return fmt.Errorf("on-hangup should be stop or detach, got %q", value)
+}
+
+// detachedLogEvery is how often a detached download logs how far it got
+var detachedLogEvery = time.Minute
+
+// TerminalSink passes the progress to the bars, title and json of the terminal until hget detaches
+// from it, from then on the progress is written to the task log every detachedLogEvery.
+type TerminalSink struct {
+	ProgressSink
+	meter *Meter
+
+	mu       sync.Mutex
+	log      *TaskLog
+	detached bool
+	logged   time.Time
+}
+
+// NewTerminalSink wraps `sink`, the progress shown on the terminal, measured by `meter`.
+func NewTerminalSink(sink ProgressSink, meter *Meter) *TerminalSink {
+	return &TerminalSink{ProgressSink: sink, meter: meter}
+}
+
+// Detach stops showing anything on the terminal, which hung up. The logs of hget, and the progress,
+// go to `log` instead.
+func (s *TerminalSink) Detach(log *TaskLog) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.detached {
+		return
+	}
+	s.detached, s.log, s.logged = true, log, time.Now()
+	stopDrawing(s.ProgressSink)
+	setConsole(Console{Stdout: taskLogWriter{log}, Stderr: taskLogWriter{log}}, true)
+}
+
+// stopDrawing stops the redraws of the bars in `sink`.
+func stopDrawing(sink ProgressSink) {
+	switch s := sink.(type) {
+	case *BarSink:
+		s.finish()
+	case MultiSink:
+		for _, inner := range s {
+			stopDrawing(inner)
+		}
+	}
+}
+
+// shown returns whether the terminal still shows the progress.
+func (s *TerminalSink) shown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.detached
+}
+
+// OnPartStart implements ProgressSink
+func (s *TerminalSink) OnPartStart(index int64, size int64) {
+	if s.shown() {
+		s.ProgressSink.OnPartStart(index, size)
+	}
+}
+
+// OnConnection implements ProgressSink
+func (s *TerminalSink) OnConnection(index int64, info ConnectionInfo) {
+	if s.shown() {
+		s.ProgressSink.OnConnection(index, info)
+	}
+}
+
+// OnBytes implements ProgressSink
+func (s *TerminalSink) OnBytes(index int64, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.detached {
+		s.ProgressSink.OnBytes(index, n)
+		return
+	}
+	if now := time.Now(); now.Sub(s.logged) >= detachedLogEvery {
+		s.logged = now
+		s.logProgress()
+	}
+}
+
+// logProgress writes how much is left to the task log, s.mu is held.
+func (s *TerminalSink) logProgress() {
+	left := s.meter.Remaining()
+	line := fmt.Sprintf("progress: %s left", humanBytes(left))
+	if eta, ok := s.meter.ETA(); ok {
+		line += fmt.Sprintf(", about %s at %s/s", formatETA(eta), humanBytes(int64(s.meter.Throughput().Rate())))
+	}
+	s.log.Logf("%s", line)
+}
+
+// OnPartDone implements ProgressSink
+func (s *TerminalSink) OnPartDone(index int64) {
+	if s.shown() {
+		s.ProgressSink.OnPartDone(index)
+	}
+}
+
+// OnJoin implements ProgressSink
+func (s *TerminalSink) OnJoin(done int, total int) {
+	if s.shown() {
+		s.ProgressSink.OnJoin(done, total)
+	}
+}
+
+// OnComplete implements ProgressSink
+func (s *TerminalSink) OnComplete(path string) {
+	if s.shown() {
+		s.ProgressSink.OnComplete(path)
+	}
+}
+
+// taskLogWriter writes the lines of the console to a task log.
+type taskLogWriter struct {
+	log *TaskLog
+}
+
+func (w taskLogWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			w.log.Logf("%s", line)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,96 @@
+package hget
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+type countingSink struct {
+	nopSink
+	bytes int64
+}
+
+func (s *countingSink) OnBytes(index int64, n int64) {
+	s.bytes += n
+}
+
+func TestTerminalSinkDetach(t *testing.T) {
+	defer func(ui UI, noColor bool, every time.Duration) {
+		Default, color.NoColor, detachedLogEvery = ui, noColor, every
+	}(Default, color.NoColor, detachedLogEvery)
+	folder := t.TempDir()
+	log, err := OpenTaskLog(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	meter := NewMeter(Throughput{})
+	shown := &countingSink{}
+	sink := MultiSink{meter, NewTerminalSink(shown, meter)}
+	sink.OnPartStart(0, 100)
+	sink.OnBytes(0, 10)
+	if shown.bytes != 10 {
+		t.Fatalf("the terminal should show the progress before hanging up, got %d bytes", shown.bytes)
+	}
+
+	detachedLogEvery = 0
+	sink[1].(*TerminalSink).Detach(log)
+	sink.OnBytes(0, 30)
+	Printf("still downloading %s\n", "file.iso")
+	if shown.bytes != 10 {
+		t.Fatalf("the terminal should not be written to once detached, got %d bytes", shown.bytes)
+	}
+	raw, _ := ioutil.ReadFile(filepath.Join(folder, taskLogName))
+	if !strings.Contains(string(raw), "progress: 60 B left") || !strings.Contains(string(raw), "INFO: still downloading file.iso") {
+		t.Fatalf("the log should hold the progress and the messages, got %q", raw)
+	}
+
+	var action hangupAction
+	if err := action.Set("ignore"); err == nil {
+		t.Fatal("expected ignore to be refused")
+	}
+}
+
+func TestDetachWhileLogging(t *testing.T) {
+	defer func(ui UI, noColor bool) {
+		Default, color.NoColor = ui, noColor
+	}(Default, color.NoColor)
+	Default = Console{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	log, err := OpenTaskLog(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	// the parts keep logging while the terminal hangs up, run with -race
+	logging := make(chan struct{})
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Warnf("part %d: retrying\n", 1)
+		close(logging)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				Warnf("part %d: retrying\n", 1)
+			}
+		}
+	}()
+	<-logging
+	NewTerminalSink(nopSink{}, NewMeter(Throughput{})).Detach(log)
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	<-done
+	if !color.NoColor {
+		t.Fatal("the log should not get colors")
+	}
+}
@@ -0,0 +1,118 @@
+package hget
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var noHashCache = false
+
+var hashCacheFileName = "hashes.json"
+
+// racyWindow is how recent a modification can be for the hash cache not to trust the mtime of a file,
+// which may change again within the precision of the file system without changing the mtime.
+var racyWindow = 2 * time.Second
+
+// cachedDigests are the digests of a file, valid while it keeps its size and modification time.
+type cachedDigests struct {
+	Size    int64
+	ModTime time.Time
+	Digests map[string]string
+}
+
+// hashCacheMu serializes the updates of the hash cache by this process, others may lose a few entries.
+var hashCacheMu sync.Mutex
+
+func hashCachePath() string {
+	return filepath.Join(dataDir(), hashCacheFileName)
+}
+
+func readHashCache() map[string]cachedDigests {
+	cache := make(map[string]cachedDigests)
+	if raw, err := ioutil.ReadFile(hashCachePath()); err == nil {
+		json.Unmarshal(raw, &cache)
+	}
+	return cache
+}
+
+// writeHashCache replaces the hash cache, dropping the files which do not exist anymore.
+func writeHashCache(cache map[string]cachedDigests) error {
+	for path := range cache {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			delete(cache, path)
+		}
+	}
+	raw, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dataDir(), hashCacheFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), hashCachePath())
+}
+
+// digestOf returns the hex digest of `path` with `algo`, one of hashes. It comes from the hash cache
+// when the file still has the size and the modification time it was hashed with, unless -no-hash-cache.
+func digestOf(path string, algo string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !noHashCache {
+		hashCacheMu.Lock()
+		cached, ok := readHashCache()[key]
+		hashCacheMu.Unlock()
+		if ok && cached.Size == stat.Size() && cached.ModTime.Equal(stat.ModTime()) && cached.Digests[algo] != "" {
+			return cached.Digests[algo], nil
+		}
+	}
+
+	h := hashes[algo]()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	if time.Since(stat.ModTime()) < racyWindow || !stat.Mode().IsRegular() {
+		return digest, nil
+	}
+	hashCacheMu.Lock()
+	defer hashCacheMu.Unlock()
+	cache := readHashCache()
+	cached := cache[key]
+	if cached.Size != stat.Size() || !cached.ModTime.Equal(stat.ModTime()) || cached.Digests == nil {
+		cached = cachedDigests{Size: stat.Size(), ModTime: stat.ModTime(), Digests: make(map[string]string)}
+	}
+	cached.Digests[algo] = digest
+	cache[key] = cached
+	if err := writeHashCache(cache); err != nil {
+		Warnf("could not update the hash cache: %v\n", err)
+	}
+	return digest, nil
+}
@@ -0,0 +1,55 @@
+package hget
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashCache(t *testing.T) {
+	defer func(path string) { dataPath = path }(dataPath)
+	dataPath = t.TempDir()
+	path := filepath.Join(t.TempDir(), "1.iso")
+	ioutil.WriteFile(path, []byte("hget"), 0600)
+	digest := sha256.Sum256([]byte("hget"))
+	expected := "sha256:" + hex.EncodeToString(digest[:])
+
+	if err := VerifyFile(path, expected); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if _, ok := readHashCache()[path]; ok {
+		t.Fatalf("files modified right now should not be cached")
+	}
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(path, old, old)
+	if err := VerifyFile(path, expected); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	// the same size and mtime, the cache can not tell
+	ioutil.WriteFile(path, []byte("HGET"), 0600)
+	os.Chtimes(path, old, old)
+	if err := VerifyFile(path, expected); err != nil {
+		t.Fatalf("the digest should come from the cache, got %v", err)
+	}
+	noHashCache = true
+	err := VerifyFile(path, expected)
+	noHashCache = false
+	if err == nil {
+		t.Fatalf("-no-hash-cache should hash the file again")
+	}
+	os.Chtimes(path, old.Add(time.Minute), old.Add(time.Minute))
+	if err := VerifyFile(path, expected); err == nil {
+		t.Fatalf("a changed mtime should hash the file again")
+	}
+
+	os.Remove(path)
+	writeHashCache(readHashCache())
+	if len(readHashCache()) != 0 {
+		t.Fatalf("removed files should be dropped from the cache")
+	}
+}
@@ -1,23 +1,24 @@
-package main
+package hget
 
 import (
+	"crypto/cipher"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	stdurl "net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/alecthomas/units"
-	"github.com/fatih/color"
 	"github.com/fujiwara/shapeio"
 	"golang.org/x/net/proxy"
-	pb "gopkg.in/cheggaaa/pb.v1"
 )
 
 var (
@@ -32,6 +33,14 @@ var (
 	contentLengthHeader = "Content-Length"
 )
 
+// fallbackRetries is how many times a failed part is retried on the single connection fallback
+var fallbackRetries = 3
+
+// Transport, when set, carries every request of a download instead of hget's own transport,
+// e.g. to add instrumentation, caching or an authentication scheme hget does not know about.
+// Part scheduling, progress and resume stay the same, proxy, dns cache and ip pinning are up to it.
+var Transport http.RoundTripper
+
 // HTTPDownloader holds the required configurations
 type HTTPDownloader struct {
 	proxy     string
@@ -41,51 +50,156 @@ type HTTPDownloader struct {
 	par       int64
 	len       int64
 	ips       []string
+	ip        string
+	headers   http.Header
+	key       []byte
+	crypt     *Encryption
+	device    string
+	upload    *S3Upload
+	sink      ProgressSink
+	redirects []string
+	peers     []string
+	peerSums  *blockSums
+	peerMu    sync.Mutex
+	mirrors   []string
+	userAgent string
+	session   http.Header
+	validator string
+	pinned    *PinnedTarget
+	version   fileVersion
+	audit     *AuditLog
+	log       *TaskLog
+	hashes    map[int64]*blockHasher
+	hashMu    sync.Mutex
 	skipTLS   bool
 	parts     []Part
+	runs      *partRuns
 	resumable bool
+	growing   bool
+	window    *byteWindow
+	// environment is what the task was started with
+	environment *Environment
 }
 
 // NewHTTPDownloader returns a ProxyAwareHttpClient with given configurations.
 func NewHTTPDownloader(url string, par int, skipTLS bool, proxyServer string, bwLimit string) *HTTPDownloader {
+	return newHTTPDownloader(url, nil, par, skipTLS, proxyServer, bwLimit)
+}
+
+// newHTTPDownloader creates the downloader of `url` sending the `session` headers, those of the
+// command line when nil.
+func newHTTPDownloader(url string, session http.Header, par int, skipTLS bool, proxyServer string, bwLimit string) *HTTPDownloader {
 	var resumable = true
-	client := ProxyAwareHTTPClient(proxyServer)
+	ret := new(HTTPDownloader)
+	ret.url = url
+	ret.session = session
+	ret.proxy = proxyServer
+	ret.userAgent = chooseUserAgent()
 
 	parsed, err := stdurl.Parse(url)
 	FatalCheck(err)
 
-	ips, err := net.LookupIP(parsed.Host)
+	ips, err := resolved.LookupIP(parsed.Hostname())
 	FatalCheck(err)
 
 	ipstr := FilterIPV4(ips)
 	Printf("Resolve ip: %s\n", strings.Join(ipstr, " | "))
 
-	req, err := http.NewRequest("GET", url, nil)
+	if raceIPs && len(ips) > 1 && len(proxyServer) == 0 {
+		ret.ip, err = FastestIP(ips, PortOf(parsed), raceTimeout)
+		if err != nil {
+			Warnf("Could not race resolved ips, letting the transport pick one: %v\n", err)
+		} else {
+			Printf("Fastest ip: %s, pinning all connections to it\n", ret.ip)
+		}
+	} else if spreadIPs && len(ips) > 1 && len(proxyServer) == 0 {
+		Printf("Spreading connections across %d ips\n", len(ips))
+	}
+
+	client := ret.client()
+	FatalCheck(ret.runPreflight())
+
+	req, err := ret.newRequest(url)
 	FatalCheck(err)
 
-	resp, err := client.Do(req)
+	// a briefly overloaded server gets some time before the download fails
+	var remote string
+	resp, err := client.Do(traceRemote(req, &remote))
+	for err != nil && isRefused(err) {
+		wait, _, ok := backoff.Refused(req.URL.Host)
+		if !ok {
+			break
+		}
+		countdown(fmt.Sprintf("%s refused the connection", req.URL.Host), wait)
+		resp, err = client.Do(traceRemote(req, &remote))
+	}
 	FatalCheck(err)
+	backoff.Connected(req.URL.Host)
+
+	if chain := RedirectChain(resp); len(chain) > 1 {
+		Printf("Redirected through %s\n", strings.Join(chain, " -> "))
+		ret.redirects = chain
+	}
+	if pinTarget {
+		ret.pinTo(resp, remote)
+	}
+	ret.checkVersion(resp, -1)
 
-	if resp.Header.Get(acceptRangeHeader) == "" {
+	if !acceptsRanges(resp) {
 		Printf("Target url is not supported range download, fallback to parallel 1\n")
 		par = 1
 	}
 
 	//get download range
 	clen := resp.Header.Get(contentLengthHeader)
-	if clen == "" {
+	if clen == "" && acceptsRanges(resp) {
+		// a range tells the length of the file, if the server knows it yet
+		if size, growing := ret.probeLength(); growing {
+			Printf("Target url is still growing, following it until its length is known\n")
+			ret.growing = true
+		} else if size > 0 {
+			clen = strconv.FormatInt(size, 10)
+		}
+	}
+	if !ret.growing {
+		// the version of a growing file changes with every byte
+		ret.validator = validatorOf(resp)
+	}
+	if clen == "" && !ret.growing {
 		Printf("Target url not contain Content-Length header, fallback to parallel 1\n")
+	}
+	if clen == "" {
 		clen = "1" //set 1 because of progress bar not accept 0 length
 		par = 1
 		resumable = false
 	}
 
-	Printf("Start download with %d connections \n", par)
-
 	len, err := strconv.ParseInt(clen, 10, 64)
 	FatalCheck(err)
+	size := len
+	if rangeSpec != "" {
+		if !resumable || !acceptsRanges(resp) {
+			FatalCheck(causedBy(ErrRangeNotSupported, "-range needs a server answering ranges and telling the length of the file"))
+		}
+		ret.window, err = parseWindow(rangeSpec, len)
+		FatalCheck(err)
+		size = ret.window.size()
+		// a part holds at least 2 bytes, its end is included
+		if int64(par) > size/2 {
+			par = int(size / 2)
+		}
+		if par < 1 {
+			par = 1
+		}
+		Printf("Downloading bytes %d to %d of %d\n", ret.window.From, ret.window.To, len)
+	}
+	if resumable {
+		FatalCheck(checkSize(size))
+	}
+
+	Printf("Start download with %d connections \n", par)
 
-	sizeInMb := float64(len) / (1024 * 1024)
+	sizeInMb := float64(size) / (1024 * 1024)
 
 	if clen == "1" {
 		Printf("Download size: not specified\n")
@@ -96,27 +210,35 @@ func NewHTTPDownloader(url string, par int, skipTLS bool, proxyServer string, bw
 	}
 
 	file := filepath.Base(url)
-	ret := new(HTTPDownloader)
 	ret.rate = 0
 	bandwidthLimit, err := units.ParseStrictBytes(bwLimit)
 	if err == nil {
 		ret.rate = bandwidthLimit
 		Printf("Download with bandwidth limit set to %s[%d]\n", bwLimit, ret.rate)
 	}
-	ret.url = url
 	ret.file = file
 	ret.par = int64(par)
 	ret.len = len
 	ret.ips = ipstr
 	ret.skipTLS = skipTLS
-	ret.parts = partCalculate(int64(par), len, url)
+	if ret.window != nil {
+		ret.parts, err = ret.window.parts(int64(par), url)
+	} else {
+		ret.parts, err = partCalculate(int64(par), len, url)
+	}
+	FatalCheck(err)
 	ret.resumable = resumable
-	ret.proxy = proxyServer
 
 	return ret
 }
 
-func partCalculate(par int64, len int64, url string) []Part {
+func partCalculate(par int64, len int64, url string) ([]Part, error) {
+	file := filepath.Base(url)
+	folder := partsFolderOf(url)
+	if err := MkdirIfNotExist(folder); err != nil {
+		return nil, err
+	}
+
 	// Pre-allocate, perf tunning
 	ret := make([]Part, par)
 	for j := int64(0); j < par; j++ {
@@ -128,60 +250,111 @@ func partCalculate(par int64, len int64, url string) []Part {
 			to = len
 		}
 
-		file := filepath.Base(url)
-		folder := FolderOf(url)
-		if err := MkdirIfNotExist(folder); err != nil {
-			Errorf("%v", err)
-			os.Exit(1)
+		end := to
+		if j == par-1 {
+			end = len - 1
 		}
-
-		// Padding 0 before path name as filename will be sorted as string
-		fname := fmt.Sprintf("%s.part%06d", file, j)
-		path := filepath.Join(folder, fname) // ~/.hget/download-file-name/part-name
+		path := filepath.Join(folder, partName(file, j, from, end)) // ~/.hget/download-file-name/part-name
 		ret[j] = Part{Index: j, URL: url, Path: path, RangeFrom: from, RangeTo: to}
 	}
 
-	return ret
+	return ret, nil
 }
 
 // ProxyAwareHTTPClient will use http or socks5 proxy if given one.
 func ProxyAwareHTTPClient(proxyServer string) *http.Client {
 	// setup a http client
-	httpTransport := &http.Transport{}
-	httpClient := &http.Client{Transport: httpTransport}
-	var dialer proxy.Dialer
-	dialer = proxy.Direct
+	// the transport would otherwise ask for gzip on its own, hiding the Content-Length of the file
+	httpTransport := &http.Transport{DisableCompression: true}
+	applyTimeouts(httpTransport)
+	if lowMemory {
+		httpTransport.ReadBufferSize = lowMemoryBuffer
+		httpTransport.WriteBufferSize = lowMemoryBuffer
+	}
+	httpClient := &http.Client{Transport: httpTransport, CheckRedirect: checkRedirect}
 
 	if len(proxyServer) > 0 {
-		if strings.HasPrefix(proxyServer, "http") {
-			proxyURL, err := stdurl.Parse(proxyServer)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, "invalid proxy: ", err)
-			}
-			// create a http dialer
-			dialer, err = proxy.FromURL(proxyURL, proxy.Direct)
-			if err == nil {
-				httpTransport.Dial = dialer.Dial
-			}
-		} else {
-			// create a socks5 dialer
-			dialer, err := proxy.SOCKS5("tcp", proxyServer, nil, proxy.Direct)
-			if err == nil {
-				httpTransport.Dial = dialer.Dial
-			}
+		if err := setProxy(httpTransport, proxyServer); err != nil {
+			// every request fails with the reason rather than silently going around the proxy
+			httpTransport.Proxy = func(*http.Request) (*stdurl.URL, error) { return nil, err }
 		}
-
+	} else {
+		httpTransport.DialContext = newDialer().DialContext
 	}
 	return httpClient
 }
 
+// setProxy makes `t` connect through `proxyServer`, a http://, https:// or socks5:// url, or the
+// host:port of a socks5 proxy.
+func setProxy(t *http.Transport, proxyServer string) error {
+	if !strings.Contains(proxyServer, "://") {
+		dialer, err := proxy.SOCKS5("tcp", proxyServer, nil, newDialer())
+		if err != nil {
+			return err
+		}
+		t.Dial = dialer.Dial
+		return nil
+	}
+	proxyURL, err := stdurl.Parse(proxyServer)
+	if err != nil {
+		return fmt.Errorf("invalid proxy: %v", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https":
+		t.Proxy = http.ProxyURL(proxyURL)
+		t.DialContext = newDialer().DialContext
+		return nil
+	case "socks5", "socks5h":
+		dialer, err := proxy.FromURL(proxyURL, newDialer())
+		if err != nil {
+			return err
+		}
+		t.Dial = dialer.Dial
+		return nil
+	}
+	return fmt.Errorf("proxy %s should be a http://, https:// or socks5:// url", proxyServer)
+}
+
+// client returns a http client for this download, dialing the pinned ip if there is one, the next
+// address of the host with -spread-ips, or else the cached addresses of the host.
+func (d *HTTPDownloader) client() *http.Client {
+	var c *http.Client
+	if Transport != nil {
+		c = &http.Client{Transport: Transport, CheckRedirect: checkRedirect}
+	} else {
+		c = ProxyAwareHTTPClient(d.proxy)
+		// a proxy resolves the host on its own
+		if len(d.proxy) == 0 && d.ip != "" {
+			c.Transport.(*http.Transport).DialContext = pinnedDial(d.ip)
+		} else if len(d.proxy) == 0 && spreadIPs {
+			c.Transport.(*http.Transport).DialContext = spread.DialContext
+		} else if len(d.proxy) == 0 && !noDNSCache {
+			c.Transport.(*http.Transport).DialContext = resolved.DialContext
+		}
+		if t := c.Transport.(*http.Transport); d.pinned != nil && d.pinned.IP != "" && len(d.proxy) == 0 {
+			if t.DialContext == nil {
+				t.DialContext = newDialer().DialContext
+			}
+			t.DialContext = d.pinnedDial(t.DialContext)
+		}
+	}
+	if idleTimeout > 0 {
+		c.Transport = idleTransport{timeout: idleTimeout, next: c.Transport}
+	}
+	if d.userAgent != "" {
+		c.Transport = userAgentTransport{agent: d.userAgent, next: c.Transport}
+	}
+	return c
+}
+
 // Do is where the magic happens.
 func (d *HTTPDownloader) Do(doneChan chan bool, fileChan chan string, errorChan chan error, interruptChan chan bool, stateSaveChan chan Part) {
 	var ws sync.WaitGroup
-	var bars []*pb.ProgressBar
-	var barpool *pb.Pool
-	var err error
+	var mu sync.Mutex
+	var failed []partFailure
+	var interrupted bool
 
+	var pending []Part
 	for _, p := range d.parts {
 
 		if p.RangeTo <= p.RangeFrom {
@@ -192,112 +365,469 @@ func (d *HTTPDownloader) Do(doneChan chan bool, fileChan chan string, errorChan
 				Path:      p.Path,
 				RangeFrom: p.RangeFrom,
 				RangeTo:   p.RangeTo,
+				Hash:      p.Hash,
 			}
 
 			continue
 		}
 
-		var bar *pb.ProgressBar
+		d.progress().OnPartStart(p.Index, p.RangeTo-p.RangeFrom)
+		pending = append(pending, p)
+	}
 
-		if DisplayProgressBar() {
-			bar = pb.New64(p.RangeTo - p.RangeFrom).SetUnits(pb.U_BYTES).Prefix(color.YellowString(fmt.Sprintf("%s-%d", d.file, p.Index)))
-			bars = append(bars, bar)
-		}
+	d.runs = d.newPartRuns(len(pending))
+	stopWatching := make(chan struct{})
+	go d.runs.watch(stopWatching)
 
+	slots := partSlots()
+	for _, batch := range d.batches(pending) {
 		ws.Add(1)
-		go func(d *HTTPDownloader, bar *pb.ProgressBar, part Part) {
-			client := ProxyAwareHTTPClient(d.proxy)
+		go func(d *HTTPDownloader, batch []Part) {
 			defer ws.Done()
+			if slots != nil {
+				slots <- struct{}{}
+				defer func() { <-slots }()
+			}
 
-			var ranges string
-			if part.RangeTo != d.len {
-				ranges = fmt.Sprintf("bytes=%d-%d", part.RangeFrom, part.RangeTo)
-			} else {
-				ranges = fmt.Sprintf("bytes=%d-", part.RangeFrom) //get all
+			for _, r := range d.fetchBatch(d.client(), batch, interruptChan) {
+				if r.err != nil {
+					mu.Lock()
+					failed = append(failed, partFailure{part: r.part, err: r.err})
+					mu.Unlock()
+					continue
+				}
+				if r.stopped {
+					mu.Lock()
+					interrupted = true
+					mu.Unlock()
+				}
+
+				d.finishPart(r.part, fileChan, stateSaveChan)
 			}
+		}(d, batch)
+	}
 
-			//send request
-			req, err := http.NewRequest("GET", d.url, nil)
-			if err != nil {
-				errorChan <- err
-				return
+	ws.Wait()
+	close(stopWatching)
+
+	for _, f := range failed {
+		// a part from another file, retries would mix them
+		if errors.Is(f.err, errTargetMismatch) {
+			errorChan <- f.err
+			return
+		}
+	}
+	for _, f := range failed {
+		if !errors.Is(f.err, errVersionMismatch) {
+			continue
+		}
+		if !d.pinVersion() {
+			errorChan <- f.err
+			return
+		}
+		Warnf("%v, retrying the other parts from %s\n", f.err, d.pinned.URL)
+		d.log.Logf("%v, pinning %s", f.err, d.pinned.URL)
+		break
+	}
+	if len(failed) > 0 {
+		if err := d.fallback(failed, interrupted, interruptChan, fileChan, stateSaveChan); err != nil {
+			errorChan <- err
+			return
+		}
+	}
+
+	doneChan <- true
+}
+
+// progress returns where the progress of the download is reported to.
+func (d *HTTPDownloader) progress() ProgressSink {
+	if d.sink == nil {
+		return nopSink{}
+	}
+	return d.sink
+}
+
+// partFailure is a part which could not be downloaded in parallel.
+type partFailure struct {
+	part Part
+	err  error
+}
+
+// fallback downloads the remaining ranges of the failed parts one after another over a single connection.
+func (d *HTTPDownloader) fallback(failed []partFailure, interrupted bool, interruptChan chan bool, fileChan chan string, stateSaveChan chan Part) error {
+	sort.Slice(failed, func(i, j int) bool { return failed[i].part.Index < failed[j].part.Index })
+
+	if interrupted || !d.resumable {
+		// nothing to fall back to, keep whatever was downloaded so far
+		for _, f := range failed {
+			if interrupted {
+				d.finishPart(f.part, fileChan, stateSaveChan)
 			}
+		}
+		if !interrupted {
+			return failed[0].err
+		}
+		return nil
+	}
 
-			if d.par > 1 { //support range download just in case parallel factor is over 1
-				req.Header.Add("Range", ranges)
-				if err != nil {
-					errorChan <- err
-					return
+	Warnf("%d of %d parts failed (%v), falling back to a single connection\n", len(failed), len(d.parts), failed[0].err)
+	d.log.Logf("%d of %d parts failed, falling back to a single connection", len(failed), len(d.parts))
+	var stopped bool
+	sources := d.sources()
+	source := 0
+	for i, f := range failed {
+		part := f.part
+		var err error
+		for attempt := 0; !stopped; attempt++ {
+			if attempt == fallbackRetries {
+				// the source keeps failing, the next mirror takes over
+				if source+1 == len(sources) {
+					break
 				}
+				source++
+				attempt = 0
+				Warnf("%v, continuing part %d from %s\n", err, part.Index, sources[source])
+				d.log.Logf("part %d: continuing from %s", part.Index, sources[source])
 			}
+			var current int64
+			current, stopped, err = d.fetchPartFrom(d.client(), sources[source], part, interruptChan)
+			part.RangeFrom += current
+			if err == nil {
+				break
+			}
+		}
+		if err != nil && !stopped {
+			// what the parts got is kept, the download may be resumed once the failure went away
+			d.finishPart(part, fileChan, stateSaveChan)
+			for _, f := range failed[i+1:] {
+				d.finishPart(f.part, fileChan, stateSaveChan)
+			}
+			return err
+		}
+		d.finishPart(part, fileChan, stateSaveChan)
+	}
+	return nil
+}
 
-			//write to file
-			resp, err := client.Do(req)
-			if err != nil {
-				errorChan <- err
-				return
+// finishPart reports the part file and its progress back to Execute.
+func (d *HTTPDownloader) finishPart(part Part, fileChan chan string, stateSaveChan chan Part) {
+	fileChan <- part.Path
+	stateSaveChan <- Part{
+		Index:     part.Index,
+		URL:       d.url,
+		Path:      part.Path,
+		RangeFrom: part.RangeFrom,
+		RangeTo:   part.RangeTo,
+		Hash:      d.hashOf(part),
+	}
+
+	d.progress().OnPartDone(part.Index)
+}
+
+// partWriter opens the file `part` is written to.
+func (d *HTTPDownloader) partWriter(part Part) (io.Writer, *partFile, error) {
+	var file *os.File
+	var err error
+	if d.device != "" {
+		file, err = os.OpenFile(d.device, os.O_WRONLY, 0)
+	} else {
+		file, err = os.OpenFile(part.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	f := d.bufferedFile(file)
+
+	var out io.Writer = f
+	if d.device != "" {
+		// devices get every part straight at its offset, there is nothing to join afterwards
+		out = smoothWrites(&offsetWriter{w: f, offset: part.RangeFrom}, file)
+	} else {
+		stat, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		// the bytes on the disk are hashed, encrypted ones included
+		hasher, err := d.hasherOf(part, stat.Size())
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		out = io.MultiWriter(smoothWrites(f, file), hasher)
+		if maxDownloadSize > 0 && !d.resumable {
+			// the size was not known upfront
+			out = &sizeCapWriter{w: out, size: stat.Size()}
+		}
+		if d.key != nil {
+			out = cipher.StreamWriter{S: partStream(d.key, part.Index, stat.Size()), W: out}
+		}
+	}
+
+	return io.MultiWriter(out, progressWriter{sink: d.progress(), index: part.Index}), f, nil
+}
+
+// rangeOf returns the remaining byte range of `part` as used in a Range header.
+func (d *HTTPDownloader) rangeOf(part Part) string {
+	if part.RangeTo != d.len {
+		return fmt.Sprintf("%d-%d", part.RangeFrom, part.RangeTo)
+	}
+	return fmt.Sprintf("%d-", part.RangeFrom) //get all
+}
+
+// fetchPart appends the remaining range of `part` to its file, it returns the number of bytes written
+// and whether the download was interrupted.
+func (d *HTTPDownloader) fetchPart(client *http.Client, part Part, interruptChan chan bool) (int64, bool, error) {
+	return d.fetchPartFrom(client, d.url, part, interruptChan)
+}
+
+// fetchPartFrom is fetchPart downloading from `url`, the url of the task or one of its mirrors.
+func (d *HTTPDownloader) fetchPartFrom(client *http.Client, url string, part Part, interruptChan chan bool) (int64, bool, error) {
+	var written int64
+	var stopped bool
+	var err error
+	if d.growing {
+		written, stopped, err = d.followGrowth(client, url, part, interruptChan)
+	} else {
+		written, stopped, err = d.requestPart(client, url, part, interruptChan)
+		for errors.Is(err, errPeerDamaged) {
+			// the peer was dropped, the range comes from another one or the origin
+			d.log.Logf("part %d: %v", part.Index, err)
+			written, stopped, err = d.requestPart(client, url, part, interruptChan)
+		}
+	}
+	switch {
+	case err != nil:
+		d.log.Logf("part %d: failed after %d bytes: %v", part.Index, written, err)
+	case stopped:
+		d.log.Logf("part %d: interrupted after %d bytes", part.Index, written)
+	default:
+		d.log.Logf("part %d: done after %d bytes", part.Index, written)
+	}
+	return written, stopped, err
+}
+
+// requestPart does the request of fetchPartFrom and copies its response into the part.
+func (d *HTTPDownloader) requestPart(client *http.Client, url string, part Part, interruptChan chan bool) (int64, bool, error) {
+	ranges := "bytes=" + d.rangeOf(part)
+
+	// a peer on the LAN may already have the range
+	resp := d.fromPeer(part, ranges)
+	fromPeer := resp != nil
+	if fromPeer {
+		d.log.Logf("part %d: %s from peer %s", part.Index, ranges, resp.Request.URL.Host)
+		d.progress().OnConnection(part.Index, ConnectionInfo{Source: resp.Request.URL.String(), IP: resp.Request.URL.Host})
+	}
+	for attempt := 0; resp == nil; attempt++ {
+		//send request
+		req, err := d.newRequest(url)
+		if err != nil {
+			return 0, false, err
+		}
+		if req, err = d.viaAgent(req, part); err != nil {
+			return 0, false, err
+		}
+
+		if d.par > 1 || d.growing || d.window != nil { //support range download just in case parallel factor is over 1
+			req.Header.Add("Range", ranges)
+			d.setIfRange(req, url)
+		} else if d.compressible() && part.RangeFrom == 0 {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+
+		if !backoff.Wait(req.URL.Host, interruptChan) {
+			return 0, true, nil
+		}
+
+		var remote string
+		resp, err = client.Do(traceRemote(req, &remote))
+		if err != nil && isRefused(err) {
+			if wait, first, ok := backoff.Refused(req.URL.Host); ok {
+				if first {
+					Warnf("%s refused the connection, pausing every part for %v\n", req.URL.Host, wait)
+				}
+				d.log.Logf("part %d: %v, retrying in %v", part.Index, err, wait)
+				resp = nil
+				continue
 			}
-			defer resp.Body.Close()
-			f, err := os.OpenFile(part.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		backoff.Connected(req.URL.Host)
+		d.log.Logf("part %d: %s from %s answered %s", part.Index, ranges, req.URL.Host, resp.Status)
+		d.progress().OnConnection(part.Index, ConnectionInfo{Source: resp.Request.URL.String(), IP: remote})
+
+		wait, throttled := Throttled(resp)
+		if !throttled || attempt >= throttleRetries {
+			break
+		}
+		resp.Body.Close()
+		d.log.Logf("part %d: throttled, retrying in %v", part.Index, wait)
+		if backoff.Pause(req.URL.Host, wait) {
+			Warnf("%s is throttling (%s), pausing all parts for %v\n", req.URL.Host, resp.Status, wait)
+		}
+		resp = nil
+	}
+	defer resp.Body.Close()
+
+	var written int64
+	defer func() { d.audit.Record(part, resp, responseStart(resp), written) }()
+
+	if err := checkRange(resp); err != nil {
+		return 0, false, err
+	}
+	// fromPeer already made sure a peer has the version of the origin
+	if url == d.url && !fromPeer {
+		if err := d.checkPinned(resp); err != nil {
+			return 0, false, err
+		}
+		if err := d.checkVersion(resp, part.Index); err != nil && !d.growing {
+			return 0, false, err
+		}
+	}
+	if d.rangeDone(resp, part) {
+		d.log.Logf("part %d: already complete, the file ends at %d", part.Index, d.len)
+		return 0, false, nil
+	}
+	if ((d.par > 1 || d.window != nil || d.growing && part.RangeFrom > 0) && resp.StatusCode != http.StatusPartialContent) || resp.StatusCode >= 300 {
+		return 0, false, &responseError{status: resp.Status, code: resp.StatusCode, index: part.Index}
+	}
+	if url != d.url && d.par > 1 {
+		if err := d.sameFile(resp); err != nil {
+			return 0, false, err
+		}
+	}
+
+	var reader io.Reader = resp.Body
+	// the digests are of the bytes as sent, before they are decompressed
+	digest := newBodyDigest(resp, resp.StatusCode == http.StatusOK)
+	if digest != nil {
+		reader = io.TeeReader(reader, digest)
+	}
+	if d.rate != 0 {
+		limited := shapeio.NewReader(reader)
+		limited.SetRateLimit(float64(d.rate))
+		reader = limited
+	}
+	reader, err := decodeBody(resp, reader)
+	if err != nil {
+		return 0, false, err
+	}
 
-			defer f.Close()
+	var copyPart func() (int64, error)
+	var run *partRun
+	var truncate bool
+	var partOut io.Writer
+	flush := func() error { return nil }
+	if d.upload != nil {
+		if resp.ContentLength < 0 {
+			return 0, false, fmt.Errorf("size of part %d is unknown, it can not be uploaded", part.Index)
+		}
+		reader = io.TeeReader(reader, progressWriter{sink: d.progress(), index: part.Index})
+		copyPart = func() (int64, error) {
+			n, err := d.upload.UploadPart(part.Index+1, reader, resp.ContentLength)
 			if err != nil {
-				Errorf("%v\n", err)
-				errorChan <- err
-				return
+				// a part is uploaded as a whole, a retry has to start over
+				return 0, err
 			}
-
-			var writer io.Writer
-			if DisplayProgressBar() {
-				writer = io.MultiWriter(f, bar)
-			} else {
-				writer = io.MultiWriter(f)
+			return n, nil
+		}
+	} else {
+		//write to file
+		writer, f, err := d.partWriter(part)
+		if err != nil {
+			Errorf("%v\n", err)
+			return 0, false, err
+		}
+		defer f.Close()
+		if (digest != nil || fromPeer) && d.device == "" {
+			// a corrupted response is cut off the part before it is retried
+			stat, err := f.Stat()
+			if err != nil {
+				return 0, false, err
 			}
-
-			current := int64(0)
-			finishDownloadChan := make(chan bool)
-
-			go func() {
-				var written int64
-				if d.rate != 0 {
-					reader := shapeio.NewReader(resp.Body)
-					reader.SetRateLimit(float64(d.rate))
-					written, _ = io.Copy(writer, reader)
-				} else {
-					written, _ = io.Copy(writer, resp.Body)
+			defer func(size int64) {
+				if truncate {
+					f.Truncate(size)
 				}
-				current += written
-				fileChan <- part.Path
-				finishDownloadChan <- true
-			}()
-
-			select {
-			case <-interruptChan:
-				// interrupt download by forcefully close the input stream
-				resp.Body.Close()
-				<-finishDownloadChan
-			case <-finishDownloadChan:
+			}(stat.Size())
+		}
+		if run = d.runs.start(part); run != nil {
+			defer d.runs.finish(run)
+			writer = io.MultiWriter(writer, run)
+		}
+		partOut, flush = writer, f.Flush
+		copyPart = func() (int64, error) {
+			n, err := io.CopyBuffer(writer, reader, copyBuffer())
+			// what -write-buffer holds is on the disk before the part is reported
+			if ferr := flush(); err == nil {
+				err = ferr
 			}
+			return n, err
+		}
+	}
 
-			stateSaveChan <- Part{
-				Index:     part.Index,
-				URL:       d.url,
-				Path:      part.Path,
-				RangeFrom: current + part.RangeFrom,
-				RangeTo:   part.RangeTo,
+	finishDownloadChan := make(chan bool)
+
+	go func() {
+		written, err = copyPart()
+		finishDownloadChan <- true
+	}()
+
+	// a straggler races its remaining range on a fresh connection, the first to finish wins
+	var hedged *hedgedRange
+	defer func() { hedged.Close() }()
+	hedge := run.Hedge()
+	if digest != nil || fromPeer {
+		// the digest is of this whole response, a range hedged on another one could not be checked,
+		// nor could the range of a peer
+		hedge = nil
+	}
+	for {
+		select {
+		case <-interruptChan:
+			// interrupt download by forcefully close the input stream
+			resp.Body.Close()
+			<-finishDownloadChan
+			return written, true, nil
+		case <-hedge:
+			hedge = nil
+			hedged = d.hedge(url, part, part.RangeFrom+atomic.LoadInt64(&run.written))
+		case <-hedged.Done():
+			if hedged.err != nil {
+				d.log.Logf("part %d: second request failed: %v", part.Index, hedged.err)
+				hedged.Close()
+				hedged = nil
+				continue
 			}
-
-			if DisplayProgressBar() {
-				bar.Update()
-				bar.Finish()
+			resp.Body.Close()
+			<-finishDownloadChan
+			n, err := hedged.copyTo(partOut, part.RangeFrom+written)
+			if ferr := flush(); err == nil {
+				err = ferr
+			}
+			written += n
+			d.log.Logf("part %d: the second request finished first", part.Index)
+			return written, false, err
+		case <-finishDownloadChan:
+			if err == nil && fromPeer {
+				if err = d.checkPeerRange(part, written); err != nil {
+					d.dropPeer(resp.Request.URL.Host)
+					truncate = true
+					return 0, false, err
+				}
+			}
+			if err == nil && digest != nil {
+				// trailers are only read at the very end of the body, which a decompressor may stop short of
+				io.Copy(digest, resp.Body)
+				if err = digest.verify(); err != nil {
+					d.log.Logf("part %d: %v", part.Index, err)
+					truncate = true
+					return 0, false, err
+				}
 			}
-		}(d, bar, p)
+			return written, false, err
+		}
 	}
-
-	barpool, err = pb.StartPool(bars...)
-	FatalCheck(err)
-
-	ws.Wait()
-	doneChan <- true
-	barpool.Stop()
 }
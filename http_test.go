@@ -1,15 +1,21 @@
-package main
+package hget
 
 import (
-	"os/user"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestPartCalculate(t *testing.T) {
 	displayProgress = false
 
-	parts := partCalculate(int64(10), 100, "http://foo.bar/file")
+	parts, _ := partCalculate(int64(10), 100, "http://foo.bar/file")
 	if len(parts) != 10 {
 		t.Fatalf("parts length should be 10")
 	}
@@ -18,8 +24,7 @@ func TestPartCalculate(t *testing.T) {
 		t.Fatalf("part url was wrong")
 	}
 
-	usr, _ := user.Current()
-	dir := filepath.Join(usr.HomeDir, dataFolder, "file/file.part000001")
+	dir := filepath.Join(dataDir(), "file/file.part000001.10-19")
 	if parts[1].Path != dir {
 		t.Fatalf("part path was wrong")
 	}
@@ -32,3 +37,169 @@ func TestPartCalculate(t *testing.T) {
 		t.Fatal("part index was wrong")
 	}
 }
+
+func TestFallbackToSingleConnection(t *testing.T) {
+	displayProgress = false
+
+	content := strings.Repeat("0123456789", 100)
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// every range but the first one fails on its first attempt
+		mu.Lock()
+		attempts[r.Header.Get("Range")]++
+		flaky := attempts[r.Header.Get("Range")] == 1 && !strings.HasPrefix(r.Header.Get("Range"), "bytes=0-")
+		mu.Unlock()
+		if flaky {
+			http.Error(w, "slow down", http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "fallback.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	url := srv.URL + "/fallback.bin"
+	defer os.RemoveAll(FolderOf(url))
+	d := NewHTTPDownloader(url, 4, true, "", "")
+
+	doneChan := make(chan bool, 1)
+	fileChan := make(chan string, 4)
+	errorChan := make(chan error, 1)
+	stateChan := make(chan Part, 4)
+	interruptChan := make(chan bool, 4)
+
+	go d.Do(doneChan, fileChan, errorChan, interruptChan, stateChan)
+
+	var files []string
+	for {
+		select {
+		case f := <-fileChan:
+			files = append(files, f)
+		case <-stateChan:
+		case err := <-errorChan:
+			t.Fatalf("download should fall back instead of failing: %v", err)
+		case <-doneChan:
+			for len(fileChan) > 0 {
+				files = append(files, <-fileChan)
+			}
+			out := filepath.Join(t.TempDir(), "fallback.bin")
+			if err := JoinFile(files, out, nil, nil); err != nil {
+				t.Fatalf("err should be nil, got %v", err)
+			}
+			joined, _ := ioutil.ReadFile(out)
+			if string(joined) != content {
+				t.Fatalf("joined content is different from the original")
+			}
+			return
+		}
+	}
+}
+
+type recordingTransport struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	r.urls = append(r.urls, req.URL.String())
+	r.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestCustomTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	recorder := &recordingTransport{}
+	Transport = recorder
+	defer func() { Transport = nil }()
+
+	d := &HTTPDownloader{url: srv.URL + "/file"}
+	req, _ := d.newRequest(d.url)
+	resp, err := d.client().Do(req)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	resp.Body.Close()
+	if len(recorder.urls) != 1 || recorder.urls[0] != d.url {
+		t.Fatalf("request should go through the custom transport, got %v", recorder.urls)
+	}
+}
+
+func TestBatchedRanges(t *testing.T) {
+	displayProgress = false
+	batchRanges = 4
+	defer func() { batchRanges = 1 }()
+
+	content := strings.Repeat("0123456789", 100)
+	var mu sync.Mutex
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if r.Header.Get("Range") != "" {
+			requests++
+		}
+		mu.Unlock()
+		http.ServeContent(w, r, "batch.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	url := srv.URL + "/batch.bin"
+	defer os.RemoveAll(FolderOf(url))
+	d := NewHTTPDownloader(url, 8, true, "", "")
+
+	doneChan := make(chan bool, 1)
+	fileChan := make(chan string, 8)
+	errorChan := make(chan error, 1)
+	stateChan := make(chan Part, 8)
+	interruptChan := make(chan bool, 8)
+
+	go d.Do(doneChan, fileChan, errorChan, interruptChan, stateChan)
+
+	var files []string
+	for {
+		select {
+		case f := <-fileChan:
+			files = append(files, f)
+		case <-stateChan:
+		case err := <-errorChan:
+			t.Fatalf("err should be nil, got %v", err)
+		case <-doneChan:
+			for len(fileChan) > 0 {
+				files = append(files, <-fileChan)
+			}
+			if requests != 2 {
+				t.Fatalf("8 parts in batches of 4 should take 2 requests, took %d", requests)
+			}
+			out := filepath.Join(t.TempDir(), "batch.bin")
+			if err := JoinFile(files, out, nil, nil); err != nil {
+				t.Fatalf("err should be nil, got %v", err)
+			}
+			joined, _ := ioutil.ReadFile(out)
+			if string(joined) != content {
+				t.Fatalf("joined content is different from the original")
+			}
+			return
+		}
+	}
+}
+
+func TestRouteMergedRanges(t *testing.T) {
+	var first, second strings.Builder
+	targets := []*batchTarget{
+		{part: Part{Index: 0, RangeFrom: 0}, end: 4, w: &first},
+		{part: Part{Index: 1, RangeFrom: 5}, end: 9, w: &second},
+	}
+	// a server may merge neighbouring ranges into one
+	if err := routeRange(0, strings.NewReader("0123456789"), targets); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if first.String() != "01234" || second.String() != "56789" {
+		t.Fatalf("merged range should be split between parts, got %q and %q", first.String(), second.String())
+	}
+
+	if err := routeRange(20, strings.NewReader("x"), targets); err == nil {
+		t.Fatalf("range which was not requested should fail")
+	}
+}
@@ -0,0 +1,163 @@
+package hget
+
+import (
+	"fmt"
+	"net/http"
+	stdurl "net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// huggingfaceHub is where the hf: shorthand looks up repositories
+var huggingfaceHub = "https://huggingface.co"
+
+// commitPattern and sha256Pattern match the commit of a revision and the sha256 of an LFS file
+var (
+	commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// huggingfaceFile is a file of a model, dataset or space of the Hugging Face hub, its path segments
+// escaped as in urls.
+type huggingfaceFile struct {
+	hub string
+	// repo is OWNER/NAME for a model, datasets/OWNER/NAME or spaces/OWNER/NAME otherwise
+	repo     string
+	revision string
+	path     string
+}
+
+// url returns the url the hub serves the file at, redirecting to its CDN.
+func (f huggingfaceFile) url() string {
+	return f.hub + "/" + f.repo + "/resolve/" + f.revision + "/" + f.path
+}
+
+// huggingfaceToken returns the Authorization of the hub, the one of -header or HF_TOKEN.
+func huggingfaceToken(header http.Header) string {
+	if auth := header.Get("Authorization"); auth != "" {
+		return auth
+	}
+	for _, name := range []string{"HF_TOKEN", "HUGGING_FACE_HUB_TOKEN"} {
+		if token := os.Getenv(name); token != "" {
+			return "Bearer " + token
+		}
+	}
+	return ""
+}
+
+// parseHuggingFaceURL parses the url of a file on the hub, as shown on its page (blob), as its
+// text or LFS pointer (raw) or as downloaded (resolve).
+func parseHuggingFaceURL(url string) (huggingfaceFile, bool) {
+	parsed, err := stdurl.Parse(url)
+	if err != nil {
+		return huggingfaceFile{}, false
+	}
+	fields := strings.Split(strings.Trim(parsed.EscapedPath(), "/"), "/")
+	name := 0
+	if len(fields) > 0 && (fields[0] == "datasets" || fields[0] == "spaces") {
+		name = 1
+	}
+	// the NAME of OWNER/NAME, or of the few old models without an owner such as gpt2
+	for _, last := range []int{name + 1, name} {
+		if len(fields) < last+4 {
+			continue
+		}
+		switch fields[last+1] {
+		case "blob", "raw", "resolve":
+			return huggingfaceFile{
+				hub:      parsed.Scheme + "://" + parsed.Host,
+				repo:     strings.Join(fields[:last+1], "/"),
+				revision: fields[last+2],
+				path:     strings.Join(fields[last+3:], "/"),
+			}, true
+		}
+	}
+	return huggingfaceFile{}, false
+}
+
+// parseHuggingFaceShorthand parses hf:REPO@REVISION:PATH, the revision is main when left out.
+func parseHuggingFaceShorthand(shorthand string) (huggingfaceFile, error) {
+	rest := strings.TrimPrefix(shorthand, "hf:")
+	colon := strings.IndexByte(rest, ':')
+	if colon < 0 {
+		return huggingfaceFile{}, fmt.Errorf("%s should name a file as REPO@REVISION:PATH", shorthand)
+	}
+	f := huggingfaceFile{hub: huggingfaceHub, repo: rest[:colon], revision: "main", path: rest[colon+1:]}
+	if at := strings.LastIndexByte(f.repo, '@'); at >= 0 {
+		f.repo, f.revision = f.repo[:at], f.repo[at+1:]
+	}
+	segments := strings.Split(f.repo, "/")
+	model := len(segments) <= 2
+	other := len(segments) == 3 && (segments[0] == "datasets" || segments[0] == "spaces")
+	if !model && !other || strings.Contains("/"+f.repo+"/", "//") || f.revision == "" || strings.Trim(f.path, "/") == "" {
+		return huggingfaceFile{}, fmt.Errorf("%s should name a file as REPO@REVISION:PATH", shorthand)
+	}
+	f.revision = stdurl.PathEscape(f.revision)
+	var escaped []string
+	for _, segment := range strings.Split(strings.Trim(f.path, "/"), "/") {
+		escaped = append(escaped, stdurl.PathEscape(segment))
+	}
+	f.path = strings.Join(escaped, "/")
+	return f, nil
+}
+
+// resolveHuggingFaceURL resolves the url of a file on the hub, see pinHuggingFace.
+func resolveHuggingFaceURL(r *Resolution) error {
+	f, ok := parseHuggingFaceURL(r.URL)
+	if !ok {
+		return nil
+	}
+	return pinHuggingFace(r, f)
+}
+
+// resolveHuggingFace resolves the hf: shorthand of a file on the hub, see pinHuggingFace.
+func resolveHuggingFace(r *Resolution) error {
+	f, err := parseHuggingFaceShorthand(r.URL)
+	if err != nil {
+		return err
+	}
+	return pinHuggingFace(r, f)
+}
+
+// pinHuggingFace points the download at the file `f` as downloaded rather than its page or LFS
+// pointer, at the commit its revision is now so that resuming after a push does not mix two
+// versions, and verifies it with the sha256 of LFS files. The token is sent to the hub, and dropped
+// by the redirect to the signed url of its CDN.
+func pinHuggingFace(r *Resolution, f huggingfaceFile) error {
+	req, err := http.NewRequest("HEAD", f.url(), nil)
+	if err != nil {
+		return err
+	}
+	auth := huggingfaceToken(r.Header)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	// the headers of the hub, not those of the CDN it redirects to
+	client := *resolverClient
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%s is private or gated (%s), set HF_TOKEN to a token of an account allowed to read it", f.repo, resp.Status)
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("could not look up %s on %s: %s", f.path, f.repo, resp.Status)
+	}
+
+	if commit := resp.Header.Get("X-Repo-Commit"); commitPattern.MatchString(commit) && commit != f.revision {
+		Printf("Revision %s of %s is %s\n", f.revision, f.repo, commit)
+		f.revision = commit
+	}
+	r.URL = f.url()
+	if auth != "" {
+		r.Header.Set("Authorization", auth)
+	}
+	if etag := strings.Trim(strings.TrimPrefix(resp.Header.Get("X-Linked-Etag"), "W/"), `"`); sha256Pattern.MatchString(etag) && r.Checksum == "" {
+		r.Checksum = "sha256:" + etag
+	}
+	return nil
+}
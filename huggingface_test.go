@@ -0,0 +1,109 @@
+package hget
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHuggingFace(t *testing.T) {
+	for _, c := range []struct {
+		url  string
+		want string
+	}{
+		{"https://huggingface.co/gpt2/resolve/main/model.safetensors", "https://huggingface.co/gpt2/resolve/main/model.safetensors"},
+		{"https://huggingface.co/openai/whisper/blob/main/onnx/model.onnx", "https://huggingface.co/openai/whisper/resolve/main/onnx/model.onnx"},
+		{"https://hf.co/datasets/owner/set/raw/refs%2Fpr%2F1/data/train.parquet", "https://hf.co/datasets/owner/set/resolve/refs%2Fpr%2F1/data/train.parquet"},
+	} {
+		f, ok := parseHuggingFaceURL(c.url)
+		if !ok || f.url() != c.want {
+			t.Fatalf("%s parsed as %s, %v", c.url, f.url(), ok)
+		}
+	}
+	for _, url := range []string{"https://huggingface.co/gpt2", "https://huggingface.co/gpt2/tree/main/onnx", "https://huggingface.co/datasets/owner/set/blob/main"} {
+		if _, ok := parseHuggingFaceURL(url); ok {
+			t.Fatalf("%s should not be a file", url)
+		}
+	}
+
+	for _, c := range []struct {
+		shorthand string
+		want      string
+	}{
+		{"hf:owner/model:model.safetensors", "/owner/model/resolve/main/model.safetensors"},
+		{"hf:gpt2:model.safetensors", "/gpt2/resolve/main/model.safetensors"},
+		{"hf:datasets/owner/set@refs/pr/1:data/train 1.parquet", "/datasets/owner/set/resolve/refs%2Fpr%2F1/data/train%201.parquet"},
+	} {
+		f, err := parseHuggingFaceShorthand(c.shorthand)
+		if err != nil || f.url() != huggingfaceHub+c.want {
+			t.Fatalf("%s parsed as %s, %v", c.shorthand, f.url(), err)
+		}
+	}
+	for _, shorthand := range []string{"hf:models/owner/model:file", "hf:owner/model", "hf:owner/model@:file", "hf:owner/:file", "hf:owner/model:/"} {
+		if _, err := parseHuggingFaceShorthand(shorthand); err == nil {
+			t.Fatalf("%s should not parse", shorthand)
+		}
+	}
+}
+
+func TestDownloadHuggingFace(t *testing.T) {
+	displayProgress = false
+	defer func(data, hub string) { dataPath, output, huggingfaceHub = data, "", hub }(dataPath, huggingfaceHub)
+	dataPath = t.TempDir()
+	os.Setenv("HF_TOKEN", "hf_secret")
+	defer os.Unsetenv("HF_TOKEN")
+	content := strings.Repeat("0123456789", 1000)
+	sum := sha256.Sum256([]byte(content))
+	commit := strings.Repeat("c0ffee", 6) + "c0ff"
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("the token should not be sent to the CDN")
+		}
+		http.ServeContent(w, r, "model.safetensors", time.Time{}, strings.NewReader(content))
+	}))
+	defer cdn.Close()
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer hf_secret" {
+			http.Error(w, "gated", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/owner/model/resolve/main/model.safetensors", "/owner/model/resolve/" + commit + "/model.safetensors":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Repo-Commit", commit)
+		w.Header().Set("X-Linked-Etag", `"`+hex.EncodeToString(sum[:])+`"`)
+		http.Redirect(w, r, cdn.URL+"/signed/model.safetensors?expires=1", http.StatusFound)
+	}))
+	defer hub.Close()
+	huggingfaceHub = hub.URL
+	output = filepath.Join(t.TempDir(), "model.safetensors")
+
+	r, err := ResolveURL("hf:owner/model:model.safetensors")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if r.URL != hub.URL+"/owner/model/resolve/"+commit+"/model.safetensors" || r.Checksum != "sha256:"+hex.EncodeToString(sum[:]) {
+		t.Fatalf("resolved to %s verified with %q", r.URL, r.Checksum)
+	}
+	if err := Download("hf:owner/model:model.safetensors"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(output); string(got) != content {
+		t.Fatalf("unexpected content %q", got)
+	}
+
+	os.Unsetenv("HF_TOKEN")
+	if _, err := ResolveURL("hf:owner/model:model.safetensors"); err == nil || !strings.Contains(err.Error(), "HF_TOKEN") {
+		t.Fatalf("a gated model should ask for a token, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package hget
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// acceptsRanges tells whether the server announced byte ranges. Other units, or `none`, can not be
+// used to split the file.
+func acceptsRanges(resp *http.Response) bool {
+	for _, value := range resp.Header.Values(acceptRangeHeader) {
+		for _, unit := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validatorOf returns what If-Range can send to make sure ranges come from the same file, the ETag
+// when it is strong and the Last-Modified date otherwise.
+func validatorOf(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// setIfRange asks for the range of `req` to `url` only if the file is still the same. The validator
+// belongs to the url of the task, mirrors have their own.
+func (d *HTTPDownloader) setIfRange(req *http.Request, url string) {
+	if d.validator != "" && url == d.url && req.Header.Get("Range") != "" {
+		req.Header.Set("If-Range", d.validator)
+	}
+}
+
+// checkRange makes sure `resp` is a range of the same file, in bytes.
+func checkRange(resp *http.Response) error {
+	if resp.Request != nil && resp.Request.Header.Get("If-Range") != "" && resp.StatusCode == http.StatusOK {
+		return ErrRemoteChanged
+	}
+	// multipart responses have a Content-Range per part
+	contentRange := resp.Header.Get("Content-Range")
+	if resp.StatusCode == http.StatusPartialContent && contentRange != "" && !strings.HasPrefix(contentRange, "bytes ") {
+		return fmt.Errorf("unsupported Content-Range %q, only bytes are supported", contentRange)
+	}
+	return nil
+}
+
+// rangeDone tells whether `resp` refusing the range of `part` with 416 only means nothing is left of it:
+// the part already starts at the end of the file, as a retried part which got its last byte does. The
+// file has to still be as long as when the download started, the server tells its length in Content-Range.
+func (d *HTTPDownloader) rangeDone(resp *http.Response, part Part) bool {
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable || d.len <= 0 {
+		return false
+	}
+	if d.growing {
+		// nothing new yet
+		return true
+	}
+	total := d.len
+	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+		if _, err := fmt.Sscanf(contentRange, "bytes */%d", &total); err != nil {
+			return false
+		}
+	}
+	return total == d.len && part.RangeFrom >= total
+}
+
+// fetchRange requests the bytes of the file from `from` to `to`, excluded, outside of any part.
+func (d *HTTPDownloader) fetchRange(from int64, to int64) (io.ReadCloser, error) {
+	req, err := d.newRequest(d.url)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to-1))
+	resp, err := d.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if start, err := rangeStart(resp.Header.Get("Content-Range")); resp.StatusCode != http.StatusPartialContent || err != nil || start != from {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response %q for bytes %d-%d", resp.Status, from, to-1)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,186 @@
+package hget
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAcceptsRanges(t *testing.T) {
+	cases := map[string]bool{
+		"":             false,
+		"none":         false,
+		"items":        false,
+		"bytes":        true,
+		"items, BYTES": true,
+	}
+	for value, expected := range cases {
+		resp := &http.Response{Header: http.Header{}}
+		if value != "" {
+			resp.Header.Set(acceptRangeHeader, value)
+		}
+		if acceptsRanges(resp) != expected {
+			t.Fatalf("Accept-Ranges %q: expected %v", value, expected)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{"Etag": {`W/"weak"`}, "Last-Modified": {"Wed, 21 Oct 2015 07:28:00 GMT"}}}
+	if v := validatorOf(resp); v != "Wed, 21 Oct 2015 07:28:00 GMT" {
+		t.Fatalf("weak etags can not be used with If-Range, got %q", v)
+	}
+	resp.Header.Set("ETag", `"strong"`)
+	if v := validatorOf(resp); v != `"strong"` {
+		t.Fatalf("expected the strong etag, got %q", v)
+	}
+
+	partial := &http.Response{StatusCode: http.StatusPartialContent, Header: http.Header{"Content-Range": {"items 0-1/2"}}}
+	if err := checkRange(partial); err == nil {
+		t.Fatalf("ranges in other units than bytes should be refused")
+	}
+}
+
+func TestIfRange(t *testing.T) {
+	displayProgress = false
+	defer func(old changeMode) { onChange = old }(onChange)
+	version := `"v1"`
+	content := strings.Repeat("0123456789", 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", version)
+		http.ServeContent(w, r, "ifrange.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	url := server.URL + "/ifrange.bin"
+	defer os.RemoveAll(FolderOf(url))
+	d := NewHTTPDownloader(url, 2, true, "", "")
+	if d.validator != `"v1"` {
+		t.Fatalf("the etag should be kept, got %q", d.validator)
+	}
+	if _, _, err := d.fetchPart(d.client(), d.parts[0], make(chan bool)); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+
+	// replaced by a file of the same size
+	version = `"v2"`
+	if _, _, err := d.fetchPart(d.client(), d.parts[1], make(chan bool)); err != ErrRemoteChanged {
+		t.Fatalf("expected %v, got %v", ErrRemoteChanged, err)
+	}
+	onChange = changeTruncate
+	if err := d.followChange(); err == nil || !strings.Contains(err.Error(), "replaced") {
+		t.Fatalf("keeping the bytes of a replaced file should be refused, got %v", err)
+	}
+	onChange = changeRestart
+	if err := d.followChange(); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if d.validator != `"v2"` || d.parts[0].RangeFrom != 0 {
+		t.Fatalf("the task should start over with the new file, got %q %+v", d.validator, d.parts)
+	}
+}
+
+func TestRangeDone(t *testing.T) {
+	displayProgress = false
+	content := strings.Repeat("0123456789", 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "done.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	url := server.URL + "/done.bin"
+	defer os.RemoveAll(FolderOf(url))
+	d := NewHTTPDownloader(url, 2, true, "", "")
+
+	// retried after its last byte, the server has nothing left to send
+	last := d.parts[1]
+	last.RangeFrom = last.RangeTo
+	written, _, err := d.fetchPart(d.client(), last, make(chan bool))
+	if err != nil || written != 0 {
+		t.Fatalf("a part at the end of the file should be complete, got %d %v", written, err)
+	}
+
+	// nearly complete, the last byte is still fetched
+	last.RangeFrom = last.RangeTo - 1
+	if written, _, err = d.fetchPart(d.client(), last, make(chan bool)); err != nil || written != 1 {
+		t.Fatalf("the last byte should be fetched, got %d %v", written, err)
+	}
+
+	// the file got shorter, the part is not complete but lost
+	content = content[:90]
+	last.RangeFrom = last.RangeTo
+	if _, _, err = d.fetchPart(d.client(), last, make(chan bool)); err == nil || !strings.Contains(err.Error(), "416") {
+		t.Fatalf("a 416 for a shorter file should fail, got %v", err)
+	}
+
+	resp := &http.Response{StatusCode: http.StatusRequestedRangeNotSatisfiable, Header: http.Header{"Content-Range": {"bytes */100"}}}
+	if !d.rangeDone(resp, Part{RangeFrom: 100, RangeTo: 100}) || d.rangeDone(resp, Part{RangeFrom: 99, RangeTo: 100}) {
+		t.Fatalf("only a part starting at the end of the file is complete")
+	}
+	resp.Header.Set("Content-Range", "bytes 0-9/100")
+	if d.rangeDone(resp, Part{RangeFrom: 100, RangeTo: 100}) {
+		t.Fatalf("a malformed Content-Range should not be trusted")
+	}
+}
+
+func TestResumeNearlyComplete(t *testing.T) {
+	displayProgress = false
+	content := strings.Repeat("0123456789", 100)
+	var mu sync.Mutex
+	var cut bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		first := r.Header.Get("Range") == "bytes=500-" && !cut
+		cut = cut || first
+		mu.Unlock()
+		if first {
+			// the whole rest of the file, then the connection drops before the response ends
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 500-999/%d", len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte(content[500:]))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "nearly.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	url := server.URL + "/nearly.bin"
+	defer os.RemoveAll(FolderOf(url))
+	d := NewHTTPDownloader(url, 2, true, "", "")
+
+	doneChan := make(chan bool, 1)
+	fileChan := make(chan string, 2)
+	errorChan := make(chan error, 1)
+	stateChan := make(chan Part, 2)
+	interruptChan := make(chan bool, 2)
+	go d.Do(doneChan, fileChan, errorChan, interruptChan, stateChan)
+
+	var files []string
+	for {
+		select {
+		case f := <-fileChan:
+			files = append(files, f)
+		case <-stateChan:
+		case err := <-errorChan:
+			t.Fatalf("the retried part has nothing left and should be complete, got %v", err)
+		case <-doneChan:
+			for len(fileChan) > 0 {
+				files = append(files, <-fileChan)
+			}
+			out := filepath.Join(t.TempDir(), "nearly.bin")
+			if err := JoinFile(files, out, nil, nil); err != nil {
+				t.Fatalf("err should be nil, got %v", err)
+			}
+			if joined, _ := ioutil.ReadFile(out); string(joined) != content || !cut {
+				t.Fatalf("joined content is different from the original")
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package hget
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// ioPriority is how much of the disk hget takes when other programs need it too.
+type ioPriority string
+
+const (
+	ioNormal ioPriority = "normal"
+	ioLow    ioPriority = "low"
+	ioIdle   ioPriority = "idle"
+)
+
+var ioPriorityLevel = ioNormal
+
+// ioSyncEvery is how many bytes are written between two flushes to the disk with a low io priority,
+// so that the page cache does not build up into bursts of writes
+var ioSyncEvery int64 = 4 << 20
+
+func (p *ioPriority) String() string {
+	return string(*p)
+}
+
+func (p *ioPriority) Set(value string) error {
+	switch priority := ioPriority(value); priority {
+	case ioNormal, ioLow, ioIdle:
+		*p = priority
+		return nil
+	}
+	return fmt.Errorf("io priority should be normal, low or idle, got %q", value)
+}
+
+// applyIOPriority lowers the io priority of hget as asked by -io-priority.
+func applyIOPriority() error {
+	if ioPriorityLevel == ioNormal {
+		return nil
+	}
+	return setIOPriority(ioPriorityLevel)
+}
+
+// smoothWrites flushes what is written through `w` into `f` to the disk every ioSyncEvery bytes
+// with a low io priority, and returns `w` as it is otherwise.
+func smoothWrites(w io.Writer, f *os.File) io.Writer {
+	if ioPriorityLevel == ioNormal {
+		return w
+	}
+	return &syncWriter{w: w, f: f}
+}
+
+type syncWriter struct {
+	w       io.Writer
+	f       *os.File
+	pending int64
+}
+
+func (s *syncWriter) Write(b []byte) (int, error) {
+	n, err := s.w.Write(b)
+	s.pending += int64(n)
+	if err == nil && s.pending >= ioSyncEvery {
+		s.pending = 0
+		err = s.f.Sync()
+	}
+	return n, err
+}
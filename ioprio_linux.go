@@ -0,0 +1,43 @@
+//go:build linux
+// +build linux
+
+package hget
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"syscall"
+)
+
+// ioprio_set classes and target, from linux/ioprio.h
+const (
+	ioprioClassBE     = 2
+	ioprioClassIdle   = 3
+	ioprioClassShift  = 13
+	ioprioWhoProcess  = 1
+	ioprioLowestLevel = 7
+)
+
+// setIOPriority applies `priority` to every thread of hget, the io priority being per thread on
+// linux. Threads started later inherit it from the thread starting them.
+func setIOPriority(priority ioPriority) error {
+	value := ioprioClassBE<<ioprioClassShift | ioprioLowestLevel
+	if priority == ioIdle {
+		value = ioprioClassIdle << ioprioClassShift
+	}
+	tasks, err := ioutil.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(value)); errno != 0 && errno != syscall.ESRCH {
+			return fmt.Errorf("could not set the io priority: %v", errno)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package hget
+
+import "errors"
+
+// setIOPriority is only implemented with ioprio_set on linux so far.
+func setIOPriority(priority ioPriority) error {
+	return errors.New("-io-priority only lowers the io priority on linux, writes are still flushed in small steps")
+}
@@ -0,0 +1,48 @@
+package hget
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestIOPrioritySet(t *testing.T) {
+	var p ioPriority
+	for _, value := range []string{"normal", "low", "idle"} {
+		if err := p.Set(value); err != nil || p.String() != value {
+			t.Fatalf("Set(%q) = %v, got %q", value, err, p.String())
+		}
+	}
+	if err := p.Set("high"); err == nil {
+		t.Fatalf("high should not be an io priority")
+	}
+}
+
+func TestSmoothWrites(t *testing.T) {
+	f, err := ioutil.TempFile(t.TempDir(), "smooth")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer f.Close()
+
+	defer func(level ioPriority, every int64) { ioPriorityLevel, ioSyncEvery = level, every }(ioPriorityLevel, ioSyncEvery)
+	ioPriorityLevel = ioNormal
+	if w := smoothWrites(f, f); w != f {
+		t.Fatalf("writes should not be flushed with a normal io priority")
+	}
+
+	ioPriorityLevel, ioSyncEvery = ioLow, 10
+	w := smoothWrites(f, f)
+	for i := 0; i < 5; i++ {
+		if _, err := w.Write([]byte("1234")); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if pending := w.(*syncWriter).pending; pending != 8 {
+		t.Fatalf("expected 8 bytes waiting for a flush, got %d", pending)
+	}
+	got, err := ioutil.ReadFile(f.Name())
+	if err != nil || !bytes.Equal(got, bytes.Repeat([]byte("1234"), 5)) {
+		t.Fatalf("unexpected content %q, %v", got, err)
+	}
+}
@@ -0,0 +1,102 @@
+package hget
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ipfsGateways = "https://ipfs.io,https://dweb.link,https://cloudflare-ipfs.com"
+
+// IsIPFS checks if `url` is an ipfs://CID url.
+func IsIPFS(url string) bool {
+	return strings.HasPrefix(url, "ipfs://")
+}
+
+// resolveIPFS resolves an ipfs://CID url to the fastest gateway, verified with the checksum of the CID.
+func resolveIPFS(r *Resolution) error {
+	url, sum, err := ResolveIPFS(r.URL)
+	if err != nil {
+		return err
+	}
+	r.URL = url
+	if sum != "" {
+		r.Checksum = sum
+	}
+	return nil
+}
+
+// ResolveIPFS races the configured gateways for `url` and returns the address on the fastest one,
+// together with the sha256 checksum of the content when the CID allows verifying it.
+func ResolveIPFS(url string) (string, string, error) {
+	path := strings.TrimPrefix(url, "ipfs://")
+	cid := strings.SplitN(path, "/", 2)[0]
+	if cid == "" {
+		return "", "", fmt.Errorf("no CID in %s", url)
+	}
+
+	type result struct {
+		url string
+		err error
+	}
+	gateways := strings.Split(ipfsGateways, ",")
+	results := make(chan result, len(gateways))
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, gw := range gateways {
+		go func(candidate string) {
+			resp, err := client.Head(candidate)
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					err = errors.New(resp.Status)
+				}
+			}
+			results <- result{url: candidate, err: err}
+		}(strings.TrimSuffix(strings.TrimSpace(gw), "/") + "/ipfs/" + path)
+	}
+
+	var err error
+	for range gateways {
+		r := <-results
+		if r.err == nil {
+			Printf("Fastest ipfs gateway: %s\n", r.url)
+			return r.url, rawCIDChecksum(cid, path), nil
+		}
+		err = r.err
+	}
+	return "", "", fmt.Errorf("no gateway could serve %s: %v", url, err)
+}
+
+// rawCIDChecksum returns the sha256 checksum of a CIDv1 of raw content, which is the hash of the file itself.
+// Other CIDs address a DAG of chunks whose hash can not be compared to the downloaded bytes.
+func rawCIDChecksum(cid string, path string) string {
+	if path != cid || !strings.HasPrefix(cid, "b") {
+		Warnf("%s can not be verified against its CID, only raw CIDv1 content can\n", cid)
+		return ""
+	}
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(cid[1:]))
+	if err != nil {
+		return ""
+	}
+
+	var fields []uint64
+	for i := 0; i < 4; i++ {
+		v, n := binary.Uvarint(raw)
+		if n <= 0 {
+			return ""
+		}
+		fields = append(fields, v)
+		raw = raw[n:]
+	}
+	// version 1, raw codec, sha2-256 multihash of 32 bytes
+	if fields[0] != 1 || fields[1] != 0x55 || fields[2] != 0x12 || fields[3] != 32 || len(raw) != 32 {
+		Warnf("%s can not be verified against its CID, only raw CIDv1 content can\n", cid)
+		return ""
+	}
+	return "sha256:" + hex.EncodeToString(raw)
+}
@@ -0,0 +1,43 @@
+package hget
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRawCIDChecksum(t *testing.T) {
+	digest := sha256.Sum256([]byte("hello world"))
+	raw := append([]byte{0x01, 0x55, 0x12, 0x20}, digest[:]...)
+	cid := "b" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))
+
+	if sum := rawCIDChecksum(cid, cid); sum != "sha256:"+hex.EncodeToString(digest[:]) {
+		t.Fatalf("checksum of raw cid was wrong: %s", sum)
+	}
+	if sum := rawCIDChecksum("QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o", "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"); sum != "" {
+		t.Fatalf("CIDv0 can not be verified, got %s", sum)
+	}
+	if sum := rawCIDChecksum(cid, cid+"/file"); sum != "" {
+		t.Fatalf("paths inside a CID can not be verified, got %s", sum)
+	}
+}
+
+func TestResolveIPFS(t *testing.T) {
+	bad := httptest.NewServer(http.NotFoundHandler())
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer good.Close()
+
+	ipfsGateways = bad.URL + "," + good.URL + "/"
+	url, _, err := ResolveIPFS("ipfs://QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o/file.txt")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if url != good.URL+"/ipfs/QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o/file.txt" {
+		t.Fatalf("gateway url was wrong: %s", url)
+	}
+}
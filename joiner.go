@@ -1,41 +1,55 @@
-package main
+package hget
 
 import (
-	"github.com/fatih/color"
-	"gopkg.in/cheggaaa/pb.v1"
+	"crypto/cipher"
+	"hash"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
 )
 
-// JoinFile joins seperate chunks of file and forms the final downloaded artifact
-func JoinFile(files []string, out string) error {
+// JoinFile joins seperate chunks of file and forms the final downloaded artifact,
+// parts of an encrypted download are decrypted with `key` on the way.
+func JoinFile(files []string, out string, key []byte, sink ProgressSink) error {
+	return joinHashing(files, out, key, sink, nil)
+}
+
+// joinHashing joins as JoinFile does, writing what is joined to `digest` as well unless it is nil.
+func joinHashing(files []string, out string, key []byte, sink ProgressSink, digest hash.Hash) (err error) {
 	//sort with file name or we will join files with wrong order
 	sort.Strings(files)
-	var bar *pb.ProgressBar
-
-	if DisplayProgressBar() {
-		Printf("Start joining \n")
-		bar = pb.StartNew(len(files)).Prefix(color.CyanString("Joining"))
+	// then by the index of parts, whose names may hold their range or not
+	sort.SliceStable(files, func(i, j int) bool { return partIndex(files[i]) < partIndex(files[j]) })
+	if sink == nil {
+		sink = nopSink{}
 	}
 
 	outf, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY, 0600)
-	defer outf.Close()
 	if err != nil {
 		return err
 	}
+	defer func() {
+		// a failed close may have lost what was written last
+		if cerr := outf.Close(); err == nil {
+			err = cerr
+		}
+	}()
 
-	for _, f := range files {
-		if err = copy(f, outf); err != nil {
-			return err
+	// the digest is of the file as written, after the parts are decrypted
+	var w io.Writer = outf
+	if digest != nil {
+		w = io.MultiWriter(outf, digest)
+	}
+	for i, f := range files {
+		var to io.Writer = smoothWrites(w, outf)
+		if key != nil {
+			to = cipher.StreamWriter{S: partStream(key, partIndex(f), 0), W: w}
 		}
-		if DisplayProgressBar() {
-			bar.Increment()
+		if err = copy(f, to); err != nil {
+			return err
 		}
-	}
-
-	if DisplayProgressBar() {
-		bar.Finish()
+		sink.OnJoin(i+1, len(files))
 	}
 
 	return nil
@@ -48,6 +62,12 @@ func copy(from string, to io.Writer) error {
 	if err != nil {
 		return err
 	}
-	io.Copy(to, f)
-	return nil
+	_, err = io.CopyBuffer(to, f, copyBuffer())
+	return err
+}
+
+// partIndex parses the index out of a part file name, 0 for other files
+func partIndex(path string) int64 {
+	index, _, _, _ := parsePartName(filepath.Base(path))
+	return index
 }
@@ -1,9 +1,10 @@
-package main
+package hget
 
 import (
 	"testing"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
 
@@ -13,7 +14,7 @@ func TestJoiner(t *testing.T) {
 	prepare()
 
 	files := [2]string{"file1", "file2"}
-	JoinFile(files[:], "join")
+	JoinFile(files[:], "join", nil, nil)
 	content, err := ioutil.ReadFile("join")
 	if err != nil {
 		t.Fatalf("err should be nil")
@@ -25,6 +26,16 @@ func TestJoiner(t *testing.T) {
 	clean()
 }
 
+func TestJoinerReadError(t *testing.T) {
+	dir := t.TempDir()
+	part := filepath.Join(dir, "file.part000000")
+	// a directory opens fine but can not be read
+	os.Mkdir(part, 0700)
+	if err := JoinFile([]string{part}, filepath.Join(dir, "join"), nil, nil); err == nil {
+		t.Fatalf("a part that can not be read should fail the join")
+	}
+}
+
 func prepare() {
 	ioutil.WriteFile("file1", []byte("file1"), 0600)
 	ioutil.WriteFile("file2", []byte("file2"), 0600)
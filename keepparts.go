@@ -0,0 +1,27 @@
+package hget
+
+import (
+	"os"
+	"path/filepath"
+)
+
+var keepParts = false
+
+// stateOf returns the state of the download of `url` by `d`, whose parts got as far as `parts`.
+func (d *HTTPDownloader) stateOf(url string, parts []Part, throughput Throughput) *State {
+	return &State{URL: url, Output: output, Parts: parts, Encryption: d.crypt, Device: d.device, Throughput: &throughput, Redirects: d.redirects, Mirrors: d.mirrors, UserAgent: d.userAgent, Headers: d.savedHeaders(), Validator: d.validator, Version: d.version.tag, Pinned: d.pinned, Window: d.window, Environment: d.environment}
+}
+
+// keepTask leaves the folder of a completed task with its parts and a state listing them, for
+// -keep-parts. The output is complete, so it is no longer marked as being joined and hget cancel
+// of the task only removes the folder.
+func keepTask(s *State) error {
+	if err := s.Save(); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(taskFolder(s.task()), joiningFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
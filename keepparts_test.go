@@ -0,0 +1,60 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeepParts(t *testing.T) {
+	displayProgress = false
+	defer func(data string) { dataPath, output, keepParts = data, "", false }(dataPath)
+	dataPath = t.TempDir()
+	keepParts = true
+	content := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "kept.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	output = filepath.Join(t.TempDir(), "kept.bin")
+
+	url := server.URL + "/kept.bin"
+	if err := Download(url); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(output); string(got) != content {
+		t.Fatalf("unexpected content %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(FolderOf(url), joiningFileName)); !os.IsNotExist(err) {
+		t.Fatalf("the kept task should not be marked as joining, got %v", err)
+	}
+
+	s, err := Read(TaskFromURL(url))
+	if err != nil {
+		t.Fatalf("the state should be kept, got %v", err)
+	}
+	if s.Environment == nil || s.Environment.FinalURL != url {
+		t.Fatalf("the state should record what the task was started with, got %+v", s.Environment)
+	}
+	sort.Slice(s.Parts, func(i, j int) bool { return s.Parts[i].Index < s.Parts[j].Index })
+	var joined []byte
+	for _, part := range s.Parts {
+		if part.RangeTo > part.RangeFrom {
+			t.Fatalf("part %d should be complete, got %+v", part.Index, part)
+		}
+		raw, err := ioutil.ReadFile(part.Path)
+		if err != nil {
+			t.Fatalf("part %d should be kept, got %v", part.Index, err)
+		}
+		joined = append(joined, raw...)
+	}
+	if string(joined) != content {
+		t.Fatalf("kept parts hold %d bytes", len(joined))
+	}
+}
@@ -0,0 +1,78 @@
+package hget_test
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abzcoding/hget"
+)
+
+type countingTransport struct {
+	requests int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.requests, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestImportedDownload(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	fs := flag.NewFlagSet("hget", flag.ContinueOnError)
+	hget.RegisterOptions(fs)
+	defer fs.Parse([]string{"-data-dir", "", "-o", "", "-checksum", ""})
+	output := filepath.Join(t.TempDir(), "file.bin")
+	if err := fs.Parse([]string{"-n", "2", "-data-dir", t.TempDir(), "-o", output}); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	transport := &countingTransport{}
+	hget.Transport = transport
+	defer func() { hget.Transport = nil }()
+
+	if err := hget.Download(server.URL + "/file.bin"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(output); string(got) != content {
+		t.Fatalf("unexpected content %q", got)
+	}
+	if atomic.LoadInt32(&transport.requests) == 0 {
+		t.Fatalf("the requests should go through the transport of the program")
+	}
+
+	fs.Parse([]string{"-checksum", "sha256:00"})
+	if err := hget.Download(server.URL + "/mismatch.bin"); !errors.Is(err, hget.ErrChecksumMismatch) {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+}
+
+func TestImportedDownloadFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, strings.NewReader(strings.Repeat("0", 1000)))
+	}))
+	defer server.Close()
+
+	fs := flag.NewFlagSet("hget", flag.ContinueOnError)
+	hget.RegisterOptions(fs)
+	defer fs.Parse([]string{"-data-dir", "", "-work-dir", "", "-o", ""})
+	notDir := filepath.Join(t.TempDir(), "file")
+	ioutil.WriteFile(notDir, nil, 0600)
+	fs.Parse([]string{"-data-dir", t.TempDir(), "-work-dir", notDir, "-o", filepath.Join(t.TempDir(), "file.bin")})
+
+	// the parts can not be written, which must not end the program
+	if err := hget.Download(server.URL + "/file.bin"); err == nil {
+		t.Fatalf("the download should fail")
+	}
+}
@@ -0,0 +1,98 @@
+package hget
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/alecthomas/units"
+)
+
+// daemonMaxConnections, daemonMaxRate and daemonMaxSize cap every task of hget daemon, whatever it asks for
+var daemonMaxConnections = 0
+var daemonMaxRate = ""
+var daemonMaxSize = ""
+
+// maxDownloadSize is how large a download may be, unlimited when 0
+var maxDownloadSize int64
+
+// TaskLimits are the caps of every task of a daemon, so that one client can not take the whole host.
+type TaskLimits struct {
+	Connections int   `json:"connections,omitempty"`
+	Rate        int64 `json:"rate,omitempty"`
+	Size        int64 `json:"size,omitempty"`
+}
+
+// daemonLimits reads the caps of -daemon-max-connections, -daemon-max-rate and -daemon-max-size.
+func daemonLimits() (TaskLimits, error) {
+	limits := TaskLimits{Connections: daemonMaxConnections}
+	var err error
+	if daemonMaxRate != "" {
+		if limits.Rate, err = units.ParseStrictBytes(daemonMaxRate); err != nil {
+			return limits, fmt.Errorf("invalid -daemon-max-rate: %v", err)
+		}
+	}
+	if daemonMaxSize != "" {
+		if limits.Size, err = units.ParseStrictBytes(daemonMaxSize); err != nil {
+			return limits, fmt.Errorf("invalid -daemon-max-size: %v", err)
+		}
+	}
+	return limits, nil
+}
+
+// clamp lowers the connections and rate `r` asks for, or those of the command line, to the caps.
+func (l TaskLimits) clamp(r *DownloadRequest) error {
+	if l.Connections > 0 {
+		if r.Connections <= 0 {
+			r.Connections = connections
+		}
+		if r.Connections > l.Connections {
+			r.Connections = l.Connections
+		}
+	}
+
+	rate := r.Rate
+	if rate == "" {
+		rate = bwLimit
+	}
+	var limit int64
+	if rate != "" {
+		var err error
+		if limit, err = units.ParseStrictBytes(rate); err != nil {
+			return fmt.Errorf("invalid rate %q: %v", rate, err)
+		}
+	}
+	if l.Rate > 0 && (limit <= 0 || limit > l.Rate) {
+		r.Rate = fmt.Sprintf("%dB", l.Rate)
+	}
+	return nil
+}
+
+// apply makes the size cap the one of the downloads, until the returned func restores it.
+func (l TaskLimits) apply() func() {
+	size := maxDownloadSize
+	maxDownloadSize = l.Size
+	return func() { maxDownloadSize = size }
+}
+
+// checkSize refuses a download of `size` bytes larger than maxDownloadSize.
+func checkSize(size int64) error {
+	if maxDownloadSize > 0 && size > maxDownloadSize {
+		return fmt.Errorf("the file is %s, more than the %s a download may take", humanBytes(size), humanBytes(maxDownloadSize))
+	}
+	return nil
+}
+
+// sizeCapWriter fails once a download of unknown size grows larger than maxDownloadSize.
+type sizeCapWriter struct {
+	w    io.Writer
+	size int64
+}
+
+func (c *sizeCapWriter) Write(b []byte) (int, error) {
+	if err := checkSize(c.size + int64(len(b))); err != nil {
+		return 0, err
+	}
+	n, err := c.w.Write(b)
+	c.size += int64(n)
+	return n, err
+}
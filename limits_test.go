@@ -0,0 +1,69 @@
+package hget
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/units"
+)
+
+func TestDaemonLimits(t *testing.T) {
+	defer func(n int, rate, size string) { daemonMaxConnections, daemonMaxRate, daemonMaxSize = n, rate, size }(daemonMaxConnections, daemonMaxRate, daemonMaxSize)
+	defer func(n int, limit string) { connections, bwLimit = n, limit }(connections, bwLimit)
+	daemonMaxConnections, daemonMaxRate, daemonMaxSize = 4, "1MiB", "1GiB"
+	connections, bwLimit = 16, ""
+
+	d, err := NewDaemon("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		body        string
+		connections int
+		rate        int64
+	}{
+		{`{"url": "http://a.org/1.iso"}`, 4, 1 << 20},
+		{`{"url": "http://a.org/1.iso", "connections": 2, "rate": "100KiB"}`, 2, 100 << 10},
+		{`{"url": "http://a.org/1.iso", "connections": 64, "rate": "1GiB"}`, 4, 1 << 20},
+	}
+	for i, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/downloads", strings.NewReader(c.body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("case %d: expected %d, got %d", i, http.StatusAccepted, rec.Code)
+		}
+		queued := <-d.queue
+		rate, err := units.ParseStrictBytes(queued.Rate)
+		if err != nil || queued.Connections != c.connections || rate != c.rate {
+			t.Fatalf("case %d: expected %d connections at %d, got %+v", i, c.connections, c.rate, queued)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/downloads", strings.NewReader(`{"url": "http://a.org/1.iso", "rate": "fast"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	d.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("an invalid rate should be refused, got %d", rec.Code)
+	}
+}
+
+func TestSizeCap(t *testing.T) {
+	defer TaskLimits{Size: 10}.apply()()
+	if checkSize(10) != nil || checkSize(11) == nil {
+		t.Fatalf("only files larger than 10 bytes should be refused")
+	}
+	var buf bytes.Buffer
+	w := &sizeCapWriter{w: &buf, size: 4}
+	if _, err := w.Write([]byte("123456")); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if _, err := w.Write([]byte("7")); err == nil || buf.Len() != 6 {
+		t.Fatalf("writes past the cap should fail, got %v with %d bytes written", err, buf.Len())
+	}
+}
@@ -0,0 +1,118 @@
+package hget
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ParseDownloadList reads the list of a -file: urls one per line, an aria2c input file, a metalink, or
+// the JSON "copy all urls" browser extensions and download managers export.
+func ParseDownloadList(raw []byte) ([]DownloadRequest, error) {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf")))
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")), bytes.HasPrefix(trimmed, []byte("{")):
+		return jsonRequests(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return metalinkRequests(trimmed)
+	}
+	return aria2Requests(raw)
+}
+
+// jsonListKeys are where exports keep their list when it is not the document itself
+var jsonListKeys = []string{"downloads", "items", "urls", "links", "files"}
+
+// jsonRequests reads a list of urls, or of objects with an url and optionally its referrer, cookies and
+// file name, as a bare array or under one of jsonListKeys.
+func jsonRequests(raw []byte) ([]DownloadRequest, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	items, ok := doc.([]interface{})
+	if object, isObject := doc.(map[string]interface{}); isObject {
+		for _, key := range jsonListKeys {
+			if items, ok = field(object, key).([]interface{}); ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, errors.New("no list of downloads in the json document")
+	}
+
+	requests := make([]DownloadRequest, 0, len(items))
+	for i, item := range items {
+		var req DownloadRequest
+		switch v := item.(type) {
+		case string:
+			req.URL = v
+		case map[string]interface{}:
+			req.URL = firstString(v, "url", "finalUrl", "href", "link", "uri")
+			req.Referrer = firstString(v, "referrer", "referer", "referrerUrl")
+			req.Cookie = cookiesOf(firstOf(v, "cookies", "cookie"))
+			// browsers export the full path the file was saved to
+			if name := filepath.Base(firstString(v, "filename", "fileName", "output")); name != "." && name != string(filepath.Separator) && !strings.HasPrefix(name, ".") {
+				req.Output = name
+			}
+		}
+		if req.URL == "" {
+			return nil, fmt.Errorf("entry %d has no url", i)
+		}
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
+
+// field returns the value of `key` in `object`, whatever the case of the key.
+func field(object map[string]interface{}, key string) interface{} {
+	if v, ok := object[key]; ok {
+		return v
+	}
+	for k, v := range object {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+func firstOf(object map[string]interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		if v := field(object, key); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func firstString(object map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := field(object, key).(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// cookiesOf turns exported cookies, a Cookie header or a list of name/value objects, into a Cookie header.
+func cookiesOf(v interface{}) string {
+	switch cookies := v.(type) {
+	case string:
+		return cookies
+	case []interface{}:
+		var pairs []string
+		for _, c := range cookies {
+			if object, ok := c.(map[string]interface{}); ok {
+				if name := firstString(object, "name"); name != "" {
+					pairs = append(pairs, name+"="+firstString(object, "value"))
+				}
+			}
+		}
+		return strings.Join(pairs, "; ")
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package hget
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseDownloadList(t *testing.T) {
+	cases := []struct {
+		name     string
+		raw      string
+		expected []DownloadRequest
+	}{
+		{"lines", "http://a.org/1.iso\n\n# skipped\nhttp://a.org/2.iso\n",
+			[]DownloadRequest{{URL: "http://a.org/1.iso"}, {URL: "http://a.org/2.iso"}}},
+		{"urls", `["http://a.org/1.iso", "http://a.org/2.iso"]`,
+			[]DownloadRequest{{URL: "http://a.org/1.iso"}, {URL: "http://a.org/2.iso"}}},
+		{"copy all urls", "\xef\xbb\xbf" + `[{"title": "One", "url": "http://a.org/1.iso"}]`,
+			[]DownloadRequest{{URL: "http://a.org/1.iso"}}},
+		{"download manager", `{"version": 2, "Downloads": [{"finalUrl": "http://cdn.a.org/1.iso", "referrer": "http://a.org/", "filename": "/home/me/Downloads/one.iso",
+			"cookies": [{"name": "session", "value": "s3cret"}, {"name": "lang", "value": "en"}]}]}`,
+			[]DownloadRequest{{URL: "http://cdn.a.org/1.iso", Referrer: "http://a.org/", Output: "one.iso", Cookie: "session=s3cret; lang=en"}}},
+		{"metalink", `<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="1.iso"><url>http://a.org/1.iso</url></file></metalink>`,
+			[]DownloadRequest{{URL: "http://a.org/1.iso"}}},
+	}
+	for _, c := range cases {
+		requests, err := ParseDownloadList([]byte(c.raw))
+		if err != nil {
+			t.Fatalf("%s: err should be nil, got %v", c.name, err)
+		}
+		if !reflect.DeepEqual(requests, c.expected) {
+			t.Fatalf("%s: expected %+v, got %+v", c.name, c.expected, requests)
+		}
+	}
+
+	for _, broken := range []string{`{"title": "no list"}`, `[{"title": "no url"}]`, `[1, 2`} {
+		if _, err := ParseDownloadList([]byte(broken)); err == nil {
+			t.Fatalf("%s should not parse", broken)
+		}
+	}
+}
+
+func TestDownloadRequestApply(t *testing.T) {
+	defer func(h http.Header) { extraHeaders.header = h }(extraHeaders.header)
+	extraHeaders.header = http.Header{"X-Token": {"t"}}
+	output = "kept.iso"
+
+	restore := DownloadRequest{URL: "http://a.org/1.iso", Output: "one.iso", Referrer: "http://a.org/", Cookie: "a=b"}.apply()
+	if output != "one.iso" || extraHeaders.header.Get("Referer") != "http://a.org/" || extraHeaders.header.Get("Cookie") != "a=b" || extraHeaders.header.Get("X-Token") != "t" {
+		t.Fatalf("the request should apply, got output %q and headers %v", output, extraHeaders.header)
+	}
+	restore()
+	if output != "kept.iso" || extraHeaders.header.Get("Referer") != "" {
+		t.Fatalf("the command line should be restored, got output %q and headers %v", output, extraHeaders.header)
+	}
+	output = ""
+}
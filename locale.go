@@ -0,0 +1,80 @@
+package hget
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var acceptLanguage = ""
+
+// languages are the presets of -lang, anything else is sent as the Accept-Language as it is
+var languages = map[string]string{
+	"us": "en-US,en;q=0.9",
+	"uk": "en-GB,en;q=0.9",
+	"de": "de-DE,de;q=0.9,en;q=0.8",
+	"fr": "fr-FR,fr;q=0.9,en;q=0.8",
+	"es": "es-ES,es;q=0.9,en;q=0.8",
+	"it": "it-IT,it;q=0.9,en;q=0.8",
+	"br": "pt-BR,pt;q=0.9,en;q=0.8",
+	"ru": "ru-RU,ru;q=0.9,en;q=0.8",
+	"jp": "ja-JP,ja;q=0.9,en;q=0.8",
+	"cn": "zh-CN,zh;q=0.9,en;q=0.8",
+}
+
+// languageNames lists the presets of -lang for the help.
+func languageNames() string {
+	names := make([]string, 0, len(languages))
+	for name := range languages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+// commandLineHeaders returns the headers given with -header and -lang.
+func commandLineHeaders() http.Header {
+	header := extraHeaders.header.Clone()
+	if acceptLanguage != "" && header.Get("Accept-Language") == "" {
+		if preset, ok := languages[strings.ToLower(acceptLanguage)]; ok {
+			header.Set("Accept-Language", preset)
+		} else {
+			header.Set("Accept-Language", acceptLanguage)
+		}
+	}
+	return header
+}
+
+// sessionHeaders returns the headers sent with every request of the download, those it was started
+// with when it is resumed, so that hosts picking mirrors or content by them answer the same.
+func (d *HTTPDownloader) sessionHeaders() http.Header {
+	if d.session != nil {
+		return d.session
+	}
+	return commandLineHeaders()
+}
+
+// savedHeaders returns the session headers worth keeping in the state, credentials are left out
+// of the file and have to be given again when resuming.
+func (d *HTTPDownloader) savedHeaders() http.Header {
+	header := d.sessionHeaders().Clone()
+	for _, name := range sensitiveHeaders {
+		header.Del(name)
+	}
+	if len(header) == 0 {
+		return nil
+	}
+	return header
+}
+
+// resumeHeaders returns the headers a download was started with, overridden by those given again.
+func resumeHeaders(saved http.Header) http.Header {
+	header := saved.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	for name, values := range commandLineHeaders() {
+		header[name] = values
+	}
+	return header
+}
@@ -0,0 +1,33 @@
+package hget
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSessionHeaders(t *testing.T) {
+	defer func() { acceptLanguage, extraHeaders = "", &headerFlag{header: http.Header{}} }()
+
+	acceptLanguage = "de"
+	extraHeaders.Set("Authorization: Bearer secret")
+	extraHeaders.Set("X-Region: eu")
+	d := &HTTPDownloader{}
+	req, _ := d.newRequest("http://a.org/1.iso")
+	if req.Header.Get("Accept-Language") != languages["de"] || req.Header.Get("X-Region") != "eu" {
+		t.Fatalf("unexpected headers %v", req.Header)
+	}
+	saved := d.savedHeaders()
+	if saved.Get("Authorization") != "" || saved.Get("Accept-Language") != languages["de"] {
+		t.Fatalf("credentials should not be saved, the rest should, got %v", saved)
+	}
+
+	// resumed with other flags, the saved headers stay unless given again
+	acceptLanguage = ""
+	extraHeaders = &headerFlag{header: http.Header{}}
+	extraHeaders.Set("X-Region: us")
+	resumed := &HTTPDownloader{session: resumeHeaders(saved)}
+	req, _ = resumed.newRequest("http://a.org/1.iso")
+	if req.Header.Get("Accept-Language") != languages["de"] || req.Header.Get("X-Region") != "us" {
+		t.Fatalf("unexpected resumed headers %v", req.Header)
+	}
+}
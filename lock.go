@@ -0,0 +1,162 @@
+package hget
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var forceUnlock = false
+var lockFileName = "lock"
+
+// TaskLock keeps other hget processes away from a task folder while we are downloading into it.
+type TaskLock struct {
+	path  string
+	owner []byte
+}
+
+// lockOwner identifies the process holding a lock, the start time tells a reused pid apart.
+type lockOwner struct {
+	PID   int
+	Start string
+}
+
+// LockTask takes the lock of the task `folder`, replacing it if its owner is gone.
+func LockTask(folder string) (*TaskLock, error) {
+	if err := MkdirIfNotExist(folder); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(folder, lockFileName)
+	me, err := json.Marshal(lockOwner{PID: os.Getpid(), Start: processStart(os.Getpid())})
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		err := createLock(path, me)
+		if err == nil {
+			return &TaskLock{path: path, owner: me}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		data, owner, alive := readLock(path)
+		if alive && !forceUnlock {
+			return nil, fmt.Errorf("task is locked by running process %d, use -force-unlock if that is not hget", owner.PID)
+		}
+		if alive {
+			Warnf("Forcefully unlocking task held by process %d\n", owner.PID)
+		} else {
+			Warnf("Removing stale lock of process %d\n", owner.PID)
+		}
+		if _, err := removeLock(path, data); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("could not lock %s", folder)
+}
+
+// removeLock removes the lock at `path` if it still holds `owner`. The lock is first renamed aside,
+// which only one process can do, so a lock another process took in the meantime is put back instead
+// of being removed.
+func removeLock(path string, owner []byte) (bool, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+lockFileName)
+	if err != nil {
+		return false, err
+	}
+	f.Close()
+	aside := f.Name()
+	defer os.Remove(aside)
+	if err := os.Rename(path, aside); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if data, err := ioutil.ReadFile(aside); err != nil || !bytes.Equal(data, owner) {
+		// fails if yet another process locked the task since, which keeps its lock
+		os.Link(aside, path)
+		return false, err
+	}
+	return true, nil
+}
+
+// createLock writes `owner` aside and links it to `path`, so the lock never shows up empty to another
+// process, which would take it for a stale one. It fails if `path` exists.
+func createLock(path string, owner []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+lockFileName)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(owner)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Link(f.Name(), path)
+}
+
+// Unlock releases the lock, it is fine if the task folder was removed already. A lock another process
+// took over with -force-unlock is left to it.
+func (l *TaskLock) Unlock() error {
+	_, err := removeLock(l.path, l.owner)
+	return err
+}
+
+// TaskLocked checks if the task `folder` is locked by a running process.
+func TaskLocked(folder string) bool {
+	_, alive := lockHolder(filepath.Join(folder, lockFileName))
+	return alive
+}
+
+// lockHolder reads the lock at `path` and reports whether its owner still runs.
+func lockHolder(path string) (lockOwner, bool) {
+	_, owner, alive := readLock(path)
+	return owner, alive
+}
+
+// readLock returns the content of the lock at `path`, its owner and whether the owner still runs.
+func readLock(path string) ([]byte, lockOwner, bool) {
+	var owner lockOwner
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return data, owner, false
+	}
+	if err := json.Unmarshal(data, &owner); err != nil || owner.PID <= 0 {
+		return data, owner, false
+	}
+
+	if !processAlive(owner.PID) {
+		return data, owner, false
+	}
+	// the pid may have been recycled by an unrelated process since the lock was taken
+	if start := processStart(owner.PID); start != "" && owner.Start != "" && start != owner.Start {
+		return data, owner, false
+	}
+	return data, owner, true
+}
+
+// processStart returns the start time of process `pid` in clock ticks since boot,
+// or an empty string when the platform does not expose it.
+func processStart(pid int) string {
+	stat, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return ""
+	}
+	// the command name may contain spaces, fields are counted after its closing paren
+	s := string(stat)
+	fields := strings.Fields(s[strings.LastIndex(s, ")")+1:])
+	if len(fields) < 20 {
+		return ""
+	}
+	return fields[19]
+}
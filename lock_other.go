@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !windows
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly,!windows
+
+package hget
+
+// processAlive can not tell whether another process runs here, its locks are kept until -force-unlock.
+func processAlive(pid int) bool {
+	return true
+}
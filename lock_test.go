@@ -0,0 +1,128 @@
+package hget
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLockTask(t *testing.T) {
+	folder := t.TempDir()
+
+	lock, err := LockTask(folder)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if !TaskLocked(folder) {
+		t.Fatalf("task should be locked")
+	}
+	if _, err := LockTask(folder); err == nil {
+		t.Fatalf("task should not be locked twice")
+	}
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if TaskLocked(folder) {
+		t.Fatalf("task should be unlocked")
+	}
+}
+
+func TestStaleLock(t *testing.T) {
+	folder := t.TempDir()
+	// pid far above any pid_max, so nobody owns this lock anymore
+	stale := []byte(`{"PID": 2147483646, "Start": "42"}`)
+	if err := ioutil.WriteFile(filepath.Join(folder, lockFileName), stale, 0600); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+
+	if TaskLocked(folder) {
+		t.Fatalf("stale lock should not count")
+	}
+	lock, err := LockTask(folder)
+	if err != nil {
+		t.Fatalf("stale lock should be replaced, got %v", err)
+	}
+	lock.Unlock()
+}
+
+func TestLockTaskConcurrently(t *testing.T) {
+	folder := t.TempDir()
+	var mu sync.Mutex
+	var locks []*TaskLock
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if lock, err := LockTask(folder); err == nil {
+				mu.Lock()
+				locks = append(locks, lock)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// a lock being written must not look stale to the others
+	if len(locks) != 1 {
+		t.Fatalf("exactly one should get the lock, got %d", len(locks))
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(folder, "."+lockFileName+"*")); len(leftovers) > 0 {
+		t.Fatalf("the lock should be written aside only while it is taken, found %v", leftovers)
+	}
+	locks[0].Unlock()
+}
+
+func TestStaleLockConcurrently(t *testing.T) {
+	folder := t.TempDir()
+	stale := []byte(`{"PID": 2147483646, "Start": "42"}`)
+	ioutil.WriteFile(filepath.Join(folder, lockFileName), stale, 0600)
+	var mu sync.Mutex
+	var locks []*TaskLock
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if lock, err := LockTask(folder); err == nil {
+				mu.Lock()
+				locks = append(locks, lock)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// replacing the stale lock must not remove the one another process just took
+	if len(locks) != 1 {
+		t.Fatalf("exactly one should get the lock, got %d", len(locks))
+	}
+	locks[0].Unlock()
+}
+
+func TestUnlockTakenOver(t *testing.T) {
+	folder := t.TempDir()
+	lock, err := LockTask(folder)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	// another process took the lock with -force-unlock
+	taken := []byte(`{"PID": 1, "Start": "42"}`)
+	ioutil.WriteFile(filepath.Join(folder, lockFileName), taken, 0600)
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(folder, lockFileName)); string(got) != string(taken) {
+		t.Fatalf("the lock of the new holder should be kept, got %q", got)
+	}
+}
+
+func TestProcessAlive(t *testing.T) {
+	if !processAlive(os.Getpid()) {
+		t.Fatalf("this process should be alive")
+	}
+	if processAlive(2147483646) {
+		t.Fatalf("a pid above pid_max should not be alive")
+	}
+}
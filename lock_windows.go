@@ -0,0 +1,27 @@
+package hget
+
+import "syscall"
+
+// processQueryLimitedInformation is the least access right which still reads the exit code
+const processQueryLimitedInformation = 0x1000
+
+// stillActive is the exit code of a process which has not exited
+const stillActive = 259
+
+// processAlive tells whether process `pid` runs, a process of another user counts although it can
+// not be opened.
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err == syscall.ERROR_ACCESS_DENIED {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
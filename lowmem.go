@@ -0,0 +1,41 @@
+package hget
+
+var lowMemory = false
+
+// lowMemoryParts is how many parts are downloaded at the same time with -low-memory
+var lowMemoryParts = 2
+
+// lowMemoryBuffer is the size of copy and transport buffers with -low-memory
+var lowMemoryBuffer = 4 * 1024
+
+// copyBuffer returns the buffer downloaded data is copied through.
+func copyBuffer() []byte {
+	if lowMemory {
+		return make([]byte, lowMemoryBuffer)
+	}
+	return make([]byte, 32*1024)
+}
+
+// partSlots returns a semaphore limiting how many parts are downloaded at the same time,
+// nil when they all may run at once.
+func partSlots() chan struct{} {
+	slots := 0
+	if lowMemory {
+		slots = lowMemoryParts
+	}
+	if openFileParts > 0 && (slots == 0 || openFileParts < slots) {
+		slots = openFileParts
+	}
+	if slots == 0 {
+		return nil
+	}
+	return make(chan struct{}, slots)
+}
+
+// applyLowMemory caps the connections of new downloads for the low memory profile.
+func applyLowMemory() {
+	if lowMemory && connections > lowMemoryParts {
+		Printf("Low memory mode, using %d connections\n", lowMemoryParts)
+		connections = lowMemoryParts
+	}
+}
@@ -0,0 +1,72 @@
+package hget
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLowMemoryLimitsParts(t *testing.T) {
+	displayProgress = false
+	lowMemory = true
+	defer func() { lowMemory = false }()
+
+	content := strings.Repeat("0123456789", 100)
+	var mu sync.Mutex
+	var running, most int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+		if r.Header.Get("Range") != "" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		http.ServeContent(w, r, "low.bin", time.Time{}, strings.NewReader(content))
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	url := srv.URL + "/low.bin"
+	defer os.RemoveAll(FolderOf(url))
+	// a resumed task keeps its parts, only as many as allowed may run at once
+	d := NewHTTPDownloader(url, 6, true, "", "")
+
+	doneChan := make(chan bool, 1)
+	fileChan := make(chan string, 6)
+	errorChan := make(chan error, 1)
+	stateChan := make(chan Part, 6)
+	go d.Do(doneChan, fileChan, errorChan, make(chan bool, 6), stateChan)
+
+	for {
+		select {
+		case <-fileChan:
+		case <-stateChan:
+		case err := <-errorChan:
+			t.Fatalf("err should be nil, got %v", err)
+		case <-doneChan:
+			if most > lowMemoryParts {
+				t.Fatalf("at most %d parts should run at once, %d did", lowMemoryParts, most)
+			}
+			return
+		}
+	}
+}
+
+func TestLowMemoryBars(t *testing.T) {
+	sink := &BarSink{file: "file", index: make(map[int64]*bar), summary: true}
+	for i := 0; i < 4; i++ {
+		sink.bars = append(sink.bars, &bar{name: "file", total: 10, bytes: true})
+	}
+	if lines := sink.lines(79, 23); len(lines) != 1 {
+		t.Fatalf("low memory mode should only show the total, got %d lines", len(lines))
+	}
+}
@@ -1,73 +1,223 @@
-package main
+// Package hget downloads files over many connections and resumes interrupted downloads. Programs
+// importing it set the options of the command line with RegisterOptions and call Download, cmd/hget
+// is the command line itself.
+package hget
 
 import (
-	"bufio"
+	"errors"
 	"flag"
-	"io"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"runtime"
 	"syscall"
+	"time"
 
 	"github.com/imkira/go-task"
 )
 
 var displayProgress = true
 
-func main() {
+// Main runs the command line of hget with the arguments of the process.
+func Main() {
 	var err error
-	var proxy, filepath, bwLimit string
+	defer exitFatal()
 
-	conn := flag.Int("n", runtime.NumCPU(), "connection")
-	skiptls := flag.Bool("skip-tls", true, "skip verify certificate for https")
-	flag.StringVar(&proxy, "proxy", "", "proxy for downloading, ex \n\t-proxy '127.0.0.1:12345' for socks5 proxy\n\t-proxy 'http://proxy.com:8080' for http proxy")
-	flag.StringVar(&filepath, "file", "", "filepath that contains links in each line")
-	flag.StringVar(&bwLimit, "rate", "", "bandwidth limit to use while downloading, ex\n\t -rate 10kB\n\t-rate 10MiB")
-
-	flag.Parse()
+	// until the flags are parsed, in the language of the system
+	SetLanguage("")
+	RegisterOptions(flag.CommandLine)
+	flag.Usage = usage
+	cmdline := aria2Args(flag.CommandLine, os.Args[1:])
+	if err = ApplyConfig(flag.CommandLine, cmdline); err != nil {
+		exit(err)
+	}
+	if err = ApplyEnvironment(flag.CommandLine); err != nil {
+		exit(err)
+	}
+	flag.CommandLine.Parse(cmdline)
+	if err = ValidateOptions(flag.CommandLine); err != nil {
+		exit(err)
+	}
+	if err = SetLanguage(messagesLanguage); err != nil {
+		exit(err)
+	}
+	applyLowMemory()
+	applyOpenFileLimit()
+	if err = applyIOPriority(); err != nil {
+		Warnf("%v\n", err)
+	}
+	if writeBuffer, err = parseWriteBuffer(); err != nil {
+		exit(err)
+	}
+	if err = prepareOutputDir(); err != nil {
+		exit(err)
+	}
+	if meteredQuota, err = openQuota(); err != nil {
+		exit(err)
+	}
+	if proxyPAC != "" {
+		if pacScript, err = LoadPAC(proxyPAC); err != nil {
+			exit(err)
+		}
+	}
+	if reportPath != "" {
+		if batchReport, err = OpenReport(reportPath); err != nil {
+			exit(err)
+		}
+	}
+	if jsonProgress {
+		// keep stdout for the progress events only
+		setConsole(Console{Stdout: Stderr, Stderr: Stderr}, false)
+	}
+	if quiet {
+		// only the OK or ERR line of the download is written
+		setConsole(Console{Stdout: ioutil.Discard, Stderr: ioutil.Discard}, false)
+		displayProgress, terminalTitle = false, false
+		defer finishQuiet()
+	}
 	args := flag.Args()
+	if sandbox {
+		writable, readable, executable := sandboxPaths(args)
+		if err := Sandbox(writable, readable, executable); err != nil {
+			exit(err)
+		}
+	}
 	if len(args) < 1 {
-		if len(filepath) < 2 {
-			Errorln("url is required")
-			usage()
-			os.Exit(1)
+		if len(urlFile) < 2 {
+			usageFailure("url is required")
 		}
 		// Creating a SerialGroup.
 		g1 := task.NewSerialGroup()
-		file, err := os.Open(filepath)
-		if err != nil {
-			FatalCheck(err)
-		}
-
-		defer file.Close()
-
-		reader := bufio.NewReader(file)
-
-		for {
-			line, _, err := reader.ReadLine()
-
-			if err == io.EOF {
-				break
-			}
+		raw, err := ioutil.ReadFile(urlFile)
+		FatalCheck(err)
+		requests, err := ParseDownloadList(raw)
+		FatalCheck(err)
 
-			g1.AddChild(downloadTask(string(line), nil, *conn, *skiptls, proxy, bwLimit))
+		for _, req := range requests {
+			g1.AddChild(downloadTask(req, connections, skipTLS, proxyServer, bwLimit))
 		}
 		g1.Run(nil)
 		return
 	}
 
 	command := args[0]
-	if command == "tasks" {
-		if err = TaskPrint(); err != nil {
-			Errorf("%v\n", err)
+	if command == "man" {
+		WriteManPage(os.Stdout, flag.CommandLine)
+		return
+	} else if command == "self-update" {
+		exe, err := os.Executable()
+		FatalCheck(err)
+		FatalCheck(SelfUpdate(exe))
+		return
+	} else if command == "tasks" {
+		if err = tasksCommand(args[1:]); err != nil {
+			exit(err)
+		}
+		return
+	} else if command == "from-curl" {
+		if err = fromCurlCommand(args[1:]); err != nil {
+			exit(err)
+		}
+		return
+	} else if command == "zip" {
+		if err = zipCommand(args[1:]); err != nil {
+			exit(err)
+		}
+		return
+	} else if command == "package" {
+		if len(args) < 4 {
+			usageFailure("index kind, index url and package are required")
+		}
+		url, sum, err := PackageArtifact(args[1], args[2], args[3])
+		if err != nil {
+			exit(err)
+		}
+		if checksum == "" {
+			checksum = sum
+		}
+		if err := clearTask(url); err != nil {
+			exit(err)
+		}
+		Execute(url, nil, connections, skipTLS, proxyServer, bwLimit)
+		exitStopped()
+		return
+	} else if command == "repair" {
+		if len(args) < 4 {
+			usageFailure("file, url and block checksums are required")
+		}
+		if err = RepairFile(args[1], args[2], args[3], connections); err != nil {
+			exit(err)
+		}
+		return
+	} else if command == "hash-manifest" {
+		if len(args) < 2 {
+			usageFailure("file is required")
+		}
+		size := defaultBlockSize
+		if len(args) > 2 {
+			if size, err = parseOffset(args[2]); err != nil || size <= 0 {
+				exit(fmt.Errorf("invalid block size %q", args[2]))
+			}
+		}
+		FatalCheck(WriteManifest(args[1], size, "sha256", os.Stdout))
+		return
+	} else if command == "verify" {
+		if len(args) < 3 {
+			usageFailure("file and checksum are required")
+		}
+		if err = VerifyFile(args[1], args[2]); err != nil {
+			exit(err)
+		}
+		Printf("Verified %s\n", args[2])
+		return
+	} else if command == "cancel" {
+		if len(args) < 2 {
+			usageFailure("task name is required")
+		}
+		task := args[1]
+		if IsURL(task) {
+			task = TaskFromURL(task)
+		}
+		if err = CancelTask(task); err != nil {
+			exit(err)
 		}
 		return
+	} else if command == "watch" {
+		if len(args) < 2 {
+			usageFailure("folder to watch is required")
+		}
+		FatalCheck(Watch(args[1]))
+		return
+	} else if command == "feed" {
+		if len(args) < 2 {
+			usageFailure("feed url is required")
+		}
+		FatalCheck(Feed(args[1]))
+		return
+	} else if command == "daemon" {
+		daemon, err := NewDaemon(webhookToken)
+		FatalCheck(err)
+		FatalCheck(daemon.Serve(listenAddress))
+		return
+	} else if command == "share" {
+		dir := "."
+		if len(args) > 1 {
+			dir = args[1]
+		}
+		share, err := NewShare(dir, webhookToken)
+		FatalCheck(err)
+		FatalCheck(share.Serve(listenAddress))
+		return
+	} else if command == "agent" {
+		agent, err := NewAgent(webhookToken)
+		FatalCheck(err)
+		FatalCheck(agent.Serve(listenAddress))
+		return
 	} else if command == "resume" {
 		if len(args) < 2 {
-			Errorln("downloading task name is required")
-			usage()
-			os.Exit(1)
+			usageFailure("downloading task name is required")
 		}
 
 		var task string
@@ -79,27 +229,202 @@ func main() {
 
 		state, err := Resume(task)
 		FatalCheck(err)
-		Execute(state.URL, state, *conn, *skiptls, proxy, bwLimit)
+		if detach && !detachedChild() {
+			FatalCheck(Detach(state.URL))
+			return
+		}
+		Execute(state.URL, state, connections, skipTLS, proxyServer, bwLimit)
+		exitStopped()
+		return
+	} else if command == "attach" {
+		if len(args) < 2 {
+			usageFailure("task name is required")
+		}
+		task := args[1]
+		if IsURL(task) {
+			task = TaskFromURL(task)
+		}
+		if err = Attach(task, os.Stdout); err != nil {
+			exit(err)
+		}
 		return
 	} else {
-		if ExistDir(FolderOf(command)) {
-			Warnf("Downloading task already exist, remove first \n")
-			err := os.RemoveAll(FolderOf(command))
-			FatalCheck(err)
+		if detach && !detachedChild() {
+			FatalCheck(Detach(command))
+			return
+		}
+		if err := clearTask(command); err != nil {
+			exit(err)
 		}
-		Execute(command, nil, *conn, *skiptls, proxy, bwLimit)
+		Execute(command, nil, connections, skipTLS, proxyServer, bwLimit)
+		exitStopped()
 	}
 }
 
-func downloadTask(url string, state *State, conn int, skiptls bool, proxy string, bwLimit string) task.Task {
+func downloadTask(req DownloadRequest, conn int, skiptls bool, proxy string, bwLimit string) task.Task {
 	run := func(t task.Task, ctx task.Context) {
-		Execute(url, state, conn, skiptls, proxy, bwLimit)
+		defer req.apply()()
+		if batchReport == nil {
+			Execute(req.URL, nil, conn, skiptls, proxy, bwLimit)
+			return
+		}
+		// with a report, a failed download is recorded and the next one goes on
+		started := time.Now()
+		err := recovered(func() { Execute(req.URL, nil, conn, skiptls, proxy, bwLimit) })
+		batchReport.Add(req.URL, outputOf(req.URL), started, err == nil && ExistDir(FolderOf(req.URL)), err)
 	}
 	return task.NewTaskWithFunc(run)
 }
 
+func tasksCommand(args []string) error {
+	if len(args) == 0 {
+		return TaskPrint()
+	}
+
+	switch args[0] {
+	case "eta":
+		if len(args) < 2 {
+			return errors.New("task name is required")
+		}
+		return TaskETA(args[1])
+	case "show":
+		if len(args) < 2 {
+			return errors.New("task name is required")
+		}
+		withLog := false
+		for _, arg := range args[2:] {
+			if arg != "--log" && arg != "-log" {
+				return fmt.Errorf("unknown option %s of tasks show", arg)
+			}
+			withLog = true
+		}
+		return TaskShow(args[1], withLog, os.Stdout)
+	case "progress":
+		if len(args) < 2 {
+			return errors.New("task name is required")
+		}
+		return TaskProgress(args[1], os.Stdout)
+	case "export":
+		if len(args) < 2 {
+			return errors.New("task name is required")
+		}
+		return ExportTask(args[1], os.Stdout)
+	case "import":
+		if len(args) < 2 {
+			return errors.New("task archive is required")
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		task, err := ImportTask(f)
+		if err != nil {
+			return err
+		}
+		Printf("Imported task %s, continue it with `hget resume %s`\n", task, task)
+		return nil
+	}
+	return fmt.Errorf("unknown tasks command %q", args[0])
+}
+
+// fromCurlCommand prints the hget command, or with --config the profile, of a curl or wget command
+// given as one pasted argument, as its words, or on stdin.
+func fromCurlCommand(args []string) error {
+	asConfig := len(args) > 0 && (args[0] == "--config" || args[0] == "-config")
+	if asConfig {
+		args = args[1:]
+	}
+	words := args
+	if len(args) <= 1 {
+		line := ""
+		if len(args) == 1 {
+			line = args[0]
+		} else {
+			raw, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			line = string(raw)
+		}
+		var err error
+		if words, err = SplitCommand(line); err != nil {
+			return err
+		}
+	}
+
+	t, err := TranslateCommand(words)
+	if err != nil {
+		return err
+	}
+	if asConfig {
+		fmt.Print(t.Config())
+	} else {
+		fmt.Println(t.CommandLine())
+	}
+	return nil
+}
+
 // Execute configures the HTTPDownloader and uses it to download stuff.
 func Execute(url string, state *State, conn int, skiptls bool, proxy string, bwLimit string) {
+	for {
+		if err := meteredQuota.wait(); err != nil {
+			// the task, if any, was saved already
+			Warnf("%v\n", err)
+			stopReason = err
+			return
+		}
+		if state = execute(url, state, conn, skiptls, proxy, bwLimit); state == nil {
+			return
+		}
+		// paused by the quota, resumed in the next period
+		var err error
+		state, err = Resume(TaskFromURL(state.URL))
+		FatalCheck(err)
+		url = state.URL
+	}
+}
+
+// stopReason is why the last download stopped before completing, wrapping ErrInterrupted unless the
+// quota ran out
+var stopReason error
+
+// Download downloads `url` with the options of the command line, or those a program set by parsing
+// its flags into a flag.FlagSet given to RegisterOptions, resuming its task if there is one. A
+// failure is returned instead of ending the process, wrapping ErrRangeNotSupported, ErrChecksumMismatch,
+// ErrRemoteChanged or ErrInterrupted when it is one of them.
+func Download(url string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if fatal, ok := r.(fatalError); ok {
+				err = fatal.err
+			} else if err, ok = r.(error); !ok {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	var state *State
+	if ExistDir(FolderOf(url)) {
+		state, err = Resume(TaskFromURL(url))
+		if os.IsNotExist(err) {
+			// a failed download leaves its folder without a state, there is nothing to resume
+			state, err = nil, clearTask(url)
+		}
+		if err != nil {
+			return err
+		}
+		if state != nil && state.URL != url {
+			return fmt.Errorf("task %s is downloading %s, cancel it first", TaskFromURL(url), state.URL)
+		}
+	}
+	stopReason = nil
+	Execute(url, state, connections, skipTLS, proxyServer, bwLimit)
+	return stopReason
+}
+
+// execute downloads `url`, it returns the saved state of the download when the quota paused it.
+func execute(url string, state *State, conn int, skiptls bool, proxy string, bwLimit string) *State {
 	//otherwise is hget <URL> command
 
 	signalChan := make(chan os.Signal, 1)
@@ -108,12 +433,16 @@ func Execute(url string, state *State, conn int, skiptls bool, proxy string, bwL
 		syscall.SIGINT,
 		syscall.SIGTERM,
 		syscall.SIGQUIT)
+	defer signal.Stop(signalChan)
 
 	//set up parallel
 
 	var files = make([]string, 0)
 	var parts = make([]Part, 0)
 	var isInterrupted = false
+	var isCancelled = false
+	var quotaUsed = false
+	var saved *State
 
 	doneChan := make(chan bool, conn)
 	fileChan := make(chan string, conn)
@@ -121,55 +450,384 @@ func Execute(url string, state *State, conn int, skiptls bool, proxy string, bwL
 	stateChan := make(chan Part, 1)
 	interruptChan := make(chan bool, conn)
 
+	if !resolvedScheme(url) {
+		FatalCheck(CheckURL(url))
+	}
+	for _, mirror := range mirrorURLs {
+		FatalCheck(CheckURL(mirror))
+	}
+
+	expected := checksum
+	var session http.Header
+	if state == nil {
+		resolution, err := ResolveURL(url)
+		FatalCheck(err)
+		if resolution.URL != url {
+			FatalCheck(CheckURL(resolution.URL))
+			if FolderOf(resolution.URL) != FolderOf(url) {
+				// the task is of the url it resolved to
+				FatalCheck(clearTask(resolution.URL))
+			}
+		}
+		url, session, expected = resolution.URL, resolution.Header, resolution.Checksum
+	}
+
+	lock, err := LockTask(FolderOf(url))
+	FatalCheck(err)
+	defer lock.Unlock()
+	if pacScript != nil && proxy == "" {
+		proxy, err = pacScript.proxyFor(url)
+		FatalCheck(err)
+	}
+
+	if IsRsync(url) {
+		executeRsync(url, proxy, bwLimit)
+		return nil
+	}
+
+	tasklog, err := OpenTaskLog(FolderOf(url))
+	FatalCheck(err)
+	defer tasklog.Close()
+	control, err := ListenControl(FolderOf(url))
+	if err != nil {
+		Warnf("hget cancel will not be able to stop this download: %v\n", err)
+	}
+	defer control.Close()
+	if pacScript != nil {
+		tasklog.Logf("proxy auto-config chose %q", proxy)
+	}
+	if state == nil {
+		tasklog.Logf("starting %s with %d connections", url, conn)
+	} else {
+		tasklog.Logf("resuming %s, %s left in %d parts", url, humanBytes(state.Remaining()), len(state.Parts))
+	}
+
 	var downloader *HTTPDownloader
 	if state == nil {
-		downloader = NewHTTPDownloader(url, conn, skiptls, proxy, bwLimit)
+		downloader = newHTTPDownloader(url, session, conn, skiptls, proxy, bwLimit)
 	} else {
-		downloader = &HTTPDownloader{url: state.URL, file: filepath.Base(state.URL), par: int64(len(state.Parts)), parts: state.Parts, resumable: true}
+		downloader = &HTTPDownloader{url: state.URL, file: filepath.Base(state.URL), par: int64(len(state.Parts)), parts: state.Parts, resumable: true, proxy: proxy, redirects: state.Redirects, mirrors: state.Mirrors, userAgent: state.UserAgent, session: resumeHeaders(state.Headers), validator: state.Validator, pinned: state.Pinned, window: state.Window}
+		downloader.resumeVersion(state)
+		if downloader.userAgent == "" {
+			downloader.userAgent = chooseUserAgent()
+		}
+		if err := downloader.runPreflight(); err != nil {
+			tasklog.Logf("preflight failed: %v", err)
+			FatalCheck(err)
+		}
+	}
+	downloader.log = tasklog
+	if state != nil && state.Environment != nil {
+		downloader.environment = state.Environment
+	} else {
+		downloader.environment = currentEnvironment(flag.CommandLine, downloader.finalURL())
+		tasklog.Logf("started by %s", downloader.environment)
+	}
+	if state != nil {
+		FatalCheck(downloader.followChange())
+	}
+	downloader.addMirrors(mirrorURLs)
+	if state != nil {
+		downloader.device = state.Device
+	} else if output != "" && IsDevice(output) {
+		if encrypt {
+			FatalCheck(errors.New("encrypting parts is not possible when writing to a device"))
+		}
+		FatalCheck(PrepareDevice(output, downloader.len))
+		downloader.device = output
+	}
+	if state != nil {
+		FatalCheck(downloader.verifyParts())
+	}
+	if state != nil && state.Encryption != nil {
+		passphrase, err := Passphrase(false)
+		FatalCheck(err)
+		downloader.crypt = state.Encryption
+		downloader.key, err = state.Encryption.Key(passphrase)
+		FatalCheck(err)
+	} else if state == nil && encrypt {
+		passphrase, err := Passphrase(true)
+		FatalCheck(err)
+		downloader.crypt, downloader.key, err = NewEncryption(passphrase)
+		FatalCheck(err)
+	}
+	if upload != "" {
+		if state != nil {
+			FatalCheck(errors.New("uploads can not be resumed"))
+		}
+		FatalCheck(downloader.startUpload(upload))
+	}
+	if sharePeers {
+		if err := downloader.findPeers(manifestPath); err != nil {
+			Warnf("not taking parts from peers: %v\n", err)
+		}
+		peer, err := ServePeers(downloader)
+		if err != nil {
+			Warnf("could not share parts with peers: %v\n", err)
+		}
+		defer peer.Close()
+	}
+	if audit {
+		downloader.audit, err = OpenAudit(FolderOf(url))
+		FatalCheck(err)
+		defer downloader.audit.Close()
+	}
+	var prior Throughput
+	if state != nil && state.Throughput != nil {
+		prior = *state.Throughput
+	}
+	meter := NewMeter(prior)
+	terminal := NewTerminalSink(NewProgressSink(downloader.file, meter), meter)
+	downloader.sink = MultiSink{meter, terminal}
+	if detachedChild() {
+		// started by hget -detach, there is no terminal to show anything on
+		terminal.Detach(tasklog)
+	}
+	// hget attach draws the parts as they are drawn here
+	live := &LiveParts{}
+	// the throughput of the connections backs the advice on -n
+	stats := NewConnectionStats()
+	downloader.sink = MultiSink{downloader.sink, live, stats}
+	total, _ := downloader.progressOf()
+	control.SetProgress(func() AttachFrame { return AttachFrame{Line: progressLine(meter, total), Parts: live.Parts()} })
+	if prefixHook != "" {
+		prefix, err := NewPrefixSink(prefixHook, prefixEvery, url, downloader.parts, downloader.device)
+		FatalCheck(err)
+		defer prefix.Close()
+		downloader.sink = MultiSink{downloader.sink, prefix}
+	}
+	if downloader.resumable {
+		total, done := downloader.progressOf()
+		snapshots := OpenSnapshots(FolderOf(url), total, done)
+		defer snapshots.Close()
+		downloader.sink = MultiSink{downloader.sink, snapshots}
+	}
+	if meteredQuota != nil {
+		downloader.sink = MultiSink{downloader.sink, meteredQuota}
+		defer meteredQuota.Save()
 	}
 	go downloader.Do(doneChan, fileChan, errorChan, interruptChan, stateChan)
 
+	cancelled, paused, exhausted := control.Cancelled(), control.Paused(), meteredQuota.Exhausted()
 	for {
 		select {
-		case <-signalChan:
-			//send par number of interrupt for each routine
+		case <-exhausted:
+			exhausted = nil
+			if !downloader.resumable {
+				tasklog.Logf("the quota is used up, but the download can not be resumed and goes on")
+				Warnf("The quota is used up, but %s is not resumable and goes on\n", url)
+				continue
+			}
+			tasklog.Logf("paused, the quota is used up")
+			isInterrupted, quotaUsed = true, true
+			interruptAll(interruptChan, conn)
+		case <-paused:
+			paused = nil
+			tasklog.Logf("paused through the control socket")
 			isInterrupted = true
-			for i := 0; i < conn; i++ {
-				interruptChan <- true
+			interruptAll(interruptChan, conn)
+		case <-cancelled:
+			// the channel stays closed, it is only handled once
+			cancelled = nil
+			tasklog.Logf("cancelled by hget cancel")
+			isInterrupted, isCancelled = true, true
+			interruptAll(interruptChan, conn)
+		case sig := <-signalChan:
+			if sig == syscall.SIGHUP && onHangup == hangupDetach {
+				// an ssh session went away, the download goes on in the background
+				tasklog.Logf("the terminal hung up, downloading on with the logs and progress written here")
+				terminal.Detach(tasklog)
+				continue
 			}
+			//send par number of interrupt for each routine
+			isInterrupted = true
+			interruptAll(interruptChan, conn)
 		case file := <-fileChan:
 			files = append(files, file)
 		case err := <-errorChan:
+			if downloader.upload != nil {
+				downloader.upload.Abort()
+			}
+			tasklog.Logf("failed: %v", err)
+			if rsyncFallback != "" && downloader.device == "" && downloader.upload == nil {
+				Warnf("%v, falling back to %s\n", err, rsyncFallback)
+				// the http parts can not be reused by rsync, start over cleanly
+				tasklog.Close()
+				FatalCheck(removeTask(url))
+				out := outputOf(url)
+				_, err := RsyncDownload(rsyncFallback, out, proxy, bwLimit)
+				FatalCheck(err)
+				FatalCheck(os.RemoveAll(FolderOf(rsyncFallback)))
+				return nil
+			}
+			if downloader.resumable && downloader.upload == nil && isTemporary(err) {
+				// parts reported right before failing may still be buffered
+				for len(stateChan) > 0 {
+					parts = append(parts, <-stateChan)
+				}
+				if len(parts) == len(downloader.parts) {
+					Printf("Failed for now, saving state ... \n")
+					s := downloader.stateOf(url, parts, meter.Throughput())
+					serr := s.Save()
+					if serr == nil {
+						tasklog.Logf("temporary failure, %s left in %d parts saved", humanBytes(s.Remaining()), len(parts))
+						stopReason = causedBy(ErrTemporary, "%v, continue later with %s", err, resumeCommand(url))
+						return nil
+					}
+					tasklog.Logf("could not save state: %v", serr)
+				}
+			}
 			Errorf("%v", err)
 			panic(err) //maybe need better style
 		case part := <-stateChan:
 			parts = append(parts, part)
 		case <-doneChan:
-			if isInterrupted {
+			// parts reported right before finishing may still be buffered
+			for len(fileChan) > 0 {
+				files = append(files, <-fileChan)
+			}
+			for len(stateChan) > 0 {
+				parts = append(parts, <-stateChan)
+			}
+			if isCancelled {
+				if downloader.upload != nil {
+					downloader.upload.Abort()
+				}
+				tasklog.Close()
+				FatalCheck(removeTask(url))
+				Printf("Cancelled, downloaded parts removed\n")
+				stopReason = fmt.Errorf("%w by hget cancel, downloaded parts removed", ErrInterrupted)
+			} else if isInterrupted {
 				if downloader.resumable {
 					Printf("Interrupted, saving state ... \n")
-					s := &State{URL: url, Parts: parts}
+					throughput := meter.Throughput()
+					s := downloader.stateOf(url, parts, throughput)
 					if err := s.Save(); err != nil {
+						tasklog.Logf("could not save state: %v", err)
 						Errorf("%v\n", err)
+					} else {
+						tasklog.Logf("interrupted, %s left in %d parts saved", humanBytes(s.Remaining()), len(parts))
+						stopReason = fmt.Errorf("%w, continue with %s", ErrInterrupted, resumeCommand(url))
+						if quotaUsed {
+							saved = s
+						}
 					}
 				} else {
+					if downloader.upload != nil {
+						FatalCheck(downloader.upload.Abort())
+					}
 					Warnf("Interrupted, but downloading url is not resumable, silently die")
+					stopReason = fmt.Errorf("%w, the download is not resumable", ErrInterrupted)
 				}
 			} else {
-				err := JoinFile(files, filepath.Base(url))
-				FatalCheck(err)
-				err = os.RemoveAll(FolderOf(url))
-				FatalCheck(err)
+				out := outputOf(url)
+				if downloader.upload != nil {
+					FatalCheck(downloader.upload.Complete())
+					out = upload
+					Printf("Uploaded to %s\n", upload)
+				} else if downloader.device == "" {
+					if err := downloader.audit.Verify(parts); err != nil {
+						tasklog.Logf("audit failed: %v", err)
+						FatalCheck(err)
+					}
+					// joined aside and renamed once verified, the output is never seen partial
+					joined := joiningPath(out)
+					FatalCheck(markJoining(FolderOf(url), joined))
+					if joined != out {
+						if err := os.Remove(joined); err != nil && !os.IsNotExist(err) {
+							FatalCheck(err)
+						}
+					}
+					// -print-hash hashes the file as it is joined
+					digest := printHash.newHash()
+					err := joinHashing(files, joined, downloader.key, downloader.sink, digest)
+					if err != nil && joined != out {
+						os.Remove(joined)
+					}
+					FatalCheck(err)
+					if expected != "" {
+						if err := VerifyFile(joined, expected); err != nil {
+							tasklog.Logf("verification failed: %v", err)
+							FatalCheck(err)
+						}
+						Printf("Verified %s\n", expected)
+					}
+					if manifestPath != "" {
+						// a part from a LAN peer, or a proxy, may have been damaged
+						if err := RepairFile(joined, url, manifestPath, conn); err != nil {
+							tasklog.Logf("manifest check failed: %v", err)
+							FatalCheck(err)
+						}
+						if digest != nil {
+							// blocks may have been downloaded again
+							FatalCheck(hashFile(digest, joined))
+						}
+					}
+					FatalCheck(moveIntoPlace(joined, out))
+					if digest != nil {
+						printDigest(digest, out)
+					}
+					if follow {
+						FatalCheck(downloader.followTail(out, signalChan, control.Cancelled()))
+					}
+				} else if digest := printHash.newHash(); digest != nil {
+					// the device holds the file, or its -range, from the offset it has in the file
+					from, total := int64(0), int64(0)
+					if downloader.window != nil {
+						from = downloader.window.From
+					}
+					total, _ = downloader.progressOf()
+					FatalCheck(hashRange(digest, downloader.device, from, total))
+					printDigest(digest, downloader.device)
+				}
+				tasklog.Logf("completed %s", out)
+				// the log goes with the task folder
+				tasklog.Close()
+				if keepParts {
+					FatalCheck(keepTask(downloader.stateOf(url, parts, meter.Throughput())))
+				} else {
+					err = removeTask(url)
+					FatalCheck(err)
+				}
+				downloader.sink.OnComplete(out)
+				Printf("Completed %s, started by %s\n", out, downloader.environment)
+				if advice := stats.Advice(int(downloader.par)); advice != "" {
+					Printf("%s\n", advice)
+				}
+				if quiet {
+					total, _ := downloader.progressOf()
+					FatalCheck(writeOK(os.Stdout, out, total, downloader.upload == nil && downloader.device == ""))
+				}
 			}
-			return
+			return saved
+		}
+	}
+}
+
+// clearTask removes what is left of an earlier task of `url` before downloading it again.
+func clearTask(url string) error {
+	if !ExistDir(FolderOf(url)) {
+		return nil
+	}
+	if TaskLocked(FolderOf(url)) && !forceUnlock {
+		return errors.New("task is being downloaded by another hget process")
+	}
+	Warnf("Downloading task already exist, remove first \n")
+	return removeTask(url)
+}
+
+// interruptAll asks every running part to stop
+func interruptAll(interruptChan chan bool, conn int) {
+	for i := 0; i < conn; i++ {
+		select {
+		case interruptChan <- true:
+		default:
 		}
 	}
 }
 
 func usage() {
-	Printf(`Usage:
-hget [-n connection] [-skip-tls true] [-proxy proxy_address] [-file filename] URL
-hget tasks
-hget resume [TaskName]
-`)
+	// -h is handled while parsing, -ui-lang may come before it
+	SetLanguage(messagesLanguage)
+	WriteHelp(Stdout, flag.CommandLine)
 }
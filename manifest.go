@@ -0,0 +1,63 @@
+package hget
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// manifestPath is the block manifest the output of a download is checked against
+var manifestPath = ""
+
+// defaultBlockSize is the size of the blocks of hget hash-manifest when none is given
+var defaultBlockSize int64 = 1 << 20
+
+// WriteManifest writes the manifest of `path` for hget repair and -manifest: its name and size, and the
+// `algo` digest of every block of `size` bytes.
+func WriteManifest(path string, size int64, algo string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "# hget manifest\nfile %s\nsize %d\nblock %d\n", filepath.Base(path), stat.Size(), size)
+	buf := make([]byte, size)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			h := hashes[algo]()
+			h.Write(buf[:n])
+			fmt.Fprintf(w, "%s:%x\n", algo, h.Sum(nil))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readManifest reads the manifest at `location`, a http(s) url or a file.
+func readManifest(location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return ioutil.ReadFile(location)
+	}
+	resp, err := http.Get(location)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch the manifest: %s", resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, 64<<20))
+}
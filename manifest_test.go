@@ -0,0 +1,59 @@
+package hget
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHashManifest(t *testing.T) {
+	displayProgress = false
+	content := strings.Repeat("0123456789", 250)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.bin")
+	ioutil.WriteFile(path, []byte(content), 0644)
+
+	var manifest bytes.Buffer
+	if err := WriteManifest(path, 1000, "sha256", &manifest); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if !strings.HasPrefix(manifest.String(), "# hget manifest\nfile data.bin\nsize 2500\nblock 1000\n") {
+		t.Fatalf("unexpected manifest %q", manifest.String())
+	}
+	sums, err := parseBlockSums(manifest.Bytes(), "data.bin")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if sums.length != 2500 || sums.size != 1000 || len(sums.sums) != 3 {
+		t.Fatalf("unexpected block sums %+v", sums)
+	}
+
+	// published alongside the file
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".blocks") {
+			w.Write(manifest.Bytes())
+			return
+		}
+		http.ServeContent(w, r, "data.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	damaged := []byte(content)
+	damaged[1500] = 'x'
+	ioutil.WriteFile(path, damaged, 0644)
+	if err := RepairFile(path, server.URL+"/data.bin", server.URL+"/data.bin.blocks", 2); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if repaired, _ := ioutil.ReadFile(path); string(repaired) != content {
+		t.Fatalf("the file should be repaired")
+	}
+
+	content = content[:2400]
+	if err := RepairFile(path, server.URL+"/data.bin", server.URL+"/data.bin.blocks", 2); err == nil || !strings.Contains(err.Error(), "manifest is of a file") {
+		t.Fatalf("a manifest of another size should be refused, got %v", err)
+	}
+}
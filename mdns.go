@@ -0,0 +1,252 @@
+package hget
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// mdnsGroup is where mDNS queries and announcements are sent to
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+const (
+	dnsTypeTXT = 16
+	dnsTypeANY = 255
+	dnsClassIN = 1
+)
+
+// dnsRecord is a question, or an answer when it has a TXT value.
+type dnsRecord struct {
+	Name string
+	Type uint16
+	TXT  []string
+}
+
+// mdnsName is the service instance hget instances sharing the download `key` answer for.
+func mdnsName(key string) string {
+	return key + "._hget._tcp.local"
+}
+
+// encodeDNS builds a DNS message with `questions` and `answers`, a response when there are answers.
+func encodeDNS(id uint16, questions []dnsRecord, answers []dnsRecord) []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	if len(answers) > 0 {
+		// response, authoritative
+		binary.BigEndian.PutUint16(msg[2:], 0x8400)
+	}
+	binary.BigEndian.PutUint16(msg[4:], uint16(len(questions)))
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(answers)))
+
+	for _, q := range questions {
+		msg = appendName(msg, q.Name)
+		msg = appendUint16(msg, q.Type)
+		msg = appendUint16(msg, dnsClassIN)
+	}
+	for _, a := range answers {
+		var rdata []byte
+		for _, s := range a.TXT {
+			rdata = append(rdata, byte(len(s)))
+			rdata = append(rdata, s...)
+		}
+		msg = appendName(msg, a.Name)
+		msg = appendUint16(msg, a.Type)
+		msg = appendUint16(msg, dnsClassIN)
+		// ttl of 120s
+		msg = appendUint16(appendUint16(msg, 0), 120)
+		msg = appendUint16(msg, uint16(len(rdata)))
+		msg = append(msg, rdata...)
+	}
+	return msg
+}
+
+func appendUint16(msg []byte, v uint16) []byte {
+	return append(msg, byte(v>>8), byte(v))
+}
+
+func appendName(msg []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0)
+}
+
+// decodeDNS returns the id, questions and answers of a DNS message, answers other than TXT come without value.
+func decodeDNS(msg []byte) (uint16, []dnsRecord, []dnsRecord, error) {
+	if len(msg) < 12 {
+		return 0, nil, nil, errors.New("short dns message")
+	}
+	id := binary.BigEndian.Uint16(msg[0:])
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+
+	offset := 12
+	var questions, answers []dnsRecord
+	for i := 0; i < qdcount; i++ {
+		name, next, err := readName(msg, offset)
+		if err != nil || next+4 > len(msg) {
+			return 0, nil, nil, errors.New("invalid dns question")
+		}
+		questions = append(questions, dnsRecord{Name: name, Type: binary.BigEndian.Uint16(msg[next:])})
+		offset = next + 4
+	}
+	for i := 0; i < ancount; i++ {
+		name, next, err := readName(msg, offset)
+		if err != nil || next+10 > len(msg) {
+			return 0, nil, nil, errors.New("invalid dns answer")
+		}
+		record := dnsRecord{Name: name, Type: binary.BigEndian.Uint16(msg[next:])}
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		rdata := next + 10
+		if rdata+length > len(msg) {
+			return 0, nil, nil, errors.New("invalid dns answer")
+		}
+		if record.Type == dnsTypeTXT {
+			for p := rdata; p < rdata+length; {
+				n := int(msg[p])
+				if p+1+n > rdata+length {
+					return 0, nil, nil, errors.New("invalid txt record")
+				}
+				record.TXT = append(record.TXT, string(msg[p+1:p+1+n]))
+				p += 1 + n
+			}
+		}
+		answers = append(answers, record)
+		offset = rdata + length
+	}
+	return id, questions, answers, nil
+}
+
+// readName reads the possibly compressed name at `offset`, it returns the name and the offset after it.
+func readName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; jumps < 16; {
+		if offset >= len(msg) {
+			return "", 0, errors.New("name out of bounds")
+		}
+		n := int(msg[offset])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = offset + 1
+			}
+			return strings.Join(labels, "."), end, nil
+		case n&0xC0 == 0xC0:
+			if offset+1 >= len(msg) {
+				return "", 0, errors.New("name out of bounds")
+			}
+			if end < 0 {
+				end = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3FFF)
+			jumps++
+		default:
+			if offset+1+n > len(msg) {
+				return "", 0, errors.New("name out of bounds")
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+n]))
+			offset += 1 + n
+		}
+	}
+	return "", 0, errors.New("too many compression pointers")
+}
+
+// DiscoverPeers asks the LAN over mDNS for hget instances sharing the download `key`, and returns the
+// host:port of those answering within `wait`.
+func DiscoverPeers(key string, wait time.Duration) ([]string, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	name := mdnsName(key)
+	// sent from a port other than 5353, responders answer straight back to it
+	if _, err := conn.WriteToUDP(encodeDNS(0, []dnsRecord{{Name: name, Type: dnsTypeTXT}}, nil), mdnsGroup); err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(wait))
+
+	var peers []string
+	seen := make(map[string]bool)
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// the deadline ends the discovery
+			return peers, nil
+		}
+		_, _, answers, err := decodeDNS(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, a := range answers {
+			if !strings.EqualFold(a.Name, name) {
+				continue
+			}
+			for _, txt := range a.TXT {
+				if !strings.HasPrefix(txt, "port=") {
+					continue
+				}
+				peer := net.JoinHostPort(from.IP.String(), strings.TrimPrefix(txt, "port="))
+				if !seen[peer] {
+					seen[peer] = true
+					peers = append(peers, peer)
+				}
+			}
+		}
+	}
+}
+
+// mdnsResponder answers the mDNS queries for a download shared on `port`.
+type mdnsResponder struct {
+	conn *net.UDPConn
+}
+
+// AnnouncePeer answers mDNS queries for the download `key` with the port it is shared on.
+func AnnouncePeer(key string, port int) (*mdnsResponder, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+	name := mdnsName(key)
+	answer := []dnsRecord{{Name: name, Type: dnsTypeTXT, TXT: []string{fmt.Sprintf("port=%d", port)}}}
+
+	go func() {
+		buf := make([]byte, 9000)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			id, questions, _, err := decodeDNS(buf[:n])
+			if err != nil {
+				continue
+			}
+			for _, q := range questions {
+				if strings.EqualFold(q.Name, name) && (q.Type == dnsTypeTXT || q.Type == dnsTypeANY) {
+					to := from
+					if from.Port == mdnsGroup.Port {
+						to = mdnsGroup
+					}
+					conn.WriteToUDP(encodeDNS(id, []dnsRecord{q}, answer), to)
+					break
+				}
+			}
+		}
+	}()
+	return &mdnsResponder{conn: conn}, nil
+}
+
+// Close stops answering.
+func (r *mdnsResponder) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.conn.Close()
+}
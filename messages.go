@@ -0,0 +1,166 @@
+package hget
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var messagesLanguage = ""
+
+// catalogs are the translations of the messages of hget, keyed by the english format string they
+// replace. More languages, or other translations, are read from messages/LANG.json in the config folder.
+var catalogs = map[string]map[string]string{
+	"de": {
+		"Usage:\n":                                        "Aufruf:\n",
+		"\nOptions:\n":                                    "\nOptionen:\n",
+		"url is required":                                 "eine URL wird benötigt",
+		"Start download with %d connections \n":           "Download mit %d Verbindungen gestartet \n",
+		"Download target size: %.1f MB\n":                 "Größe der Datei: %.1f MB\n",
+		"Download target size: %.1f GB\n":                 "Größe der Datei: %.1f GB\n",
+		"Download size: not specified\n":                  "Größe der Datei: unbekannt\n",
+		"Resolve ip: %s\n":                                "Aufgelöste IP: %s\n",
+		"Interrupted, saving state ... \n":                "Unterbrochen, der Stand wird gespeichert ... \n",
+		"Cancelled, downloaded parts removed\n":           "Abgebrochen, die geladenen Teile wurden gelöscht\n",
+		"Currently on going download: \n":                 "Laufende Downloads: \n",
+		"Downloading task already exist, remove first \n": "Der Download existiert bereits, bitte zuerst entfernen \n",
+		"Verified %s\n":                                   "%s geprüft\n",
+		"Uploaded to %s\n":                                "Nach %s hochgeladen\n",
+		"Redirected through %s\n":                         "Über %s umgeleitet\n",
+		"Target url not contain Content-Length header, fallback to parallel 1\n": "Die URL nennt keine Content-Length, es wird eine Verbindung genutzt\n",
+		"Target url is not supported range download, fallback to parallel 1\n":   "Die URL unterstützt keine Ranges, es wird eine Verbindung genutzt\n",
+	},
+	"fr": {
+		"Usage:\n":                                        "Utilisation :\n",
+		"\nOptions:\n":                                    "\nOptions :\n",
+		"url is required":                                 "une url est requise",
+		"Start download with %d connections \n":           "Téléchargement avec %d connexions \n",
+		"Download target size: %.1f MB\n":                 "Taille du fichier : %.1f Mo\n",
+		"Download target size: %.1f GB\n":                 "Taille du fichier : %.1f Go\n",
+		"Download size: not specified\n":                  "Taille du fichier : inconnue\n",
+		"Resolve ip: %s\n":                                "Adresse résolue : %s\n",
+		"Interrupted, saving state ... \n":                "Interrompu, sauvegarde de l'état ... \n",
+		"Cancelled, downloaded parts removed\n":           "Annulé, les parties téléchargées sont supprimées\n",
+		"Currently on going download: \n":                 "Téléchargements en cours : \n",
+		"Downloading task already exist, remove first \n": "Ce téléchargement existe déjà, supprimez-le d'abord \n",
+		"Verified %s\n":                                   "%s vérifié\n",
+		"Uploaded to %s\n":                                "Envoyé vers %s\n",
+		"Redirected through %s\n":                         "Redirigé par %s\n",
+		"Target url not contain Content-Length header, fallback to parallel 1\n": "L'url ne donne pas de Content-Length, une seule connexion est utilisée\n",
+		"Target url is not supported range download, fallback to parallel 1\n":   "L'url n'accepte pas les ranges, une seule connexion est utilisée\n",
+	},
+	"es": {
+		"Usage:\n":                                        "Uso:\n",
+		"\nOptions:\n":                                    "\nOpciones:\n",
+		"url is required":                                 "se requiere una url",
+		"Start download with %d connections \n":           "Descarga iniciada con %d conexiones \n",
+		"Download target size: %.1f MB\n":                 "Tamaño del archivo: %.1f MB\n",
+		"Download target size: %.1f GB\n":                 "Tamaño del archivo: %.1f GB\n",
+		"Download size: not specified\n":                  "Tamaño del archivo: desconocido\n",
+		"Resolve ip: %s\n":                                "IP resuelta: %s\n",
+		"Interrupted, saving state ... \n":                "Interrumpido, guardando el estado ... \n",
+		"Cancelled, downloaded parts removed\n":           "Cancelado, las partes descargadas se han borrado\n",
+		"Currently on going download: \n":                 "Descargas en curso: \n",
+		"Downloading task already exist, remove first \n": "La descarga ya existe, elimínela primero \n",
+		"Verified %s\n":                                   "%s verificado\n",
+		"Uploaded to %s\n":                                "Subido a %s\n",
+		"Redirected through %s\n":                         "Redirigido por %s\n",
+		"Target url not contain Content-Length header, fallback to parallel 1\n": "La url no indica Content-Length, se usa una sola conexión\n",
+		"Target url is not supported range download, fallback to parallel 1\n":   "La url no admite rangos, se usa una sola conexión\n",
+	},
+}
+
+// messages is the catalog in use, nil for english
+var messages map[string]string
+
+// systemLanguage returns the language of the messages of the locale, from LC_ALL, LC_MESSAGES or LANG.
+func systemLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// languageCandidates returns the catalogs to look for a locale such as pt_BR.UTF-8 in, pt_BR then pt.
+func languageCandidates(locale string) []string {
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	locale = strings.ReplaceAll(locale, "-", "_")
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+	candidates := []string{locale}
+	if i := strings.Index(locale, "_"); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	for i := range candidates {
+		candidates[i] = strings.ToLower(candidates[i])
+	}
+	return candidates
+}
+
+// catalogPath is the file translations of `lang` are read from.
+func catalogPath(lang string) string {
+	return filepath.Join(configDir(), "messages", lang+".json")
+}
+
+// readCatalog returns the translations of `locale`, the built in ones overridden by those of its
+// file, or nil for english.
+func readCatalog(locale string) (map[string]string, error) {
+	for _, lang := range languageCandidates(locale) {
+		catalog := make(map[string]string)
+		for english, translated := range catalogs[lang] {
+			catalog[english] = translated
+		}
+		raw, err := ioutil.ReadFile(catalogPath(lang))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			var custom map[string]string
+			if err := json.Unmarshal(raw, &custom); err != nil {
+				return nil, fmt.Errorf("invalid catalog %s: %v", catalogPath(lang), err)
+			}
+			for english, translated := range custom {
+				catalog[english] = translated
+			}
+		}
+		if len(catalog) > 0 {
+			return catalog, nil
+		}
+	}
+	return nil, nil
+}
+
+// SetLanguage shows the messages in `locale` such as de or fr_FR.UTF-8, or in the language of the
+// system when it is empty. Messages without a translation stay in english, only a language given
+// explicitly without any is an error.
+func SetLanguage(locale string) error {
+	given := locale != ""
+	if !given {
+		locale = systemLanguage()
+	}
+	catalog, err := readCatalog(locale)
+	if err != nil {
+		return err
+	}
+	if given && catalog == nil && len(languageCandidates(locale)) > 0 && !strings.HasPrefix(strings.ToLower(locale), "en") {
+		return fmt.Errorf("no translation of the messages in %s, add them to %s", locale, catalogPath(languageCandidates(locale)[0]))
+	}
+	messages = catalog
+	return nil
+}
+
+// translate returns the translation of `message` in the language of the messages.
+func translate(message string) string {
+	if translated, ok := messages[message]; ok {
+		return translated
+	}
+	return message
+}
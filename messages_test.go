@@ -0,0 +1,45 @@
+package hget
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetLanguage(t *testing.T) {
+	defer func(config string, current map[string]string) {
+		os.Setenv("XDG_CONFIG_HOME", config)
+		messages = current
+	}(os.Getenv("XDG_CONFIG_HOME"), messages)
+	os.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	if err := SetLanguage("de_DE.UTF-8"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got := translate("Verified %s\n"); got != "%s geprüft\n" {
+		t.Fatalf("expected the german message, got %q", got)
+	}
+	if got := translate("not in the catalog"); got != "not in the catalog" {
+		t.Fatalf("messages without a translation should stay in english, got %q", got)
+	}
+
+	// catalogs of the config folder add languages and override the built in translations
+	folder := filepath.Join(configDir(), "messages")
+	os.MkdirAll(folder, 0755)
+	ioutil.WriteFile(filepath.Join(folder, "it.json"), []byte(`{"Verified %s\n": "%s verificato\n"}`), 0644)
+	ioutil.WriteFile(filepath.Join(folder, "fr.json"), []byte(`{"Verified %s\n": "%s contrôlé\n"}`), 0644)
+	if err := SetLanguage("it_IT"); err != nil || translate("Verified %s\n") != "%s verificato\n" {
+		t.Fatalf("expected the italian message of the catalog file, got %q, %v", translate("Verified %s\n"), err)
+	}
+	if err := SetLanguage("fr"); err != nil || translate("Verified %s\n") != "%s contrôlé\n" || translate("Resolve ip: %s\n") != "Adresse résolue : %s\n" {
+		t.Fatalf("the catalog file should override the built in messages, got %q, %v", translate("Verified %s\n"), err)
+	}
+
+	if err := SetLanguage("C"); err != nil || translate("Verified %s\n") != "Verified %s\n" {
+		t.Fatalf("the C locale should be in english, got %v", err)
+	}
+	if err := SetLanguage("ja_JP"); err == nil {
+		t.Fatalf("a language given without any translation should fail")
+	}
+}
@@ -0,0 +1,56 @@
+package hget
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// mirrorFlag collects the `-mirror URL` flags, other urls of the same file.
+type mirrorFlag []string
+
+func (f *mirrorFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *mirrorFlag) Set(value string) error {
+	if !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+		return fmt.Errorf("mirror should be a http or https url, got %q", value)
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+var mirrorURLs mirrorFlag
+
+// sources returns the urls the file can be downloaded from, the url of the task first.
+func (d *HTTPDownloader) sources() []string {
+	return append([]string{d.url}, d.mirrors...)
+}
+
+// addMirrors adds the `urls` which are not a source yet.
+func (d *HTTPDownloader) addMirrors(urls []string) {
+	for _, url := range urls {
+		known := false
+		for _, source := range d.sources() {
+			known = known || source == url
+		}
+		if !known {
+			d.mirrors = append(d.mirrors, url)
+		}
+	}
+}
+
+// sameFile makes sure the range a mirror answered with belongs to a file as long as ours.
+func (d *HTTPDownloader) sameFile(resp *http.Response) error {
+	var start, end, total int64
+	contentRange := resp.Header.Get("Content-Range")
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total); err != nil {
+		return fmt.Errorf("%s answered with an invalid Content-Range %q", resp.Request.URL.Host, contentRange)
+	}
+	// the last part ends at the length of the file
+	if length := d.parts[len(d.parts)-1].RangeTo; total != length {
+		return fmt.Errorf("%s has a file of %d bytes instead of %d", resp.Request.URL.Host, total, length)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMirrorTakesOver(t *testing.T) {
+	displayProgress = false
+	content := strings.Repeat("0123456789", 100)
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			http.Error(w, "broken", http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, "mirror.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer origin.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "mirror.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer mirror.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "mirror.bin", time.Time{}, strings.NewReader(content[:500]))
+	}))
+	defer other.Close()
+
+	url := origin.URL + "/mirror.bin"
+	defer os.RemoveAll(FolderOf(url))
+	d := NewHTTPDownloader(url, 2, true, "", "")
+	d.addMirrors([]string{other.URL + "/mirror.bin", mirror.URL + "/mirror.bin", url})
+	if len(d.mirrors) != 2 {
+		t.Fatalf("the url of the task is not a mirror of itself, got %v", d.mirrors)
+	}
+
+	doneChan := make(chan bool, 1)
+	fileChan := make(chan string, 2)
+	errorChan := make(chan error, 1)
+	stateChan := make(chan Part, 2)
+	interruptChan := make(chan bool, 2)
+	go d.Do(doneChan, fileChan, errorChan, interruptChan, stateChan)
+
+	var files []string
+	for {
+		select {
+		case f := <-fileChan:
+			files = append(files, f)
+		case <-stateChan:
+		case err := <-errorChan:
+			t.Fatalf("err should be nil, got %v", err)
+		case <-doneChan:
+			for len(fileChan) > 0 {
+				files = append(files, <-fileChan)
+			}
+			out := filepath.Join(t.TempDir(), "mirror.bin")
+			if err := JoinFile(files, out, nil, nil); err != nil {
+				t.Fatalf("err should be nil, got %v", err)
+			}
+			joined, _ := ioutil.ReadFile(out)
+			if string(joined) != content {
+				t.Fatalf("joined content is different from the original")
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package hget
+
+var raiseNoFile = false
+
+// fdsPerPart are the files a running part keeps open, its connection and its part file
+var fdsPerPart uint64 = 2
+
+// fdReserve are the files left for everything else, the standard streams, the state, the task log,
+// the control socket, dns lookups and the peers
+var fdReserve uint64 = 64
+
+// openFileParts is how many parts may run at the same time within the open file limit, 0 when unlimited
+var openFileParts = 0
+
+// applyOpenFileLimit raises the soft limit of open files with -raise-nofile, and staggers the parts of
+// the downloads when -n needs more files than the limit allows, instead of failing halfway through.
+func applyOpenFileLimit() {
+	if raiseNoFile {
+		if err := raiseOpenFileLimit(); err != nil {
+			Warnf("could not raise the open file limit: %v\n", err)
+		}
+	}
+	soft, ok := openFileLimit()
+	if !ok {
+		return
+	}
+	openFileParts = partsWithin(soft)
+	if connections > openFileParts {
+		hint := ", -raise-nofile raises it"
+		if raiseNoFile {
+			hint = ""
+		}
+		Warnf("-n %d needs more than the limit of %d open files, downloading %d parts at a time%s\n", connections, soft, openFileParts, hint)
+	}
+}
+
+// partsWithin returns how many parts may run at the same time with `limit` open files.
+func partsWithin(limit uint64) int {
+	if limit <= fdReserve+fdsPerPart {
+		return 1
+	}
+	return int((limit - fdReserve) / fdsPerPart)
+}
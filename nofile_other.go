@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package hget
+
+import "errors"
+
+// openFileLimit returns the soft limit of open files of hget, there is none here.
+func openFileLimit() (uint64, bool) {
+	return 0, false
+}
+
+func raiseOpenFileLimit() error {
+	return errors.New("not supported on this platform")
+}
@@ -0,0 +1,45 @@
+package hget
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestPartsWithinOpenFileLimit(t *testing.T) {
+	if n := partsWithin(1024); n != 480 {
+		t.Fatalf("1024 open files should take 480 parts, got %d", n)
+	}
+	if n := partsWithin(10); n != 1 {
+		t.Fatalf("a part should always be downloaded, got %d", n)
+	}
+
+	defer func(parts int, low bool) { openFileParts, lowMemory = parts, low }(openFileParts, lowMemory)
+	openFileParts, lowMemory = 0, false
+	if partSlots() != nil {
+		t.Fatalf("the parts should not be limited")
+	}
+	openFileParts = 8
+	if slots := partSlots(); cap(slots) != 8 {
+		t.Fatalf("8 parts should run at a time, got %d", cap(slots))
+	}
+	lowMemory = true
+	if slots := partSlots(); cap(slots) != lowMemoryParts {
+		t.Fatalf("the lower limit should win, got %d", cap(slots))
+	}
+}
+
+func TestApplyOpenFileLimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("open file limits are read on linux")
+	}
+	defer func(parts int, n int) { openFileParts, connections = parts, n }(openFileParts, connections)
+	soft, ok := openFileLimit()
+	if !ok || soft == 0 {
+		t.Fatalf("the open file limit should be known")
+	}
+	connections = 1 << 30
+	applyOpenFileLimit()
+	if openFileParts != partsWithin(soft) {
+		t.Fatalf("the parts should be limited to %d, got %d", partsWithin(soft), openFileParts)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package hget
+
+import "syscall"
+
+const openMax = 10240
+
+// openFileLimit returns the soft limit of open files of hget.
+func openFileLimit() (uint64, bool) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, false
+	}
+	return uint64(limit.Cur), true
+}
+
+// raiseOpenFileLimit raises the soft limit of open files to the hard one.
+func raiseOpenFileLimit() error {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return err
+	}
+	if limit.Cur == limit.Max {
+		return nil
+	}
+	limit.Cur = limit.Max
+	err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit)
+	if err != nil && limit.Max > openMax {
+		// macOS refuses an unlimited soft limit, OPEN_MAX is the most it takes
+		limit.Cur = openMax
+		err = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit)
+	}
+	return err
+}
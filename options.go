@@ -0,0 +1,331 @@
+package hget
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var connections = runtime.NumCPU()
+var skipTLS = true
+var proxyServer = ""
+var urlFile = ""
+var bwLimit = ""
+
+// Option describes a command line flag once, it is used to parse the flag and to render the help and the man page.
+type Option struct {
+	Name string
+	// Value points to the variable set by the flag, a *bool, *int, *string, *time.Duration or a flag.Value
+	Value interface{}
+	// Arg names the value of the flag in the help
+	Arg string
+	// Env is the environment variable of the option, when it is not derived from its name
+	Env      string
+	Usage    string
+	Examples []string
+}
+
+// options are all the flags of hget, in the order they are shown
+var options = []Option{
+	{Name: "n", Value: &connections, Arg: "connections", Env: "HGET_CONNECTIONS", Usage: "number of connections, the file is split into as many parts"},
+	{Name: "file", Value: &urlFile, Arg: "path", Usage: "file that contains links in each line, or a metalink, or the JSON list of a browser extension or download manager with referrers and cookies, downloaded one after another"},
+	{Name: "report", Value: &reportPath, Arg: "path", Usage: "list every download of -file, watch, feed and daemon with its status, output, size, sha256, duration and error in this JSON file, or CSV if it ends with .csv; failed downloads of -file no longer stop the others"},
+	{Name: "data-dir", Value: &dataPath, Arg: "path", Usage: "folder the tasks are kept in, the StateDirectory of the systemd unit or else $HOME/.hget if empty"},
+	{Name: "work-dir", Value: &workDir, Arg: "path", Usage: "folder the parts are written to while downloading, such as a scratch disk, they are moved to the folder of the task when it is interrupted"},
+	{Name: "o", Value: &shortOutput, Arg: "path", Usage: "output file, or a device such as /dev/sdX or /dev/null which parts are written to directly"},
+	{Name: "output", Value: &longOutput, Arg: "path", Usage: "the same as -o, for scripts spelling it --output"},
+	{Name: "dir", Value: &outputDir, Arg: "path", Usage: "folder the downloaded file is saved into rather than the current one, created if missing, a relative -o is in it"},
+	{Name: "rate", Value: &bwLimit, Arg: "limit", Usage: "bandwidth limit to use while downloading",
+		Examples: []string{"-rate 10kB", "-rate 10MiB"}},
+	{Name: "quota", Value: &quotaSpec, Arg: "size/period", Env: "HGET_QUOTA", Usage: "bytes every hget sharing the data folder may download per day or month, downloads are paused once they are used up and resumed in the next period",
+		Examples: []string{"-quota 100GiB/month", "-quota 2GB/day"}},
+	{Name: "proxy", Value: &proxyServer, Arg: "address", Usage: "proxy for downloading",
+		Examples: []string{"-proxy '127.0.0.1:12345' for socks5 proxy", "-proxy 'http://proxy.com:8080' for http proxy"}},
+	{Name: "proxy-pac", Value: &proxyPAC, Arg: "url", Env: "HGET_PROXY_PAC", Usage: "proxy auto-config file or url whose FindProxyForURL picks the proxy of every download, the first one it lists is used"},
+	{Name: "skip-tls", Value: &skipTLS, Usage: "skip verify certificate for https"},
+	{Name: "checksum", Value: &checksum, Arg: "algo:hex", Usage: "verify the downloaded file against a checksum, md5, sha1, sha256 and sha512 are supported",
+		Examples: []string{"-checksum sha256:HEX"}},
+	{Name: "no-hash-cache", Value: &noHashCache, Usage: "hash files again even when their digest is known for their size and modification time, e.g. to look for bit rot"},
+	{Name: "batch", Value: &batchRanges, Arg: "parts", Usage: "request this many parts at once with a single multi range request",
+		Examples: []string{"-n 64 -batch 8 for 64 parts over 8 requests"}},
+	{Name: "compress", Value: &compress, Usage: "ask for a gzip/deflate encoded body when downloading over a single connection, it is decoded while downloading"},
+	{Name: "on-change", Value: &onChange, Arg: "mode", Usage: "what resuming does when the remote file changed size since the task started: restart, truncate (keep the downloaded bytes) or abort"},
+	{Name: "audit", Value: &audit, Usage: "log the status, Content-Range and bytes of every response per part, and check the parts line up before joining"},
+	{Name: "ua", Value: &userAgentName, Arg: "preset", Usage: "User-Agent of every request, one of " + presetNames() + " or sent as given, kept when resuming"},
+	{Name: "ua-random", Value: &userAgentRandom, Usage: "pick the User-Agent of a browser at random for the download, kept when resuming"},
+	{Name: "lang", Value: &acceptLanguage, Arg: "preset", Usage: "Accept-Language of every request, one of " + languageNames() + " or sent as given, for hosts picking mirrors or gating content by it"},
+	{Name: "ui-lang", Value: &messagesLanguage, Arg: "locale", Usage: "language of the messages of hget such as de or fr_FR.UTF-8, taken from LC_ALL, LC_MESSAGES or LANG if not set, translations are read from messages/LOCALE.json in the config folder as well"},
+	{Name: "header", Value: extraHeaders, Arg: "'Name: value'", Usage: "header sent with every request, can be repeated, resumed tasks send the headers they were started with",
+		Examples: []string{"-header 'Authorization: Bearer TOKEN'"}},
+	{Name: "preflight", Value: &preflight, Arg: "handler", Usage: "acquire cookies/tokens before downloading",
+		Examples: []string{"-preflight cookies", "-preflight 'my-solver --print-headers'"}},
+	{Name: "resolver", Value: &resolverSpecs, Arg: "command", Usage: "command the url goes through before downloading, it gets HGET_URL and prints the url to download then `Name: value` header lines, can be repeated, built-in resolvers follow for ipfs://, gh:/gl: release assets, GitHub latest release urls and hf: or Hugging Face files",
+		Examples: []string{"-resolver 'region-mirror.sh'", "-resolver './sign.sh --key ~/.sign.key'"}},
+	{Name: "allow-host", Value: &allowHosts, Arg: "hosts", Usage: "comma separated hosts (and their subdomains) downloads and redirects may go to, any host if empty"},
+	{Name: "deny-host", Value: &denyHosts, Arg: "hosts", Usage: "comma separated hosts (and their subdomains) downloads and redirects must not go to"},
+	{Name: "https-only", Value: &httpsOnly, Usage: "refuse plain http urls, including redirects downgrading to http"},
+	{Name: "max-redirects", Value: &maxRedirects, Arg: "n", Usage: "how many redirects are followed before giving up"},
+	{Name: "no-follow", Value: &noFollow, Usage: "fail instead of following redirects"},
+	{Name: "unsafe-redirect-auth", Value: &unsafeRedirectAuth, Usage: "keep sending Authorization and Cookie headers when redirected to another host"},
+	{Name: "pin-target", Value: &pinTarget, Usage: "request every part from the url and the ip the first request was redirected to, and abort when a part comes with another ETag, for CDNs redirecting each request to a different file"},
+	{Name: "race-ips", Value: &raceIPs, Usage: "race connections to all resolved ips and pin the fastest one"},
+	{Name: "manifest", Value: &manifestPath, Arg: "path|url", Usage: "check the downloaded file against the block manifest of hget hash-manifest, or the pieces of a metalink, and download again only the blocks which do not match, such as ones from a LAN peer"},
+	{Name: "range", Value: &rangeSpec, Arg: "from-to", Usage: "download only the bytes from one offset to another, e.g. 100MB-200MB, 1GiB- to the end or -512KiB from the start, still with several connections; the output holds only them"},
+	{Name: "follow", Value: &follow, Usage: "once downloaded, keep requesting what is appended to the file and add it to the output until interrupted, as tail -f does, for logs and files still being written; -interval sets how often (5s if not set)"},
+	{Name: "grow-timeout", Value: &growTimeout, Arg: "duration", Usage: "how long a file the server is still generating, which answers ranges with an unknown length (bytes 0-0/*), may stop growing before it is taken as complete"},
+	{Name: "no-digest", Value: &noDigest, Usage: "do not check the parts against the Content-Digest, Content-MD5, Repr-Digest or Digest the server sends in their headers or trailers"},
+	{Name: "raise-nofile", Value: &raiseNoFile, Usage: "raise the soft limit of open files to the hard one, parts beyond what the limit allows are otherwise downloaded a few at a time"},
+	{Name: "no-hedge", Value: &noHedge, Usage: "do not request the remaining range of a part again on a second connection when it is much slower than the others near the end of the download"},
+	{Name: "spread-ips", Value: &spreadIPs, Usage: "spread the connections of the parts across all resolved ips of the host, such as mirror pools behind DNS round robin, and stop dialing the slow ones"},
+	{Name: "dns-timeout", Value: &dnsTimeout, Arg: "duration", Usage: "how long resolving the host may take, no limit if not set"},
+	{Name: "connect-timeout", Value: &connectTimeout, Arg: "duration", Usage: "how long connecting to the host, or to the proxy, may take, no limit if not set"},
+	{Name: "tls-timeout", Value: &tlsTimeout, Arg: "duration", Usage: "how long the TLS handshake may take, no limit if not set"},
+	{Name: "header-timeout", Value: &headerTimeout, Arg: "duration", Usage: "how long the server may take to answer a request with its headers, raise it for mirrors slow to start sending, no limit if not set"},
+	{Name: "idle-timeout", Value: &idleTimeout, Arg: "duration", Usage: "how long a connection may go without receiving a byte before it is dropped and its part retried, no limit if not set"},
+	{Name: "no-dns-cache", Value: &noDNSCache, Usage: "resolve the host again for every connection instead of caching its addresses"},
+	{Name: "ipfs-gateway", Value: &ipfsGateways, Arg: "urls", Usage: "comma separated ipfs gateways raced for ipfs:// urls"},
+	{Name: "mirror", Value: &mirrorURLs, Arg: "url", Usage: "another url of the same file, parts failing again and again continue from it, can be repeated"},
+	{Name: "rsync-fallback", Value: &rsyncFallback, Arg: "url", Usage: "rsync:// url of the same file, used when downloading over http fails"},
+	{Name: "upload", Value: &upload, Arg: "s3://bucket/key", Usage: "stream the download into a S3 compatible bucket instead of the disk"},
+	{Name: "encrypt", Value: &encrypt, Usage: "encrypt part files with a passphrase (from HGET_PASSPHRASE or prompted) until they are joined, they are decrypted while joining so the joined file and the output are not encrypted"},
+	{Name: "sign-state", Value: &signState, Usage: "sign task state files with a key of the user, and refuse to resume from unsigned or changed ones"},
+	{Name: "sandbox", Value: &sandbox, Usage: "restrict hget to the network, the data folder and the output folder with landlock, for downloads from untrusted sources (linux only); rsync and the program a hook command starts may still run, but not what they start in turn"},
+	{Name: "force-unlock", Value: &forceUnlock, Usage: "take over the lock of a task even if another hget process seems to hold it"},
+	{Name: "fsync", Value: &fsyncMode, Arg: "never|parts|always", Usage: "when part files and the state are synced to the disk: never, when a part stops and the state is saved, or after every write as well, so that a resume after a power loss does not find parts shorter or zeroed behind the state"},
+	{Name: "print-hash", Value: &printHash, Arg: "algo", Usage: "print the md5, sha1, sha256 or sha512 of the downloaded file once complete, computed while joining the parts, to paste into release notes or compare by hand"},
+	{Name: "keep-parts", Value: &keepParts, Usage: "leave the task folder, its parts and a state listing them, once the file is joined, to look into them or verify the file again; remove it with hget cancel"},
+	{Name: "write-buffer", Value: &writeBufferSpec, Arg: "size", Usage: "memory the parts may hold before writing, shared by all of them, each part writes its share in one go once full and one at a time, for spinning disks slowed down by many interleaved streams"},
+	{Name: "io-priority", Value: &ioPriorityLevel, Arg: "level", Usage: "normal, low or idle (only when the disk is not used otherwise), lowers the io priority of hget on linux and flushes writes in small steps, so a background download does not starve databases sharing the disk"},
+	{Name: "low-memory", Value: &lowMemory, Usage: "for routers and NAS boxes, download 2 parts at a time through small buffers and only show the total progress"},
+	{Name: "dest", Value: &watchDest, Arg: "path", Usage: "folder hget watch and hget feed move finished downloads to, they stay in the current folder if empty"},
+	{Name: "interval", Value: &pollInterval, Arg: "duration", Usage: "how often hget watch looks for new files (10s if not set), hget feed polls the feed (1h if not set) and -follow asks for new bytes (5s if not set)"},
+	{Name: "match", Value: &feedMatch, Arg: "regex", Usage: "only download the feed entries whose title or link matches",
+		Examples: []string{"-match '(?i)episode.*\\.mp3$'"}},
+	{Name: "listen", Value: &listenAddress, Arg: "address", Usage: "address hget daemon, hget agent and hget share accept requests on"},
+	{Name: "tls-cert", Value: &daemonCert, Arg: "path", Usage: "certificate hget daemon serves https with, and the gRPC service of contrib/grpc/hget.proto over HTTP/2"},
+	{Name: "tls-key", Value: &daemonKey, Arg: "path", Usage: "private key of -tls-cert"},
+	{Name: "users", Value: &daemonUsers, Arg: "path", Usage: "file of name and token lines, each user of hget daemon gets tasks of their own which the others can neither list nor cancel"},
+	{Name: "daemon-max-connections", Value: &daemonMaxConnections, Arg: "n", Usage: "most connections a download of hget daemon may use, whatever the request asks for"},
+	{Name: "daemon-max-rate", Value: &daemonMaxRate, Arg: "limit", Usage: "highest bandwidth a download of hget daemon may use, whatever the request asks for"},
+	{Name: "daemon-max-size", Value: &daemonMaxSize, Arg: "size", Usage: "largest file hget daemon downloads, larger ones fail before anything is written"},
+	{Name: "token", Value: &webhookToken, Arg: "secret", Usage: "token webhooks have to send to hget daemon, agents to each other and clients to hget share, better given as HGET_TOKEN"},
+	{Name: "peer", Value: &sharePeers, Usage: "take parts from other hget -peer instances on the LAN downloading the same version of the url, found over mDNS, checked against the -manifest which is needed for it, and share our complete parts with them"},
+	{Name: "agents", Value: &clusterAgents, Arg: "host:port,...", Usage: "experimental, spread the parts across these hget agents, which fetch them with their own bandwidth"},
+	{Name: "prefix-hook", Value: &prefixHook, Arg: "command|url", Usage: "run the command, or POST JSON to the url, every time another -prefix-every bytes from the start of the file are downloaded and once it is complete, the command gets HGET_PREFIX, HGET_PARTS (the part files holding them, in order), HGET_PATH and HGET_COMPLETE"},
+	{Name: "prefix-every", Value: &prefixEvery, Arg: "size", Usage: "how many more bytes from the start of the file -prefix-hook waits for between events"},
+	{Name: "detach", Value: &detach, Usage: "download in the background, printing the task and its control socket, hget attach TASK shows the progress and the logs go to the task log"},
+	{Name: "on-hangup", Value: &onHangup, Arg: "stop|detach", Usage: "what a download does when its terminal hangs up, such as an ssh session closing: stop and save its state as on ctrl-c, or detach and go on, writing its logs and progress to the task log shown by hget tasks show TASK --log"},
+	{Name: "q", Value: &quiet, Usage: "write nothing but a last line for scripts, OK path size sha256 or ERR code message, the code is the exit status: 1 failure, 2 usage, 3 checksum mismatch, 4 interrupted, 5 temporary failure saved to resume later"},
+	{Name: "json", Value: &jsonProgress, Usage: "report progress as JSON lines on stdout, with the source, ip, retries and speed of each connection, logs go to stderr"},
+	{Name: "title", Value: &terminalTitle, Usage: "show the progress in the terminal title and taskbar (OSC 9;4)"},
+	{Name: "profile", Value: &profileName, Arg: "name", Usage: "apply the options of the [name] section of the config file on top of those for every download"},
+	{Name: "y", Value: &assumeYes, Usage: "answer yes to every confirmation"},
+}
+
+// exclusiveOptions are pairs of options which can not be given together
+var exclusiveOptions = [][2]string{
+	{"upload", "o"},
+	{"upload", "encrypt"},
+	{"no-follow", "max-redirects"},
+	{"compress", "batch"},
+	{"race-ips", "proxy"},
+	{"spread-ips", "proxy"},
+	{"proxy-pac", "proxy"},
+	{"spread-ips", "race-ips"},
+	{"pin-target", "spread-ips"},
+	{"pin-target", "agents"},
+	{"agents", "batch"},
+	{"ua", "ua-random"},
+	{"prefix-hook", "encrypt"},
+	{"prefix-hook", "upload"},
+	{"follow", "upload"},
+	{"range", "upload"},
+	{"range", "follow"},
+	{"range", "prefix-hook"},
+	{"manifest", "range"},
+	{"manifest", "upload"},
+	{"q", "json"},
+	{"print-hash", "upload"},
+	{"upload", "output"},
+	{"upload", "dir"},
+}
+
+// commands are the ways to run hget, as shown in the help and the man page
+var commands = [][2]string{
+	{"hget [options] URL", "download URL"},
+	{"hget [options] -file path", "download every url listed in the file"},
+	{"hget [options] resume TASK", "continue an interrupted download"},
+	{"hget attach TASK", "draw the progress bars of a running download, such as one started with -detach or by hget daemon, from another terminal or ssh session"},
+	{"hget tasks", "list interrupted downloads"},
+	{"hget [-y] cancel TASK", "stop a running download, or forget an interrupted one, removing its parts"},
+	{"hget tasks eta TASK", "estimate the remaining time of a task"},
+	{"hget tasks show TASK --log", "show a task and the log of its requests, retries and interruptions"},
+	{"hget tasks progress TASK", "show how a task advanced across its sessions, with the speed between snapshots taken every 30s"},
+	{"hget tasks export TASK > task.tar", "bundle a task with its downloaded parts"},
+	{"hget tasks import task.tar", "continue an exported task, e.g. on another machine"},
+	{"hget from-curl 'curl ...'", "print the hget command of a curl or wget command copied from a browser, --config prints a config profile"},
+	{"hget zip ls URL", "list the members of a zip archive, only its central directory is downloaded"},
+	{"hget [-o path] zip get URL member", "download one member of a zip archive, only its central directory and the member are downloaded"},
+	{"hget [options] package pypi|conda|apt INDEX NAME==VERSION|FILE", "download a package from an index, or a mirror of it, verified with the checksum the index lists, INDEX is a simple index such as https://pypi.org/simple, a conda channel subdir or an apt dists/SUITE/COMPONENT/binary-ARCH folder"},
+	{"hget [-n connections] repair FILE URL MANIFEST", "download again only the blocks of FILE which do not match MANIFEST, of hget hash-manifest or a metalink with pieces, a file or an url"},
+	{"hget hash-manifest FILE [SIZE] > FILE.blocks", "print the sha256 of every block of FILE, 1MiB if SIZE is not given, for hget repair and -manifest"},
+	{"hget verify FILE algo:hex", "check a file against a checksum, digests of unchanged files are remembered"},
+	{"hget [options] watch DIR", "download the urls of .url, .txt and .metalink files dropped into DIR"},
+	{"hget [options] feed URL", "download the new enclosures of a RSS or Atom feed, polling it"},
+	{"hget [options] daemon", "download the urls POSTed to /downloads one after another, GET /downloads shows the current one and / a dashboard"},
+	{"hget [options] share [DIR]", "serve the downloaded files of DIR, or of the current folder, with ranges to other machines"},
+	{"hget [options] agent", "fetch ranges for another hget given -agents (experimental)"},
+	{"hget self-update", "replace hget with its latest release"},
+	{"hget man", "print the man page"},
+}
+
+// RegisterOptions defines every option on `fs`, with the current value of its variable as default.
+func RegisterOptions(fs *flag.FlagSet) {
+	for _, o := range options {
+		switch v := o.Value.(type) {
+		case *bool:
+			fs.BoolVar(v, o.Name, *v, o.Usage)
+		case *int:
+			fs.IntVar(v, o.Name, *v, o.Usage)
+		case *string:
+			fs.StringVar(v, o.Name, *v, o.Usage)
+		case *time.Duration:
+			fs.DurationVar(v, o.Name, *v, o.Usage)
+		case flag.Value:
+			fs.Var(v, o.Name, o.Usage)
+		default:
+			panic(fmt.Sprintf("option -%s has an unsupported type %T", o.Name, o.Value))
+		}
+	}
+}
+
+// envName returns the environment variable setting `o`, e.g. HGET_PROXY for -proxy.
+func envName(o Option) string {
+	if o.Env != "" {
+		return o.Env
+	}
+	return "HGET_" + strings.ToUpper(strings.ReplaceAll(o.Name, "-", "_"))
+}
+
+// ApplyEnvironment sets the options of `fs` from their HGET_* environment variables,
+// it has to run before parsing the command line so that flags take precedence.
+func ApplyEnvironment(fs *flag.FlagSet) error {
+	for _, o := range options {
+		value, ok := os.LookupEnv(envName(o))
+		if !ok {
+			continue
+		}
+		if err := fs.Set(o.Name, value); err != nil {
+			return fmt.Errorf("invalid %s: %v", envName(o), err)
+		}
+	}
+	return nil
+}
+
+// ValidateOptions refuses options given on `fs` which exclude each other, and -o and --output naming
+// different files.
+func ValidateOptions(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, pair := range exclusiveOptions {
+		if given[pair[0]] && given[pair[1]] {
+			return fmt.Errorf("-%s and -%s can not be used together", pair[0], pair[1])
+		}
+	}
+	if given["o"] && given["output"] && shortOutput.given != longOutput.given {
+		return fmt.Errorf("-o %s and --output %s name different files", shortOutput.given, longOutput.given)
+	}
+	return nil
+}
+
+// defaultOf returns the default of an option worth showing, nothing for zero values.
+func defaultOf(fs *flag.FlagSet, name string) string {
+	f := fs.Lookup(name)
+	if f == nil {
+		return ""
+	}
+	switch f.DefValue {
+	case "", "0", "false", "[]":
+		return ""
+	}
+	return f.DefValue
+}
+
+// WriteHelp renders the commands and the options of `fs`.
+func WriteHelp(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprint(w, translate("Usage:\n"))
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-36s %s\n", c[0], translate(c[1]))
+	}
+	fmt.Fprint(w, translate("\nOptions:\n"))
+	for _, o := range options {
+		fmt.Fprintf(w, "  -%s", o.Name)
+		if o.Arg != "" {
+			fmt.Fprintf(w, " %s", o.Arg)
+		}
+		fmt.Fprintf(w, "\n        %s", translate(o.Usage))
+		if def := defaultOf(fs, o.Name); def != "" {
+			fmt.Fprintf(w, " (default %s)", def)
+		}
+		fmt.Fprintf(w, "\n")
+		for _, example := range o.Examples {
+			fmt.Fprintf(w, "            %s\n", example)
+		}
+	}
+	fmt.Fprintf(w, "\nThese options can not be used together:")
+	for _, pair := range exclusiveOptions {
+		fmt.Fprintf(w, " -%s/-%s", pair[0], pair[1])
+	}
+	fmt.Fprintf(w, "\n\nEvery option can also be set with its HGET_ environment variable, e.g. HGET_PROXY for -proxy\nor HGET_CONNECTIONS for -n, and as `name = value` lines in hget/config of the config folder of the user\n(~/.config/hget/config on linux). Flags take precedence over the environment, which takes precedence\nover the config file.\n\nThe aria2c flags -x, -s, -i, -U, --max-download-limit, --all-proxy, --referer, --checksum and\n--check-certificate are understood as well, and -file reads aria2c input files.\n")
+}
+
+// WriteManPage renders the commands and the options of `fs` as a roff man page.
+func WriteManPage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(w, ".TH HGET 1\n.SH NAME\nhget \\- interruptible and resumable download accelerator\n.SH SYNOPSIS\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, ".B %s\n.br\n", roffEscape(c[0]))
+	}
+	fmt.Fprintf(w, ".SH COMMANDS\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roffEscape(c[0]), roffEscape(c[1]))
+	}
+	fmt.Fprintf(w, ".SH OPTIONS\n")
+	for _, o := range options {
+		fmt.Fprintf(w, ".TP\n.B \\-%s", roffEscape(o.Name))
+		if o.Arg != "" {
+			fmt.Fprintf(w, " \\fI%s\\fR", roffEscape(o.Arg))
+		}
+		fmt.Fprintf(w, "\n%s", roffEscape(o.Usage))
+		if def := defaultOf(fs, o.Name); def != "" {
+			fmt.Fprintf(w, " (default %s)", roffEscape(def))
+		}
+		fmt.Fprintf(w, "\n")
+		for _, example := range o.Examples {
+			fmt.Fprintf(w, ".br\n\\fB%s\\fR\n", roffEscape(example))
+		}
+	}
+	fmt.Fprintf(w, ".SH FILES\n.TP\n.B %s\noptions as \\fIname = value\\fR lines, for every download at the top and for \\fB\\-profile\\fR \\fIname\\fR in \\fB[\\fIname\\fB]\\fR sections\n", roffEscape("~/.config/hget/config"))
+	fmt.Fprintf(w, ".SH ENVIRONMENT\nOptions given as flags take precedence over the environment, which takes precedence over the config file.\n\nThe aria2c flags -x, -s, -i, -U, --max-download-limit, --all-proxy, --referer, --checksum and\n--check-certificate are understood as well, and -file reads aria2c input files.\n")
+	for _, o := range options {
+		fmt.Fprintf(w, ".TP\n.B %s\nsets \\-%s\n", roffEscape(envName(o)), roffEscape(o.Name))
+	}
+	fmt.Fprintf(w, ".SH NOTES\nThese options can not be used together:")
+	for _, pair := range exclusiveOptions {
+		fmt.Fprintf(w, " \\-%s/\\-%s", roffEscape(pair[0]), roffEscape(pair[1]))
+	}
+	fmt.Fprintf(w, ".\n")
+}
+
+// roffEscape keeps `s` from being read as roff requests or escapes.
+func roffEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package hget
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateOptions(t *testing.T) {
+	defer func(n int) { upload, output, connections = "", "", n }(connections)
+	fs := flag.NewFlagSet("hget", flag.ContinueOnError)
+	RegisterOptions(fs)
+
+	if err := fs.Parse([]string{"-n", "4", "-upload", "s3://bucket/key", "URL"}); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if err := ValidateOptions(fs); err != nil {
+		t.Fatalf("options should be valid, got %v", err)
+	}
+
+	if err := fs.Parse([]string{"-o", "out", "URL"}); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if err := ValidateOptions(fs); err == nil || !strings.Contains(err.Error(), "-upload and -o") {
+		t.Fatalf("-upload and -o should exclude each other, got %v", err)
+	}
+
+	fs = flag.NewFlagSet("hget", flag.ContinueOnError)
+	RegisterOptions(fs)
+	if err := fs.Parse([]string{"--output", "named.iso", "URL"}); err != nil || output != "named.iso" {
+		t.Fatalf("--output should set the output file, got %q, %v", output, err)
+	}
+
+	fs = flag.NewFlagSet("hget", flag.ContinueOnError)
+	RegisterOptions(fs)
+	fs.Parse([]string{"-o", "named.iso", "--output", "named.iso", "URL"})
+	if err := ValidateOptions(fs); err != nil {
+		t.Fatalf("-o and --output naming the same file should be valid, got %v", err)
+	}
+	fs = flag.NewFlagSet("hget", flag.ContinueOnError)
+	RegisterOptions(fs)
+	fs.Parse([]string{"-o", "a.iso", "--output", "b.iso", "URL"})
+	if err := ValidateOptions(fs); err == nil || !strings.Contains(err.Error(), "name different files") {
+		t.Fatalf("-o and --output naming different files should be refused, got %v", err)
+	}
+}
+
+func TestHelpCoversEveryOption(t *testing.T) {
+	fs := flag.NewFlagSet("hget", flag.ContinueOnError)
+	RegisterOptions(fs)
+
+	var help, man bytes.Buffer
+	WriteHelp(&help, fs)
+	WriteManPage(&man, fs)
+	fs.VisitAll(func(f *flag.Flag) {
+		if !strings.Contains(help.String(), "  -"+f.Name+"\n") && !strings.Contains(help.String(), "  -"+f.Name+" ") {
+			t.Fatalf("help should describe -%s", f.Name)
+		}
+		if !strings.Contains(man.String(), ".B \\-"+roffEscape(f.Name)) {
+			t.Fatalf("man page should describe -%s", f.Name)
+		}
+	})
+	for _, pair := range exclusiveOptions {
+		for _, name := range pair {
+			if fs.Lookup(name) == nil {
+				t.Fatalf("exclusive option -%s does not exist", name)
+			}
+		}
+	}
+}
+
+func TestApplyEnvironment(t *testing.T) {
+	defer func(n int, proxy string) { connections, proxyServer = n, proxy }(connections, proxyServer)
+	os.Setenv("HGET_CONNECTIONS", "3")
+	os.Setenv("HGET_PROXY", "127.0.0.1:1080")
+	defer os.Unsetenv("HGET_CONNECTIONS")
+	defer os.Unsetenv("HGET_PROXY")
+
+	fs := flag.NewFlagSet("hget", flag.ContinueOnError)
+	RegisterOptions(fs)
+	if err := ApplyEnvironment(fs); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if err := fs.Parse([]string{"-n", "8", "URL"}); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if connections != 8 || proxyServer != "127.0.0.1:1080" {
+		t.Fatalf("flags should override the environment, got -n %d -proxy %q", connections, proxyServer)
+	}
+
+	os.Setenv("HGET_CONNECTIONS", "many")
+	if err := ApplyEnvironment(fs); err == nil {
+		t.Fatalf("invalid environment value should fail")
+	}
+}
@@ -0,0 +1,39 @@
+package hget
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// outputDir is the folder downloads are saved into, the current one when empty
+var outputDir = ""
+
+// inOutputDir returns where the file `name` is saved, in -dir unless it is an absolute path.
+func inOutputDir(name string) string {
+	if outputDir == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(outputDir, name)
+}
+
+// prepareOutputDir creates -dir if it does not exist yet, and makes sure files can be saved into it
+// before anything is downloaded.
+func prepareOutputDir() error {
+	if outputDir == "" {
+		return nil
+	}
+	if info, err := os.Stat(outputDir); err == nil && !info.IsDir() {
+		return fmt.Errorf("-dir %s is not a folder", outputDir)
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("could not create -dir %s: %v", outputDir, err)
+	}
+	probe, err := ioutil.TempFile(outputDir, ".hget-probe")
+	if err != nil {
+		return fmt.Errorf("-dir %s is not writable: %v", outputDir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
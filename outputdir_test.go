@@ -0,0 +1,67 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrepareOutputDir(t *testing.T) {
+	defer func() { outputDir, output = "", "" }()
+	root := t.TempDir()
+	outputDir = filepath.Join(root, "storage", "isos")
+	if err := prepareOutputDir(); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if info, err := os.Stat(outputDir); err != nil || !info.IsDir() {
+		t.Fatalf("-dir should be created, got %v", err)
+	}
+	if entries, _ := ioutil.ReadDir(outputDir); len(entries) != 0 {
+		t.Fatalf("checking -dir should leave nothing behind, got %d files", len(entries))
+	}
+
+	if outputOf("http://foo.bar/1.iso") != filepath.Join(outputDir, "1.iso") {
+		t.Fatalf("the download should be saved into -dir, got %s", outputOf("http://foo.bar/1.iso"))
+	}
+	output = "named.iso"
+	if outputOf("http://foo.bar/1.iso") != filepath.Join(outputDir, "named.iso") {
+		t.Fatalf("a relative -o should be in -dir, got %s", outputOf("http://foo.bar/1.iso"))
+	}
+	output = filepath.Join(root, "elsewhere.iso")
+	if outputOf("http://foo.bar/1.iso") != output {
+		t.Fatalf("an absolute -o should be kept, got %s", outputOf("http://foo.bar/1.iso"))
+	}
+
+	outputDir = filepath.Join(root, "file")
+	ioutil.WriteFile(outputDir, []byte("x"), 0644)
+	if err := prepareOutputDir(); err == nil || !strings.Contains(err.Error(), "not a folder") {
+		t.Fatalf("a file should not be taken as -dir, got %v", err)
+	}
+}
+
+func TestDownloadIntoOutputDir(t *testing.T) {
+	displayProgress = false
+	defer func(data string) { dataPath, outputDir = data, "" }(dataPath)
+	dataPath = t.TempDir()
+	content := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "stored.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	outputDir = filepath.Join(t.TempDir(), "storage")
+	if err := prepareOutputDir(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Download(server.URL + "/stored.bin"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(outputDir, "stored.bin")); string(got) != content {
+		t.Fatalf("the file should be saved into -dir, got %q", got)
+	}
+}
@@ -0,0 +1,229 @@
+package hget
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	stdurl "net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+var proxyPAC = ""
+
+// pacScript is the script of -proxy-pac, nil without one
+var pacScript *PAC
+
+// pacMaxDepth is how deep the functions of a script may call each other
+var pacMaxDepth = 100
+
+// pacTimeout is how long a script may run before it is interrupted
+var pacTimeout = 10 * time.Second
+
+// PAC is a proxy auto-config script, its FindProxyForURL picks the proxy of every url.
+type PAC struct {
+	mu   sync.Mutex
+	vm   *goja.Runtime
+	find goja.Callable
+}
+
+// LoadPAC reads the proxy auto-config script at `location`, a http(s) url or a file.
+func LoadPAC(location string) (*PAC, error) {
+	var raw []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		// the script is what tells which proxy to use, it is fetched directly
+		resp, err := http.Get(location)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch the proxy auto-config: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("could not fetch the proxy auto-config: %s", resp.Status)
+		}
+		raw, err = ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch the proxy auto-config: %v", err)
+		}
+	} else if raw, err = ioutil.ReadFile(location); err != nil {
+		return nil, err
+	}
+	pac, err := ParsePAC(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", location, err)
+	}
+	return pac, nil
+}
+
+// ParsePAC runs the proxy auto-config script `src`, which has to define FindProxyForURL.
+func ParsePAC(src string) (*PAC, error) {
+	vm := goja.New()
+	vm.SetMaxCallStackSize(pacMaxDepth)
+	for name, builtin := range pacBuiltins {
+		builtin := builtin
+		vm.Set(name, func(call goja.FunctionCall) goja.Value {
+			return vm.ToValue(builtin(call.Arguments))
+		})
+	}
+	p := &PAC{vm: vm}
+	if err := p.run(func() error {
+		_, err := vm.RunString(src)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	find, ok := goja.AssertFunction(vm.Get("FindProxyForURL"))
+	if !ok {
+		return nil, errors.New("FindProxyForURL is not defined")
+	}
+	p.find = find
+	return p, nil
+}
+
+// FindProxyForURL returns what the script answers for `url`, e.g. "PROXY proxy:8080; DIRECT".
+func (p *PAC) FindProxyForURL(url string, host string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var result goja.Value
+	err := p.run(func() (err error) {
+		result, err = p.find(goja.Undefined(), p.vm.ToValue(url), p.vm.ToValue(host))
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("proxy auto-config: %v", err)
+	}
+	return result.String(), nil
+}
+
+// run calls `f`, interrupting the script if it runs longer than pacTimeout.
+func (p *PAC) run(f func() error) error {
+	timer := time.AfterFunc(pacTimeout, func() {
+		p.vm.Interrupt("timed out")
+	})
+	defer p.vm.ClearInterrupt()
+	defer timer.Stop()
+	return f()
+}
+
+// proxyFor returns the proxy to download `url` through in the form of -proxy, empty to connect directly.
+// The first proxy the script lists is used.
+func (p *PAC) proxyFor(url string) (string, error) {
+	u, err := stdurl.Parse(url)
+	if err != nil {
+		return "", err
+	}
+	result, err := p.FindProxyForURL(url, u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		switch kind := strings.ToUpper(fields[0]); {
+		case kind == "DIRECT":
+			return "", nil
+		case len(fields) != 2:
+		case kind == "PROXY" || kind == "HTTP":
+			return "http://" + fields[1], nil
+		case kind == "HTTPS":
+			return "https://" + fields[1], nil
+		case kind == "SOCKS" || kind == "SOCKS5":
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("proxy auto-config: no usable proxy in %q for %s", result, url)
+}
+
+// pacBuiltin is a function proxy auto-config scripts can call
+type pacBuiltin func(args []goja.Value) interface{}
+
+// pacBuiltins are the functions of proxy auto-config scripts
+var pacBuiltins = map[string]pacBuiltin{
+	"isPlainHostName": func(args []goja.Value) interface{} {
+		return !strings.Contains(pacArg(args, 0), ".")
+	},
+	"dnsDomainIs": func(args []goja.Value) interface{} {
+		return strings.HasSuffix(strings.ToLower(pacArg(args, 0)), strings.ToLower(pacArg(args, 1)))
+	},
+	"localHostOrDomainIs": func(args []goja.Value) interface{} {
+		host, domain := strings.ToLower(pacArg(args, 0)), strings.ToLower(pacArg(args, 1))
+		return host == domain || !strings.Contains(host, ".") && strings.HasPrefix(domain, host+".")
+	},
+	"dnsDomainLevels": func(args []goja.Value) interface{} {
+		return float64(strings.Count(pacArg(args, 0), "."))
+	},
+	"shExpMatch": func(args []goja.Value) interface{} {
+		return shExpMatch(pacArg(args, 0), pacArg(args, 1))
+	},
+	"isResolvable": func(args []goja.Value) interface{} {
+		return pacResolve(pacArg(args, 0)) != nil
+	},
+	"dnsResolve": func(args []goja.Value) interface{} {
+		if ip := pacResolve(pacArg(args, 0)); ip != nil {
+			return ip.String()
+		}
+		return nil
+	},
+	"isInNet": func(args []goja.Value) interface{} {
+		ip, network, mask := pacResolve(pacArg(args, 0)), net.ParseIP(pacArg(args, 1)).To4(), net.ParseIP(pacArg(args, 2)).To4()
+		if ip == nil || network == nil || mask == nil {
+			return false
+		}
+		return ip.Mask(net.IPMask(mask)).Equal(network.Mask(net.IPMask(mask)))
+	},
+	"myIpAddress": func(args []goja.Value) interface{} {
+		// nothing is sent, connecting a udp socket only picks the address of the default route
+		if conn, err := net.Dial("udp", "192.0.2.1:80"); err == nil {
+			defer conn.Close()
+			return conn.LocalAddr().(*net.UDPAddr).IP.String()
+		}
+		return "127.0.0.1"
+	},
+	"alert": func(args []goja.Value) interface{} {
+		Printf("proxy auto-config: %s\n", pacArg(args, 0))
+		return nil
+	},
+}
+
+func pacArg(args []goja.Value, i int) string {
+	if i < len(args) {
+		return args[i].String()
+	}
+	return "undefined"
+}
+
+// pacResolve returns the first IPv4 address of `host`, nil if it has none.
+func pacResolve(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.To4()
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4
+		}
+	}
+	return nil
+}
+
+// shExpMatch matches `s` against the shell expression `pattern`, where * and ? match any character,
+// slashes included.
+func shExpMatch(s string, pattern string) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	matched, _ := regexp.MatchString("^(?s:"+expr+")$", s)
+	return matched
+}
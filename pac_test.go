@@ -0,0 +1,143 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testPAC = `
+/* proxies of the office */
+var proxy = "PROXY proxy.corp:8080";
+
+function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	if (isPlainHostName(host) || dnsDomainIs(host, ".intranet.corp") || host == "127.0.0.1")
+		return "DIRECT";
+	if (isInternal(host))
+		return "DIRECT";
+	if (shExpMatch(url, "*://downloads.*/*")) {
+		return "SOCKS socks.corp:1080; DIRECT";
+	}
+	if (url.substring(0, 6) === 'https:' && host.indexOf("bank") >= 0) {
+		return 'HTTPS secure.corp:443';
+	}
+	return host.length > 30 ? "DIRECT" : proxy + "; DIRECT";
+}
+
+function isInternal(host) {
+	return isInNet(host, "10.0.0.0", "255.0.0.0");
+}
+`
+
+func TestPACProxyFor(t *testing.T) {
+	pac, err := ParsePAC(testPAC)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	for url, want := range map[string]string{
+		"http://nas/file.iso":                        "",
+		"http://build.intranet.corp/file.iso":        "",
+		"http://127.0.0.1:8080/file.iso":             "",
+		"http://downloads.example.org/file.iso":      "socks.corp:1080",
+		"http://10.1.2.3/file.iso":                   "",
+		"http://11.1.2.3/file.iso":                   "http://proxy.corp:8080",
+		"https://mybank.example.org/statement.pdf":   "https://secure.corp:443",
+		"https://Example.org/file.iso":               "http://proxy.corp:8080",
+		"https://a-very-long-host-name.example.org/": "",
+	} {
+		proxy, err := pac.proxyFor(url)
+		if err != nil || proxy != want {
+			t.Fatalf("%s should go through %q, got %q, %v", url, want, proxy, err)
+		}
+	}
+}
+
+func TestParsePACErrors(t *testing.T) {
+	for _, src := range []string{
+		"var a = 1;",
+		"function FindProxyForURL(url, host) { return 'DIRECT' ",
+		"function FindProxyForURL(url, host) { return \"DIRECT; }",
+	} {
+		if _, err := ParsePAC(src); err == nil {
+			t.Fatalf("%q should be refused", src)
+		}
+	}
+
+	pac, err := ParsePAC("function FindProxyForURL(url, host) { return FindProxyForURL(url, host); }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pac.proxyFor("http://a.org/"); err == nil {
+		t.Fatalf("endless recursion should fail")
+	}
+	defer func(timeout time.Duration) { pacTimeout = timeout }(pacTimeout)
+	pacTimeout = 100 * time.Millisecond
+	pac, _ = ParsePAC("function FindProxyForURL(url, host) { for (;;) {} }")
+	if _, err := pac.proxyFor("http://a.org/"); err == nil {
+		t.Fatalf("endless loops should be interrupted")
+	}
+	if _, err := ParsePAC("for (;;) {}"); err == nil {
+		t.Fatalf("endless loops while loading should be interrupted")
+	}
+	pac, _ = ParsePAC("function FindProxyForURL(url, host) { return unknown(host); }")
+	if _, err := pac.proxyFor("http://a.org/"); err == nil {
+		t.Fatalf("unknown functions should fail")
+	}
+	pac, _ = ParsePAC("function FindProxyForURL(url, host) { return 'PROXY'; }")
+	if _, err := pac.proxyFor("http://a.org/"); err == nil {
+		t.Fatalf("a proxy without address should fail")
+	}
+}
+
+func TestLoadPAC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.pac")
+	ioutil.WriteFile(path, []byte(testPAC), 0600)
+	pac, err := LoadPAC(path)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if proxy, _ := pac.proxyFor("http://a.org/file.iso"); proxy != "http://proxy.corp:8080" {
+		t.Fatalf("unexpected proxy %q", proxy)
+	}
+	if !shExpMatch("http://a.org/x/y.iso", "*.org/*") || shExpMatch("a.org", "*.com") || !shExpMatch("a1", "a?") {
+		t.Fatalf("shExpMatch should match across slashes")
+	}
+}
+
+func TestPACProxyIsUsed(t *testing.T) {
+	var proxied []string
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a proxy gets the absolute url of the file
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte("through the proxy"))
+	}))
+	defer proxyServer.Close()
+
+	address := strings.TrimPrefix(proxyServer.URL, "http://")
+	pac, err := ParsePAC("function FindProxyForURL(url, host) { return 'PROXY " + address + "'; }")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	proxy, err := pac.proxyFor("http://downloads.example/file.iso")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	resp, err := ProxyAwareHTTPClient(proxy).Get("http://downloads.example/file.iso")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "through the proxy" || len(proxied) != 1 || proxied[0] != "http://downloads.example/file.iso" {
+		t.Fatalf("the request should go through the proxy, got %q and %v", body, proxied)
+	}
+
+	if _, err := ProxyAwareHTTPClient("ftp://" + address).Get("http://downloads.example/file.iso"); err == nil || !strings.Contains(err.Error(), "should be a http://") {
+		t.Fatalf("an unknown proxy scheme should fail the request, got %v", err)
+	}
+}
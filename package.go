@@ -0,0 +1,304 @@
+package hget
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	stdurl "net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// packageIndexes are the indexes hget package reads, and how it finds an artifact in each
+var packageIndexes = map[string]func(index string, spec packageSpec) (url string, sum string, err error){
+	"pypi":  pypiArtifact,
+	"conda": condaArtifact,
+	"apt":   aptArtifact,
+}
+
+// packageSpec is a package as NAME==VERSION, or one of its files by name.
+type packageSpec struct {
+	name    string
+	version string
+	file    string
+}
+
+func (s packageSpec) String() string {
+	if s.file != "" {
+		return s.file
+	}
+	return s.name + "==" + s.version
+}
+
+// parsePackageSpec parses NAME==VERSION, anything else is the name of a file.
+func parsePackageSpec(spec string) (packageSpec, error) {
+	if fields := strings.SplitN(spec, "==", 2); len(fields) == 2 {
+		if fields[0] == "" || fields[1] == "" {
+			return packageSpec{}, fmt.Errorf("package should be NAME==VERSION or a file name, got %q", spec)
+		}
+		return packageSpec{name: fields[0], version: fields[1]}, nil
+	}
+	if spec == "" || strings.ContainsAny(spec, "/=") {
+		return packageSpec{}, fmt.Errorf("package should be NAME==VERSION or a file name, got %q", spec)
+	}
+	return packageSpec{file: spec}, nil
+}
+
+// PackageArtifact looks `spec` up in the index of `kind`, pypi, conda or apt, at `index` and returns
+// the url of its file with the checksum the index lists for it.
+func PackageArtifact(kind string, index string, spec string) (string, string, error) {
+	lookup, ok := packageIndexes[kind]
+	if !ok {
+		return "", "", fmt.Errorf("unknown package index %q, expected pypi, conda or apt", kind)
+	}
+	s, err := parsePackageSpec(spec)
+	if err != nil {
+		return "", "", err
+	}
+	url, sum, err := lookup(strings.TrimSuffix(index, "/"), s)
+	if err != nil {
+		return "", "", err
+	}
+	Printf("%s of %s is %s, expecting %s\n", s, index, url, sum)
+	return url, sum, nil
+}
+
+// fetchIndex returns the body of `url`, gunzipped when it ends with .gz, and its content type.
+func fetchIndex(url string, accept string) ([]byte, string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := resolverClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("could not read the index %s: %s", url, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if strings.HasSuffix(url, ".gz") {
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, "", err
+		}
+		if body, err = ioutil.ReadAll(r); err != nil {
+			return nil, "", err
+		}
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+// pypiSeparators are what PEP 503 folds into a dash in the names of projects
+var pypiSeparators = regexp.MustCompile(`[-_.]+`)
+
+// pypiName returns the normalized name of a python project.
+func pypiName(name string) string {
+	return strings.ToLower(pypiSeparators.ReplaceAllString(name, "-"))
+}
+
+// pypiProjectOf returns the project of the file of a release, its name up to the version.
+func pypiProjectOf(file string) string {
+	for i := 0; i+1 < len(file); i++ {
+		if file[i] == '-' && file[i+1] >= '0' && file[i+1] <= '9' {
+			return file[:i]
+		}
+	}
+	return file
+}
+
+// pypiLink matches the links of the html page of a project in a simple index
+var pypiLink = regexp.MustCompile(`<a\s[^>]*href="([^"]+)"[^>]*>([^<]+)</a>`)
+
+// pypiArtifact finds the file in the simple index (PEP 503 and 691) at `index`, such as
+// https://pypi.org/simple, the source distribution of NAME==VERSION unless a file is named.
+func pypiArtifact(index string, spec packageSpec) (string, string, error) {
+	project := spec.name
+	if spec.file != "" {
+		project = pypiProjectOf(spec.file)
+	}
+	page := index + "/" + pypiName(project) + "/"
+	body, contentType, err := fetchIndex(page, "application/vnd.pypi.simple.v1+json, text/html;q=0.1")
+	if err != nil {
+		return "", "", err
+	}
+
+	type file struct {
+		Filename string            `json:"filename"`
+		URL      string            `json:"url"`
+		Hashes   map[string]string `json:"hashes"`
+	}
+	var files []file
+	if strings.Contains(contentType, "json") {
+		var project struct {
+			Files []file `json:"files"`
+		}
+		if err := json.Unmarshal(body, &project); err != nil {
+			return "", "", err
+		}
+		files = project.Files
+	} else {
+		for _, link := range pypiLink.FindAllSubmatch(body, -1) {
+			f := file{URL: html.UnescapeString(string(link[1])), Filename: strings.TrimSpace(html.UnescapeString(string(link[2]))), Hashes: map[string]string{}}
+			// the hash is in the fragment, as href="...#sha256=HEX"
+			if hash := strings.Index(f.URL, "#"); hash >= 0 {
+				if fields := strings.SplitN(f.URL[hash+1:], "=", 2); len(fields) == 2 {
+					f.Hashes[fields[0]] = fields[1]
+				}
+			}
+			files = append(files, f)
+		}
+	}
+
+	base, err := stdurl.Parse(page)
+	if err != nil {
+		return "", "", err
+	}
+	for _, f := range files {
+		if !pypiMatches(f.Filename, spec) {
+			continue
+		}
+		href, err := base.Parse(f.URL)
+		if err != nil {
+			return "", "", err
+		}
+		href.Fragment = ""
+		sum, ok := f.Hashes["sha256"]
+		if !ok {
+			return "", "", fmt.Errorf("%s lists no sha256 of %s", index, f.Filename)
+		}
+		return href.String(), "sha256:" + sum, nil
+	}
+	return "", "", fmt.Errorf("%s has no file of %s", page, spec)
+}
+
+// pypiMatches tells whether `file` is the named file, or the source distribution of NAME==VERSION.
+func pypiMatches(file string, spec packageSpec) bool {
+	if spec.file != "" {
+		return file == spec.file
+	}
+	for _, ext := range []string{".tar.gz", ".zip"} {
+		if strings.HasSuffix(file, ext) {
+			release := strings.TrimSuffix(file, ext)
+			project := pypiProjectOf(release)
+			return pypiName(project) == pypiName(spec.name) && strings.TrimPrefix(release, project+"-") == spec.version
+		}
+	}
+	return false
+}
+
+// condaArtifact finds the file in the repodata.json of the channel subdir at `index`, such as
+// https://conda.anaconda.org/conda-forge/linux-64, the build of NAME==VERSION with the highest
+// build number unless a file is named, .conda files rather than .tar.bz2 ones of the same build.
+func condaArtifact(index string, spec packageSpec) (string, string, error) {
+	body, _, err := fetchIndex(index+"/repodata.json", "")
+	if err != nil {
+		return "", "", err
+	}
+	type record struct {
+		Name        string `json:"name"`
+		Version     string `json:"version"`
+		BuildNumber int    `json:"build_number"`
+		SHA256      string `json:"sha256"`
+		MD5         string `json:"md5"`
+	}
+	var repodata struct {
+		Packages      map[string]record `json:"packages"`
+		PackagesConda map[string]record `json:"packages.conda"`
+	}
+	if err := json.Unmarshal(body, &repodata); err != nil {
+		return "", "", err
+	}
+
+	best, found := "", record{BuildNumber: -1}
+	for _, packages := range []map[string]record{repodata.PackagesConda, repodata.Packages} {
+		names := make([]string, 0, len(packages))
+		for name := range packages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			r := packages[name]
+			matches := name == spec.file || spec.file == "" && r.Name == spec.name && r.Version == spec.version
+			if matches && r.BuildNumber > found.BuildNumber {
+				best, found = name, r
+			}
+		}
+	}
+	switch {
+	case best == "":
+		return "", "", fmt.Errorf("%s has no file of %s", index, spec)
+	case found.SHA256 != "":
+		return index + "/" + best, "sha256:" + found.SHA256, nil
+	case found.MD5 != "":
+		return index + "/" + best, "md5:" + found.MD5, nil
+	}
+	return "", "", fmt.Errorf("%s lists no checksum of %s", index, best)
+}
+
+// aptArtifact finds the file in the Packages index of the binary-ARCH folder at `index`, such as
+// http://deb.debian.org/debian/dists/bookworm/main/binary-amd64.
+func aptArtifact(index string, spec packageSpec) (string, string, error) {
+	dists := strings.Index(index, "/dists/")
+	if dists < 0 {
+		return "", "", errors.New("the apt index should be a dists/SUITE/COMPONENT/binary-ARCH folder of a mirror")
+	}
+	body, _, err := fetchIndex(index+"/Packages.gz", "")
+	if err != nil {
+		// not every mirror compresses it
+		if body, _, err = fetchIndex(index+"/Packages", ""); err != nil {
+			return "", "", err
+		}
+	}
+
+	var versions []string
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	stanza := map[string]string{}
+	for more := true; more; {
+		more = scanner.Scan()
+		line := scanner.Text()
+		if more && line != "" {
+			if fields := strings.SplitN(line, ":", 2); len(fields) == 2 && !strings.HasPrefix(line, " ") {
+				stanza[fields[0]] = strings.TrimSpace(fields[1])
+			}
+			continue
+		}
+		if len(stanza) == 0 {
+			continue
+		}
+		named := spec.file == "" && stanza["Package"] == spec.name
+		if named {
+			versions = append(versions, stanza["Version"])
+		}
+		if named && stanza["Version"] == spec.version || spec.file != "" && path.Base(stanza["Filename"]) == spec.file {
+			if stanza["SHA256"] == "" {
+				return "", "", fmt.Errorf("%s lists no sha256 of %s", index, spec)
+			}
+			return index[:dists] + "/" + stanza["Filename"], "sha256:" + stanza["SHA256"], nil
+		}
+		stanza = map[string]string{}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+	if len(versions) > 0 {
+		return "", "", fmt.Errorf("%s has no %s, only versions %s", index, spec, strings.Join(versions, ", "))
+	}
+	return "", "", fmt.Errorf("%s has no file of %s", index, spec)
+}
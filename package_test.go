@@ -0,0 +1,112 @@
+package hget
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPackageArtifact(t *testing.T) {
+	var packages bytes.Buffer
+	gz := gzip.NewWriter(&packages)
+	gz.Write([]byte("Package: curl\nVersion: 7.88.1-10\nFilename: pool/main/c/curl/curl_7.88.1-10_amd64.deb\nSHA256: aaaa\nDescription: a tool\n multi line\n\n" +
+		"Package: curl\nVersion: 7.88.1-10+deb12u5\nFilename: pool/main/c/curl/curl_7.88.1-10+deb12u5_amd64.deb\nSHA256: bbbb\n\n"))
+	gz.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/simple/requests/":
+			if strings.Contains(r.Header.Get("Accept"), "json") {
+				w.Header().Set("Content-Type", "application/vnd.pypi.simple.v1+json")
+				w.Write([]byte(`{"files": [
+					{"filename": "requests-2.31.0-py3-none-any.whl", "url": "../../files/requests-2.31.0-py3-none-any.whl", "hashes": {"sha256": "1111"}},
+					{"filename": "requests-2.31.0.tar.gz", "url": "https://files.example.org/requests-2.31.0.tar.gz", "hashes": {"sha256": "2222"}}]}`))
+				return
+			}
+		case "/html/zope-interface/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><a href="../../files/zope.interface-6.0.tar.gz#sha256=3333" data-requires-python="&gt;=3.7">zope.interface-6.0.tar.gz</a></body></html>`))
+			return
+		case "/conda/linux-64/repodata.json":
+			w.Write([]byte(`{"packages": {"numpy-1.26.4-py312h1_2.tar.bz2": {"name": "numpy", "version": "1.26.4", "build_number": 2, "sha256": "4444"}},
+				"packages.conda": {"numpy-1.26.4-py312h1_0.conda": {"name": "numpy", "version": "1.26.4", "build_number": 0, "sha256": "5555"},
+					"numpy-1.26.4-py312h1_2.conda": {"name": "numpy", "version": "1.26.4", "build_number": 2, "md5": "6666"}}}`))
+			return
+		case "/debian/dists/bookworm/main/binary-amd64/Packages.gz":
+			w.Write(packages.Bytes())
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	for _, c := range []struct {
+		kind, index, spec string
+		url, sum          string
+	}{
+		{"pypi", "/simple", "requests==2.31.0", "https://files.example.org/requests-2.31.0.tar.gz", "sha256:2222"},
+		{"pypi", "/simple/", "requests-2.31.0-py3-none-any.whl", "/files/requests-2.31.0-py3-none-any.whl", "sha256:1111"},
+		{"pypi", "/html", "Zope_Interface==6.0", "/files/zope.interface-6.0.tar.gz", "sha256:3333"},
+		{"conda", "/conda/linux-64", "numpy==1.26.4", "/conda/linux-64/numpy-1.26.4-py312h1_2.conda", "md5:6666"},
+		{"conda", "/conda/linux-64", "numpy-1.26.4-py312h1_2.tar.bz2", "/conda/linux-64/numpy-1.26.4-py312h1_2.tar.bz2", "sha256:4444"},
+		{"apt", "/debian/dists/bookworm/main/binary-amd64", "curl==7.88.1-10+deb12u5", "/debian/pool/main/c/curl/curl_7.88.1-10+deb12u5_amd64.deb", "sha256:bbbb"},
+		{"apt", "/debian/dists/bookworm/main/binary-amd64", "curl_7.88.1-10_amd64.deb", "/debian/pool/main/c/curl/curl_7.88.1-10_amd64.deb", "sha256:aaaa"},
+	} {
+		url, sum, err := PackageArtifact(c.kind, server.URL+c.index, c.spec)
+		if strings.HasPrefix(c.url, "/") {
+			c.url = server.URL + c.url
+		}
+		if err != nil || url != c.url || sum != c.sum {
+			t.Fatalf("%s %s resolved to %s %s, %v", c.kind, c.spec, url, sum, err)
+		}
+	}
+
+	for _, c := range []struct{ kind, index, spec, err string }{
+		{"apt", "/debian/dists/bookworm/main/binary-amd64", "curl==8.0", "only versions 7.88.1-10, 7.88.1-10+deb12u5"},
+		{"apt", "/debian", "curl==8.0", "dists/SUITE/COMPONENT/binary-ARCH"},
+		{"pypi", "/simple", "requests==1.0", "has no file of requests==1.0"},
+		{"npm", "/", "left-pad==1.0", "unknown package index"},
+		{"pypi", "/simple", "requests==", "NAME==VERSION"},
+	} {
+		if _, _, err := PackageArtifact(c.kind, server.URL+c.index, c.spec); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("%s %s should fail with %q, got %v", c.kind, c.spec, c.err, err)
+		}
+	}
+}
+
+func TestDownloadPackage(t *testing.T) {
+	displayProgress = false
+	defer func(data string) { dataPath, output, checksum = data, "", "" }(dataPath)
+	dataPath = t.TempDir()
+	content := strings.Repeat("0123456789", 1000)
+	sum := sha256.Sum256([]byte(content))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/simple/pkg/" {
+			fmt.Fprintf(w, `<a href="/files/pkg-1.0.tar.gz#sha256=%s">pkg-1.0.tar.gz</a>`, hex.EncodeToString(sum[:]))
+			return
+		}
+		http.ServeContent(w, r, "pkg-1.0.tar.gz", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	output = filepath.Join(t.TempDir(), "pkg-1.0.tar.gz")
+
+	url, expected, err := PackageArtifact("pypi", server.URL+"/simple", "pkg==1.0")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	checksum = expected
+	if err := Download(url); err != nil {
+		t.Fatalf("the package should download and verify, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(output); string(got) != content {
+		t.Fatalf("unexpected content %q", got)
+	}
+}
@@ -0,0 +1,94 @@
+package hget
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// partName returns the file name of part `index` of `file` holding the bytes `from` to `end` included,
+// such as file.part000001.1048576-2097151, so the folder of a task shows which part holds what. A part
+// whose end is not known yet is named file.part000001 as parts were before.
+func partName(file string, index int64, from int64, end int64) string {
+	// Padding 0 before path name as filename will be sorted as string
+	if end < from {
+		return fmt.Sprintf("%s.part%06d", file, index)
+	}
+	return fmt.Sprintf("%s.part%06d.%d-%d", file, index, from, end)
+}
+
+// parsePartName parses a part file name of either form partName gives, `from` and `end` are -1 for a
+// name without range.
+func parsePartName(name string) (index int64, from int64, end int64, ok bool) {
+	i := strings.LastIndex(name, ".part")
+	if i < 0 {
+		return 0, 0, 0, false
+	}
+	rest := name[i+len(".part"):]
+	digits, ranged := rest, ""
+	if dot := strings.IndexByte(rest, '.'); dot >= 0 {
+		digits, ranged = rest[:dot], rest[dot+1:]
+	}
+	if index, ok = parseDigits(digits); !ok {
+		return 0, 0, 0, false
+	}
+	if digits == rest {
+		return index, -1, -1, true
+	}
+	dash := strings.IndexByte(ranged, '-')
+	if dash < 0 {
+		return 0, 0, 0, false
+	}
+	from, fromOK := parseDigits(ranged[:dash])
+	end, endOK := parseDigits(ranged[dash+1:])
+	if !fromOK || !endOK || end < from {
+		return 0, 0, 0, false
+	}
+	return index, from, end, true
+}
+
+// parseDigits parses a non negative number written with digits only.
+func parseDigits(s string) (int64, bool) {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// adoptPartFiles points the parts of `s` whose file is missing at a file of the same index in the
+// task folder, so a task whose parts were named the other way, by an older hget or by hand, resumes.
+func adoptPartFiles(s *State) {
+	var entries []os.FileInfo
+	for i, part := range s.Parts {
+		if _, err := os.Stat(part.Path); !os.IsNotExist(err) {
+			continue
+		}
+		folder := filepath.Dir(part.Path)
+		if entries == nil {
+			var err error
+			if entries, err = ioutil.ReadDir(folder); err != nil {
+				return
+			}
+		}
+		file := partFileOf(filepath.Base(part.Path))
+		for _, entry := range entries {
+			index, _, _, ok := parsePartName(entry.Name())
+			if ok && index == part.Index && entry.Mode().IsRegular() && partFileOf(entry.Name()) == file {
+				s.Parts[i].Path = filepath.Join(folder, entry.Name())
+				break
+			}
+		}
+	}
+}
+
+// partFileOf returns the name of the file a part file name is a part of.
+func partFileOf(name string) string {
+	if i := strings.LastIndex(name, ".part"); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
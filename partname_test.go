@@ -0,0 +1,95 @@
+package hget
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartNames(t *testing.T) {
+	cases := []struct {
+		name            string
+		index, from, to int64
+		ok              bool
+	}{
+		{"file.part000001", 1, -1, -1, true},
+		{"file.part000001.1048576-2097151", 1, 1048576, 2097151, true},
+		{"my.partition.iso.part000012.0-9", 12, 0, 9, true},
+		{"file.part1234567.5-5", 1234567, 5, 5, true},
+		{"file.part000001.9-0", 0, 0, 0, false},
+		{"file.part000001.9", 0, 0, 0, false},
+		{"file.partial", 0, 0, 0, false},
+		{"file", 0, 0, 0, false},
+	}
+	for _, c := range cases {
+		index, from, to, ok := parsePartName(c.name)
+		if ok != c.ok || index != c.index || from != c.from || to != c.to {
+			t.Fatalf("%s parsed as %d %d-%d %v", c.name, index, from, to, ok)
+		}
+	}
+
+	if name := partName("file", 1, 1048576, 2097151); name != "file.part000001.1048576-2097151" {
+		t.Fatalf("part named %s", name)
+	}
+	if name := partName("file", 0, 0, -1); name != "file.part000000" {
+		t.Fatalf("part of unknown end named %s", name)
+	}
+
+	parts, _ := partCalculate(2, 100, "http://foo.bar/names.bin")
+	if filepath.Base(parts[1].Path) != "names.bin.part000001.50-99" {
+		t.Fatalf("last part named %s", parts[1].Path)
+	}
+	w := &byteWindow{From: 10, To: 30, Length: 100}
+	if parts, _ := w.parts(2, "http://foo.bar/names.bin"); filepath.Base(parts[1].Path) != "names.bin.part000001.20-29" {
+		t.Fatalf("last part of the window named %s", parts[1].Path)
+	}
+}
+
+func TestJoinMixedPartNames(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"file.part000010.10-10", "file.part000002", "file.part000001.1-1", "file.part000000.0-0"}
+	contents := []string{"c", "b", "a", "0"}
+	var files []string
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(contents[i]), 0600); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	out := filepath.Join(dir, "file")
+	if err := JoinFile(files, out, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if joined, _ := ioutil.ReadFile(out); string(joined) != "0abc" {
+		t.Fatalf("parts joined as %q", joined)
+	}
+}
+
+func TestResumeAdoptsPartNames(t *testing.T) {
+	defer func(data string) { dataPath = data }(dataPath)
+	dataPath = t.TempDir()
+	url := "http://foo.bar/adopted.bin"
+	folder := FolderOf(url)
+	os.MkdirAll(folder, 0700)
+	// parts saved under the names of an older hget, or renamed by hand
+	old := filepath.Join(folder, "adopted.bin.part000000")
+	ranged := filepath.Join(folder, "adopted.bin.part000001.50-99")
+	ioutil.WriteFile(old, []byte("x"), 0600)
+	ioutil.WriteFile(ranged, []byte("y"), 0600)
+	s := &State{URL: url, Parts: []Part{
+		{Index: 0, URL: url, Path: filepath.Join(folder, "adopted.bin.part000000.0-49"), RangeFrom: 1, RangeTo: 49},
+		{Index: 1, URL: url, Path: filepath.Join(folder, "adopted.bin.part000001"), RangeFrom: 51, RangeTo: 100},
+	}}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := Resume(TaskFromURL(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Parts[0].Path != old || resumed.Parts[1].Path != ranged {
+		t.Fatalf("resumed parts at %s and %s", resumed.Parts[0].Path, resumed.Parts[1].Path)
+	}
+}
@@ -0,0 +1,299 @@
+package hget
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var sharePeers = false
+
+// peerWait is how long peers get to answer the mDNS query
+var peerWait = time.Second
+
+// peerClient talks to peers directly, they are on the LAN and not behind the proxy of the origin
+var peerClient = &http.Client{}
+
+// peerValidatorHeader and peerVersionHeader tell which version of the file the parts of a peer are of,
+// the validator and version its probe got from the origin
+const (
+	peerValidatorHeader = "Hget-Validator"
+	peerVersionHeader   = "Hget-Version"
+)
+
+// errPeerDamaged is returned when the bytes of a peer do not match the manifest, the peer is dropped.
+var errPeerDamaged = errors.New("the range of the peer does not match the manifest")
+
+// peerKey identifies the download of `url` among peers, only the same version, the one of `validator`, is shared.
+func peerKey(url string, validator string) string {
+	sum := sha1.Sum([]byte(url + "\n" + validator))
+	return hex.EncodeToString(sum[:])
+}
+
+// fileLength is where the last of `parts` ends, the length of the file.
+func fileLength(parts []Part) int64 {
+	return parts[len(parts)-1].RangeTo
+}
+
+// PeerServer shares the part files of a download with other hget instances on the LAN.
+type PeerServer struct {
+	key       string
+	validator string
+	version   string
+	parts     []Part
+	// hashOf returns the hash of what was written to a part
+	hashOf   func(Part) *PartHash
+	verified sync.Map
+	listener net.Listener
+	mdns     *mdnsResponder
+}
+
+// ServePeers shares the parts of `d` over HTTP and announces them over mDNS. Encrypted parts, downloads
+// onto a device and files the origin tells no validator of have nothing to share, nil is returned for them.
+func ServePeers(d *HTTPDownloader) (*PeerServer, error) {
+	if d.key != nil || d.device != "" || d.window != nil || d.validator == "" || len(d.parts) <= 1 {
+		return nil, nil
+	}
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	s := &PeerServer{key: peerKey(d.url, d.validator), validator: d.validator, version: d.version.tag, parts: d.parts, hashOf: d.hashOf, listener: listener}
+	go http.Serve(listener, s)
+
+	s.mdns, err = AnnouncePeer(s.key, listener.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close stops sharing.
+func (s *PeerServer) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mdns.Close()
+	return s.listener.Close()
+}
+
+// ServeHTTP answers a range request with the bytes of the complete and verified part file holding
+// all of it, and 404 while no part does.
+func (s *PeerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/"+s.key {
+		http.NotFound(w, r)
+		return
+	}
+	total := fileLength(s.parts)
+	from, to, err := parseRange(r.Header.Get("Range"), total)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	par := int64(len(s.parts))
+	for _, part := range s.parts {
+		// parts are appended to, the file starts where the part started originally
+		origin := (total / par) * part.Index
+		end := part.RangeTo
+		if part.Index == par-1 {
+			end = total - 1
+		}
+		if from < origin || to > end {
+			continue
+		}
+		f, err := os.Open(part.Path)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		if !s.complete(part, f, end-origin+1) {
+			continue
+		}
+
+		w.Header().Set(peerValidatorHeader, s.validator)
+		w.Header().Set(peerVersionHeader, s.version)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", from, to, total))
+		w.Header().Set(contentLengthHeader, strconv.FormatInt(to-from+1, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		io.Copy(w, io.NewSectionReader(f, from-origin, to-from+1))
+		return
+	}
+	http.Error(w, "range is not downloaded yet", http.StatusNotFound)
+}
+
+// complete tells whether the file `f` of `part` holds all of its `size` bytes, and they match the hash
+// of what was written to it. A part in progress, or damaged on the disk, is not shared.
+func (s *PeerServer) complete(part Part, f *os.File, size int64) bool {
+	if done, ok := s.verified.Load(part.Index); ok {
+		return done.(bool)
+	}
+	stat, err := f.Stat()
+	if err != nil || stat.Size() != size {
+		return false
+	}
+	h := s.hashOf(part)
+	if h == nil || h.Size != size || int64(len(h.Blocks)) != (size+blockSize-1)/blockSize {
+		return false
+	}
+	buf := make([]byte, blockSize)
+	for b, want := range h.Blocks {
+		n, err := f.ReadAt(buf, int64(b)*blockSize)
+		if err != nil && err != io.EOF {
+			return false
+		}
+		if crc32.Checksum(buf[:n], castagnoli) != want {
+			Warnf("part %d is damaged, it is not shared with peers\n", part.Index)
+			s.verified.Store(part.Index, false)
+			return false
+		}
+	}
+	// a complete part is not written to anymore
+	s.verified.Store(part.Index, true)
+	return true
+}
+
+// parseRange parses a single `bytes=from-to` or `bytes=from-` range of a file of `total` bytes.
+func parseRange(header string, total int64) (int64, int64, error) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	bounds := strings.SplitN(spec, "-", 2)
+	if spec == header || len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q", header)
+	}
+	from, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range %q", header)
+	}
+	to := total - 1
+	if bounds[1] != "" {
+		if to, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid range %q", header)
+		}
+	}
+	if from < 0 || from > to || to >= total {
+		return 0, 0, fmt.Errorf("range %q is outside of the file", header)
+	}
+	return from, to, nil
+}
+
+// findPeers looks for peers to take parts from. Their bytes are checked against the blocks of `manifest`,
+// without one, or a validator of the version of the file, no peer is used.
+func (d *HTTPDownloader) findPeers(manifest string) error {
+	switch {
+	case d.key != nil || d.device != "" || d.upload != nil || d.window != nil || len(d.parts) <= 1:
+		return nil
+	case manifest == "":
+		return errors.New("their bytes could not be checked without -manifest")
+	case d.validator == "":
+		return errors.New("the server tells no ETag or Last-Modified, their parts could be of another version")
+	}
+	raw, err := readManifest(manifest)
+	if err != nil {
+		return err
+	}
+	sums, err := parseBlockSums(raw, d.file)
+	if err != nil {
+		return err
+	}
+	if length := fileLength(d.parts); (length+sums.size-1)/sums.size != int64(len(sums.sums)) {
+		return fmt.Errorf("the manifest has %d blocks of %s, not those of a file of %s", len(sums.sums), humanBytes(sums.size), humanBytes(length))
+	}
+	d.peerSums = sums
+	peers, err := DiscoverPeers(peerKey(d.url, d.validator), peerWait)
+	d.peerMu.Lock()
+	d.peers = peers
+	d.peerMu.Unlock()
+	return err
+}
+
+// dropPeer stops taking parts from `peer`.
+func (d *HTTPDownloader) dropPeer(peer string) {
+	d.peerMu.Lock()
+	defer d.peerMu.Unlock()
+	for i, p := range d.peers {
+		if p == peer {
+			d.peers = append(d.peers[:i:i], d.peers[i+1:]...)
+			return
+		}
+	}
+}
+
+// fromPeer asks a peer for the remaining range of `part`, it returns nil when the peer does not have all
+// of it, or has it of another version of the file than the origin.
+func (d *HTTPDownloader) fromPeer(part Part, ranges string) *http.Response {
+	d.peerMu.Lock()
+	if len(d.peers) == 0 || d.par <= 1 || d.peerSums == nil {
+		d.peerMu.Unlock()
+		return nil
+	}
+	peer := d.peers[int(part.Index)%len(d.peers)]
+	d.peerMu.Unlock()
+	req, err := http.NewRequest(http.MethodGet, "http://"+peer+"/"+peerKey(d.url, d.validator), nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Range", ranges)
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return nil
+	}
+	if start, err := rangeStart(resp.Header.Get("Content-Range")); resp.StatusCode != http.StatusPartialContent || err != nil || start != part.RangeFrom {
+		resp.Body.Close()
+		return nil
+	}
+	validator, version := resp.Header.Get(peerValidatorHeader), resp.Header.Get(peerVersionHeader)
+	d.version.mu.Lock()
+	sameVersion := d.version.tag == "" || version == d.version.tag
+	d.version.mu.Unlock()
+	if validator != d.validator || !sameVersion {
+		d.log.Logf("part %d: peer %s has %q of version %q, not %q", part.Index, peer, validator, version, d.validator)
+		resp.Body.Close()
+		d.dropPeer(peer)
+		return nil
+	}
+	return resp
+}
+
+// checkPeerRange checks the `n` bytes a peer sent for `part` against the blocks of the manifest. The
+// blocks only partly in the range are checked once the file is joined.
+func (d *HTTPDownloader) checkPeerRange(part Part, n int64) error {
+	sums := d.peerSums
+	total := fileLength(d.parts)
+	origin := (total / d.par) * part.Index
+	f, err := os.Open(part.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buf := make([]byte, sums.size)
+	for b := (part.RangeFrom + sums.size - 1) / sums.size; b < int64(len(sums.sums)); b++ {
+		start, end := b*sums.size, (b+1)*sums.size
+		if end > total {
+			end = total
+		}
+		if end > part.RangeFrom+n {
+			break
+		}
+		if _, err := f.ReadAt(buf[:end-start], start-origin); err != nil {
+			return err
+		}
+		h := hashes[sums.algo]()
+		h.Write(buf[:end-start])
+		if !bytes.Equal(h.Sum(nil), sums.sums[b]) {
+			return fmt.Errorf("%w at block %d", errPeerDamaged, b)
+		}
+	}
+	return nil
+}
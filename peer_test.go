@@ -0,0 +1,168 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMDNSMessage(t *testing.T) {
+	name := mdnsName(peerKey("http://a.org/1.iso", `"v1"`))
+	question := dnsRecord{Name: name, Type: dnsTypeTXT}
+	answer := dnsRecord{Name: name, Type: dnsTypeTXT, TXT: []string{"port=1234"}}
+
+	id, questions, answers, err := decodeDNS(encodeDNS(7, []dnsRecord{question}, []dnsRecord{answer}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 7 || !reflect.DeepEqual(questions, []dnsRecord{question}) || !reflect.DeepEqual(answers, []dnsRecord{answer}) {
+		t.Fatalf("unexpected message %d %v %v", id, questions, answers)
+	}
+
+	// answers usually point back at the name of the question
+	msg := encodeDNS(0, []dnsRecord{question}, nil)
+	msg[7] = 1
+	msg = append(msg, 0xC0, 12, 0, dnsTypeTXT, 0, dnsClassIN, 0, 0, 0, 120, 0, 4, 3, 'a', '=', 'b')
+	if _, _, answers, err = decodeDNS(msg); err != nil || answers[0].Name != name || answers[0].TXT[0] != "a=b" {
+		t.Fatalf("compressed answer should be read, got %v %v", answers, err)
+	}
+	if _, _, _, err := decodeDNS(msg[:len(msg)-2]); err == nil {
+		t.Fatalf("truncated message should be refused")
+	}
+}
+
+func TestPeerParts(t *testing.T) {
+	displayProgress = false
+	content := strings.Repeat("0123456789", 100)
+	damaged := "x" + content[1:500]
+
+	tests := []struct {
+		name      string
+		first     string
+		validator string
+		origin    int
+	}{
+		// the peer has all of the first half, and a bit of the second one which is not shared
+		{"complete part", content[:500], `"v1"`, 1},
+		{"damaged part", damaged, `"v1"`, 2},
+		{"other version", content[:500], `"v0"`, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if origin := peerDownload(t, content, tt.first, tt.validator); origin != tt.origin {
+				t.Fatalf("expected %d ranges from the origin, %d were", tt.origin, origin)
+			}
+		})
+	}
+}
+
+// peerDownload downloads `content` in 2 parts with a peer holding `first` as its first part, of the version
+// `validator`, and returns how many ranges came from the origin.
+func peerDownload(t *testing.T, content string, first string, validator string) int {
+	var mu sync.Mutex
+	var origin int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if r.Header.Get("Range") != "" {
+			origin++
+		}
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "peer.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+	url := srv.URL + "/peer.bin"
+	defer os.RemoveAll(FolderOf(url))
+
+	dir := t.TempDir()
+	shared := []Part{
+		{Index: 0, Path: filepath.Join(dir, "0"), RangeFrom: 500, RangeTo: 499},
+		{Index: 1, Path: filepath.Join(dir, "1"), RangeFrom: 600, RangeTo: 1000},
+	}
+	ioutil.WriteFile(shared[0].Path, []byte(first), 0600)
+	ioutil.WriteFile(shared[1].Path, []byte(content[500:600]), 0600)
+	hashes := make(map[int64]*PartHash)
+	for _, part := range shared {
+		h := new(blockHasher)
+		written, _ := ioutil.ReadFile(part.Path)
+		h.Write(written)
+		hashes[part.Index] = h.Sum()
+	}
+	hashOf := func(part Part) *PartHash { return hashes[part.Index] }
+	peer := httptest.NewServer(&PeerServer{key: peerKey(url, `"v1"`), validator: validator, version: validator, parts: shared, hashOf: hashOf})
+	defer peer.Close()
+
+	whole := filepath.Join(dir, "peer.bin")
+	ioutil.WriteFile(whole, []byte(content), 0600)
+	var manifest strings.Builder
+	if err := WriteManifest(whole, 100, "sha256", &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewHTTPDownloader(url, 2, true, "", "")
+	d.peers = []string{strings.TrimPrefix(peer.URL, "http://")}
+	var err error
+	if d.peerSums, err = parseBlockSums([]byte(manifest.String()), "peer.bin"); err != nil {
+		t.Fatal(err)
+	}
+
+	doneChan := make(chan bool, 1)
+	fileChan := make(chan string, 2)
+	errorChan := make(chan error, 1)
+	stateChan := make(chan Part, 2)
+	interruptChan := make(chan bool, 2)
+	go d.Do(doneChan, fileChan, errorChan, interruptChan, stateChan)
+
+	var files []string
+	for {
+		select {
+		case f := <-fileChan:
+			files = append(files, f)
+		case <-stateChan:
+		case err := <-errorChan:
+			t.Fatalf("err should be nil, got %v", err)
+		case <-doneChan:
+			for len(fileChan) > 0 {
+				files = append(files, <-fileChan)
+			}
+			out := filepath.Join(t.TempDir(), "peer.bin")
+			if err := JoinFile(files, out, nil, nil); err != nil {
+				t.Fatalf("err should be nil, got %v", err)
+			}
+			joined, _ := ioutil.ReadFile(out)
+			if string(joined) != content {
+				t.Fatalf("joined content is different from the original")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			return origin
+		}
+	}
+}
+
+func TestPeerIncompletePart(t *testing.T) {
+	dir := t.TempDir()
+	parts := []Part{
+		{Index: 0, Path: filepath.Join(dir, "0"), RangeFrom: 0, RangeTo: 9},
+		{Index: 1, Path: filepath.Join(dir, "1"), RangeFrom: 10, RangeTo: 20},
+	}
+	ioutil.WriteFile(parts[0].Path, []byte("01234"), 0600)
+	h := new(blockHasher)
+	h.Write([]byte("01234"))
+	s := &PeerServer{key: "k", validator: `"v1"`, parts: parts, hashOf: func(Part) *PartHash { return h.Sum() }}
+
+	req := httptest.NewRequest(http.MethodGet, "/k", nil)
+	req.Header.Set("Range", "bytes=0-3")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("a part in progress should not be shared, got %d", w.Code)
+	}
+}
@@ -0,0 +1,76 @@
+package hget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	stdurl "net/url"
+)
+
+var pinTarget = false
+
+// PinnedTarget is where the probe of a download ended up, every part is requested from there with -pin-target.
+type PinnedTarget struct {
+	// URL is the last url of the redirects
+	URL string
+	// IP is the address the probe got its answer from, empty behind a proxy
+	IP string `json:",omitempty"`
+	// ETag is the one of the probe, every part has to come with the same
+	ETag string `json:",omitempty"`
+}
+
+// errTargetMismatch is returned when a part does not come from the pinned target, retrying would not help.
+var errTargetMismatch = errors.New("a part does not match the pinned target")
+
+// pinTo records the final url, remote ip and ETag of the probe `resp`, which was answered by `remote`.
+func (d *HTTPDownloader) pinTo(resp *http.Response, remote string) {
+	d.pinned = &PinnedTarget{URL: resp.Request.URL.String(), ETag: resp.Header.Get("ETag")}
+	if ip, _, err := net.SplitHostPort(remote); err == nil && len(d.proxy) == 0 {
+		d.pinned.IP = ip
+	}
+	if d.pinned.IP != "" {
+		Printf("Pinning all parts to %s at %s\n", d.pinned.URL, d.pinned.IP)
+	} else {
+		Printf("Pinning all parts to %s\n", d.pinned.URL)
+	}
+}
+
+// pinnedURL returns the url requests to `url` go to, the pinned target for the url of the task.
+func (d *HTTPDownloader) pinnedURL(url string) string {
+	if d.pinned != nil && url == d.url {
+		return d.pinned.URL
+	}
+	return url
+}
+
+// pinnedDial dials the pinned ip for the host of the pinned target, and `next` for the others, such as mirrors.
+func (d *HTTPDownloader) pinnedDial(next func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	target, err := stdurl.Parse(d.pinned.URL)
+	if err != nil {
+		return next
+	}
+	pinned := pinnedDial(d.pinned.IP)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == net.JoinHostPort(target.Hostname(), PortOf(target)) {
+			return pinned(ctx, network, addr)
+		}
+		return next(ctx, network, addr)
+	}
+}
+
+// checkPinned makes sure the answer `resp` to a request of the url of the task comes from the pinned
+// target, without another redirect, and with the ETag of the probe.
+func (d *HTTPDownloader) checkPinned(resp *http.Response) error {
+	if d.pinned == nil {
+		return nil
+	}
+	if final := resp.Request.URL.String(); final != d.pinned.URL {
+		return fmt.Errorf("%w: redirected to %s instead of %s", errTargetMismatch, final, d.pinned.URL)
+	}
+	if etag := resp.Header.Get("ETag"); d.pinned.ETag != "" && etag != d.pinned.ETag {
+		return fmt.Errorf("%w: ETag %q instead of %q", errTargetMismatch, etag, d.pinned.ETag)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package hget
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPinnedTarget(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	etag := `"a"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file":
+			// another request could land on another version
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/a":
+			w.Header().Set("ETag", etag)
+			http.ServeContent(w, r, "a", time.Time{}, strings.NewReader(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	port := strconv.Itoa(srv.Listener.Addr().(*net.TCPAddr).Port)
+
+	// the host does not resolve, only the pinned ip makes the requests reach the server
+	d := &HTTPDownloader{url: "http://pinned.invalid:" + port + "/file", par: 2, len: int64(len(content))}
+	d.pinned = &PinnedTarget{URL: "http://pinned.invalid:" + port + "/a", IP: "127.0.0.1", ETag: `"a"`}
+	path := filepath.Join(t.TempDir(), "file.part000001")
+	written, _, err := d.fetchPart(d.client(), Part{Index: 1, Path: path, RangeFrom: 500, RangeTo: d.len}, make(chan bool))
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if stored, _ := ioutil.ReadFile(path); written != 500 || string(stored) != content[500:] {
+		t.Fatalf("expected the second half from the pinned target, got %d bytes", written)
+	}
+
+	etag = `"b"`
+	_, _, err = d.fetchPart(d.client(), Part{Index: 0, Path: path + "0", RangeTo: 499}, make(chan bool))
+	if !errors.Is(err, errTargetMismatch) {
+		t.Fatalf("a part with another ETag should abort, got %v", err)
+	}
+
+	mirror := "http://mirror.example/file"
+	d = &HTTPDownloader{url: srv.URL + "/file", pinned: &PinnedTarget{URL: srv.URL + "/a"}}
+	if d.pinnedURL(d.url) != srv.URL+"/a" || d.pinnedURL(mirror) != mirror {
+		t.Fatalf("only the url of the task should be pinned")
+	}
+}
@@ -0,0 +1,100 @@
+package hget
+
+import (
+	"fmt"
+	"net/http"
+	stdurl "net/url"
+	"strings"
+)
+
+var allowHosts = ""
+var denyHosts = ""
+var httpsOnly = false
+
+// maxRedirects is how many redirects are followed before giving up
+var maxRedirects = 10
+var noFollow = false
+var unsafeRedirectAuth = false
+
+// sensitiveHeaders are only sent to the origin they were meant for
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Cookie2", "WWW-Authenticate"}
+
+// CheckURL validates `url` against the host and scheme policy given on the command line,
+// it is applied to the url of a download and to every redirect it goes through.
+func CheckURL(url string) error {
+	parsed, err := stdurl.Parse(url)
+	if err != nil {
+		return err
+	}
+	if httpsOnly && parsed.Scheme != "https" {
+		return fmt.Errorf("refusing %s, only https urls are allowed", url)
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if hostListed(host, denyHosts) {
+		return fmt.Errorf("refusing %s, host %s is denied", url, host)
+	}
+	if allowHosts != "" && !hostListed(host, allowHosts) {
+		return fmt.Errorf("refusing %s, host %s is not allowed", url, host)
+	}
+	return nil
+}
+
+// hostListed tells whether `host` or one of its parent domains is in the comma separated `list`.
+func hostListed(host string, list string) bool {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.Trim(strings.TrimSpace(entry), "*."))
+		if entry == "" {
+			continue
+		}
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect is the redirect policy of every client, each hop has to pass CheckURL.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if noFollow {
+		return fmt.Errorf("%s redirects to %s, not following it", via[len(via)-1].URL, req.URL)
+	}
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if err := CheckURL(req.URL.String()); err != nil {
+		return err
+	}
+
+	original := via[0]
+	for _, name := range sensitiveHeaders {
+		if unsafeRedirectAuth {
+			// net/http drops them for other domains on its own, bring them back
+			if values := original.Header.Values(name); len(values) > 0 {
+				req.Header[http.CanonicalHeaderKey(name)] = values
+			}
+		} else if !sameOrigin(req.URL, original.URL) {
+			// e.g. a signed CDN url must not get the credentials of the api redirecting to it
+			req.Header.Del(name)
+		}
+	}
+	return nil
+}
+
+// sameOrigin tells whether `a` and `b` have the same scheme, host and port.
+func sameOrigin(a, b *stdurl.URL) bool {
+	return a.Scheme == b.Scheme && strings.EqualFold(a.Hostname(), b.Hostname()) && PortOf(a) == PortOf(b)
+}
+
+// RedirectChain returns every url `resp` was redirected through, starting with the requested one.
+func RedirectChain(resp *http.Response) []string {
+	var chain []string
+	for req := resp.Request; req != nil; {
+		chain = append([]string{req.URL.String()}, chain...)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+	return chain
+}
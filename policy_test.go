@@ -0,0 +1,139 @@
+package hget
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	defer func() { allowHosts, denyHosts, httpsOnly = "", "", false }()
+
+	allowHosts, denyHosts, httpsOnly = "example.org", "evil.example.org", true
+	cases := map[string]bool{
+		"https://example.org/file":          true,
+		"https://cdn.example.org/file":      true,
+		"http://example.org/file":           false,
+		"https://evil.example.org/file":     false,
+		"https://notexample.org/file":       false,
+		"https://example.org.attacker/file": false,
+	}
+	for url, ok := range cases {
+		if err := CheckURL(url); (err == nil) != ok {
+			t.Fatalf("%s should be allowed: %v, got %v", url, ok, err)
+		}
+	}
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	defer func() { denyHosts = "" }()
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(target.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	denyHosts = "localhost"
+	d := &HTTPDownloader{url: redirect.URL}
+	req, _ := d.newRequest(d.url)
+	if _, err := d.client().Do(req); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Fatalf("redirect to a denied host should fail, got %v", err)
+	}
+}
+
+func TestRedirectChain(t *testing.T) {
+	defer func() { noFollow, maxRedirects = false, 10 }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	d := &HTTPDownloader{url: srv.URL + "/a"}
+	req, _ := d.newRequest(d.url)
+	resp, err := d.client().Do(req)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	resp.Body.Close()
+	chain := RedirectChain(resp)
+	if strings.Join(chain, " ") != srv.URL+"/a "+srv.URL+"/b "+srv.URL+"/c" {
+		t.Fatalf("chain should hold every hop, got %v", chain)
+	}
+
+	maxRedirects = 1
+	req, _ = d.newRequest(d.url)
+	if _, err := d.client().Do(req); err == nil {
+		t.Fatalf("second redirect should exceed the limit")
+	}
+
+	noFollow = true
+	req, _ = d.newRequest(d.url)
+	if _, err := d.client().Do(req); err == nil || !strings.Contains(err.Error(), "not following") {
+		t.Fatalf("redirect should fail with -no-follow, got %v", err)
+	}
+}
+
+func TestSignedURLRedirectDropsCredentials(t *testing.T) {
+	defer func() { unsafeRedirectAuth = false }()
+
+	var cdnAuth, cdnCookie string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnAuth, cdnCookie = r.Header.Get("Authorization"), r.Header.Get("Cookie")
+		if r.URL.Query().Get("signature") == "" {
+			http.Error(w, "unsigned", http.StatusForbidden)
+		}
+	}))
+	defer cdn.Close()
+	// the api checks the credentials and hands out a signed url of another host
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("Authorization") != "Bearer secret":
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case r.URL.Path == "/moved":
+			http.Redirect(w, r, "/file", http.StatusFound)
+		default:
+			signed := strings.Replace(cdn.URL, "127.0.0.1", "localhost", 1) + "/file?signature=abc"
+			http.Redirect(w, r, signed, http.StatusFound)
+		}
+	}))
+	defer api.Close()
+
+	d := &HTTPDownloader{url: api.URL + "/moved", headers: http.Header{"Authorization": {"Bearer secret"}, "Cookie": {"session=1"}}}
+	for _, unsafe := range []bool{false, true} {
+		unsafeRedirectAuth = unsafe
+		req, _ := d.newRequest(d.url)
+		resp, err := d.client().Do(req)
+		if err != nil {
+			t.Fatalf("err should be nil, got %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("same origin redirect should keep the credentials, got %s", resp.Status)
+		}
+		if leaked := cdnAuth != "" || cdnCookie != ""; leaked != unsafe {
+			t.Fatalf("credentials should reach the cdn only with -unsafe-redirect-auth (%v), got %q %q", unsafe, cdnAuth, cdnCookie)
+		}
+	}
+}
+
+func TestHeaderFlag(t *testing.T) {
+	f := &headerFlag{header: http.Header{}}
+	if err := f.Set("Authorization: Bearer token"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if err := f.Set("no colon"); err == nil {
+		t.Fatalf("header without a name should fail")
+	}
+	if f.header.Get("Authorization") != "Bearer token" {
+		t.Fatalf("header should be kept, got %v", f.header)
+	}
+}
@@ -0,0 +1,197 @@
+package hget
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/units"
+)
+
+var prefixHook = ""
+var prefixEvery = "64MiB"
+
+// PrefixEvent tells a hook that the first Prefix bytes of the file are downloaded. They are in the part
+// files Parts, one after another, or in Path once the download is Complete or written to a device.
+type PrefixEvent struct {
+	URL      string   `json:"url"`
+	Prefix   int64    `json:"prefix"`
+	Size     int64    `json:"size,omitempty"`
+	Parts    []string `json:"parts,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Complete bool     `json:"complete,omitempty"`
+}
+
+// prefixPart is a part of the file from `origin` on, with `written` of its bytes on disk.
+type prefixPart struct {
+	origin  int64
+	written int64
+	done    bool
+	path    string
+}
+
+// PrefixSink follows how long the downloaded start of the file is, and calls its hook every time
+// another `every` bytes of it are there, so pipelines can start on the file before it finishes.
+// A hook still running when more is downloaded gets the latest event only once it returns.
+type PrefixSink struct {
+	nopSink
+	hook   string
+	every  int64
+	url    string
+	device string
+	size   int64
+
+	mu       sync.Mutex
+	parts    map[int64]*prefixPart
+	order    []int64
+	reported int64
+	events   chan PrefixEvent
+	done     chan struct{}
+}
+
+// NewPrefixSink starts calling `hook`, a command or a http(s) url events are POSTed to, while `parts`
+// of `url` are downloaded, into the part files or onto `device` if not empty.
+func NewPrefixSink(hook string, every string, url string, parts []Part, device string) (*PrefixSink, error) {
+	n, err := units.ParseStrictBytes(every)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid -prefix-every %q", every)
+	}
+	s := &PrefixSink{hook: hook, every: n, url: url, device: device, parts: make(map[int64]*prefixPart),
+		events: make(chan PrefixEvent, 1), done: make(chan struct{})}
+
+	sorted := append([]Part(nil), parts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Index < sorted[j].Index })
+	var origin int64
+	for _, p := range sorted {
+		s.parts[p.Index] = &prefixPart{origin: origin, written: p.RangeFrom - origin, done: p.RangeTo <= p.RangeFrom, path: p.Path}
+		s.order = append(s.order, p.Index)
+		// the last part ends at the length of the file, the others right before the next one
+		origin = p.RangeTo + 1
+		s.size = p.RangeTo
+	}
+	s.reported = s.prefix() / s.every
+
+	go s.run()
+	return s, nil
+}
+
+// prefix returns how many bytes from the start of the file are downloaded, with s.mu held.
+func (s *PrefixSink) prefix() int64 {
+	var prefix int64
+	for _, index := range s.order {
+		p := s.parts[index]
+		prefix = p.origin + p.written
+		if !p.done {
+			break
+		}
+	}
+	return prefix
+}
+
+// report queues the event of the current prefix in place of one the hook did not take yet, with s.mu held.
+func (s *PrefixSink) report(event PrefixEvent) {
+	select {
+	case <-s.events:
+	default:
+	}
+	s.events <- event
+}
+
+// OnBytes implements ProgressSink
+func (s *PrefixSink) OnBytes(index int64, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.parts[index]; ok {
+		p.written += n
+		s.check()
+	}
+}
+
+// OnPartDone implements ProgressSink
+func (s *PrefixSink) OnPartDone(index int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.parts[index]; ok {
+		p.done = true
+		s.check()
+	}
+}
+
+// check reports the prefix if it grew past another `every` bytes, with s.mu held.
+func (s *PrefixSink) check() {
+	prefix := s.prefix()
+	if prefix/s.every <= s.reported {
+		return
+	}
+	s.reported = prefix / s.every
+	event := PrefixEvent{URL: s.url, Prefix: prefix, Size: s.size, Path: s.device}
+	if s.device == "" {
+		for _, index := range s.order {
+			if p := s.parts[index]; p.origin < prefix {
+				event.Parts = append(event.Parts, p.path)
+			}
+		}
+	}
+	s.report(event)
+}
+
+// OnComplete implements ProgressSink
+func (s *PrefixSink) OnComplete(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report(PrefixEvent{URL: s.url, Prefix: s.prefix(), Size: s.size, Path: path, Complete: true})
+}
+
+// Close waits for the hook to handle the last event.
+func (s *PrefixSink) Close() {
+	close(s.events)
+	<-s.done
+}
+
+func (s *PrefixSink) run() {
+	defer close(s.done)
+	for event := range s.events {
+		if err := s.call(event); err != nil {
+			Warnf("prefix hook failed: %v\n", err)
+		}
+	}
+}
+
+// call runs the hook with the event in HGET_* variables, or POSTs it as JSON to the hook url.
+func (s *PrefixSink) call(event PrefixEvent) error {
+	if strings.HasPrefix(s.hook, "http://") || strings.HasPrefix(s.hook, "https://") {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Post(s.hook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("%s answered %s", s.hook, resp.Status)
+		}
+		return nil
+	}
+
+	cmd := shellCommand(s.hook)
+	cmd.Env = append(os.Environ(),
+		"HGET_URL="+event.URL,
+		"HGET_PREFIX="+strconv.FormatInt(event.Prefix, 10),
+		"HGET_SIZE="+strconv.FormatInt(event.Size, 10),
+		"HGET_PARTS="+strings.Join(event.Parts, string(os.PathListSeparator)),
+		"HGET_PATH="+event.Path,
+		"HGET_COMPLETE="+strconv.FormatBool(event.Complete))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,62 @@
+package hget
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPrefixSink(t *testing.T) {
+	events := make(chan PrefixEvent)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event PrefixEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("the event should be JSON, got %v", err)
+		}
+		events <- event
+	}))
+	defer server.Close()
+	next := func() PrefixEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the hook was not called")
+		}
+		return PrefixEvent{}
+	}
+
+	// a resumed task of 300 bytes, the first part is done and 50 bytes of the second one are there
+	parts := []Part{
+		{Index: 1, Path: "part.1", RangeFrom: 150, RangeTo: 199},
+		{Index: 0, Path: "part.0", RangeFrom: 100, RangeTo: 99},
+		{Index: 2, Path: "part.2", RangeFrom: 200, RangeTo: 300},
+	}
+	s, err := NewPrefixSink(server.URL, "100B", "http://a.org/1.iso", parts, "")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+
+	s.OnBytes(2, 100)
+	s.OnBytes(1, 10)
+	s.OnBytes(1, 40)
+	if event := next(); !reflect.DeepEqual(event, PrefixEvent{URL: "http://a.org/1.iso", Prefix: 200, Size: 300, Parts: []string{"part.0", "part.1"}}) {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	s.OnPartDone(1)
+	if event := next(); event.Prefix != 300 || len(event.Parts) != 3 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	s.OnComplete("1.iso")
+	if event := next(); !event.Complete || event.Path != "1.iso" || event.Prefix != 300 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	s.Close()
+
+	if _, err := NewPrefixSink(server.URL, "lots", "http://a.org/1.iso", parts, ""); err == nil {
+		t.Fatalf("invalid sizes should fail")
+	}
+}
@@ -0,0 +1,175 @@
+package hget
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/textproto"
+	stdurl "net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var preflight = ""
+
+// Preflight acquires whatever a server wants to see before it lets us download, e.g. the cookies
+// or clearance tokens of a challenge page, and returns them as headers for every following request.
+type Preflight interface {
+	Preflight(url string, client *http.Client) (http.Header, error)
+}
+
+var preflights = map[string]Preflight{
+	"cookies": CookiePreflight{},
+}
+
+// RegisterPreflight makes `p` selectable with `-preflight name`.
+func RegisterPreflight(name string, p Preflight) {
+	preflights[name] = p
+}
+
+// PreflightFor returns the handler registered as `name`, anything else is treated as an external command.
+func PreflightFor(name string) Preflight {
+	if p, ok := preflights[name]; ok {
+		return p
+	}
+	return CommandPreflight{Command: name}
+}
+
+// CookiePreflight visits the site like a browser would, first its front page then the url itself,
+// and hands the collected cookies to the download.
+type CookiePreflight struct{}
+
+// Preflight implements the Preflight interface
+func (CookiePreflight) Preflight(url string, client *http.Client) (http.Header, error) {
+	parsed, err := stdurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := *client
+	c.Jar = jar
+	for _, page := range []string{parsed.Scheme + "://" + parsed.Host + "/", url} {
+		req, err := http.NewRequest("GET", page, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+		resp, err := c.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+	}
+
+	header := make(http.Header)
+	var cookies []string
+	for _, cookie := range jar.Cookies(parsed) {
+		cookies = append(cookies, cookie.String())
+	}
+	if len(cookies) > 0 {
+		header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	return header, nil
+}
+
+// CommandPreflight delegates the challenge to an external program, it gets the url in HGET_URL
+// and must print the headers to use, one `Name: value` per line, on its stdout.
+type CommandPreflight struct {
+	Command string
+}
+
+// Preflight implements the Preflight interface
+func (p CommandPreflight) Preflight(url string, client *http.Client) (http.Header, error) {
+	cmd := shellCommand(p.Command)
+	cmd.Env = append(os.Environ(), "HGET_URL="+url)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("preflight command failed: %v", err)
+	}
+	return ParseHeaders(out)
+}
+
+// shellCommand runs `command` through the shell of the system.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// ParseHeaders reads `Name: value` lines into a http.Header.
+func ParseHeaders(raw []byte) (http.Header, error) {
+	raw = append(bytes.TrimSpace(raw), '\n', '\n')
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(raw))).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	return http.Header(header), nil
+}
+
+// runPreflight fetches the preflight headers of the download if one is configured.
+func (d *HTTPDownloader) runPreflight() error {
+	if preflight == "" {
+		return nil
+	}
+	Printf("Running preflight %s\n", preflight)
+	header, err := PreflightFor(preflight).Preflight(d.url, d.client())
+	if err != nil {
+		return err
+	}
+	d.headers = header
+	return nil
+}
+
+// headerFlag collects the `-header 'Name: value'` flags sent with every request.
+type headerFlag struct {
+	header http.Header
+}
+
+func (f *headerFlag) String() string {
+	return ""
+}
+
+func (f *headerFlag) Set(value string) error {
+	header, err := ParseHeaders([]byte(value))
+	if err != nil || len(header) == 0 {
+		return fmt.Errorf("header should look like 'Name: value', got %q", value)
+	}
+	for name, values := range header {
+		for _, v := range values {
+			f.header.Add(name, v)
+		}
+	}
+	return nil
+}
+
+var extraHeaders = &headerFlag{header: http.Header{}}
+
+// newRequest creates a GET request carrying the headers of the session and those of the preflight.
+func (d *HTTPDownloader) newRequest(url string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", d.pinnedURL(url), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range d.sessionHeaders() {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	for name, values := range d.headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	return req, nil
+}
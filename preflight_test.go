@@ -0,0 +1,34 @@
+package hget
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseHeaders(t *testing.T) {
+	header, err := ParseHeaders([]byte("Cookie: cf_clearance=abc\nuser-agent: Mozilla/5.0\n\n"))
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if header.Get("Cookie") != "cf_clearance=abc" || header.Get("User-Agent") != "Mozilla/5.0" {
+		t.Fatalf("headers were parsed wrong: %v", header)
+	}
+}
+
+func TestCookiePreflight(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.SetCookie(w, &http.Cookie{Name: "clearance", Value: "ok", Path: "/"})
+		}
+	}))
+	defer srv.Close()
+
+	header, err := CookiePreflight{}.Preflight(srv.URL+"/file", http.DefaultClient)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if header.Get("Cookie") != "clearance=ok" {
+		t.Fatalf("cookie should be collected, got %q", header.Get("Cookie"))
+	}
+}
@@ -0,0 +1,68 @@
+package hget
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// hashName is an algorithm of hashes, or none when empty.
+type hashName string
+
+var printHash hashName
+
+func (h *hashName) String() string {
+	return string(*h)
+}
+
+func (h *hashName) Set(value string) error {
+	value = strings.ToLower(value)
+	if _, ok := hashes[value]; !ok {
+		var names []string
+		for name := range hashes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("print-hash should be one of %s, got %q", strings.Join(names, ", "), value)
+	}
+	*h = hashName(value)
+	return nil
+}
+
+// newHash returns a hash of the algorithm, nil for none.
+func (h hashName) newHash() hash.Hash {
+	if h == "" {
+		return nil
+	}
+	return hashes[string(h)]()
+}
+
+// printDigest shows the digest `h` got of `path` for -print-hash, as algo:hex then the path.
+func printDigest(h hash.Hash, path string) {
+	Printf("%s:%s  %s\n", printHash, hex.EncodeToString(h.Sum(nil)), path)
+}
+
+// hashFile hashes the whole of `path` into `h`, dropping what it held.
+func hashFile(h hash.Hash, path string) error {
+	h.Reset()
+	return hashRange(h, path, 0, math.MaxInt64)
+}
+
+// hashRange hashes `size` bytes of `path` from `from`, such as the part of a device a download filled.
+func hashRange(h hash.Hash, path string, from int64, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(from, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.CopyBuffer(h, io.LimitReader(f, size), copyBuffer())
+	return err
+}
@@ -0,0 +1,76 @@
+package hget
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintHash(t *testing.T) {
+	displayProgress = false
+	defer func(data string, ui UI) { dataPath, output, printHash, Default = data, "", "", ui }(dataPath, Default)
+	dataPath = t.TempDir()
+	var logs bytes.Buffer
+	Default = Console{Stdout: &logs, Stderr: ioutil.Discard}
+	content := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "hashed.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	output = filepath.Join(t.TempDir(), "hashed.bin")
+
+	if err := printHash.Set("SHA256"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if err := Download(server.URL + "/hashed.bin"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	if want := "sha256:" + hex.EncodeToString(sum[:]) + "  " + output; !strings.Contains(logs.String(), want) {
+		t.Fatalf("expected %q to be printed, got %q", want, logs.String())
+	}
+
+	var h hashName
+	if err := h.Set("crc32"); err == nil || !strings.Contains(err.Error(), "md5, sha1, sha256, sha512") {
+		t.Fatalf("expected crc32 to be refused, got %v", err)
+	}
+}
+
+func TestPrintHashEncrypted(t *testing.T) {
+	displayProgress = false
+	defer func(data string, ui UI, iterations int) {
+		dataPath, output, printHash, encrypt, keyIterations, Default = data, "", "", false, iterations, ui
+		os.Unsetenv("HGET_PASSPHRASE")
+	}(dataPath, Default, keyIterations)
+	dataPath = t.TempDir()
+	var logs bytes.Buffer
+	Default = Console{Stdout: &logs, Stderr: ioutil.Discard}
+	content := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "hashed-encrypted.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	output = filepath.Join(t.TempDir(), "hashed-encrypted.bin")
+	encrypt, keyIterations = true, 10
+	os.Setenv("HGET_PASSPHRASE", "secret")
+
+	if err := printHash.Set("sha256"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if err := Download(server.URL + "/hashed-encrypted.bin"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	// the hash is of the decrypted file, not of the encrypted parts
+	sum := sha256.Sum256([]byte(content))
+	if want := "sha256:" + hex.EncodeToString(sum[:]) + "  " + output; !strings.Contains(logs.String(), want) {
+		t.Fatalf("expected %q to be printed, got %q", want, logs.String())
+	}
+}
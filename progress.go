@@ -0,0 +1,157 @@
+package hget
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var jsonProgress = false
+
+// ProgressSink receives the progress of a download, so the downloader does not need to know
+// whether it is shown as terminal bars, emitted as JSON or not shown at all.
+type ProgressSink interface {
+	// OnPartStart is called for every part before any of them starts downloading
+	OnPartStart(index int64, size int64)
+	// OnConnection is called whenever a part gets a response, over its first connection or a retry
+	OnConnection(index int64, info ConnectionInfo)
+	OnBytes(index int64, n int64)
+	OnPartDone(index int64)
+	// OnJoin is called after each of the `total` part files got joined
+	OnJoin(done int, total int)
+	OnComplete(path string)
+}
+
+// NewProgressSink picks the sink matching the command line for downloading `file`,
+// estimating the remaining time with `meter`.
+func NewProgressSink(file string, meter *Meter) ProgressSink {
+	var sink ProgressSink = nopSink{}
+	if jsonProgress {
+		sink = NewJSONSink(Stdout)
+	} else if DisplayProgressBar() {
+		sink = NewBarSink(file, meter)
+	}
+	if terminalTitle && IsTerminal(os.Stderr) {
+		sink = MultiSink{sink, NewTitleSink(Stderr, file)}
+	}
+	if progressStats != nil {
+		sink = MultiSink{sink, progressStats}
+	}
+	return sink
+}
+
+type nopSink struct{}
+
+func (nopSink) OnPartStart(index int64, size int64)           {}
+func (nopSink) OnConnection(index int64, info ConnectionInfo) {}
+func (nopSink) OnBytes(index int64, n int64)                  {}
+func (nopSink) OnPartDone(index int64)                        {}
+func (nopSink) OnJoin(done int, total int)                    {}
+func (nopSink) OnComplete(path string)                        {}
+
+// progressWriter reports everything written through it as bytes of part `index`.
+type progressWriter struct {
+	sink  ProgressSink
+	index int64
+}
+
+func (p progressWriter) Write(b []byte) (int, error) {
+	p.sink.OnBytes(p.index, int64(len(b)))
+	return len(b), nil
+}
+
+// progressEvent is a line of JSON progress output
+type progressEvent struct {
+	Event string `json:"event"`
+	Part  *int64 `json:"part,omitempty"`
+	Size  int64  `json:"size,omitempty"`
+	Bytes int64  `json:"bytes,omitempty"`
+	Done  int    `json:"done,omitempty"`
+	Total int    `json:"total,omitempty"`
+	Path  string `json:"path,omitempty"`
+	// Source, IP and Retries describe the connection of the part, Rate is its throughput in bytes/s
+	Source  string  `json:"source,omitempty"`
+	IP      string  `json:"ip,omitempty"`
+	Retries int     `json:"retries,omitempty"`
+	Rate    float64 `json:"rate,omitempty"`
+}
+
+// JSONSink emits the progress as one JSON object per line, byte counts are sent at most every interval per part.
+type JSONSink struct {
+	mu       sync.Mutex
+	emit     func(e progressEvent)
+	interval time.Duration
+	written  map[int64]int64
+	sent     map[int64]time.Time
+	stats    *ConnectionStats
+}
+
+// NewJSONSink writes progress events to `w`.
+func NewJSONSink(w io.Writer) *JSONSink {
+	enc := json.NewEncoder(w)
+	return newEventSink(func(e progressEvent) { enc.Encode(e) })
+}
+
+// newEventSink passes the progress events of NewJSONSink to `emit` rather than writing them.
+func newEventSink(emit func(e progressEvent)) *JSONSink {
+	return &JSONSink{
+		emit:     emit,
+		interval: 500 * time.Millisecond,
+		written:  make(map[int64]int64),
+		sent:     make(map[int64]time.Time),
+		stats:    NewConnectionStats(),
+	}
+}
+
+// OnPartStart implements ProgressSink
+func (s *JSONSink) OnPartStart(index int64, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.OnPartStart(index, size)
+	s.emit(progressEvent{Event: "part_start", Part: &index, Size: size})
+}
+
+// OnConnection implements ProgressSink
+func (s *JSONSink) OnConnection(index int64, info ConnectionInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.OnConnection(index, info)
+	stats := s.stats.Of(index)
+	s.emit(progressEvent{Event: "connection", Part: &index, Source: stats.Source, IP: stats.IP, Retries: stats.Retries})
+}
+
+// OnBytes implements ProgressSink
+func (s *JSONSink) OnBytes(index int64, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written[index] += n
+	s.stats.OnBytes(index, n)
+	if now := time.Now(); now.Sub(s.sent[index]) >= s.interval {
+		s.sent[index] = now
+		stats := s.stats.Of(index)
+		s.emit(progressEvent{Event: "progress", Part: &index, Bytes: s.written[index], Source: stats.Source, IP: stats.IP, Retries: stats.Retries, Rate: stats.Rate})
+	}
+}
+
+// OnPartDone implements ProgressSink
+func (s *JSONSink) OnPartDone(index int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emit(progressEvent{Event: "part_done", Part: &index, Bytes: s.written[index]})
+}
+
+// OnJoin implements ProgressSink
+func (s *JSONSink) OnJoin(done int, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emit(progressEvent{Event: "join", Done: done, Total: total})
+}
+
+// OnComplete implements ProgressSink
+func (s *JSONSink) OnComplete(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emit(progressEvent{Event: "complete", Path: path})
+}
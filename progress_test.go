@@ -0,0 +1,78 @@
+package hget
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONSink(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewJSONSink(&out)
+	sink.interval = 0
+
+	sink.OnPartStart(0, 10)
+	sink.OnBytes(0, 4)
+	sink.OnBytes(0, 6)
+	sink.OnPartDone(0)
+	sink.OnJoin(1, 1)
+	sink.OnComplete("file")
+
+	var events []progressEvent
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var e progressEvent
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("every line should be json: %v", err)
+		}
+		events = append(events, e)
+	}
+
+	expected := []string{"part_start", "progress", "progress", "part_done", "join", "complete"}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(events))
+	}
+	for i, e := range events {
+		if e.Event != expected[i] {
+			t.Fatalf("event %d should be %s, got %s", i, expected[i], e.Event)
+		}
+	}
+	if events[3].Bytes != 10 || *events[3].Part != 0 {
+		t.Fatalf("part_done should report all bytes of the part, got %+v", events[3])
+	}
+	if events[5].Path != "file" {
+		t.Fatalf("complete should report the output, got %+v", events[5])
+	}
+}
+
+func TestJSONSinkConnections(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewJSONSink(&out)
+	sink.interval = 0
+
+	sink.OnPartStart(1, 10)
+	sink.OnConnection(1, ConnectionInfo{Source: "http://a.org/f", IP: "10.0.0.1:80"})
+	sink.OnBytes(1, 4)
+	sink.OnConnection(1, ConnectionInfo{Source: "http://b.org/f", IP: "10.0.0.2:80"})
+	sink.OnBytes(1, 2)
+
+	var events []progressEvent
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var e progressEvent
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("every line should be json: %v", err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 5 || events[1].Event != "connection" || events[1].Source != "http://a.org/f" || events[1].Retries != 0 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	last := events[4]
+	if last.Source != "http://b.org/f" || last.IP != "10.0.0.2:80" || last.Retries != 1 || last.Bytes != 6 || last.Rate <= 0 {
+		t.Fatalf("progress should tell about the current connection, got %+v", last)
+	}
+	if stats := sink.stats.Of(1); stats.Bytes != 2 {
+		t.Fatalf("the rate should be measured over the current connection, got %+v", stats)
+	}
+}
@@ -0,0 +1,121 @@
+package hget
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var quiet = false
+
+// codes of the ERR line of -q, hget exits with them as well
+const (
+	codeFailure     = 1
+	codeUsage       = 2
+	codeChecksum    = 3
+	codeInterrupted = 4
+	codeTemporary   = 5
+)
+
+// usageErr is a command line missing an argument.
+type usageErr string
+
+func (e usageErr) Error() string {
+	return string(e)
+}
+
+// codeOf returns the code of the ERR line of `err`.
+func codeOf(err error) int {
+	var usage usageErr
+	switch {
+	case errors.As(err, &usage):
+		return codeUsage
+	case errors.Is(err, ErrChecksumMismatch):
+		return codeChecksum
+	case errors.Is(err, ErrInterrupted):
+		return codeInterrupted
+	case errors.Is(err, ErrTemporary):
+		return codeTemporary
+	}
+	return codeFailure
+}
+
+// writeOK writes the OK line of -q for the download saved to `path`. The sha256 of an upload, or of a
+// device the download only filled the start of, is -.
+func writeOK(w io.Writer, path string, size int64, local bool) error {
+	sum := "-"
+	if local {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if sum, err = digestOf(path, "sha256"); err != nil {
+			return err
+		}
+		size = info.Size()
+	}
+	_, err := fmt.Fprintf(w, "OK %s %d %s\n", path, size, sum)
+	return err
+}
+
+// writeErr writes the ERR line of -q for `err`, on a single line, and returns its code.
+func writeErr(w io.Writer, err error) int {
+	code := codeOf(err)
+	fmt.Fprintf(w, "ERR %d %s\n", code, strings.Join(strings.Fields(err.Error()), " "))
+	return code
+}
+
+// exit ends hget after `err`, logged or with -q written as the ERR line, whose code is the exit status.
+func exit(err error) {
+	if quiet {
+		os.Exit(writeErr(os.Stdout, err))
+	}
+	Errorf("%v\n", err)
+	os.Exit(codeOf(err))
+}
+
+// exitFatal is deferred by Main, hget ends with the error FatalCheck stopped it with, anything else
+// keeps panicking.
+func exitFatal() {
+	if r := recover(); r != nil {
+		if fatal, ok := r.(fatalError); ok {
+			exit(fatal.err)
+		}
+		panic(r)
+	}
+}
+
+// exitStopped ends hget with the code of why the download stopped before completing, if it did, so
+// that scripts tell a download to resume later from one which failed for good.
+func exitStopped() {
+	if stopReason != nil {
+		exit(stopReason)
+	}
+}
+
+// usageFailure ends hget after the command line missed `message`, showing the help unless -q is set.
+func usageFailure(message string) {
+	if quiet {
+		exit(usageErr(message))
+	}
+	Errorln(message)
+	usage()
+	os.Exit(1)
+}
+
+// finishQuiet is deferred by main with -q, hget ends with the ERR line of a failure, or of a download
+// which stopped before completing.
+func finishQuiet() {
+	if r := recover(); r != nil {
+		err, ok := r.(error)
+		if !ok {
+			err = fmt.Errorf("%v", r)
+		}
+		exit(err)
+	}
+	if stopReason != nil {
+		exit(stopReason)
+	}
+}
@@ -0,0 +1,40 @@
+package hget
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuietLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "1.iso")
+	ioutil.WriteFile(path, []byte("hget"), 0644)
+	var out bytes.Buffer
+	if err := writeOK(&out, path, 0, true); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	writeOK(&out, "s3://bucket/1.iso", 10, false)
+	sum := "0750b9b5077f5aa4a43937819bc8ede613a18a88bc2806007404dd71d881e661"
+	if out.String() != "OK "+path+" 4 "+sum+"\nOK s3://bucket/1.iso 10 -\n" {
+		t.Fatalf("unexpected OK lines %q", out.String())
+	}
+
+	for _, c := range []struct {
+		err  error
+		line string
+	}{
+		{errors.New("dial tcp:\nconnection refused"), "ERR 1 dial tcp: connection refused\n"},
+		{usageErr("url is required"), "ERR 2 url is required\n"},
+		{VerifyFile(path, "sha256:00"), fmt.Sprintf("ERR 3 checksum mismatch for %s: expected sha256:00, got sha256:%s\n", path, sum)},
+		{fmt.Errorf("%w, continue with hget resume 1.iso", ErrInterrupted), "ERR 4 interrupted, continue with hget resume 1.iso\n"},
+		{causedBy(ErrTemporary, "unexpected response \"502 Bad Gateway\" for part 1, continue later with hget resume 1.iso"), "ERR 5 unexpected response \"502 Bad Gateway\" for part 1, continue later with hget resume 1.iso\n"},
+	} {
+		out.Reset()
+		if code := writeErr(&out, c.err); out.String() != c.line || code != codeOf(c.err) {
+			t.Fatalf("expected %q, got %q with code %d", c.line, out.String(), code)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package hget
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/units"
+)
+
+var quotaSpec = ""
+
+var quotaFileName = "quota.json"
+
+// quotaFlushEvery is how often the bytes of a running download are added to the quota file
+var quotaFlushEvery = 10 * time.Second
+
+// meteredQuota is the quota of -quota, nil without one
+var meteredQuota *Quota
+
+// quotaMu serializes the updates of the quota file by this process, others may lose a few bytes.
+var quotaMu sync.Mutex
+
+// quotaUsage is what the quota file keeps, the bytes downloaded by every hget sharing the data folder
+// during the period.
+type quotaUsage struct {
+	Period string
+	Bytes  int64
+}
+
+// Quota caps the bytes downloaded per day or per month, for metered links. It counts the bytes as a
+// ProgressSink and tells the download to pause once they are used up.
+type Quota struct {
+	nopSink
+	limit  int64
+	period string
+
+	mu        sync.Mutex
+	used      quotaUsage
+	pending   int64
+	flushed   time.Time
+	exhausted chan struct{}
+}
+
+// parseQuota parses a quota such as 100GiB/month, the period is day or month.
+func parseQuota(spec string) (*Quota, error) {
+	i := strings.LastIndex(spec, "/")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid quota %q, expected a size per day or month such as 100GiB/month", spec)
+	}
+	period := spec[i+1:]
+	if period != "day" && period != "month" {
+		return nil, fmt.Errorf("invalid quota period %q, expected day or month", period)
+	}
+	limit, err := units.ParseStrictBytes(spec[:i])
+	if err != nil || limit <= 0 {
+		return nil, fmt.Errorf("invalid quota size %q", spec[:i])
+	}
+	return &Quota{limit: limit, period: period, exhausted: make(chan struct{})}, nil
+}
+
+// openQuota returns the quota of -quota with what was already downloaded during the period, nil without one.
+func openQuota() (*Quota, error) {
+	if quotaSpec == "" {
+		return nil, nil
+	}
+	q, err := parseQuota(quotaSpec)
+	if err != nil {
+		return nil, err
+	}
+	q.used = q.read(time.Now())
+	return q, nil
+}
+
+// key names the period `t` is in.
+func (q *Quota) key(t time.Time) string {
+	if q.period == "day" {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01")
+}
+
+// next returns when the period after the one of `t` starts.
+func (q *Quota) next(t time.Time) time.Time {
+	if q.period == "day" {
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+}
+
+func quotaPath() string {
+	return filepath.Join(dataDir(), quotaFileName)
+}
+
+// read returns the usage of the period of `now` from the quota file.
+func (q *Quota) read(now time.Time) quotaUsage {
+	usage := quotaUsage{Period: q.key(now)}
+	var saved quotaUsage
+	if raw, err := ioutil.ReadFile(quotaPath()); err == nil && json.Unmarshal(raw, &saved) == nil && saved.Period == usage.Period {
+		usage.Bytes = saved.Bytes
+	}
+	return usage
+}
+
+// flush adds the pending bytes to the quota file, q.mu is held.
+func (q *Quota) flush(now time.Time) error {
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	usage := q.read(now)
+	usage.Bytes += q.pending
+	raw, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dataDir(), quotaFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), quotaPath()); err != nil {
+		return err
+	}
+	q.used, q.pending, q.flushed = usage, 0, now
+	return nil
+}
+
+// OnBytes implements ProgressSink
+func (q *Quota) OnBytes(index int64, n int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	if q.key(now) != q.used.Period {
+		// the bytes are counted in the period they are downloaded in
+		q.flushLogged(now.Add(-time.Second))
+		q.used = quotaUsage{Period: q.key(now)}
+	}
+	q.pending += n
+	if now.Sub(q.flushed) >= quotaFlushEvery {
+		q.flushLogged(now)
+	}
+	if q.used.Bytes+q.pending >= q.limit {
+		select {
+		case <-q.exhausted:
+		default:
+			// so that the other hget processes stop too
+			q.flushLogged(now)
+			close(q.exhausted)
+		}
+	}
+}
+
+func (q *Quota) flushLogged(now time.Time) {
+	if err := q.flush(now); err != nil {
+		Warnf("could not update the quota: %v\n", err)
+	}
+}
+
+// Save adds the bytes downloaded since the last update to the quota file.
+func (q *Quota) Save() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending > 0 {
+		q.flushLogged(time.Now())
+	}
+}
+
+// Exhausted is closed once the quota of the period is used up. It never fires on a nil quota.
+func (q *Quota) Exhausted() <-chan struct{} {
+	if q == nil {
+		return nil
+	}
+	return q.exhausted
+}
+
+// wait blocks until the quota has bytes left, which may only be in the next period. It does nothing
+// on a nil quota.
+func (q *Quota) wait() error {
+	if q == nil {
+		return nil
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+	for {
+		q.mu.Lock()
+		now := time.Now()
+		q.used = q.read(now)
+		left := q.used.Bytes+q.pending < q.limit
+		if left {
+			q.exhausted = make(chan struct{})
+		}
+		q.mu.Unlock()
+		if left {
+			return nil
+		}
+
+		next := q.next(now)
+		Printf("The quota of %s per %s is used up, waiting until %s\n", humanBytes(q.limit), q.period, next.Format(time.RFC1123))
+		select {
+		case <-signals:
+			return fmt.Errorf("%w while waiting for the quota", ErrInterrupted)
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
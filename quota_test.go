@@ -0,0 +1,67 @@
+package hget
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuota(t *testing.T) {
+	q, err := parseQuota("100GiB/month")
+	if err != nil || q.limit != 100<<30 || q.period != "month" {
+		t.Fatalf("unexpected quota %+v, %v", q, err)
+	}
+	for _, spec := range []string{"100GiB", "100GiB/week", "lots/day", "0B/day"} {
+		if _, err := parseQuota(spec); err == nil {
+			t.Fatalf("%q should be refused", spec)
+		}
+	}
+
+	december := time.Date(2026, time.December, 31, 23, 0, 0, 0, time.UTC)
+	if next := q.next(december); !next.Equal(time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("the next month should start on January 1st, got %v", next)
+	}
+	q.period = "day"
+	if next := q.next(december); !next.Equal(time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("the next day should start at midnight, got %v", next)
+	}
+}
+
+func TestQuotaExhausted(t *testing.T) {
+	defer func(data string, spec string) { dataPath, quotaSpec = data, spec }(dataPath, quotaSpec)
+	dataPath, quotaSpec = t.TempDir(), "1KiB/day"
+	q, err := openQuota()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.wait(); err != nil {
+		t.Fatalf("an unused quota should not wait, got %v", err)
+	}
+	q.OnBytes(0, 1000)
+	select {
+	case <-q.Exhausted():
+		t.Fatalf("the quota should not be used up yet")
+	default:
+	}
+	q.OnBytes(1, 24)
+	select {
+	case <-q.Exhausted():
+	default:
+		t.Fatalf("the quota should be used up")
+	}
+
+	raw, _ := ioutil.ReadFile(filepath.Join(dataPath, quotaFileName))
+	if !strings.Contains(string(raw), `"Bytes":1024`) {
+		t.Fatalf("the usage should be saved for the other hget processes, got %s", raw)
+	}
+	other, _ := openQuota()
+	if other.used.Bytes != 1024 {
+		t.Fatalf("another hget should see the usage, got %+v", other.used)
+	}
+	var none *Quota
+	if none.Exhausted() != nil || none.wait() != nil {
+		t.Fatalf("a nil quota should do nothing")
+	}
+}
@@ -0,0 +1,36 @@
+package hget
+
+import (
+	"fmt"
+	"strings"
+)
+
+// releaseAsset is an asset of a release in the shorthand gh:OWNER/REPO@TAG:ASSET, or gl: for GitLab.
+type releaseAsset struct {
+	project string
+	// tag is latest when the shorthand has none
+	tag  string
+	name string
+}
+
+// parseReleaseAsset parses the shorthand of a release asset, the tag may be left out or be latest
+// for the latest release.
+func parseReleaseAsset(shorthand string) (releaseAsset, error) {
+	var asset releaseAsset
+	rest := shorthand
+	if colon := strings.IndexByte(rest, ':'); colon >= 0 {
+		rest = rest[colon+1:]
+	}
+	colon := strings.IndexByte(rest, ':')
+	if colon < 0 {
+		return asset, fmt.Errorf("%s should name an asset as PROJECT@TAG:ASSET", shorthand)
+	}
+	asset.project, asset.name, asset.tag = rest[:colon], rest[colon+1:], "latest"
+	if at := strings.LastIndexByte(asset.project, '@'); at >= 0 {
+		asset.project, asset.tag = asset.project[:at], asset.project[at+1:]
+	}
+	if asset.project == "" || asset.tag == "" || asset.name == "" || strings.Contains(asset.name, "/") {
+		return asset, fmt.Errorf("%s should name an asset as PROJECT@TAG:ASSET", shorthand)
+	}
+	return asset, nil
+}
@@ -0,0 +1,107 @@
+package hget
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReleaseAsset(t *testing.T) {
+	for _, c := range []struct {
+		shorthand           string
+		project, tag, asset string
+	}{
+		{"gh:abzcoding/hget@v1.2.3:hget.tar.gz", "abzcoding/hget", "v1.2.3", "hget.tar.gz"},
+		{"gh:abzcoding/hget:hget.tar.gz", "abzcoding/hget", "latest", "hget.tar.gz"},
+		{"gl:group/sub/project@latest:app.zip", "group/sub/project", "latest", "app.zip"},
+		{"gh:abzcoding/hget@release@2:a:b", "abzcoding/hget@release", "2", "a:b"},
+	} {
+		asset, err := parseReleaseAsset(c.shorthand)
+		if err != nil || asset.project != c.project || asset.tag != c.tag || asset.name != c.asset {
+			t.Fatalf("%s parsed as %+v, %v", c.shorthand, asset, err)
+		}
+	}
+	for _, shorthand := range []string{"gh:abzcoding/hget", "gh:abzcoding/hget@:a", "gh::a", "gh:abzcoding/hget:dir/a"} {
+		if _, err := parseReleaseAsset(shorthand); err == nil {
+			t.Fatalf("%s should not parse", shorthand)
+		}
+	}
+}
+
+func TestResolveGitLabAsset(t *testing.T) {
+	defer func(api string) { gitlabAPI = api }(gitlabAPI)
+	os.Setenv("GITLAB_TOKEN", "secret")
+	defer os.Unsetenv("GITLAB_TOKEN")
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/projects/group%2Fproject/releases/v2.0" || r.Header.Get("PRIVATE-TOKEN") != "secret" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"tag_name": "v2.0", "assets": {"links": [
+			{"name": "app.zip", "url": "https://gitlab.com/group/project/-/releases/v2.0/downloads/app.zip", "direct_asset_url": "https://cdn.example.org/app.zip"},
+			{"name": "notes.txt", "url": "https://gitlab.com/notes.txt"}]}}`))
+	}))
+	defer api.Close()
+	gitlabAPI = api.URL
+
+	r := &Resolution{URL: "gl:group/project@v2.0:app.zip", Header: http.Header{}}
+	if err := resolveGitLabAsset(r); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if r.URL != "https://cdn.example.org/app.zip" || r.Header.Get("PRIVATE-TOKEN") != "secret" {
+		t.Fatalf("resolved to %s with %v", r.URL, r.Header)
+	}
+	r = &Resolution{URL: "gl:group/project@v2.0:notes.txt", Header: http.Header{}}
+	if err := resolveGitLabAsset(r); err != nil || r.URL != "https://gitlab.com/notes.txt" {
+		t.Fatalf("a link without a direct url resolved to %s, %v", r.URL, err)
+	}
+	r = &Resolution{URL: "gl:group/project@v2.0:missing.zip", Header: http.Header{}}
+	if err := resolveGitLabAsset(r); err == nil || !strings.Contains(err.Error(), "no asset missing.zip") {
+		t.Fatalf("a missing asset should fail, got %v", err)
+	}
+}
+
+func TestDownloadGitHubAsset(t *testing.T) {
+	displayProgress = false
+	defer func(data, api string) { dataPath, output, githubAPI = data, "", api }(dataPath, githubAPI)
+	dataPath = t.TempDir()
+	content := strings.Repeat("0123456789", 1000)
+	sum := sha256.Sum256([]byte(content))
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/abzcoding/hget/releases/tags/v1.2.3":
+			fmt.Fprintf(w, `{"tag_name": "v1.2.3", "assets": [{"name": "hget.tar.gz", "browser_download_url": "%s/download/v1.2.3/hget.tar.gz", "digest": "%s"}]}`, server.URL, digest)
+		case "/repos/abzcoding/hget/releases/latest":
+			fmt.Fprintf(w, `{"tag_name": "v1.3.0", "assets": [{"name": "hget.tar.gz", "browser_download_url": "%s/download/v1.3.0/hget.tar.gz", "digest": "sha256:00"}]}`, server.URL)
+		case "/download/v1.2.3/hget.tar.gz", "/download/v1.3.0/hget.tar.gz":
+			http.ServeContent(w, r, "hget.tar.gz", time.Time{}, strings.NewReader(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	githubAPI = server.URL
+	output = filepath.Join(t.TempDir(), "hget.tar.gz")
+
+	if err := Download("gh:abzcoding/hget@v1.2.3:hget.tar.gz"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(output); string(got) != content {
+		t.Fatalf("unexpected content %q", got)
+	}
+	// the latest release published a digest the asset does not match
+	if err := Download("gh:abzcoding/hget:hget.tar.gz"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("the asset should be verified against its digest, got %v", err)
+	}
+}
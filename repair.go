@@ -0,0 +1,283 @@
+package hget
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// blockSums are the digests of every block of a file, the last block may be shorter.
+type blockSums struct {
+	size int64
+	algo string
+	sums [][]byte
+	// length is the size of the file when the manifest tells it
+	length int64
+}
+
+// parseBlockSums reads the digests of the blocks of `name` from the pieces of a metalink, version 3 or
+// 4, or from a manifest of hget hash-manifest: "file NAME" and "size N" lines, which may be left out,
+// a "block SIZE" line, then one algo:hex line per block.
+func parseBlockSums(raw []byte, name string) (*blockSums, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("<")) {
+		return metalinkPieces(raw, name)
+	}
+	b := &blockSums{}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fields := strings.Fields(line); b.size == 0 && len(fields) >= 2 && fields[0] == "file" {
+			continue
+		} else if b.size == 0 && len(fields) == 2 && fields[0] == "size" {
+			length, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid file size %q", fields[1])
+			}
+			b.length = length
+			continue
+		} else if b.size == 0 {
+			if len(fields) != 2 || fields[0] != "block" {
+				return nil, fmt.Errorf("expected the block size first, such as block 1MiB, got %q", line)
+			}
+			size, err := parseOffset(fields[1])
+			if err != nil || size <= 0 {
+				return nil, fmt.Errorf("invalid block size %q", fields[1])
+			}
+			b.size = size
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("expected algo:hex, got %q", line)
+		}
+		if err := b.add(line[:i], line[i+1:]); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(b.sums) == 0 {
+		return nil, errors.New("no block checksums")
+	}
+	return b, nil
+}
+
+// add appends the digest `hexSum` of the next block, all have to be of the same algorithm.
+func (b *blockSums) add(algo string, hexSum string) error {
+	// metalinks name them sha-256
+	algo = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(algo)), "-", "")
+	if hashes[algo] == nil {
+		return fmt.Errorf("unsupported block checksum %q", algo)
+	}
+	if b.algo != "" && b.algo != algo {
+		return fmt.Errorf("blocks are hashed with both %s and %s", b.algo, algo)
+	}
+	sum, err := hex.DecodeString(strings.TrimSpace(hexSum))
+	if err != nil || len(sum) != hashes[algo]().Size() {
+		return fmt.Errorf("invalid %s checksum %q", algo, hexSum)
+	}
+	b.algo = algo
+	b.sums = append(b.sums, sum)
+	return nil
+}
+
+// metalinkPieces reads the pieces of the file `name` of a metalink, or of its first file with pieces.
+func metalinkPieces(raw []byte, name string) (*blockSums, error) {
+	type pieces struct {
+		Length int64    `xml:"length,attr"`
+		Type   string   `xml:"type,attr"`
+		Hashes []string `xml:"hash"`
+	}
+	var doc struct {
+		Files []struct {
+			Name     string `xml:"name,attr"`
+			Pieces   pieces `xml:"pieces"`
+			PiecesV3 pieces `xml:"verification>pieces"`
+		} `xml:"file"`
+		FilesV3 []struct {
+			Name   string `xml:"name,attr"`
+			Pieces pieces `xml:"verification>pieces"`
+		} `xml:"files>file"`
+	}
+	if err := xml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	var candidates []pieces
+	var names []string
+	for _, f := range doc.Files {
+		candidates, names = append(candidates, f.Pieces, f.PiecesV3), append(names, f.Name, f.Name)
+	}
+	for _, f := range doc.FilesV3 {
+		candidates, names = append(candidates, f.Pieces), append(names, f.Name)
+	}
+	var found *pieces
+	for i := range candidates {
+		if len(candidates[i].Hashes) == 0 {
+			continue
+		}
+		if found == nil || names[i] == name {
+			found = &candidates[i]
+		}
+	}
+	if found == nil || found.Length <= 0 {
+		return nil, errors.New("no pieces in the metalink")
+	}
+	b := &blockSums{size: found.Length}
+	for _, sum := range found.Hashes {
+		if err := b.add(found.Type, sum); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// badBlocks returns the blocks of `path` which do not match, the ones past its end included.
+func (b *blockSums) badBlocks(path string) ([]int, error) {
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var bad []int
+	buf := make([]byte, b.size)
+	for i, want := range b.sums {
+		var n int
+		if f != nil {
+			n, err = f.ReadAt(buf, int64(i)*b.size)
+			if err != nil && err != io.EOF {
+				f.Close()
+				return nil, err
+			}
+		}
+		h := hashes[b.algo]()
+		h.Write(buf[:n])
+		if n == 0 || !bytes.Equal(h.Sum(nil), want) {
+			bad = append(bad, i)
+		}
+	}
+	if f != nil {
+		f.Close()
+	}
+	return bad, nil
+}
+
+// RepairFile downloads again from `url` only the blocks of `path` which do not match the checksums at
+// `sumsPath`, a file or a http(s) url, written in place with up to `conn` requests at once.
+func RepairFile(path string, url string, sumsPath string, conn int) error {
+	raw, err := readManifest(sumsPath)
+	if err != nil {
+		return err
+	}
+	sums, err := parseBlockSums(raw, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	d := &HTTPDownloader{url: url, proxy: proxyServer, userAgent: chooseUserAgent()}
+	resp, err := d.probe()
+	if err != nil {
+		return err
+	}
+	length := sizeOf(resp)
+	if resp.StatusCode != http.StatusPartialContent || length < 0 {
+		return fmt.Errorf("%w, the file can only be downloaded again as a whole", ErrRangeNotSupported)
+	}
+	if sums.length > 0 && sums.length != length {
+		return fmt.Errorf("the manifest is of a file of %s, the remote one is %s", humanBytes(sums.length), humanBytes(length))
+	}
+	if blocks := (length + sums.size - 1) / sums.size; blocks != int64(len(sums.sums)) {
+		return fmt.Errorf("the checksums are of %d blocks of %s, the remote file of %s has %d", len(sums.sums), humanBytes(sums.size), humanBytes(length), blocks)
+	}
+
+	bad, err := sums.badBlocks(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(length); err != nil {
+		return err
+	}
+	if len(bad) == 0 {
+		Printf("%s is intact\n", path)
+		return nil
+	}
+	Printf("%d of %d blocks of %s do not match, downloading them again\n", len(bad), len(sums.sums), path)
+
+	// neighbouring blocks are fetched with a single request
+	var ranges [][2]int64
+	for _, i := range bad {
+		from, to := int64(i)*sums.size, int64(i+1)*sums.size
+		if to > length {
+			to = length
+		}
+		if n := len(ranges); n > 0 && ranges[n-1][1] == from {
+			ranges[n-1][1] = to
+		} else {
+			ranges = append(ranges, [2]int64{from, to})
+		}
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed error
+	if conn < 1 {
+		conn = 1
+	}
+	slots := make(chan struct{}, conn)
+	for _, r := range ranges {
+		wg.Add(1)
+		go func(from int64, to int64) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			err := d.repairRange(f, from, to)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && failed == nil {
+				failed = err
+			}
+		}(r[0], r[1])
+	}
+	wg.Wait()
+	if failed != nil {
+		return failed
+	}
+
+	if bad, err = sums.badBlocks(path); err != nil {
+		return err
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("%d blocks still do not match, the server may have another version of the file", len(bad))
+	}
+	Printf("Repaired %s\n", path)
+	return nil
+}
+
+// repairRange writes the bytes from `from` to `to`, excluded, into `f` at their offset.
+func (d *HTTPDownloader) repairRange(f *os.File, from int64, to int64) error {
+	body, err := d.fetchRange(from, to)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	n, err := io.Copy(&offsetWriter{w: f, offset: from}, io.LimitReader(body, to-from))
+	if err == nil && n != to-from {
+		err = fmt.Errorf("bytes %d-%d were cut short after %d", from, to-1, n)
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package hget
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepairFile(t *testing.T) {
+	displayProgress = false
+	content := make([]byte, 10*1024+100)
+	rand.New(rand.NewSource(1)).Read(content)
+	var served int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(&countingWriter{ResponseWriter: w, n: &served}, r, "disk.img", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	url := server.URL + "/disk.img"
+
+	dir := t.TempDir()
+	good, bad, sums := filepath.Join(dir, "good.img"), filepath.Join(dir, "disk.img"), filepath.Join(dir, "sums.txt")
+	ioutil.WriteFile(good, content, 0644)
+	var list bytes.Buffer
+	if err := WriteManifest(good, 1024, "sha256", &list); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	ioutil.WriteFile(sums, list.Bytes(), 0644)
+
+	// blocks 2, 3 and 7 are damaged, the last one is missing
+	damaged := append([]byte(nil), content[:10*1024]...)
+	damaged[2*1024+5] ^= 1
+	damaged[3*1024] ^= 1
+	damaged[7*1024+1023] ^= 1
+	ioutil.WriteFile(bad, damaged, 0644)
+
+	if err := RepairFile(bad, url, sums, 4); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if repaired, _ := ioutil.ReadFile(bad); !bytes.Equal(repaired, content) {
+		t.Fatalf("the file should be repaired")
+	}
+	// the probe, blocks 2 and 3 at once, 7 and the last one
+	if served != 1+2*1024+1024+100 {
+		t.Fatalf("only the damaged blocks should be downloaded, got %d bytes", served)
+	}
+
+	served = 0
+	if err := RepairFile(bad, url, sums, 4); err != nil || served != 1 {
+		t.Fatalf("an intact file should not be downloaded, got %d bytes %v", served, err)
+	}
+	ioutil.WriteFile(sums, []byte("block 2KiB\n"+strings.Repeat("sha256:"+strings.Repeat("00", 32)+"\n", 6)), 0644)
+	if err := RepairFile(bad, url, sums, 4); err == nil || !strings.Contains(err.Error(), "still do not match") {
+		t.Fatalf("checksums of another file should fail, got %v", err)
+	}
+}
+
+func TestMetalinkPieces(t *testing.T) {
+	sum := sha256.Sum256([]byte("block"))
+	raw := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="other.iso"><pieces length="1024" type="sha-1"><hash>%s</hash></pieces></file>
+  <file name="disk.img">
+    <url>http://a.org/disk.img</url>
+    <pieces length="262144" type="sha-256"><hash>%x</hash><hash>%x</hash></pieces>
+  </file>
+</metalink>`, strings.Repeat("00", 20), sum, sum)
+	b, err := parseBlockSums([]byte(raw), "disk.img")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if b.size != 262144 || b.algo != "sha256" || len(b.sums) != 2 || !bytes.Equal(b.sums[0], sum[:]) {
+		t.Fatalf("unexpected pieces %+v", b)
+	}
+	if _, err := parseBlockSums([]byte("sha256:00\n"), "disk.img"); err == nil {
+		t.Fatalf("a list without a block size should be refused")
+	}
+}
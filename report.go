@@ -0,0 +1,126 @@
+package hget
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var reportPath = ""
+
+// batchReport records the downloads of -file, watch, feed and daemon when -report is given
+var batchReport *Report
+
+// ReportEntry is the outcome of a download of a batch.
+type ReportEntry struct {
+	URL string `json:"url"`
+	// Status is done, failed or interrupted
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	// Duration is in seconds
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Report is the file the downloads of a batch are listed in, as CSV if its name ends with .csv and as
+// JSON otherwise. It is rewritten after every download, so it is complete whenever the batch stops.
+type Report struct {
+	path string
+
+	mu      sync.Mutex
+	entries []ReportEntry
+}
+
+// OpenReport creates the report at `path`, replacing the one of a previous batch.
+func OpenReport(path string) (*Report, error) {
+	r := &Report{path: path}
+	return r, r.write()
+}
+
+// Add records the download of `url` into `output` started at `started`, which got interrupted or failed
+// with `err`. Reports are optional, Add does nothing on a nil one.
+func (r *Report) Add(url string, output string, started time.Time, interrupted bool, err error) {
+	if r == nil {
+		return
+	}
+	entry := ReportEntry{URL: url, Status: "done", Duration: time.Since(started).Seconds()}
+	switch {
+	case err != nil:
+		entry.Status, entry.Error = "failed", err.Error()
+	case interrupted:
+		entry.Status = "interrupted"
+	default:
+		entry.Output = output
+		if abs, err := filepath.Abs(output); err == nil {
+			entry.Output = abs
+		}
+		if stat, err := os.Stat(output); err == nil && stat.Mode().IsRegular() {
+			entry.Size = stat.Size()
+			if entry.SHA256, err = digestOf(output, "sha256"); err != nil {
+				Warnf("could not hash %s for the report: %v\n", output, err)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+	if err := r.write(); err != nil {
+		Warnf("could not write the report: %v\n", err)
+	}
+}
+
+// write replaces the report file with the entries so far, with r.mu held.
+func (r *Report) write() error {
+	var content []byte
+	if strings.EqualFold(filepath.Ext(r.path), ".csv") {
+		var b strings.Builder
+		w := csv.NewWriter(&b)
+		w.Write([]string{"url", "status", "output", "size", "sha256", "duration", "error"})
+		for _, e := range r.entries {
+			w.Write([]string{e.URL, e.Status, e.Output, strconv.FormatInt(e.Size, 10), e.SHA256, fmt.Sprintf("%.3f", e.Duration), e.Error})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		content = []byte(b.String())
+	} else {
+		entries := r.entries
+		if entries == nil {
+			entries = []ReportEntry{}
+		}
+		var err error
+		if content, err = json.MarshalIndent(entries, "", "  "); err != nil {
+			return err
+		}
+		content = append(content, '\n')
+	}
+
+	tmp := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// recovered runs `fn`, turning the panic of a failure into an error instead of taking the whole
+// process down with it.
+func recovered(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	fn()
+	return nil
+}
@@ -0,0 +1,69 @@
+package hget
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	defer func(path string) { dataPath = path }(dataPath)
+	dataPath = t.TempDir()
+	dir := t.TempDir()
+	out := filepath.Join(dir, "1.iso")
+	digest := sha256.Sum256([]byte("hget"))
+	ioutil.WriteFile(out, []byte("hget"), 0600)
+
+	for _, name := range []string{"report.json", "report.csv"} {
+		path := filepath.Join(dir, name)
+		r, err := OpenReport(path)
+		if err != nil {
+			t.Fatalf("err should be nil, got %v", err)
+		}
+		started := time.Now().Add(-time.Second)
+		r.Add("http://a.org/1.iso", out, started, false, nil)
+		r.Add("http://a.org/2.iso", "2.iso", started, false, errors.New("404 Not Found"))
+		r.Add("http://a.org/3.iso", "3.iso", started, true, nil)
+
+		raw, _ := ioutil.ReadFile(path)
+		var entries []ReportEntry
+		if name == "report.csv" {
+			records, err := csv.NewReader(bytes.NewReader(raw)).ReadAll()
+			if err != nil || len(records) != 4 || records[0][0] != "url" {
+				t.Fatalf("unexpected csv %q, %v", raw, err)
+			}
+			for _, record := range records[1:] {
+				entries = append(entries, ReportEntry{URL: record[0], Status: record[1], Output: record[2], SHA256: record[4], Error: record[6]})
+			}
+		} else if err := json.Unmarshal(raw, &entries); err != nil {
+			t.Fatalf("unexpected json %s, %v", raw, err)
+		}
+
+		if len(entries) != 3 {
+			t.Fatalf("%s: expected 3 entries, got %+v", name, entries)
+		}
+		if e := entries[0]; e.Status != "done" || e.Output != out || e.SHA256 != hex.EncodeToString(digest[:]) {
+			t.Fatalf("%s: unexpected entry %+v", name, e)
+		}
+		if e := entries[1]; e.Status != "failed" || e.Error != "404 Not Found" || e.Output != "" {
+			t.Fatalf("%s: unexpected entry %+v", name, e)
+		}
+		if e := entries[2]; e.Status != "interrupted" {
+			t.Fatalf("%s: unexpected entry %+v", name, e)
+		}
+		if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+			t.Fatalf("the temporary report should be renamed")
+		}
+	}
+
+	var none *Report
+	none.Add("http://a.org/1.iso", out, time.Now(), false, nil)
+}
@@ -0,0 +1,156 @@
+package hget
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	stdurl "net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// resolverFlag collects the `-resolver` flags, the resolvers every url goes through first.
+type resolverFlag []string
+
+func (f *resolverFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *resolverFlag) Set(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("resolver should be a command")
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+var resolverSpecs resolverFlag
+
+// resolverClient is the client of the built-in resolvers
+var resolverClient = &http.Client{Timeout: 30 * time.Second}
+
+// Resolution is where a download starts from, resolvers may change any of it.
+type Resolution struct {
+	URL string
+	// Header is sent with every request of the download, the -header options to begin with
+	Header http.Header
+	// Checksum is verified once the file is downloaded, -checksum to begin with
+	Checksum string
+}
+
+// Resolver rewrites where a download starts from before it does, e.g. a "latest" link to the file
+// of the release it is now, an url to a mirror of the region, or adds the credentials a host wants.
+type Resolver interface {
+	Resolve(r *Resolution) error
+}
+
+// ResolverFunc is a function used as a Resolver.
+type ResolverFunc func(r *Resolution) error
+
+// Resolve implements the Resolver interface
+func (f ResolverFunc) Resolve(r *Resolution) error {
+	return f(r)
+}
+
+// registeredResolver is a resolver of the urls of a scheme, such as "ipfs:", or of a host.
+type registeredResolver struct {
+	pattern  string
+	resolver Resolver
+}
+
+var resolvers = []registeredResolver{
+	{"ipfs:", ResolverFunc(resolveIPFS)},
+	{"github.com", ResolverFunc(resolveGitHubLatest)},
+	{"gh:", ResolverFunc(resolveGitHubAsset)},
+	{"gl:", ResolverFunc(resolveGitLabAsset)},
+	{"hf:", ResolverFunc(resolveHuggingFace)},
+	{"huggingface.co", ResolverFunc(resolveHuggingFaceURL)},
+	{"hf.co", ResolverFunc(resolveHuggingFaceURL)},
+}
+
+// RegisterResolver makes `r` resolve the urls matching `pattern`, a scheme such as "ipfs:" or a
+// host such as "github.com", after the resolvers registered before.
+func RegisterResolver(pattern string, r Resolver) {
+	resolvers = append(resolvers, registeredResolver{pattern: pattern, resolver: r})
+}
+
+// matches tells whether `url` is of the scheme or host of the resolver.
+func (r registeredResolver) matches(url string) bool {
+	parsed, err := stdurl.Parse(url)
+	if err != nil {
+		return false
+	}
+	if strings.HasSuffix(r.pattern, ":") {
+		return strings.EqualFold(parsed.Scheme+":", r.pattern)
+	}
+	return strings.EqualFold(parsed.Hostname(), r.pattern)
+}
+
+// resolvedScheme tells whether a resolver is registered for the scheme of `url`, which is only
+// checked against the policy once resolved.
+func resolvedScheme(url string) bool {
+	for _, r := range resolvers {
+		if strings.HasSuffix(r.pattern, ":") && r.matches(url) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveURL runs `url` through the -resolver resolvers in the order given, then through those
+// registered for its scheme or host, and returns where the download starts from.
+func ResolveURL(url string) (*Resolution, error) {
+	r := &Resolution{URL: url, Header: commandLineHeaders(), Checksum: checksum}
+	for _, spec := range resolverSpecs {
+		if err := (CommandResolver{Command: spec}).Resolve(r); err != nil {
+			return nil, fmt.Errorf("resolver %s failed: %v", spec, err)
+		}
+	}
+	for _, registered := range resolvers {
+		if !registered.matches(r.URL) {
+			continue
+		}
+		if err := registered.resolver.Resolve(r); err != nil {
+			return nil, err
+		}
+	}
+	if r.URL != url {
+		Printf("Resolved %s to %s\n", url, r.URL)
+	}
+	return r, nil
+}
+
+// CommandResolver delegates the resolution to an external program, it gets the url in HGET_URL and
+// prints the url to download on its first line, followed by `Name: value` lines of headers to send.
+// Printing nothing keeps the url.
+type CommandResolver struct {
+	Command string
+}
+
+// Resolve implements the Resolver interface
+func (c CommandResolver) Resolve(r *Resolution) error {
+	cmd := shellCommand(c.Command)
+	cmd.Env = append(os.Environ(), "HGET_URL="+r.URL)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("resolver command failed: %v", err)
+	}
+	lines := strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)
+	if url := strings.TrimSpace(lines[0]); url != "" {
+		r.URL = url
+	}
+	if len(lines) < 2 {
+		return nil
+	}
+	header, err := ParseHeaders([]byte(lines[1]))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveURL(t *testing.T) {
+	defer func(registered []registeredResolver, specs resolverFlag) {
+		resolvers, resolverSpecs = registered, specs
+	}(resolvers, resolverSpecs)
+	if runtime.GOOS == "windows" {
+		t.Skip("the resolver command is a sh script")
+	}
+	resolverSpecs = resolverFlag{`echo "$HGET_URL" | sed s/example.org/mirror.example.org/; echo 'X-Region: eu'`}
+	var seen []string
+	RegisterResolver("mirror.example.org", ResolverFunc(func(r *Resolution) error {
+		seen = append(seen, r.URL)
+		r.URL += "?signed=1"
+		return nil
+	}))
+	RegisterResolver("other.example.org", ResolverFunc(func(r *Resolution) error {
+		t.Fatalf("the resolver of another host should not run")
+		return nil
+	}))
+
+	r, err := ResolveURL("https://example.org/file.iso")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if r.URL != "https://mirror.example.org/file.iso?signed=1" || r.Header.Get("X-Region") != "eu" {
+		t.Fatalf("resolved to %s with %v", r.URL, r.Header)
+	}
+	if len(seen) != 1 || seen[0] != "https://mirror.example.org/file.iso" {
+		t.Fatalf("the resolver of the host should see the url the command printed, saw %v", seen)
+	}
+
+	resolverSpecs = resolverFlag{"true"}
+	if r, err := ResolveURL("https://example.org/file.iso"); err != nil || r.URL != "https://example.org/file.iso" {
+		t.Fatalf("a silent resolver should keep the url, got %v %v", r, err)
+	}
+	resolverSpecs = resolverFlag{"false"}
+	if _, err := ResolveURL("https://example.org/file.iso"); err == nil {
+		t.Fatalf("a failing resolver should fail the download")
+	}
+	if !resolvedScheme("ipfs://bafy/file") || resolvedScheme("https://example.org/file") {
+		t.Fatalf("only ipfs urls should be resolved by scheme")
+	}
+}
+
+func TestResolveGitHubLatest(t *testing.T) {
+	defer func(api string) { githubAPI = api }(githubAPI)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/abzcoding/hget/releases/latest" || r.Header.Get("Authorization") != "token secret" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"tag_name": "v1.2.0", "name": "hget 1.2.0"}`))
+	}))
+	defer api.Close()
+	githubAPI = api.URL
+
+	r := &Resolution{URL: "https://github.com/abzcoding/hget/releases/latest/download/hget_linux_amd64.tar.gz", Header: http.Header{"Authorization": {"token secret"}}}
+	if err := resolveGitHubLatest(r); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if r.URL != "https://github.com/abzcoding/hget/releases/download/v1.2.0/hget_linux_amd64.tar.gz" {
+		t.Fatalf("resolved to %s", r.URL)
+	}
+	// already a release, or not a release at all
+	for _, url := range []string{r.URL, "https://github.com/abzcoding/hget/archive/refs/heads/master.zip"} {
+		r := &Resolution{URL: url, Header: http.Header{}}
+		if err := resolveGitHubLatest(r); err != nil || r.URL != url {
+			t.Fatalf("%s resolved to %s, %v", url, r.URL, err)
+		}
+	}
+	r = &Resolution{URL: "https://github.com/abzcoding/private/releases/latest/download/a.zip", Header: http.Header{}}
+	if err := resolveGitHubLatest(r); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("a repository without releases should fail, got %v", err)
+	}
+}
+
+func TestDownloadResolved(t *testing.T) {
+	displayProgress = false
+	defer func(data string, registered []registeredResolver) {
+		dataPath, output, resolvers = data, "", registered
+	}(dataPath, resolvers)
+	dataPath = t.TempDir()
+	content := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "resolved" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "resolved.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	RegisterResolver("test:", ResolverFunc(func(r *Resolution) error {
+		r.URL = server.URL + "/resolved.bin"
+		r.Header.Set("X-Token", "resolved")
+		return nil
+	}))
+	output = filepath.Join(t.TempDir(), "resolved.bin")
+
+	if err := Download("test://bucket/resolved.bin"); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(output); string(got) != content {
+		t.Fatalf("unexpected content %q", got)
+	}
+}
@@ -1,23 +1,22 @@
-package main
+package hget
 
 import (
 	"fmt"
 	"io/ioutil"
-	"os"
-	"path/filepath"
 	"strings"
 )
 
 // TaskPrint read and prints data about current download jobs
 func TaskPrint() error {
-	downloading, err := ioutil.ReadDir(filepath.Join(os.Getenv("HOME"), dataFolder))
+	downloading, err := ioutil.ReadDir(dataDir())
 	if err != nil {
 		return err
 	}
 
 	folders := make([]string, 0)
 	for _, d := range downloading {
-		if d.IsDir() {
+		// the tasks of the users of hget daemon are kept in a hidden folder
+		if d.IsDir() && !strings.HasPrefix(d.Name(), ".") {
 			folders = append(folders, d.Name())
 		}
 	}
@@ -31,5 +30,14 @@ func TaskPrint() error {
 
 // Resume gets back to a previously stopped task
 func Resume(task string) (*State, error) {
-	return Read(task)
+	s, err := Read(task)
+	if err != nil {
+		return nil, err
+	}
+	adoptPartFiles(s)
+	// the output given when the task started is where it is joined to
+	if s.Output != "" {
+		output = s.Output
+	}
+	return s, nil
 }
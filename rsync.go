@@ -0,0 +1,83 @@
+package hget
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/units"
+)
+
+var rsyncFallback = ""
+
+// IsRsync checks if `url` has to be fetched with rsync.
+func IsRsync(url string) bool {
+	return strings.HasPrefix(url, "rsync://")
+}
+
+// RsyncDownload fetches `url` into `out` with the system rsync, incomplete data is kept in the task
+// folder so an interrupted transfer continues where it stopped on `hget resume`.
+// It returns whether rsync was interrupted.
+func RsyncDownload(url string, out string, proxy string, bwLimit string) (bool, error) {
+	bin, err := exec.LookPath("rsync")
+	if err != nil {
+		return false, errors.New("rsync is required to download rsync:// urls")
+	}
+
+	folder := FolderOf(url)
+	if err := MkdirIfNotExist(folder); err != nil {
+		return false, err
+	}
+	partialDir, err := filepath.Abs(filepath.Join(folder, "rsync-partial"))
+	if err != nil {
+		return false, err
+	}
+
+	args := []string{"--times", "--partial", "--partial-dir=" + partialDir}
+	if DisplayProgressBar() {
+		args = append(args, "--progress")
+	}
+	if rate, err := units.ParseStrictBytes(bwLimit); err == nil {
+		// rsync counts in KiB/s and takes 0 as unlimited, so the limit is rounded up
+		args = append(args, fmt.Sprintf("--bwlimit=%d", (rate+1023)/1024))
+	}
+	args = append(args, "--", url, out)
+
+	cmd := exec.Command(bin, args...)
+	cmd.Stdout = Stdout
+	cmd.Stderr = Stderr
+	cmd.Env = os.Environ()
+	if len(proxy) > 0 {
+		// rsync only understands http proxies, given as host:port
+		cmd.Env = append(cmd.Env, "RSYNC_PROXY="+strings.TrimPrefix(strings.TrimPrefix(proxy, "http://"), "https://"))
+	}
+
+	Printf("Downloading with %s\n", strings.Join(cmd.Args, " "))
+	err = cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 20 {
+		// rsync exits with 20 when it received SIGINT, SIGTERM or SIGHUP
+		return true, nil
+	}
+	return false, err
+}
+
+// executeRsync runs a rsync task, saving its state when interrupted so it can be resumed.
+func executeRsync(url string, proxy string, bwLimit string) {
+	out := outputOf(url)
+
+	interrupted, err := RsyncDownload(url, out, proxy, bwLimit)
+	FatalCheck(err)
+	if interrupted {
+		Printf("Interrupted, saving state ... \n")
+		s := &State{URL: url}
+		if err := s.Save(); err != nil {
+			Errorf("%v\n", err)
+		}
+		return
+	}
+	FatalCheck(os.RemoveAll(FolderOf(url)))
+}
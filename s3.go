@@ -0,0 +1,348 @@
+package hget
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	stdurl "net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var upload = ""
+
+// s3MinPart is the smallest part S3 accepts in a multipart upload, except for the last one
+var s3MinPart int64 = 5 * 1024 * 1024
+
+// s3MaxPart is the largest part S3 accepts in a multipart upload
+var s3MaxPart int64 = 5 * 1024 * 1024 * 1024
+
+// s3MaxParts is the most parts a multipart upload can have
+var s3MaxParts int64 = 10000
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3Upload streams the parts of a download into a S3 multipart upload instead of the local disk.
+// Any S3 compatible storage works, e.g. GCS through its interoperability API or MinIO,
+// by pointing AWS_ENDPOINT_URL at it.
+type S3Upload struct {
+	object    string
+	region    string
+	accessKey string
+	secretKey string
+	token     string
+	uploadID  string
+	client    *http.Client
+
+	mu    sync.Mutex
+	etags map[int64]string
+}
+
+// NewS3Upload prepares an upload to `target`, given as s3://bucket/key,
+// credentials are taken from the usual AWS_* environment variables.
+func NewS3Upload(target string) (*S3Upload, error) {
+	parsed, err := stdurl.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Scheme != "s3" || parsed.Host == "" || key == "" {
+		return nil, fmt.Errorf("upload target should look like s3://bucket/key, got %s", target)
+	}
+
+	u := &S3Upload{
+		region:    os.Getenv("AWS_REGION"),
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		client:    &http.Client{},
+		etags:     make(map[int64]string),
+	}
+	if u.accessKey == "" || u.secretKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required to upload")
+	}
+	if u.region == "" {
+		u.region = "us-east-1"
+	}
+
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		u.object = strings.TrimSuffix(endpoint, "/") + "/" + s3Escape(parsed.Host, true) + "/" + s3Escape(key, false)
+	} else {
+		u.object = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", parsed.Host, u.region, s3Escape(key, false))
+	}
+	return u, nil
+}
+
+// Start creates the multipart upload.
+func (u *S3Upload) Start() error {
+	body, err := u.call("POST", "uploads=", nil, 0)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(body, &result); err != nil || result.UploadID == "" {
+		return fmt.Errorf("could not start upload: %s", body)
+	}
+	u.uploadID = result.UploadID
+	return nil
+}
+
+// UploadPart streams `size` bytes of `body` as part `number` of the upload.
+func (u *S3Upload) UploadPart(number int64, body io.Reader, size int64) (int64, error) {
+	counter := &countingReader{r: body}
+	query := fmt.Sprintf("partNumber=%d&uploadId=%s", number, s3Escape(u.uploadID, true))
+	req, err := u.request("PUT", query, counter, size)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return counter.n, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return counter.n, fmt.Errorf("upload of part %d failed: %s %s", number, resp.Status, msg)
+	}
+
+	u.mu.Lock()
+	u.etags[number] = resp.Header.Get("ETag")
+	u.mu.Unlock()
+	return counter.n, nil
+}
+
+// Complete assembles the uploaded parts into the final object.
+func (u *S3Upload) Complete() error {
+	type part struct {
+		PartNumber int64
+		ETag       string
+	}
+	var complete struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}
+
+	u.mu.Lock()
+	for number, etag := range u.etags {
+		complete.Parts = append(complete.Parts, part{PartNumber: number, ETag: etag})
+	}
+	u.mu.Unlock()
+	sort.Slice(complete.Parts, func(i, j int) bool { return complete.Parts[i].PartNumber < complete.Parts[j].PartNumber })
+
+	payload, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	body, err := u.call("POST", "uploadId="+s3Escape(u.uploadID, true), payload, int64(len(payload)))
+	if err != nil {
+		return err
+	}
+	// S3 may report a failed completion with a 200 status
+	if bytes.Contains(body, []byte("<Error>")) {
+		return fmt.Errorf("could not complete upload: %s", body)
+	}
+	return nil
+}
+
+// Abort drops the upload and every part uploaded so far.
+func (u *S3Upload) Abort() error {
+	if u.uploadID == "" {
+		return nil
+	}
+	_, err := u.call("DELETE", "uploadId="+s3Escape(u.uploadID, true), nil, 0)
+	return err
+}
+
+// call sends a small signed request and returns the response body.
+func (u *S3Upload) call(method, query string, payload []byte, size int64) ([]byte, error) {
+	req, err := u.request(method, query, bytes.NewReader(payload), size)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s: %s %s", method, u.object, resp.Status, body)
+	}
+	return body, nil
+}
+
+func (u *S3Upload) request(method, query string, body io.Reader, size int64) (*http.Request, error) {
+	req, err := http.NewRequest(method, u.object+"?"+query, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if u.token != "" {
+		req.Header.Set("X-Amz-Security-Token", u.token)
+	}
+	signV4(req, unsignedPayload, u.region, u.accessKey, u.secretKey, time.Now())
+	return req, nil
+}
+
+// signV4 adds an AWS signature version 4 Authorization header covering every header of `req`.
+func signV4(req *http.Request, payloadHash, region, accessKey, secretKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	var params []string
+	for key, values := range req.URL.Query() {
+		for _, value := range values {
+			params = append(params, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	sort.Strings(params)
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent encodes everything but the RFC 3986 unreserved characters, slashes are kept unless asked otherwise.
+func s3Escape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// uploadParts returns how many parts of a download of `length` bytes can be uploaded, the closest to
+// `par` keeping every part but the last above s3MinPart, all of them below s3MaxPart and at most
+// s3MaxParts of them.
+func uploadParts(length int64, par int64) (int64, error) {
+	if max := length / s3MinPart; par > max {
+		par = max
+	}
+	if par > s3MaxParts {
+		par = s3MaxParts
+	}
+	if par < 1 {
+		par = 1
+	}
+	// the last part also gets the remainder of the division
+	for length/par+length%par > s3MaxPart {
+		par++
+	}
+	if par > s3MaxParts || par > 1 && length/par < s3MinPart {
+		return 0, fmt.Errorf("%d bytes can not be uploaded in at most %d parts of %d to %d bytes", length, s3MaxParts, s3MinPart, s3MaxPart)
+	}
+	return par, nil
+}
+
+// countingReader remembers how many bytes went through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// startUpload makes the download stream into `target` instead of part files,
+// parts are re-planned so that all of them are within the S3 part sizes.
+func (d *HTTPDownloader) startUpload(target string) error {
+	if d.len <= 1 || !d.resumable {
+		return errors.New("size of the download is unknown, it can not be uploaded")
+	}
+	if d.key != nil || d.device != "" {
+		return errors.New("uploading can not be combined with -encrypt or a device output")
+	}
+
+	par, err := uploadParts(d.len, d.par)
+	if err != nil {
+		return err
+	}
+	if par != d.par {
+		Printf("Uploading with %d connections, so every part is %d to %d bytes\n", par, s3MinPart, s3MaxPart)
+		d.par = par
+		if d.parts, err = partCalculate(par, d.len, d.url); err != nil {
+			return err
+		}
+	}
+
+	u, err := NewS3Upload(target)
+	if err != nil {
+		return err
+	}
+	if err := u.Start(); err != nil {
+		return err
+	}
+	Printf("Streaming download into %s\n", target)
+	d.upload = u
+	// parts which are half uploaded can not be continued
+	d.resumable = false
+	return nil
+}
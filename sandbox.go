@@ -0,0 +1,82 @@
+package hget
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var sandbox = false
+
+// sandboxReadOnly are the system files hget reads, certificates, resolver configuration and /proc for locks
+var sandboxReadOnly = []string{"/etc", "/usr/share/ca-certificates", "/usr/local/share/certs", "/usr/lib/ssl", "/proc"}
+
+// sandboxPaths returns the paths hget needs to write, to read and to execute to run `args`, anything else
+// is off limits once the sandbox is applied.
+func sandboxPaths(args []string) ([]string, []string, []string) {
+	cwd, _ := os.Getwd()
+	writable := []string{dataDir(), cwd, os.DevNull, "/dev/tty"}
+	// the key state files are signed with
+	writable = append(writable, configDir())
+	if output != "" {
+		if IsDevice(output) {
+			writable = append(writable, output)
+		} else {
+			writable = append(writable, filepath.Dir(inOutputDir(output)))
+		}
+	}
+	if outputDir != "" {
+		writable = append(writable, outputDir)
+	}
+	if watchDest != "" {
+		writable = append(writable, watchDest)
+	}
+	if reportPath != "" {
+		writable = append(writable, filepath.Dir(reportPath))
+	}
+	readable := append([]string(nil), sandboxReadOnly...)
+	if urlFile != "" {
+		readable = append(readable, urlFile)
+	}
+
+	switch {
+	case len(args) > 1 && args[0] == "watch":
+		writable = append(writable, args[1])
+	case len(args) > 2 && args[0] == "tasks" && args[1] == "import":
+		readable = append(readable, args[2])
+	}
+	return writable, readable, sandboxPrograms()
+}
+
+// sandboxPrograms returns the programs hget may have to run: rsync for rsync:// urls, which may come
+// from any list, and the shell with the program each hook command starts.
+func sandboxPrograms() []string {
+	var commands []string
+	if _, builtin := preflights[preflight]; preflight != "" && !builtin {
+		commands = append(commands, preflight)
+	}
+	commands = append(commands, resolverSpecs...)
+	if prefixHook != "" && !strings.HasPrefix(prefixHook, "http://") && !strings.HasPrefix(prefixHook, "https://") {
+		commands = append(commands, prefixHook)
+	}
+
+	names := []string{"rsync"}
+	if len(commands) > 0 {
+		names = append(names, "sh")
+	}
+	for _, command := range commands {
+		if fields := strings.Fields(command); len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	var programs []string
+	for _, name := range names {
+		if path, err := exec.LookPath(name); err == nil {
+			if abs, err := filepath.Abs(path); err == nil {
+				programs = append(programs, abs)
+			}
+		}
+	}
+	return programs
+}
@@ -0,0 +1,151 @@
+//go:build linux
+// +build linux
+
+package hget
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// landlock system calls, numbered the same on every architecture
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1
+	landlockRulePathBeneath      = 1
+
+	prSetNoNewPrivs = 38
+	oPath           = 0x200000
+)
+
+// landlock file system rights
+const (
+	accessExecute = 1 << iota
+	accessWriteFile
+	accessReadFile
+	accessReadDir
+	accessRemoveDir
+	accessRemoveFile
+	accessMakeChar
+	accessMakeDir
+	accessMakeReg
+	accessMakeSock
+	accessMakeFifo
+	accessMakeBlock
+	accessMakeSym
+	accessRefer
+
+	accessFile  = accessExecute | accessWriteFile | accessReadFile
+	accessRead  = accessReadFile | accessReadDir
+	accessWrite = accessRead | accessWriteFile | accessRemoveDir | accessRemoveFile | accessMakeDir | accessMakeReg | accessMakeSock
+)
+
+// sandboxedEnv tells hget it executed itself once restricted, it holds the pid which exec keeps
+const sandboxedEnv = "HGET_SANDBOXED"
+
+// sandboxLibraries are where the dynamic loader and the libraries of a cgo build are, hget needs to
+// execute itself once restricted
+var sandboxLibraries = []string{"/lib", "/lib64", "/usr/lib", "/usr/lib64", "/usr/local/lib"}
+
+type landlockRulesetAttr struct {
+	handledAccessFS uint64
+}
+
+// landlockPathBeneathAttr is packed in the kernel, the trailing padding of the Go struct is not read
+type landlockPathBeneathAttr struct {
+	allowedAccess uint64
+	parentFd      int32
+}
+
+// Sandbox restricts the file system access of hget to reading `readable`, writing `writable` and
+// executing `executable` with Landlock, for good: it can not be lifted until hget exits. Network access
+// stays allowed.
+//
+// Go can only restrict every thread of a process at once when built without cgo, so the current thread
+// is restricted and hget executes itself again on it with the same arguments: the new process starts
+// from that thread alone and every thread it creates inherits the restriction. Sandbox only returns
+// once in the new process, or with an error.
+func Sandbox(writable []string, readable []string, executable []string) error {
+	if os.Getenv(sandboxedEnv) == strconv.Itoa(os.Getpid()) {
+		os.Unsetenv(sandboxedEnv)
+		return nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	abi, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return fmt.Errorf("landlock is not available (linux 5.13 or later with landlock enabled is needed): %v", errno)
+	}
+	handled := uint64(accessMakeSym<<1 - 1)
+	write := uint64(accessWrite)
+	if abi >= 2 {
+		// files may be moved between the allowed folders
+		handled |= accessRefer
+		write |= accessRefer
+	}
+
+	attr := landlockRulesetAttr{handledAccessFS: handled}
+	ruleset, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("could not create landlock ruleset: %v", errno)
+	}
+	defer syscall.Close(int(ruleset))
+
+	for _, rule := range []struct {
+		paths  []string
+		access uint64
+	}{{readable, accessRead}, {writable, write}, {append(append([]string{exe}, executable...), sandboxLibraries...), accessRead | accessExecute}} {
+		for _, path := range rule.paths {
+			if err := landlockAllow(int(ruleset), path, rule.access); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the thread is never unlocked, no other goroutine may run on it once restricted
+	runtime.LockOSThread()
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("could not set no_new_privs: %v", errno)
+	}
+	if _, _, errno := syscall.RawSyscall(sysLandlockRestrictSelf, ruleset, 0, 0); errno != 0 {
+		return fmt.Errorf("could not apply landlock ruleset: %v", errno)
+	}
+	env := append(os.Environ(), sandboxedEnv+"="+strconv.Itoa(os.Getpid()))
+	return fmt.Errorf("could not execute hget in the sandbox: %v", syscall.Exec(exe, os.Args, env))
+}
+
+// landlockAllow grants `access` below `path`, or to the file itself, missing paths are skipped.
+func landlockAllow(ruleset int, path string, access uint64) error {
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		access &= accessFile
+	}
+
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("could not open %s for the sandbox: %v", path, err)
+	}
+	defer syscall.Close(fd)
+
+	attr := landlockPathBeneathAttr{allowedAccess: access, parentFd: int32(fd)}
+	if _, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(ruleset), landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("could not allow %s in the sandbox: %v", path, errno)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+//go:build linux
+// +build linux
+
+package hget
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSandbox(t *testing.T) {
+	if dir := os.Getenv("HGET_SANDBOX_TEST"); dir != "" {
+		// the sandboxed process, the sandbox can not be lifted so it gets a process of its own
+		allowed, _ := exec.LookPath("true")
+		if err := Sandbox([]string{filepath.Join(dir, "allowed"), os.DevNull}, nil, []string{allowed}); err != nil {
+			os.Stdout.WriteString("unavailable: " + err.Error())
+			os.Exit(0)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "allowed", "file"), nil, 0600); err != nil {
+			os.Stdout.WriteString("allowed write failed: " + err.Error())
+			os.Exit(1)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0600); err == nil {
+			os.Stdout.WriteString("write outside of the sandbox succeeded")
+			os.Exit(1)
+		}
+		if err := exec.Command(allowed).Run(); err != nil {
+			os.Stdout.WriteString("allowed program failed: " + err.Error())
+			os.Exit(1)
+		}
+		// false exits with 1 when it runs at all
+		var exit *exec.ExitError
+		if err := exec.Command("false").Run(); errors.As(err, &exit) {
+			os.Stdout.WriteString("other program ran in the sandbox")
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "allowed"), 0700)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSandbox$")
+	cmd.Env = append(os.Environ(), "HGET_SANDBOX_TEST="+dir)
+	out, err := cmd.CombinedOutput()
+	if strings.HasPrefix(string(out), "unavailable: ") {
+		t.Skip(string(out))
+	}
+	if err != nil {
+		t.Fatalf("sandboxed process failed: %v %s", err, out)
+	}
+}
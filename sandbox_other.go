@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package hget
+
+import "errors"
+
+// Sandbox is only implemented with Landlock on linux so far.
+func Sandbox(writable []string, readable []string, executable []string) error {
+	return errors.New("-sandbox is only supported on linux")
+}
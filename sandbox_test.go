@@ -0,0 +1,29 @@
+package hget
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestSandboxPrograms(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell")
+	}
+	defer func(hook string) { prefixHook = hook }(prefixHook)
+
+	prefixHook = "https://hooks.example/prefix"
+	for _, program := range sandboxPrograms() {
+		if program == sh {
+			t.Fatalf("the shell should only run with hook commands")
+		}
+	}
+	prefixHook = "sh ./notify.sh"
+	found := false
+	for _, program := range sandboxPrograms() {
+		found = found || program == sh
+	}
+	if !found {
+		t.Fatalf("the shell of a hook command should be executable, got %v", sandboxPrograms())
+	}
+}
@@ -0,0 +1,154 @@
+package hget
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// GitCommit is the version of the binary, set by the Makefile
+var GitCommit = ""
+
+var releaseEndpoint = "https://api.github.com/repos/abzcoding/hget/releases/latest"
+
+// release is the part of a GitHub release hget needs to update itself.
+type release struct {
+	Tag    string `json:"tag_name"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// asset returns the download url of the first asset whose name passes `match`.
+func (r *release) asset(match func(name string) bool) (string, string) {
+	for _, a := range r.Assets {
+		if match(strings.ToLower(a.Name)) {
+			return a.Name, a.URL
+		}
+	}
+	return "", ""
+}
+
+// SelfUpdate replaces the executable at `exe` with the binary of the latest release for this platform,
+// after verifying it against the checksums published with the release.
+func SelfUpdate(exe string) error {
+	client := ProxyAwareHTTPClient("")
+	var latest release
+	if err := getJSON(client, releaseEndpoint, &latest); err != nil {
+		return err
+	}
+	if latest.Tag != "" && latest.Tag == GitCommit {
+		Printf("hget %s is up to date\n", GitCommit)
+		return nil
+	}
+
+	platform := runtime.GOOS + "_" + runtime.GOARCH
+	name, binaryURL := latest.asset(func(name string) bool {
+		return strings.HasPrefix(name, "hget") && strings.Contains(name, platform)
+	})
+	if binaryURL == "" {
+		return fmt.Errorf("release %s has no binary for %s", latest.Tag, platform)
+	}
+	_, sumsURL := latest.asset(func(name string) bool {
+		return strings.Contains(name, "checksums") || strings.Contains(name, "sha256sums")
+	})
+	if sumsURL == "" {
+		return fmt.Errorf("release %s publishes no checksums, refusing to update", latest.Tag)
+	}
+	expected, err := releaseChecksum(client, sumsURL, name)
+	if err != nil {
+		return err
+	}
+
+	Printf("Updating to %s from %s\n", latest.Tag, binaryURL)
+	// next to the executable, so that the final rename does not cross file systems
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), ".hget-update-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := download(client, binaryURL, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := VerifyFile(tmp.Name(), expected); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	if runtime.GOOS == "windows" {
+		// a running executable can not be replaced, but it can be moved away
+		os.Remove(exe + ".old")
+		if err := os.Rename(exe, exe+".old"); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		return err
+	}
+	Printf("Updated %s to %s\n", exe, latest.Tag)
+	return nil
+}
+
+// releaseChecksum finds the sha256 of `name` in a `hex  name` checksums file.
+func releaseChecksum(client *http.Client, url string, name string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get checksums: %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return "sha256:" + fields[0], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("no checksum published for " + name)
+}
+
+func getJSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func download(client *http.Client, url string, w io.Writer) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
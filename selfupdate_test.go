@@ -0,0 +1,56 @@
+package hget
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSelfUpdate(t *testing.T) {
+	binary := []byte("new hget")
+	digest := sha256.Sum256(binary)
+	name := fmt.Sprintf("hget_%s_%s", runtime.GOOS, runtime.GOARCH)
+	sums := hex.EncodeToString(digest[:]) + "  " + name + "\n"
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest":
+			fmt.Fprintf(w, `{"tag_name": "v2.0.0", "assets": [
+				{"name": %q, "browser_download_url": "%s/binary"},
+				{"name": "checksums.txt", "browser_download_url": "%s/checksums"}]}`, name, srv.URL, srv.URL)
+		case "/binary":
+			w.Write(binary)
+		case "/checksums":
+			w.Write([]byte(sums))
+		}
+	}))
+	defer srv.Close()
+	defer func(endpoint string) { releaseEndpoint = endpoint }(releaseEndpoint)
+	releaseEndpoint = srv.URL + "/latest"
+
+	exe := filepath.Join(t.TempDir(), "hget")
+	ioutil.WriteFile(exe, []byte("old hget"), 0755)
+	if err := SelfUpdate(exe); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(exe); string(got) != string(binary) {
+		t.Fatalf("executable should be replaced, got %q", got)
+	}
+
+	// a tampered binary must not replace the executable
+	binary = []byte("evil hget")
+	ioutil.WriteFile(exe, []byte("old hget"), 0755)
+	if err := SelfUpdate(exe); err == nil {
+		t.Fatalf("checksum mismatch should fail")
+	}
+	if got, _ := ioutil.ReadFile(exe); string(got) != "old hget" {
+		t.Fatalf("executable should be kept, got %q", got)
+	}
+}
@@ -0,0 +1,146 @@
+package hget
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Share serves the downloaded files of a folder, with ranges, to other machines.
+type Share struct {
+	root  string
+	token string
+	files http.Handler
+}
+
+// NewShare creates a share of `dir`, requiring `token` from clients when it is not empty.
+func NewShare(dir string, token string) (*Share, error) {
+	root, err := filepath.Abs(dir)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stat, err := os.Stat(root); err != nil || !stat.IsDir() {
+		return nil, fmt.Errorf("%s is not a folder", dir)
+	}
+	s := &Share{root: root, token: token}
+	s.files = http.FileServer(shareFS{root: root})
+	return s, nil
+}
+
+// Serve shares the folder on `addr`, or the socket systemd passed, until hget gets interrupted.
+func (s *Share) Serve(addr string) error {
+	listener, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: s}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+	defer server.Close()
+	defer sdNotify("STOPPING=1")
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sig)
+
+	Printf("Sharing %s on http://%s/\n", s.root, listener.Addr())
+	sdNotify("READY=1")
+	select {
+	case err := <-serveErr:
+		return err
+	case <-sig:
+		return nil
+	}
+}
+
+// ServeHTTP answers GET and HEAD requests for the files of the share, authenticated with the token as a
+// bearer token, the password of basic auth (for browsers) or a `token` query parameter (for wget and curl).
+func (s *Share) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		http.Error(w, "only GET and HEAD are accepted", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.token != "" && !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="hget"`)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	s.files.ServeHTTP(w, r)
+}
+
+func (s *Share) authorized(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	} else if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// shareFS is the folder of a share, without its hidden files and without the links leading out of it.
+type shareFS struct {
+	root string
+}
+
+// Open implements http.FileSystem
+func (fs shareFS) Open(name string) (http.File, error) {
+	for _, element := range strings.Split(path.Clean("/"+name), "/") {
+		if strings.HasPrefix(element, ".") {
+			return nil, os.ErrNotExist
+		}
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(fs.root, filepath.FromSlash(path.Clean("/"+name))))
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+	if resolved != fs.root && !strings.HasPrefix(resolved, fs.root+string(filepath.Separator)) {
+		return nil, os.ErrNotExist
+	}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, err
+	}
+	return shareFile{f}, nil
+}
+
+// shareFile hides the hidden files of the folders listed.
+type shareFile struct {
+	*os.File
+}
+
+// Readdir implements http.File
+func (f shareFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+	visible := infos[:0]
+	for _, info := range infos {
+		if !strings.HasPrefix(info.Name(), ".") {
+			visible = append(visible, info)
+		}
+	}
+	return visible, err
+}
+
+// ReadDir implements fs.ReadDirFile, which http.FileServer prefers to Readdir
+func (f shareFile) ReadDir(count int) ([]os.DirEntry, error) {
+	entries, err := f.File.ReadDir(count)
+	visible := entries[:0]
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			visible = append(visible, entry)
+		}
+	}
+	return visible, err
+}
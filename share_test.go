@@ -0,0 +1,74 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShare(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hget-share")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outside, err := ioutil.TempDir("", "hget-outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	ioutil.WriteFile(filepath.Join(dir, "1.iso"), []byte("0123456789"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".hidden"), []byte("secret"), 0644)
+	ioutil.WriteFile(filepath.Join(outside, "passwd"), []byte("root"), 0644)
+	os.Symlink(filepath.Join(outside, "passwd"), filepath.Join(dir, "passwd"))
+
+	if _, err := NewShare(filepath.Join(dir, "1.iso"), ""); err == nil {
+		t.Fatalf("files should not be shared as folders")
+	}
+	s, err := NewShare(dir, "secret")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/1.iso", nil); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("requests without token should be refused, got %d", rec.Code)
+	}
+	if rec := get("/1.iso", http.Header{"Authorization": {"Bearer wrong"}}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("a wrong token should be refused, got %d", rec.Code)
+	}
+	rec := get("/1.iso?token=secret", http.Header{"Range": {"bytes=2-5"}})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" {
+		t.Fatalf("ranges should be served, got %d %q", rec.Code, rec.Body.String())
+	}
+	basic := httptest.NewRequest(http.MethodGet, "/", nil)
+	basic.SetBasicAuth("me", "secret")
+	listing := httptest.NewRecorder()
+	s.ServeHTTP(listing, basic)
+	if listing.Code != http.StatusOK || !strings.Contains(listing.Body.String(), "1.iso") || strings.Contains(listing.Body.String(), ".hidden") {
+		t.Fatalf("the listing should show the visible files only, got %d %s", listing.Code, listing.Body.String())
+	}
+	for _, target := range []string{"/.hidden", "/passwd", "/../" + filepath.Base(outside) + "/passwd"} {
+		if rec := get(target, http.Header{"Authorization": {"Bearer secret"}}); rec.Code != http.StatusNotFound {
+			t.Fatalf("%s should not be served, got %d", target, rec.Code)
+		}
+	}
+	post := httptest.NewRequest(http.MethodPost, "/1.iso?token=secret", nil)
+	rec = httptest.NewRecorder()
+	if s.ServeHTTP(rec, post); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST should be refused, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package hget
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var snapshotFileName = "progress.jsonl"
+
+// snapshotEvery is how often a running download records how far it got
+var snapshotEvery = 30 * time.Second
+
+// Snapshot is how far a task got at some point of one of its sessions, a run between two interruptions.
+type Snapshot struct {
+	Time    time.Time
+	Session int
+	Done    int64
+	Total   int64
+}
+
+// Snapshots is a ProgressSink recording snapshots of the running download in its task folder, for
+// hget tasks progress to show how it advanced across sessions.
+type Snapshots struct {
+	nopSink
+	path string
+
+	mu      sync.Mutex
+	current Snapshot
+	saved   time.Time
+}
+
+// OpenSnapshots starts a new session of the task in `folder`, which already has `done` of its `total` bytes.
+func OpenSnapshots(folder string, total int64, done int64) *Snapshots {
+	s := &Snapshots{path: filepath.Join(folder, snapshotFileName)}
+	session := 1
+	if previous, err := readSnapshots(s.path); err == nil && len(previous) > 0 {
+		session = previous[len(previous)-1].Session + 1
+	}
+	s.current = Snapshot{Session: session, Done: done, Total: total}
+	s.record(time.Now())
+	return s
+}
+
+// record appends the current snapshot to the file, s.mu is held unless nobody else has s yet.
+func (s *Snapshots) record(now time.Time) {
+	s.current.Time, s.saved = now, now
+	raw, err := json.Marshal(s.current)
+	if err != nil {
+		return
+	}
+	// opened for every snapshot, the task folder is removed once complete
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(raw, '\n'))
+}
+
+// OnBytes implements ProgressSink
+func (s *Snapshots) OnBytes(index int64, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current.Done += n
+	if now := time.Now(); now.Sub(s.saved) >= snapshotEvery {
+		s.record(now)
+	}
+}
+
+// Close records where the session ended.
+func (s *Snapshots) Close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record(time.Now())
+}
+
+// readSnapshots returns the snapshots of the file at `path`, oldest first.
+func readSnapshots(path string) ([]Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var snapshots []Snapshot
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var snapshot Snapshot
+		// a line cut short by a crash is skipped
+		if json.Unmarshal(scanner.Bytes(), &snapshot) == nil {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, scanner.Err()
+}
+
+// TaskProgress prints how `task` advanced across its sessions, as a burn-down of the bytes left with
+// the speed between snapshots, and the remaining time at the speed of the last session.
+func TaskProgress(task string, w io.Writer) error {
+	snapshots, err := readSnapshots(filepath.Join(taskFolder(task), snapshotFileName))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s has no progress recorded", task)
+	}
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return fmt.Errorf("%s has no progress recorded", task)
+	}
+
+	const width = 30
+	var sessionStart Snapshot
+	for i, s := range snapshots {
+		if i == 0 || s.Session != snapshots[i-1].Session {
+			fmt.Fprintf(w, "session %d\n", s.Session)
+			sessionStart = s
+		}
+		left := s.Total - s.Done
+		filled := 0
+		if s.Total > 0 {
+			filled = int(left * width / s.Total)
+		}
+		rate := ""
+		if i > 0 && s.Session == snapshots[i-1].Session {
+			if elapsed := s.Time.Sub(snapshots[i-1].Time).Seconds(); elapsed > 0 {
+				rate = humanBytes(int64(float64(s.Done-snapshots[i-1].Done)/elapsed)) + "/s"
+			}
+		}
+		fmt.Fprintf(w, "  %s  [%s%s] %10s left  %s\n", s.Time.Local().Format("2006-01-02 15:04:05"),
+			strings.Repeat("#", filled), strings.Repeat(".", width-filled), humanBytes(left), rate)
+	}
+
+	last := snapshots[len(snapshots)-1]
+	measured := Throughput{Bytes: last.Done - sessionStart.Done, Elapsed: last.Time.Sub(sessionStart.Time)}
+	if eta, ok := measured.ETA(last.Total - last.Done); ok && last.Done < last.Total {
+		fmt.Fprintf(w, "%s left, about %s at %s/s\n", humanBytes(last.Total-last.Done), formatETA(eta), humanBytes(int64(measured.Rate())))
+	}
+	return nil
+}
+
+// progressOf returns the bytes the download of `d` holds and how many of them are done already.
+func (d *HTTPDownloader) progressOf() (int64, int64) {
+	total := d.len
+	if d.window != nil {
+		total = d.window.size()
+	} else if total <= 0 && len(d.parts) > 0 {
+		// resumed, the last part ends at the length of the file
+		total = d.parts[len(d.parts)-1].RangeTo
+	}
+	done := total
+	for _, part := range d.parts {
+		if part.RangeTo > part.RangeFrom {
+			done -= part.RangeTo - part.RangeFrom
+		}
+	}
+	if done < 0 {
+		done = 0
+	}
+	return total, done
+}
@@ -0,0 +1,53 @@
+package hget
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshots(t *testing.T) {
+	defer func(data string, every time.Duration) { dataPath, snapshotEvery = data, every }(dataPath, snapshotEvery)
+	dataPath = t.TempDir()
+	snapshotEvery = 0
+	folder := FolderOf("big.iso")
+	os.MkdirAll(folder, 0755)
+
+	s := OpenSnapshots(folder, 1000, 0)
+	s.OnBytes(0, 100)
+	s.OnBytes(1, 200)
+	s.Close()
+	// resumed
+	s = OpenSnapshots(folder, 1000, 300)
+	s.OnBytes(0, 200)
+	s.Close()
+
+	snapshots, err := readSnapshots(filepath.Join(folder, snapshotFileName))
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if len(snapshots) != 7 || snapshots[3].Session != 1 || snapshots[3].Done != 300 || snapshots[4].Session != 2 || snapshots[6].Done != 500 {
+		t.Fatalf("unexpected snapshots %+v", snapshots)
+	}
+
+	var report bytes.Buffer
+	if err := TaskProgress("big.iso", &report); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if !strings.Contains(report.String(), "session 2\n") || !strings.Contains(report.String(), "[###############...............]      500 B left") {
+		t.Fatalf("unexpected report %q", report.String())
+	}
+	if err := TaskProgress("other.iso", &report); err == nil {
+		t.Fatalf("a task without snapshots should fail")
+	}
+}
+
+func TestProgressOf(t *testing.T) {
+	d := &HTTPDownloader{parts: []Part{{RangeFrom: 50, RangeTo: 99}, {Index: 1, RangeFrom: 200, RangeTo: 200}}}
+	if total, done := d.progressOf(); total != 200 || done != 151 {
+		t.Fatalf("expected 151 of 200 bytes done, got %d of %d", done, total)
+	}
+}
@@ -0,0 +1,136 @@
+package hget
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+var spreadIPs = false
+
+// slowIPRatio is the share of the throughput of the fastest ip below which an ip gets no new connections
+var slowIPRatio = 0.25
+
+// ipSample is how many bytes an ip has to send before its throughput is trusted
+var ipSample int64 = 1 << 20
+
+// ipRetryAfter is how long an ip which could not be dialed gets no new connections
+var ipRetryAfter = 30 * time.Second
+
+// ipStats is the throughput of the connections to an ip, measured while they are waiting for data.
+type ipStats struct {
+	bytes   int64
+	reading time.Duration
+	failed  time.Time
+	slow    bool
+}
+
+func (s *ipStats) rate() (float64, bool) {
+	if s.bytes < ipSample || s.reading <= 0 {
+		return 0, false
+	}
+	return float64(s.bytes) / s.reading.Seconds(), true
+}
+
+// ipPool spreads the connections to a host across all its addresses, for mirror pools behind
+// DNS round robin, and stops dialing those which turn out to be slow or unreachable.
+type ipPool struct {
+	mu    sync.Mutex
+	next  map[string]int
+	stats map[string]*ipStats
+}
+
+var spread = newIPPool()
+
+func newIPPool() *ipPool {
+	return &ipPool{next: make(map[string]int), stats: make(map[string]*ipStats)}
+}
+
+// pick returns the next of the usable `ips` of `host`, every one of them if none is usable.
+func (p *ipPool) pick(host string, ips []net.IP) net.IP {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best float64
+	for _, ip := range ips {
+		if rate, ok := p.statsOf(ip).rate(); ok && rate > best {
+			best = rate
+		}
+	}
+	var usable []net.IP
+	for _, ip := range ips {
+		s := p.statsOf(ip)
+		if time.Since(s.failed) < ipRetryAfter {
+			continue
+		}
+		if rate, ok := s.rate(); ok && rate < best*slowIPRatio {
+			if !s.slow {
+				Warnf("%s is much slower than the other addresses of %s (%s/s), dialing it no more\n", ip, host, humanBytes(int64(rate)))
+				s.slow = true
+			}
+			continue
+		}
+		usable = append(usable, ip)
+	}
+	if len(usable) == 0 {
+		usable = ips
+	}
+	ip := usable[p.next[host]%len(usable)]
+	p.next[host]++
+	return ip
+}
+
+// statsOf returns the stats of `ip`, with p.mu held.
+func (p *ipPool) statsOf(ip net.IP) *ipStats {
+	s, ok := p.stats[ip.String()]
+	if !ok {
+		s = &ipStats{}
+		p.stats[ip.String()] = s
+	}
+	return s
+}
+
+// DialContext connects to the next address of the requested host, trying the others when it fails.
+func (p *ipPool) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := resolved.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := newDialer()
+	for range ips {
+		ip := p.pick(host, ips)
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return &measuredConn{Conn: conn, pool: p, ip: ip}, nil
+		}
+		p.mu.Lock()
+		p.statsOf(ip).failed = time.Now()
+		p.mu.Unlock()
+	}
+	return nil, err
+}
+
+// measuredConn adds what it reads, and how long it waited for it, to the stats of its ip.
+type measuredConn struct {
+	net.Conn
+	pool *ipPool
+	ip   net.IP
+}
+
+func (c *measuredConn) Read(b []byte) (int, error) {
+	start := time.Now()
+	n, err := c.Conn.Read(b)
+	c.pool.mu.Lock()
+	s := c.pool.statsOf(c.ip)
+	s.bytes += int64(n)
+	s.reading += time.Since(start)
+	c.pool.mu.Unlock()
+	return n, err
+}
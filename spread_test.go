@@ -0,0 +1,65 @@
+package hget
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIPPoolPick(t *testing.T) {
+	p := newIPPool()
+	ips := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3")}
+	var picked []string
+	for i := 0; i < 4; i++ {
+		picked = append(picked, p.pick("a.org", ips).String())
+	}
+	if strings.Join(picked, " ") != "10.0.0.1 10.0.0.2 10.0.0.3 10.0.0.1" {
+		t.Fatalf("ips should be picked in turn, got %v", picked)
+	}
+
+	p.stats["10.0.0.1"] = &ipStats{bytes: 10 << 20, reading: time.Second}
+	p.stats["10.0.0.2"] = &ipStats{bytes: 1 << 20, reading: time.Second}
+	p.stats["10.0.0.3"] = &ipStats{failed: time.Now()}
+	for i := 0; i < 3; i++ {
+		if ip := p.pick("a.org", ips).String(); ip != "10.0.0.1" {
+			t.Fatalf("slow and unreachable ips should not be picked, got %s", ip)
+		}
+	}
+
+	p.stats["10.0.0.1"].failed = time.Now()
+	p.stats["10.0.0.2"].failed = time.Now()
+	if ip := p.pick("a.org", ips); ip == nil {
+		t.Fatalf("every ip should be tried again when none is usable")
+	}
+}
+
+func TestIPPoolDial(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hget"))
+	}))
+	defer server.Close()
+
+	p := newIPPool()
+	client := &http.Client{Transport: &http.Transport{DialContext: p.DialContext}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hget" || p.stats["127.0.0.1"] == nil || p.stats["127.0.0.1"].bytes == 0 {
+		t.Fatalf("the bytes read should be measured, got %q and %+v", body, p.stats)
+	}
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := listener.Addr().String()
+	listener.Close()
+	if _, err := p.DialContext(context.Background(), "tcp", addr); err == nil || p.stats["127.0.0.1"].failed.IsZero() {
+		t.Fatalf("unreachable ips should be marked, got %v", err)
+	}
+}
@@ -1,19 +1,44 @@
-package main
+package hget
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
 var dataFolder = ".hget/"
+
+// dataPath replaces $HOME/.hget as the folder of the tasks when set
+var dataPath = ""
 var stateFileName = "state.json"
 
 // State holds information about url Parts
 type State struct {
-	URL   string
-	Parts []Part
+	URL        string
+	Parts      []Part
+	Encryption *Encryption `json:",omitempty"`
+	Device     string      `json:",omitempty"`
+	Throughput *Throughput `json:",omitempty"`
+	Redirects  []string    `json:",omitempty"`
+	Mirrors    []string    `json:",omitempty"`
+	UserAgent  string      `json:",omitempty"`
+	Headers    http.Header `json:",omitempty"`
+	// Validator is the ETag or Last-Modified date ranges are asked for with, through If-Range
+	Validator string `json:",omitempty"`
+	// Version is the ETag or Last-Modified date every part has to come with
+	Version string `json:",omitempty"`
+	// Pinned is where the parts are requested from with -pin-target
+	Pinned *PinnedTarget `json:",omitempty"`
+	// Window is the part of the file downloaded with -range
+	Window *byteWindow `json:",omitempty"`
+	// Environment is the hget and the options the task was started with
+	Environment *Environment `json:",omitempty"`
+	// Output is the -o the task was started with, the task is named after it
+	Output string `json:",omitempty"`
 }
 
 // Part represents a chunk of downloaded file
@@ -23,41 +48,123 @@ type Part struct {
 	Path      string
 	RangeFrom int64
 	RangeTo   int64
+	// Hash lets a resumed part be checked for damage, it is nil for parts not written to a file
+	Hash *PartHash `json:",omitempty"`
 }
 
 // Save stores downloaded file into disk
 func (s *State) Save() error {
 	//make temp folder
 	//only working in unix with env HOME
-	folder := FolderOf(s.URL)
+	folder := taskFolder(s.task())
 	Printf("Saving current download data in %s\n", folder)
 	if err := MkdirIfNotExist(folder); err != nil {
 		return err
 	}
 
 	//move current downloading file to data folder
-	for _, part := range s.Parts {
-		os.Rename(part.Path, filepath.Join(folder, filepath.Base(part.Path)))
+	for i, part := range s.Parts {
+		path := filepath.Join(folder, filepath.Base(part.Path))
+		if err := moveFile(part.Path, path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.Parts[i].Path = path
 	}
+	if parts := partsFolderOf(s.URL); parts != folder {
+		// left empty by the moves
+		os.Remove(parts)
+	}
+
+	return s.write(folder)
+}
 
-	//save state file
+// write stores the state file in `folder`
+func (s *State) write(folder string) error {
 	j, err := json.Marshal(s)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(filepath.Join(folder, stateFileName), j, 0644)
+	file := filepath.Join(folder, stateFileName)
+	if err := writeFileSynced(file, j, 0644); err != nil {
+		return err
+	}
+	return signStateFile(file, j)
+}
+
+var homeFallback sync.Once
+
+// dataDir returns the folder all tasks are kept in. Without a usable home, e.g. in a scratch
+// container where HOME is unset or read only, tasks are kept in the temp folder instead.
+func dataDir() string {
+	if dataPath != "" {
+		return dataPath
+	}
+	// StateDirectory= of a systemd unit
+	if dir := stateDirectory(); dir != "" {
+		return dir
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		folder := filepath.Join(home, dataFolder)
+		if MkdirIfNotExist(folder) == nil {
+			return folder
+		}
+	}
+
+	folder := filepath.Join(os.TempDir(), "hget")
+	homeFallback.Do(func() {
+		Warnf("No writable home folder, keeping tasks in %s, use -data-dir or HGET_DATA_DIR to pick another one\n", folder)
+	})
+	return folder
 }
 
 // Read loads data about the state of downloaded files
 func Read(task string) (*State, error) {
-	file := filepath.Join(os.Getenv("HOME"), dataFolder, task, stateFileName)
+	file := filepath.Join(dataDir(), task, stateFileName)
 	Printf("Getting data from %s\n", file)
 	bytes, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
+	if err := verifyStateFile(file, bytes); err != nil {
+		return nil, err
+	}
 
 	s := new(State)
-	err = json.Unmarshal(bytes, s)
-	return s, err
+	if err := json.Unmarshal(bytes, s); err != nil {
+		return nil, err
+	}
+	if err := s.validate(filepath.Dir(file)); err != nil {
+		return nil, fmt.Errorf("refusing state %s: %v", file, err)
+	}
+	return s, nil
+}
+
+// task returns the name of the task of the state.
+func (s *State) task() string {
+	return taskOf(s.URL, s.Output)
+}
+
+// validate makes sure a state read from `folder` only points at files of the task, so that a corrupted
+// or malicious state file can not get parts written to, renamed or joined from anywhere else.
+func (s *State) validate(folder string) error {
+	folder, err := filepath.Abs(folder)
+	if err != nil {
+		return err
+	}
+	if taskFolder(s.task()) != folder {
+		return fmt.Errorf("url %s does not belong to the task", s.URL)
+	}
+	for _, part := range s.Parts {
+		path, err := filepath.Abs(part.Path)
+		if err != nil || filepath.Dir(path) != folder {
+			return fmt.Errorf("part %d is outside of the task folder: %s", part.Index, part.Path)
+		}
+		if stat, err := os.Lstat(path); err == nil && !stat.Mode().IsRegular() {
+			return fmt.Errorf("part %d is not a regular file: %s", part.Index, part.Path)
+		}
+	}
+	if s.Device != "" && !IsDevice(s.Device) {
+		return fmt.Errorf("%s is not a device", s.Device)
+	}
+	return nil
 }
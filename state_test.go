@@ -1 +1,87 @@
-package main
+package hget
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDataDirWithoutHome(t *testing.T) {
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	fallback := filepath.Join(os.TempDir(), "hget")
+
+	os.Setenv("HOME", "")
+	if got := dataDir(); got != fallback {
+		t.Fatalf("without HOME tasks should go to %s, got %s", fallback, got)
+	}
+
+	// a home which is not a writable folder
+	home := filepath.Join(t.TempDir(), "file")
+	ioutil.WriteFile(home, nil, 0600)
+	os.Setenv("HOME", home)
+	if got := dataDir(); got != fallback {
+		t.Fatalf("with an unusable HOME tasks should go to %s, got %s", fallback, got)
+	}
+
+	dataPath = "/data"
+	defer func() { dataPath = "" }()
+	if got := dataDir(); got != "/data" {
+		t.Fatalf("-data-dir should win, got %s", got)
+	}
+}
+
+func TestStateOutsideTaskFolder(t *testing.T) {
+	defer func(old string) { dataPath = old }(dataPath)
+	dataPath = t.TempDir()
+
+	url := "http://a.org/hostile.iso"
+	folder := FolderOf(url)
+	os.MkdirAll(folder, 0700)
+	os.Symlink("/etc/passwd", filepath.Join(folder, "link.part000001"))
+
+	cases := []State{
+		{URL: url, Parts: []Part{{Path: filepath.Join(folder, "hostile.iso.part000000")}}},
+		{URL: url, Parts: []Part{{Path: "/etc/cron.d/hget"}}},
+		{URL: url, Parts: []Part{{Path: filepath.Join(folder, "..", "other", "hostile.iso.part000000")}}},
+		{URL: url, Parts: []Part{{Path: filepath.Join(folder, "link.part000001")}}},
+		{URL: "http://a.org/other.iso"},
+		{URL: url, Device: filepath.Join(folder, "link.part000001")},
+	}
+	for i, s := range cases {
+		raw, _ := json.Marshal(s)
+		ioutil.WriteFile(filepath.Join(folder, stateFileName), raw, 0644)
+		_, err := Read("hostile.iso")
+		if i == 0 && err != nil {
+			t.Fatalf("state of the task should be read, got %v", err)
+		}
+		if i > 0 && err == nil {
+			t.Fatalf("case %d: state pointing outside of the task should be refused", i)
+		}
+	}
+}
+
+func TestTaskNamedAfterOutput(t *testing.T) {
+	defer func(old string) { dataPath, output = old, "" }(dataPath)
+	dataPath = t.TempDir()
+
+	url := "http://a.org/download?id=42"
+	output = "ubuntu.iso"
+	if task, folder := TaskFromURL(url), FolderOf(url); task != "ubuntu.iso" || folder != filepath.Join(dataPath, "ubuntu.iso") {
+		t.Fatalf("the task should be named after -o, got %s in %s", task, folder)
+	}
+	if err := (&State{URL: url, Output: output}).Save(); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+
+	// hget resume ubuntu.iso, without -o
+	output = ""
+	s, err := Resume("ubuntu.iso")
+	if err != nil || s.URL != url {
+		t.Fatalf("the task should be found by the output name, got %v", err)
+	}
+	if output != "ubuntu.iso" {
+		t.Fatalf("a resumed task should be joined to its output, got %q", output)
+	}
+}
@@ -0,0 +1,105 @@
+package hget
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var signState = false
+
+var stateKeyName = "state.key"
+var stateSigSuffix = ".sig"
+
+// stateKey returns the key state files are signed with, creating it on first use. It is kept in the
+// config folder of the user rather than next to the tasks, which may be on a shared disk.
+func stateKey() ([]byte, error) {
+	folder := configDir()
+	path := filepath.Join(folder, stateKeyName)
+
+	if raw, err := ioutil.ReadFile(path); err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(raw)))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(folder, 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		// created by another hget in the meantime
+		return stateKey()
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	_, err = f.WriteString(hex.EncodeToString(key) + "\n")
+	return key, err
+}
+
+func stateMAC(data []byte) ([]byte, error) {
+	key, err := stateKey()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// signStateFile stores the signature of the state `data` written to `file` next to it, or removes a
+// signature left from before when signing is off.
+func signStateFile(file string, data []byte) error {
+	if !signState {
+		if err := os.Remove(file + stateSigSuffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	sum, err := stateMAC(data)
+	if err != nil {
+		return err
+	}
+	return writeFileSynced(file+stateSigSuffix, []byte(hex.EncodeToString(sum)+"\n"), 0644)
+}
+
+// verifyStateFile checks the state `data` read from `file` against its signature. Signed states are
+// always checked, unsigned ones are only refused when signing is on.
+func verifyStateFile(file string, data []byte) error {
+	raw, err := ioutil.ReadFile(file + stateSigSuffix)
+	if os.IsNotExist(err) {
+		if signState {
+			return fmt.Errorf("%s is not signed, refusing to trust it", file)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	expected, err := hex.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return fmt.Errorf("invalid signature of %s: %v", file, err)
+	}
+	sum, err := stateMAC(data)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(sum, expected) {
+		return errors.New(file + " does not match its signature, it was changed outside of hget")
+	}
+	return nil
+}
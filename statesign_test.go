@@ -0,0 +1,56 @@
+package hget
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignedState(t *testing.T) {
+	// the key goes to the config folder of the user
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("HOME", t.TempDir())
+	os.Setenv("XDG_CONFIG_HOME", "")
+	defer func(old string) { dataPath = old }(dataPath)
+	dataPath = t.TempDir()
+	signState = true
+	defer func() { signState = false }()
+
+	folder := FolderOf("http://a.org/signed.iso")
+	s := &State{URL: "http://a.org/signed.iso", Parts: []Part{{Index: 0, Path: filepath.Join(folder, "signed.iso.part000000"), RangeTo: 10}}}
+	os.MkdirAll(folder, 0700)
+	if err := s.write(folder); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read("signed.iso"); err != nil {
+		t.Fatalf("signed state should be read, got %v", err)
+	}
+
+	file := filepath.Join(folder, stateFileName)
+	// a range moved past what was downloaded
+	changed := *s
+	changed.Parts = []Part{s.Parts[0]}
+	changed.Parts[0].RangeFrom = 5
+	raw, _ := json.Marshal(changed)
+	ioutil.WriteFile(file, raw, 0644)
+	if _, err := Read("signed.iso"); err == nil {
+		t.Fatalf("changed state should be refused")
+	}
+
+	// signatures are checked even with signing off, unsigned states only refused with it on
+	signState = false
+	if _, err := Read("signed.iso"); err == nil {
+		t.Fatalf("changed state should be refused with signing off too")
+	}
+	os.Remove(file + stateSigSuffix)
+	if _, err := Read("signed.iso"); err != nil {
+		t.Fatalf("unsigned state should be read with signing off, got %v", err)
+	}
+	signState = true
+	if _, err := Read("signed.iso"); err == nil {
+		t.Fatalf("unsigned state should be refused with signing on")
+	}
+}
@@ -0,0 +1,171 @@
+package hget
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+)
+
+// progressStats, when set, also gets the progress of every download, for the status and the watchers of hget daemon
+var progressStats ProgressSink
+
+// ConnectionInfo tells where the response a part is downloaded from came from.
+type ConnectionInfo struct {
+	// Source is the url of the origin, a mirror, a peer or an agent
+	Source string
+	// IP is the address the response came from, the one of the proxy when there is one
+	IP string
+}
+
+// PartStats is what was measured over the current connection of a part.
+type PartStats struct {
+	Part    int64   `json:"part"`
+	Source  string  `json:"source,omitempty"`
+	IP      string  `json:"ip,omitempty"`
+	Retries int     `json:"retries"`
+	Bytes   int64   `json:"bytes"`
+	Rate    float64 `json:"rate"`
+}
+
+type connectionState struct {
+	stats       PartStats
+	started     time.Time
+	connections int
+}
+
+// ConnectionStats measures the throughput of each part over the connection it is downloaded on, so
+// that a slow mirror or CDN edge stands out.
+type ConnectionStats struct {
+	mu    sync.Mutex
+	parts map[int64]*connectionState
+
+	// parts with a running connection, and how many bytes came in while as many of them ran
+	active  map[int64]bool
+	sample  activitySample
+	samples []activitySample
+}
+
+// activitySample is what the running connections got together over a while none started or ended.
+type activitySample struct {
+	active  int
+	bytes   int64
+	started time.Time
+	elapsed time.Duration
+}
+
+// sampleEvery is how long an activity sample lasts at most
+var sampleEvery = time.Second
+
+// NewConnectionStats creates empty stats.
+func NewConnectionStats() *ConnectionStats {
+	return &ConnectionStats{parts: make(map[int64]*connectionState), active: make(map[int64]bool)}
+}
+
+// restartSample records the current sample when it lasted long enough and starts a new one, as
+// connections start or end, c.mu is held.
+func (c *ConnectionStats) restartSample(now time.Time) {
+	if !c.sample.started.IsZero() && c.sample.active > 0 {
+		c.sample.elapsed = now.Sub(c.sample.started)
+		c.samples = append(c.samples, c.sample)
+	}
+	c.sample = activitySample{active: len(c.active), started: now}
+}
+
+func (c *ConnectionStats) part(index int64) *connectionState {
+	s := c.parts[index]
+	if s == nil {
+		s = &connectionState{stats: PartStats{Part: index}, started: time.Now()}
+		c.parts[index] = s
+	}
+	return s
+}
+
+// Of returns the stats of part `index`.
+func (c *ConnectionStats) Of(index int64) PartStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.part(index).current()
+}
+
+// Snapshot returns the stats of every part, by part.
+func (c *ConnectionStats) Snapshot() []PartStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make([]PartStats, 0, len(c.parts))
+	for _, s := range c.parts {
+		stats = append(stats, s.current())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Part < stats[j].Part })
+	return stats
+}
+
+func (s *connectionState) current() PartStats {
+	stats := s.stats
+	if elapsed := time.Since(s.started).Seconds(); elapsed > 0 {
+		stats.Rate = float64(stats.Bytes) / elapsed
+	}
+	return stats
+}
+
+// OnPartStart implements ProgressSink
+func (c *ConnectionStats) OnPartStart(index int64, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.part(index)
+}
+
+// OnConnection implements ProgressSink
+func (c *ConnectionStats) OnConnection(index int64, info ConnectionInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.part(index)
+	s.connections++
+	s.started = time.Now()
+	s.stats.Source, s.stats.IP, s.stats.Bytes = info.Source, info.IP, 0
+	s.stats.Retries = s.connections - 1
+	if !c.active[index] {
+		c.active[index] = true
+		c.restartSample(time.Now())
+	}
+}
+
+// OnBytes implements ProgressSink
+func (c *ConnectionStats) OnBytes(index int64, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.part(index).stats.Bytes += n
+	c.sample.bytes += n
+	if now := time.Now(); now.Sub(c.sample.started) >= sampleEvery {
+		c.restartSample(now)
+	}
+}
+
+// OnPartDone implements ProgressSink
+func (c *ConnectionStats) OnPartDone(index int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active[index] {
+		delete(c.active, index)
+		c.restartSample(time.Now())
+	}
+}
+
+// OnJoin implements ProgressSink
+func (c *ConnectionStats) OnJoin(done int, total int) {}
+
+// OnComplete implements ProgressSink
+func (c *ConnectionStats) OnComplete(path string) {}
+
+// traceRemote makes `req` store the address it is sent to in `remote`.
+func traceRemote(req *http.Request, remote *string) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if addr := info.Conn.RemoteAddr(); addr != nil {
+				*remote = addr.String()
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
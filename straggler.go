@@ -0,0 +1,260 @@
+package hget
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fujiwara/shapeio"
+)
+
+var noHedge = false
+
+// stragglerRatio is the share of the median throughput of the parts below which a part is a straggler
+var stragglerRatio = 0.3
+
+// stragglerGrace is how long a part runs before its throughput is trusted
+var stragglerGrace = 5 * time.Second
+
+// stragglerMin is how many bytes a part has left at least for a second connection to be worth it
+var stragglerMin int64 = 1 << 20
+
+// stragglerCheck is how often the throughput of the parts is compared
+var stragglerCheck = time.Second
+
+// partRun is a request of a part being copied, its written bytes are counted as they land.
+type partRun struct {
+	index     int64
+	size      int64
+	started   time.Time
+	written   int64
+	finished  time.Time
+	hedge     chan struct{}
+	straggled bool
+}
+
+// Write implements io.Writer
+func (r *partRun) Write(b []byte) (int, error) {
+	atomic.AddInt64(&r.written, int64(len(b)))
+	return len(b), nil
+}
+
+// Hedge is closed when the part turns out to be a straggler. It never fires on a nil run.
+func (r *partRun) Hedge() <-chan struct{} {
+	if r == nil {
+		return nil
+	}
+	return r.hedge
+}
+
+// rate returns the throughput of the run at `now`, with the mutex of its tracker held.
+func (r *partRun) rate(now time.Time) float64 {
+	if !r.finished.IsZero() {
+		now = r.finished
+	}
+	elapsed := now.Sub(r.started).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&r.written)) / elapsed
+}
+
+// partRuns finds the stragglers among the parts of a download: once half of them are done, the
+// parts much slower than the median get their remaining range requested again on a fresh connection.
+type partRuns struct {
+	parts int
+
+	mu   sync.Mutex
+	runs map[int64]*partRun
+	log  *TaskLog
+}
+
+// newPartRuns tracks the `parts` of a download, nil when they can not be raced.
+func (d *HTTPDownloader) newPartRuns(parts int) *partRuns {
+	// a single connection has nothing to compare to, low memory keeps the connections down
+	if noHedge || lowMemory || d.par <= 1 || !d.resumable || d.upload != nil || parts < 2 {
+		return nil
+	}
+	return &partRuns{parts: parts, runs: make(map[int64]*partRun), log: d.log}
+}
+
+// start tracks a new request of `part`, the remaining range of which it copies.
+func (t *partRuns) start(part Part) *partRun {
+	if t == nil {
+		return nil
+	}
+	r := &partRun{index: part.Index, size: part.RangeTo - part.RangeFrom, started: time.Now(), hedge: make(chan struct{})}
+	t.mu.Lock()
+	t.runs[part.Index] = r
+	t.mu.Unlock()
+	return r
+}
+
+// finish stops the clock of `r`.
+func (t *partRuns) finish(r *partRun) {
+	if t == nil || r == nil {
+		return
+	}
+	t.mu.Lock()
+	r.finished = time.Now()
+	t.mu.Unlock()
+}
+
+// watch looks for stragglers every stragglerCheck until `stop` is closed.
+func (t *partRuns) watch(stop chan struct{}) {
+	if t == nil {
+		return
+	}
+	ticker := time.NewTicker(stragglerCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			t.check(now)
+		}
+	}
+}
+
+// check closes the hedge channel of the runs which are stragglers at `now`.
+func (t *partRuns) check(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var done int
+	var rates []float64
+	for _, r := range t.runs {
+		if !r.finished.IsZero() {
+			done++
+		}
+		if !r.finished.IsZero() || now.Sub(r.started) >= stragglerGrace {
+			rates = append(rates, r.rate(now))
+		}
+	}
+	if done*2 < t.parts || len(rates) == 0 {
+		return
+	}
+	sort.Float64s(rates)
+	median := rates[len(rates)/2]
+
+	for _, r := range t.runs {
+		if !r.finished.IsZero() || r.straggled || now.Sub(r.started) < stragglerGrace {
+			continue
+		}
+		if r.size-atomic.LoadInt64(&r.written) < stragglerMin {
+			continue
+		}
+		if rate := r.rate(now); rate < median*stragglerRatio {
+			r.straggled = true
+			t.log.Logf("part %d: straggling at %s/s while the median is %s/s, requesting its remaining range again", r.index, humanBytes(int64(rate)), humanBytes(int64(median)))
+			close(r.hedge)
+		}
+	}
+}
+
+// hedgedRange is the remaining range of a straggler downloaded again on its own connection into a
+// temporary file, to be copied into the part if it finishes first.
+type hedgedRange struct {
+	from   int64
+	file   *os.File
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// hedge requests the range of `part` from the offset `from` again from `url`.
+func (d *HTTPDownloader) hedge(url string, part Part, from int64) *hedgedRange {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &hedgedRange{from: from, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(h.done)
+		h.err = h.fetch(ctx, d, url, part)
+	}()
+	return h
+}
+
+func (h *hedgedRange) fetch(ctx context.Context, d *HTTPDownloader, url string, part Part) error {
+	var err error
+	h.file, err = ioutil.TempFile(filepath.Dir(part.Path), filepath.Base(part.Path)+".hedge")
+	if err != nil {
+		return err
+	}
+	req, err := d.newRequest(url)
+	if err != nil {
+		return err
+	}
+	hedged := part
+	hedged.RangeFrom = h.from
+	req.Header.Set("Range", "bytes="+d.rangeOf(hedged))
+	d.setIfRange(req, url)
+
+	resp, err := d.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkRange(resp); err != nil {
+		return err
+	}
+	if url == d.url {
+		if err := d.checkPinned(resp); err != nil {
+			return err
+		}
+		if err := d.checkVersion(resp, part.Index); err != nil {
+			return err
+		}
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("unexpected response %q", resp.Status)
+	}
+	if start, err := rangeStart(resp.Header.Get("Content-Range")); err != nil || start != h.from {
+		return fmt.Errorf("unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+	}
+
+	var reader io.Reader = resp.Body
+	if d.rate != 0 {
+		limited := shapeio.NewReader(reader)
+		limited.SetRateLimit(float64(d.rate))
+		reader = limited
+	}
+	_, err = io.CopyBuffer(h.file, reader, copyBuffer())
+	return err
+}
+
+// Done is closed when the hedged range is downloaded or failed. It never fires on a nil range.
+func (h *hedgedRange) Done() <-chan struct{} {
+	if h == nil {
+		return nil
+	}
+	return h.done
+}
+
+// copyTo writes what the hedged range has from the offset `offset` of the file on into `w`.
+func (h *hedgedRange) copyTo(w io.Writer, offset int64) (int64, error) {
+	if _, err := h.file.Seek(offset-h.from, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.CopyBuffer(w, h.file, copyBuffer())
+}
+
+// Close stops the hedged range and removes its temporary file, nil ranges included.
+func (h *hedgedRange) Close() {
+	if h == nil {
+		return
+	}
+	h.cancel()
+	<-h.done
+	if h.file != nil {
+		h.file.Close()
+		os.Remove(h.file.Name())
+	}
+}
@@ -0,0 +1,143 @@
+package hget
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStragglerCheck(t *testing.T) {
+	defer func(grace time.Duration, min int64) { stragglerGrace, stragglerMin = grace, min }(stragglerGrace, stragglerMin)
+	stragglerGrace, stragglerMin = time.Second, 10
+
+	runs := (&HTTPDownloader{par: 3, resumable: true}).newPartRuns(3)
+	now := time.Now()
+	add := func(index int64, written int64, finished bool) *partRun {
+		r := runs.start(Part{Index: index, RangeTo: 1000})
+		r.started, r.written = now.Add(-10*time.Second), written
+		if finished {
+			r.finished = now
+		}
+		return r
+	}
+	fast := add(0, 1000, true)
+	slow := add(1, 50, false)
+	runs.check(now)
+	select {
+	case <-slow.Hedge():
+		t.Fatalf("parts should not be raced before half of them are done")
+	default:
+	}
+
+	add(2, 900, true)
+	runs.check(now)
+	select {
+	case <-slow.Hedge():
+	default:
+		t.Fatalf("part 1 should be raced, it is 18 times slower than the others")
+	}
+	select {
+	case <-fast.Hedge():
+		t.Fatalf("a finished part should not be raced")
+	default:
+	}
+}
+
+func TestStragglerHedge(t *testing.T) {
+	defer func(grace, check time.Duration, min int64) {
+		stragglerGrace, stragglerCheck, stragglerMin = grace, check, min
+	}(stragglerGrace, stragglerCheck, stragglerMin)
+	stragglerGrace, stragglerCheck, stragglerMin = 0, 10*time.Millisecond, 10
+
+	content := strings.Repeat("0123456789", 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=0-" {
+			// the first connection stalls after a few bytes
+			w.Header().Set("Content-Range", "bytes 0-999/1000")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte(content[:10]))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	d := &HTTPDownloader{url: srv.URL, par: 2, len: int64(len(content)), resumable: true}
+	d.runs = d.newPartRuns(2)
+	done := d.runs.start(Part{Index: 1, RangeTo: 1000})
+	done.Write(make([]byte, 1000))
+	d.runs.finish(done)
+	stop := make(chan struct{})
+	defer close(stop)
+	go d.runs.watch(stop)
+
+	path := filepath.Join(t.TempDir(), "file.part000000")
+	written, stopped, err := d.fetchPart(d.client(), Part{Path: path, RangeTo: d.len}, make(chan bool))
+	if err != nil || stopped {
+		t.Fatalf("the hedged part should be done, got %v (stopped %v)", err, stopped)
+	}
+	stored, _ := ioutil.ReadFile(path)
+	if written != 1000 || !bytes.Equal(stored, []byte(content)) {
+		t.Fatalf("expected the whole content, got %d bytes written and %q", written, stored)
+	}
+	if leftovers, _ := filepath.Glob(path + ".hedge*"); len(leftovers) > 0 {
+		t.Fatalf("the hedged range should be removed, found %v", leftovers)
+	}
+}
+
+func TestStragglerNotHedgedWithDigest(t *testing.T) {
+	defer func(grace, check time.Duration, min int64) {
+		stragglerGrace, stragglerCheck, stragglerMin = grace, check, min
+	}(stragglerGrace, stragglerCheck, stragglerMin)
+	stragglerGrace, stragglerCheck, stragglerMin = 0, 10*time.Millisecond, 10
+
+	content := strings.Repeat("0123456789", 100)
+	sum := sha256.Sum256([]byte(content))
+	var hedged int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=0-" {
+			// slow, but its digest can be checked
+			w.Header().Set("Content-Range", "bytes 0-999/1000")
+			w.Header().Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte(content[:10]))
+			w.(http.Flusher).Flush()
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(content[10:]))
+			return
+		}
+		// a second request would get damaged bytes nothing could check
+		atomic.AddInt32(&hedged, 1)
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(strings.Repeat("X", len(content))))
+	}))
+	defer srv.Close()
+
+	d := &HTTPDownloader{url: srv.URL, par: 2, len: int64(len(content)), resumable: true}
+	d.runs = d.newPartRuns(2)
+	done := d.runs.start(Part{Index: 1, RangeTo: 1000})
+	done.Write(make([]byte, 1000))
+	d.runs.finish(done)
+	stop := make(chan struct{})
+	defer close(stop)
+	go d.runs.watch(stop)
+
+	path := filepath.Join(t.TempDir(), "file.part000000")
+	written, _, err := d.fetchPart(d.client(), Part{Path: path, RangeTo: d.len}, make(chan bool))
+	stored, _ := ioutil.ReadFile(path)
+	if err != nil || written != 1000 || !bytes.Equal(stored, []byte(content)) {
+		t.Fatalf("expected the verified content, got %v after %d bytes", err, written)
+	}
+	if n := atomic.LoadInt32(&hedged); n != 0 {
+		t.Fatalf("a response with a digest should not be hedged, got %d requests", n)
+	}
+}
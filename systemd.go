@@ -0,0 +1,69 @@
+package hget
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor systemd passes sockets on
+const listenFDsStart = 3
+
+// listen returns the socket systemd passed to hget when it was started by socket activation, and
+// listens on `addr` otherwise.
+func listen(addr string) (net.Listener, error) {
+	if listener, err := activatedListener(); listener != nil || err != nil {
+		return listener, err
+	}
+	return net.Listen("tcp", addr)
+}
+
+// activatedListener returns the first socket passed by systemd, nil when there is none. The variables
+// are cleared so that the processes hget starts, such as hooks, do not take the socket for theirs.
+func activatedListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+	if fds > 1 {
+		Warnf("systemd passed %d sockets, only the first one is used\n", fds)
+	}
+	f := os.NewFile(listenFDsStart, "LISTEN_FD_3")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// sdNotify tells systemd about the state of hget, e.g. READY=1 once it accepts requests, when it runs
+// as a Type=notify service. It does nothing otherwise.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	// abstract sockets start with a null byte
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		Warnf("could not notify systemd: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		Warnf("could not notify systemd: %v\n", err)
+	}
+}
+
+// stateDirectory returns the first folder of StateDirectory= in the unit hget runs in, if any.
+func stateDirectory() string {
+	return strings.Split(os.Getenv("STATE_DIRECTORY"), ":")[0]
+}
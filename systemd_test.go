@@ -0,0 +1,54 @@
+package hget
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestListenWithoutActivation(t *testing.T) {
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+
+	// the sockets of another process are not ours
+	listener, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	defer listener.Close()
+	if _, ok := listener.Addr().(*net.TCPAddr); !ok {
+		t.Fatalf("expected a tcp listener, got %v", listener.Addr())
+	}
+}
+
+func TestSdNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("no unix datagram sockets: %v", err)
+	}
+	defer conn.Close()
+	os.Setenv("NOTIFY_SOCKET", path)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	sdNotify("READY=1")
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1" {
+		t.Fatalf("expected READY=1, got %q (%v)", buf[:n], err)
+	}
+}
+
+func TestStateDirectory(t *testing.T) {
+	defer func(path string) { dataPath = path }(dataPath)
+	dataPath = ""
+	os.Setenv("STATE_DIRECTORY", "/var/lib/hget/tasks:/var/lib/hget/downloads")
+	defer os.Unsetenv("STATE_DIRECTORY")
+	if dir := dataDir(); dir != "/var/lib/hget/tasks" {
+		t.Fatalf("tasks should be kept in the first state directory, got %s", dir)
+	}
+}
@@ -0,0 +1,149 @@
+package hget
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var taskLogName = "task.log"
+
+// taskLogMaxSize is the size after which the log is rotated, only the previous log is kept.
+var taskLogMaxSize int64 = 1 << 20
+
+// TaskLog records the requests, retries and state changes of a task in its folder, across resumes,
+// so that `hget tasks show NAME --log` can tell why a task keeps failing.
+type TaskLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+}
+
+// OpenTaskLog appends to the log of the task in `folder`.
+func OpenTaskLog(folder string) (*TaskLog, error) {
+	if err := MkdirIfNotExist(folder); err != nil {
+		return nil, err
+	}
+	l := &TaskLog{path: filepath.Join(folder, taskLogName)}
+	return l, l.open()
+}
+
+func (l *TaskLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.size = f, stat.Size()
+	return nil
+}
+
+// rotate moves the full log aside and starts a new one.
+func (l *TaskLog) rotate() error {
+	l.file.Close()
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// Logf adds a line to the log. It does nothing on a nil log, a task log which can not be written
+// must not stop the download it describes.
+func (l *TaskLog) Logf(format string, args ...interface{}) {
+	if l == nil {
+		return
+	}
+	line := time.Now().Format(time.RFC3339) + " " + fmt.Sprintf(format, args...) + "\n"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	if l.size+int64(len(line)) > taskLogMaxSize {
+		if err := l.rotate(); err != nil {
+			Warnf("could not rotate task log: %v\n", err)
+			l.file = nil
+			return
+		}
+	}
+	n, err := l.file.WriteString(line)
+	l.size += int64(n)
+	if err != nil {
+		Warnf("could not write task log: %v\n", err)
+	}
+}
+
+// Close closes the log, it is fine to close it more than once.
+func (l *TaskLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// TaskShow prints what is known about `task`, and its log when `withLog` is set.
+func TaskShow(task string, withLog bool, w io.Writer) error {
+	folder := taskFolder(task)
+	if !ExistDir(folder) {
+		return fmt.Errorf("%s is not a task", task)
+	}
+
+	if s, err := Read(task); err != nil {
+		fmt.Fprintf(w, "state: %v\n", err)
+	} else {
+		var total int64
+		if len(s.Parts) > 0 {
+			// the last part ends at the length of the file
+			total = s.Parts[len(s.Parts)-1].RangeTo
+		}
+		fmt.Fprintf(w, "url:       %s\n", s.URL)
+		fmt.Fprintf(w, "parts:     %d\n", len(s.Parts))
+		fmt.Fprintf(w, "remaining: %s of %s\n", humanBytes(s.Remaining()), humanBytes(total))
+		for _, mirror := range s.Mirrors {
+			fmt.Fprintf(w, "mirror:    %s\n", mirror)
+		}
+		if env := s.Environment; env != nil {
+			fmt.Fprintf(w, "hget:      %s on %s\n", env.Version, env.Platform)
+			fmt.Fprintf(w, "final url: %s\n", env.FinalURL)
+			for _, arg := range env.Args {
+				fmt.Fprintf(w, "option:    %s\n", arg)
+			}
+		}
+	}
+
+	if !withLog {
+		return nil
+	}
+	path := filepath.Join(folder, taskLogName)
+	for _, file := range []string{path + ".1", path} {
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
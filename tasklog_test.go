@@ -0,0 +1,75 @@
+package hget
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTaskLog(t *testing.T) {
+	displayProgress = false
+	dir, err := ioutil.TempDir("", "hget-tasklog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(old string) { dataPath = old }(dataPath)
+	dataPath = dir
+	defer func(old int64) { taskLogMaxSize = old }(taskLogMaxSize)
+	taskLogMaxSize = 200
+
+	url := "http://foo.bar/logged.bin"
+	folder := FolderOf(url)
+	l, err := OpenTaskLog(folder)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		l.Logf("part %d: done after %d bytes", i, i)
+	}
+	l.Close()
+	l.Close()
+	// a nil log is silently ignored
+	var nolog *TaskLog
+	nolog.Logf("ignored")
+
+	for _, name := range []string{taskLogName, taskLogName + ".1"} {
+		stat, err := os.Stat(filepath.Join(folder, name))
+		if err != nil {
+			t.Fatalf("%s should exist, got %v", name, err)
+		}
+		if stat.Size() > taskLogMaxSize {
+			t.Fatalf("%s should have been rotated, it has %d bytes", name, stat.Size())
+		}
+	}
+
+	s := &State{URL: url, Parts: []Part{{Index: 0, URL: url, Path: filepath.Join(folder, "logged.bin.part000000"), RangeFrom: 4, RangeTo: 8}}}
+	ioutil.WriteFile(s.Parts[0].Path, []byte("half"), 0600)
+	if err := s.write(folder); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := TaskShow("logged.bin", false, &out); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if !strings.Contains(out.String(), url) || strings.Contains(out.String(), "part 9") {
+		t.Fatalf("unexpected task without log %q", out.String())
+	}
+
+	out.Reset()
+	if err := TaskShow("logged.bin", true, &out); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	shown := out.String()
+	if !strings.HasSuffix(shown, "part 9: done after 9 bytes\n") || strings.Index(shown, "part 8") > strings.Index(shown, "part 9") {
+		t.Fatalf("log should be shown oldest first, got %q", shown)
+	}
+
+	if err := TaskShow("missing.bin", true, &out); err == nil {
+		t.Fatalf("showing a missing task should fail")
+	}
+}
@@ -0,0 +1,49 @@
+package hget
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// responseError is a response a part could not be downloaded from.
+type responseError struct {
+	status string
+	code   int
+	index  int64
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("unexpected response %q for part %d", e.status, e.index)
+}
+
+// isTemporary tells whether a download failed with `err` for a reason likely to go away, a network
+// outage, a timeout or an overloaded server, rather than for good.
+func isTemporary(err error) bool {
+	var response *responseError
+	if errors.As(err, &response) {
+		return response.code == http.StatusRequestTimeout || response.code == http.StatusTooManyRequests || response.code >= 500
+	}
+	var dns *net.DNSError
+	if errors.As(err, &dns) {
+		return dns.IsTimeout || dns.IsTemporary
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	for _, cause := range []error{syscall.ECONNABORTED, syscall.ENETUNREACH, syscall.EHOSTUNREACH, syscall.EPIPE, io.ErrUnexpectedEOF, errStalled} {
+		if errors.Is(err, cause) {
+			return true
+		}
+	}
+	return isRefused(err)
+}
+
+// resumeCommand returns the command continuing the task of `url`, as it is typed in a shell.
+func resumeCommand(url string) string {
+	return "hget resume " + shellQuote(TaskFromURL(url))
+}
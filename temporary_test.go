@@ -0,0 +1,87 @@
+package hget
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsTemporary(t *testing.T) {
+	for _, c := range []struct {
+		err       error
+		temporary bool
+	}{
+		{&responseError{status: "502 Bad Gateway", code: 502}, true},
+		{fmt.Errorf("part 1: %w", &responseError{status: "429 Too Many Requests", code: 429}), true},
+		{&responseError{status: "404 Not Found", code: 404}, false},
+		{&responseError{status: "200 OK", code: 200}, false},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{&net.DNSError{Err: "timeout", IsTimeout: true}, true},
+		{&net.DNSError{Err: "no such host", IsNotFound: true}, false},
+		{io.ErrUnexpectedEOF, true},
+		{causedBy(errStalled, "no data received for 1s"), true},
+		{fmt.Errorf("%w for foo", ErrChecksumMismatch), false},
+		{errors.New("dial tcp: connection refused"), false},
+	} {
+		if isTemporary(c.err) != c.temporary {
+			t.Fatalf("%v should be temporary: %v", c.err, c.temporary)
+		}
+	}
+	if command := resumeCommand("http://foo.bar/my file.iso"); command != "hget resume 'my file.iso'" {
+		t.Fatalf("resumed with %s", command)
+	}
+}
+
+func TestTemporaryFailureSaved(t *testing.T) {
+	displayProgress = false
+	defer func(data string, conn int) { dataPath, output, connections = data, "", conn }(dataPath, connections)
+	dataPath = t.TempDir()
+	connections = 2
+	content := strings.Repeat("0123456789", 1000)
+	var failing int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the second half is behind an overloaded gateway
+		if atomic.LoadInt32(&failing) == 1 && strings.HasPrefix(r.Header.Get("Range"), "bytes=5000-") {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		http.ServeContent(w, r, "flaky.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	output = filepath.Join(t.TempDir(), "flaky.bin")
+
+	url := server.URL + "/flaky.bin"
+	err := Download(url)
+	if !errors.Is(err, ErrTemporary) || codeOf(err) != codeTemporary {
+		t.Fatalf("the download should fail for now, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "hget resume flaky.bin") {
+		t.Fatalf("the failure should tell how to resume, got %v", err)
+	}
+	s, err := Read(TaskFromURL(url))
+	if err != nil {
+		t.Fatalf("the state should be saved, got %v", err)
+	}
+	if s.Remaining() != 5000 {
+		t.Fatalf("%d bytes should be left, got %d", 5000, s.Remaining())
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	if err := Download(url); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(output); string(got) != content {
+		t.Fatalf("unexpected content %q", got)
+	}
+}
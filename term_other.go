@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package hget
+
+import (
+	"os"
+	"strconv"
+)
+
+// terminalSize returns the columns and rows of the terminal, as far as the environment tells.
+func terminalSize() (int, int) {
+	cols, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || cols <= 0 {
+		cols = 80
+	}
+	rows, err := strconv.Atoi(os.Getenv("LINES"))
+	if err != nil || rows <= 0 {
+		rows = 24
+	}
+	return cols, rows
+}
@@ -0,0 +1,108 @@
+package hget
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// timeouts of every phase of a request, none when zero
+var (
+	dnsTimeout     time.Duration
+	connectTimeout time.Duration
+	tlsTimeout     time.Duration
+	headerTimeout  time.Duration
+	idleTimeout    time.Duration
+)
+
+// errStalled is the cause of a response ended after no byte came in for -idle-timeout
+var errStalled = errors.New("stalled")
+
+// newDialer returns a dialer giving up on a connection after -connect-timeout.
+func newDialer() *net.Dialer {
+	return &net.Dialer{Timeout: connectTimeout}
+}
+
+// lookupIP resolves `host`, giving up after -dns-timeout.
+func lookupIP(host string) ([]net.IP, error) {
+	ctx := context.Background()
+	if dnsTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dnsTimeout)
+		defer cancel()
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, nil
+}
+
+// applyTimeouts sets the timeouts of the handshake and of the response headers on `t`.
+func applyTimeouts(t *http.Transport) {
+	t.TLSHandshakeTimeout = tlsTimeout
+	t.ResponseHeaderTimeout = headerTimeout
+}
+
+// idleTransport ends responses whose body did not get a byte for `timeout`, the connection of a part
+// stalled that way fails and is retried rather than hanging.
+type idleTransport struct {
+	timeout time.Duration
+	next    http.RoundTripper
+}
+
+func (t idleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || t.timeout <= 0 {
+		return resp, err
+	}
+	resp.Body = newIdleBody(resp.Body, t.timeout)
+	return resp, nil
+}
+
+// idleBody closes its body once no read returned a byte for `timeout`.
+type idleBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+
+	mu      sync.Mutex
+	expired bool
+}
+
+func newIdleBody(body io.ReadCloser, timeout time.Duration) *idleBody {
+	b := &idleBody{ReadCloser: body, timeout: timeout}
+	b.timer = time.AfterFunc(timeout, func() {
+		b.mu.Lock()
+		b.expired = true
+		b.mu.Unlock()
+		body.Close()
+	})
+	return b
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.expired {
+		return n, causedBy(errStalled, "no data received for %v", b.timeout)
+	}
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,53 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeouts(t *testing.T) {
+	defer func() { headerTimeout, idleTimeout = 0, 0 }()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-start" {
+			<-release
+		}
+		w.Write([]byte("first bytes"))
+		w.(http.Flusher).Flush()
+		if r.URL.Path == "/stalled" {
+			<-release
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	headerTimeout = 20 * time.Millisecond
+	if _, err := (&HTTPDownloader{}).client().Get(server.URL + "/slow-start"); err == nil || !strings.Contains(err.Error(), "timeout awaiting response headers") {
+		t.Fatalf("expected the headers to time out, got %v", err)
+	}
+	headerTimeout = 0
+
+	idleTimeout = 20 * time.Millisecond
+	resp, err := (&HTTPDownloader{}).client().Get(server.URL + "/stalled")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	defer resp.Body.Close()
+	got, err := ioutil.ReadAll(resp.Body)
+	if string(got) != "first bytes" || err == nil || !strings.Contains(err.Error(), "no data received for 20ms") {
+		t.Fatalf("expected the body to stall after its first bytes, got %q, %v", got, err)
+	}
+
+	resp, err = (&HTTPDownloader{}).client().Get(server.URL + "/complete")
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, err = ioutil.ReadAll(resp.Body); string(got) != "first bytes" || err != nil {
+		t.Fatalf("a body sent in time should be read whole, got %q, %v", got, err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,121 @@
+package hget
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+var terminalTitle = false
+
+// TitleSink shows the overall percentage in the terminal title, and as an OSC 9;4 progress
+// sequence which Windows Terminal and ConEmu render in the taskbar, so the download is
+// visible while its window is in the background.
+type TitleSink struct {
+	mu      sync.Mutex
+	out     io.Writer
+	file    string
+	total   int64
+	written int64
+	percent int
+}
+
+// NewTitleSink reports the progress of `file` to the terminal behind `out`.
+func NewTitleSink(out io.Writer, file string) *TitleSink {
+	return &TitleSink{out: out, file: file, percent: -1}
+}
+
+func (s *TitleSink) show(title string, percent int) {
+	fmt.Fprintf(s.out, "\x1b]0;%s\x07\x1b]9;4;1;%d\x07", title, percent)
+}
+
+// OnPartStart implements ProgressSink
+func (s *TitleSink) OnPartStart(index int64, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total += size
+}
+
+// OnBytes implements ProgressSink
+func (s *TitleSink) OnBytes(index int64, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written += n
+	if s.total <= 0 {
+		return
+	}
+	percent := int(s.written * 100 / s.total)
+	if percent > 100 {
+		percent = 100
+	}
+	// only talk to the terminal when there is something new to show
+	if percent != s.percent {
+		s.percent = percent
+		s.show(fmt.Sprintf("%d%% %s", percent, s.file), percent)
+	}
+}
+
+// OnPartDone implements ProgressSink
+func (s *TitleSink) OnPartDone(index int64) {}
+
+// OnConnection implements ProgressSink
+func (s *TitleSink) OnConnection(index int64, info ConnectionInfo) {}
+
+// OnJoin implements ProgressSink
+func (s *TitleSink) OnJoin(done int, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.show(fmt.Sprintf("joining %s", s.file), done*100/total)
+}
+
+// OnComplete implements ProgressSink
+func (s *TitleSink) OnComplete(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, "\x1b]0;done %s\x07\x1b]9;4;0;0\x07", path)
+}
+
+// MultiSink passes the progress on to every one of its sinks.
+type MultiSink []ProgressSink
+
+// OnPartStart implements ProgressSink
+func (m MultiSink) OnPartStart(index int64, size int64) {
+	for _, s := range m {
+		s.OnPartStart(index, size)
+	}
+}
+
+// OnConnection implements ProgressSink
+func (m MultiSink) OnConnection(index int64, info ConnectionInfo) {
+	for _, s := range m {
+		s.OnConnection(index, info)
+	}
+}
+
+// OnBytes implements ProgressSink
+func (m MultiSink) OnBytes(index int64, n int64) {
+	for _, s := range m {
+		s.OnBytes(index, n)
+	}
+}
+
+// OnPartDone implements ProgressSink
+func (m MultiSink) OnPartDone(index int64) {
+	for _, s := range m {
+		s.OnPartDone(index)
+	}
+}
+
+// OnJoin implements ProgressSink
+func (m MultiSink) OnJoin(done int, total int) {
+	for _, s := range m {
+		s.OnJoin(done, total)
+	}
+}
+
+// OnComplete implements ProgressSink
+func (m MultiSink) OnComplete(path string) {
+	for _, s := range m {
+		s.OnComplete(path)
+	}
+}
@@ -0,0 +1,28 @@
+package hget
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTitleSink(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewTitleSink(&out, "file")
+	sink.OnPartStart(0, 100)
+	sink.OnPartStart(1, 100)
+	sink.OnBytes(0, 50)
+	sink.OnBytes(1, 1)
+
+	if !strings.Contains(out.String(), "\x1b]0;25% file\x07\x1b]9;4;1;25\x07") {
+		t.Fatalf("title should show 25%%, got %q", out.String())
+	}
+	if strings.Count(out.String(), "\x1b]0;") != 1 {
+		t.Fatalf("title should only be updated when the percentage changes, got %q", out.String())
+	}
+
+	sink.OnComplete("file")
+	if !strings.HasSuffix(out.String(), "\x1b]9;4;0;0\x07") {
+		t.Fatalf("taskbar progress should be cleared when done, got %q", out.String())
+	}
+}
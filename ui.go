@@ -1,9 +1,10 @@
-package main
+package hget
 
 import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/fatih/color"
 	"github.com/mattn/go-colorable"
@@ -16,6 +17,25 @@ var (
 	Default UI = Console{Stdout: Stdout, Stderr: Stderr}
 )
 
+// consoleMu guards Default and color.NoColor, which a download detaching from its terminal
+// replaces while other goroutines are logging.
+var consoleMu sync.RWMutex
+
+// console returns the UI the logs currently go to.
+func console() UI {
+	consoleMu.RLock()
+	defer consoleMu.RUnlock()
+	return Default
+}
+
+// setConsole sends the logs to `ui` from now on, without colors if `noColor`.
+func setConsole(ui UI, noColor bool) {
+	consoleMu.Lock()
+	defer consoleMu.Unlock()
+	Default = ui
+	color.NoColor = color.NoColor || noColor
+}
+
 // UI represents a simple IO output.
 type UI interface {
 	Printf(format string, a ...interface{}) (n int, err error)
@@ -26,22 +46,33 @@ type UI interface {
 
 // Printf outputs information level logs
 func Printf(format string, a ...interface{}) (n int, err error) {
-	return Default.Printf(color.CyanString("INFO: ")+format, a...)
+	consoleMu.RLock()
+	defer consoleMu.RUnlock()
+	return Default.Printf(color.CyanString("INFO: ")+translate(format), a...)
 }
 
 // Errorf outputs error level logs
 func Errorf(format string, a ...interface{}) (n int, err error) {
-	return Default.Errorf(color.RedString("ERROR: ")+format, a...)
+	consoleMu.RLock()
+	defer consoleMu.RUnlock()
+	return Default.Errorf(color.RedString("ERROR: ")+translate(format), a...)
 }
 
 // Warnf outputs warning level logs
 func Warnf(format string, a ...interface{}) (n int, err error) {
-	return Default.Errorf(color.YellowString("WARN: ")+format, a...)
+	consoleMu.RLock()
+	defer consoleMu.RUnlock()
+	return Default.Errorf(color.YellowString("WARN: ")+translate(format), a...)
 }
 
 // Errorln is non formatted error printer.
 func Errorln(a ...interface{}) (n int, err error) {
-	return Default.Errorln(a...)
+	if len(a) == 1 {
+		if message, ok := a[0].(string); ok {
+			a = []interface{}{translate(message)}
+		}
+	}
+	return console().Errorln(a...)
 }
 
 // IsTerminal checks if we have tty
@@ -0,0 +1,61 @@
+package hget
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var userAgentName = ""
+var userAgentRandom = false
+
+// userAgents are the presets of -ua, anything else given is sent as it is
+var userAgents = map[string]string{
+	"curl":    "curl/8.5.0",
+	"wget":    "Wget/1.21.4",
+	"firefox": "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0",
+	"chrome":  "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+	"safari":  "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15",
+}
+
+// browserAgents are the presets -ua-random picks from
+var browserAgents = []string{"firefox", "chrome", "safari"}
+
+// presetNames lists the presets of -ua for the help.
+func presetNames() string {
+	names := make([]string, 0, len(userAgents))
+	for name := range userAgents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+// chooseUserAgent returns the User-Agent of a new download, empty to keep the one of Go.
+func chooseUserAgent() string {
+	if userAgentRandom {
+		pick := rand.New(rand.NewSource(time.Now().UnixNano())).Intn(len(browserAgents))
+		return userAgents[browserAgents[pick]]
+	}
+	if agent, ok := userAgents[strings.ToLower(userAgentName)]; ok {
+		return agent
+	}
+	return userAgentName
+}
+
+// userAgentTransport sends every request of a download with the same User-Agent, unless it
+// already has one, e.g. from -header or a preflight.
+type userAgentTransport struct {
+	agent string
+	next  http.RoundTripper
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.agent)
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,43 @@
+package hget
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUserAgent(t *testing.T) {
+	defer func() { userAgentName, userAgentRandom = "", false }()
+
+	var agents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("User-Agent"))
+	}))
+	defer srv.Close()
+
+	userAgentName = "curl"
+	d := &HTTPDownloader{url: srv.URL, userAgent: chooseUserAgent()}
+	req, _ := d.newRequest(srv.URL)
+	d.client().Do(req)
+	// -header wins over the preset
+	req, _ = d.newRequest(srv.URL)
+	req.Header.Set("User-Agent", "custom/1.0")
+	d.client().Do(req)
+	if len(agents) != 2 || agents[0] != userAgents["curl"] || agents[1] != "custom/1.0" {
+		t.Fatalf("unexpected user agents %v", agents)
+	}
+
+	userAgentName = "my-bot/2.0"
+	if got := chooseUserAgent(); got != "my-bot/2.0" {
+		t.Fatalf("unknown presets should be sent as given, got %q", got)
+	}
+
+	userAgentRandom = true
+	got := chooseUserAgent()
+	for _, name := range browserAgents {
+		if userAgents[name] == got {
+			return
+		}
+	}
+	t.Fatalf("random user agent should be one of a browser, got %q", got)
+}
@@ -0,0 +1,131 @@
+package hget
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var daemonUsers = ""
+
+// usersFolder holds the tasks of every user of hget daemon, in a folder of their own
+var usersFolder = ".users"
+
+var userName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// readUsers reads the users of hget daemon from `path`, one `name token` per line, and returns them by token.
+func readUsers(path string) (map[string]string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 || !userName.MatchString(fields[0]) {
+			return nil, fmt.Errorf("%s:%d: expected a user name and its token", path, line)
+		}
+		if _, ok := users[fields[1]]; ok {
+			return nil, fmt.Errorf("%s:%d: the token of %s is already used", path, line, fields[0])
+		}
+		users[fields[1]] = fields[0]
+	}
+	return users, scanner.Err()
+}
+
+// userOf returns the user `token` belongs to, empty for the token of the daemon itself.
+func (d *Daemon) userOf(token string) (string, bool) {
+	if d.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) == 1 {
+		return "", true
+	}
+	for known, user := range d.users {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+			return user, true
+		}
+	}
+	return "", false
+}
+
+// tasksOf returns the folder the tasks of `user` are kept in, the data folder for the daemon itself.
+func (d *Daemon) tasksOf(user string) string {
+	if user == "" {
+		return d.root
+	}
+	return filepath.Join(d.root, usersFolder, user)
+}
+
+// namespace keeps the tasks and the downloads of the user of `req` in folders of their own, until the
+// returned func restores the shared ones.
+func (d *Daemon) namespace(req *DownloadRequest) (func(), error) {
+	if req.User == "" {
+		return func() {}, nil
+	}
+	tasks, dest := d.tasksOf(req.User), watchDest
+	for _, folder := range []string{tasks, req.User} {
+		if err := os.MkdirAll(folder, 0700); err != nil {
+			return nil, err
+		}
+	}
+	if dest != "" {
+		if err := os.MkdirAll(filepath.Join(dest, req.User), 0700); err != nil {
+			return nil, err
+		}
+		watchDest = filepath.Join(dest, req.User)
+	}
+	name := req.Output
+	if name == "" {
+		name = filepath.Base(req.URL)
+	}
+	req.Output = filepath.Join(req.User, name)
+	data := dataPath
+	dataPath = tasks
+	return func() { dataPath, watchDest = data, dest }, nil
+}
+
+// listTasks returns the names of the tasks of `user`.
+func (d *Daemon) listTasks(user string) ([]string, error) {
+	infos, err := ioutil.ReadDir(d.tasksOf(user))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tasks := []string{}
+	for _, info := range infos {
+		if info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+			tasks = append(tasks, info.Name())
+		}
+	}
+	return tasks, nil
+}
+
+// cancelTask stops and removes the task `name` of `user`, and drops its queued downloads.
+func (d *Daemon) cancelTask(user string, name string) (bool, error) {
+	d.mu.Lock()
+	queued := d.waiting[user+"/"+name] > 0
+	if queued {
+		d.skip[user+"/"+name] = true
+	}
+	d.mu.Unlock()
+
+	folder := filepath.Join(d.tasksOf(user), filepath.Base(name))
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") || !ExistDir(folder) {
+		return queued, nil
+	}
+	if TaskLocked(folder) {
+		return true, sendControl(folder, "cancel")
+	}
+	return true, os.RemoveAll(folder)
+}
@@ -0,0 +1,78 @@
+package hget
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadUsers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	ioutil.WriteFile(path, []byte("# name token\nalice a-secret\n\nbob b-secret\n"), 0600)
+	users, err := readUsers(path)
+	if err != nil || !reflect.DeepEqual(users, map[string]string{"a-secret": "alice", "b-secret": "bob"}) {
+		t.Fatalf("unexpected users %v, %v", users, err)
+	}
+	for _, content := range []string{"alice\n", "../alice secret\n", "alice secret\nbob secret\n"} {
+		ioutil.WriteFile(path, []byte(content), 0600)
+		if _, err := readUsers(path); err == nil {
+			t.Fatalf("%q should be refused", content)
+		}
+	}
+}
+
+func TestDaemonUsers(t *testing.T) {
+	defer func(users, data string) { daemonUsers, dataPath = users, data }(daemonUsers, dataPath)
+	dataPath = t.TempDir()
+	daemonUsers = filepath.Join(dataPath, "users")
+	ioutil.WriteFile(daemonUsers, []byte("alice a-secret\nbob b-secret\n"), 0600)
+	d, err := NewDaemon("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method string, path string, token string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := do(http.MethodPost, "/downloads", "a-secret", `{"url": "http://a.org/1.iso"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("alice should be able to queue a download, got %d", rec.Code)
+	}
+	var status DaemonStatus
+	json.NewDecoder(do(http.MethodGet, "/downloads", "b-secret", "").Body).Decode(&status)
+	if status.Queued != 0 {
+		t.Fatalf("bob should not see the downloads of alice, got %+v", status)
+	}
+	if rec := do(http.MethodDelete, "/tasks/1.iso", "b-secret", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("bob should not cancel the download of alice, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/tasks/1.iso", "a-secret", ""); rec.Code != http.StatusOK {
+		t.Fatalf("alice should cancel her queued download, got %d", rec.Code)
+	}
+	if req := <-d.queue; req.User != "alice" || !d.dequeue(req) {
+		t.Fatalf("the cancelled download of alice should be skipped, got %+v", req)
+	}
+
+	os.MkdirAll(filepath.Join(d.tasksOf("alice"), "2.iso"), 0700)
+	var tasks []string
+	json.NewDecoder(do(http.MethodGet, "/tasks", "a-secret", "").Body).Decode(&tasks)
+	if !reflect.DeepEqual(tasks, []string{"2.iso"}) {
+		t.Fatalf("alice should see her task, got %v", tasks)
+	}
+	json.NewDecoder(do(http.MethodGet, "/tasks", "b-secret", "").Body).Decode(&tasks)
+	if len(tasks) != 0 {
+		t.Fatalf("bob should not see the tasks of alice, got %v", tasks)
+	}
+	if rec := do(http.MethodDelete, "/tasks/2.iso", "a-secret", ""); rec.Code != http.StatusOK || ExistDir(filepath.Join(d.tasksOf("alice"), "2.iso")) {
+		t.Fatalf("alice should remove her task, got %d", rec.Code)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package hget
 
 import (
 	"errors"
@@ -10,14 +10,27 @@ import (
 	"strings"
 )
 
-// FatalCheck panics if err is not nil.
+// FatalCheck stops what is running with `err` if it is not nil: Download returns it and the command
+// line ends with it.
 func FatalCheck(err error) {
 	if err != nil {
-		Errorf("%v", err)
-		panic(err)
+		panic(fatalError{err})
 	}
 }
 
+// fatalError is what FatalCheck panics with, telling a failure apart from a bug.
+type fatalError struct {
+	err error
+}
+
+func (f fatalError) Error() string {
+	return f.err.Error()
+}
+
+func (f fatalError) Unwrap() error {
+	return f.err
+}
+
 // FilterIPV4 returns parsed ipv4 string.
 func FilterIPV4(ips []net.IP) []string {
 	var ret = make([]string, 0)
@@ -50,10 +63,15 @@ func DisplayProgressBar() bool {
 	return isatty.IsTerminal(os.Stdout.Fd()) && displayProgress
 }
 
-// FolderOf makes sure you won't get LFI
+// FolderOf returns the folder of the task downloading `url`
 func FolderOf(url string) string {
-	safePath := filepath.Join(os.Getenv("HOME"), dataFolder)
-	fullQualifyPath, err := filepath.Abs(filepath.Join(os.Getenv("HOME"), dataFolder, filepath.Base(url)))
+	return taskFolder(TaskFromURL(url))
+}
+
+// taskFolder returns the folder of `task` in the data folder, it makes sure you won't get LFI
+func taskFolder(task string) string {
+	safePath := dataDir()
+	fullQualifyPath, err := filepath.Abs(filepath.Join(safePath, filepath.Base(task)))
 	FatalCheck(err)
 
 	//must ensure full qualify path is CHILD of safe path
@@ -73,10 +91,16 @@ func FolderOf(url string) string {
 
 // TaskFromURL runs when you want to download a single url
 func TaskFromURL(url string) string {
-	//task is just download file name
-	//so we get download file name on url
-	filename := filepath.Base(url)
-	return filename
+	return taskOf(url, output)
+}
+
+// taskOf returns the name of the task downloading `url` into `out`, which is the name of the output
+// file when one is given, other than a device, and the file name on the url otherwise.
+func taskOf(url string, out string) string {
+	if out != "" && !IsDevice(out) {
+		return filepath.Base(out)
+	}
+	return filepath.Base(url)
 }
 
 // IsURL checks if `s` is actually a parsable URL.
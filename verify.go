@@ -0,0 +1,39 @@
+package hget
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// checksum is the expected digest of the downloaded file, as algo:hex
+var checksum = ""
+
+// hashes are the algorithms a checksum can be given in
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// VerifyFile checks the content of `path` against `expected`, given as algo:hex, e.g. sha256:hex.
+func VerifyFile(path string, expected string) error {
+	fields := strings.SplitN(expected, ":", 2)
+	if _, ok := hashes[strings.ToLower(fields[0])]; len(fields) != 2 || !ok {
+		return fmt.Errorf("unsupported checksum %q", expected)
+	}
+
+	got, err := digestOf(path, strings.ToLower(fields[0]))
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, fields[1]) {
+		return fmt.Errorf("%w for %s: expected %s, got %s:%s", ErrChecksumMismatch, path, expected, fields[0], got)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package hget
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	ioutil.WriteFile(path, []byte("hget"), 0600)
+
+	for algo, newHash := range hashes {
+		h := newHash()
+		h.Write([]byte("hget"))
+		if err := VerifyFile(path, algo+":"+hex.EncodeToString(h.Sum(nil))); err != nil {
+			t.Fatalf("%s should match, got %v", algo, err)
+		}
+	}
+	if err := VerifyFile(path, "sha256:00"); err == nil {
+		t.Fatalf("wrong digest should fail")
+	}
+	if err := VerifyFile(path, "crc32:00"); err == nil {
+		t.Fatalf("unknown algorithm should fail")
+	}
+}
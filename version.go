@@ -0,0 +1,75 @@
+package hget
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// errVersionMismatch is returned when a part comes from another version of the file than the others.
+var errVersionMismatch = errors.New("parts come from different versions of the file")
+
+// fileVersion is the version of the file the parts of a download have to come from, the ETag, weak ones
+// included, or else the Last-Modified date of the first response which had one.
+type fileVersion struct {
+	mu  sync.Mutex
+	tag string
+	// url is where the version was served from, after the redirects
+	url string
+}
+
+// resumeVersion sets the version of a resumed download from its state.
+func (d *HTTPDownloader) resumeVersion(state *State) {
+	d.version.tag, d.version.url = state.Version, state.URL
+	if len(state.Redirects) > 0 {
+		d.version.url = state.Redirects[len(state.Redirects)-1]
+	}
+}
+
+// resetVersion makes the version of `resp` the one of the download, once a change of the file was accepted.
+func (d *HTTPDownloader) resetVersion(resp *http.Response) {
+	d.version.tag = ""
+	d.checkVersion(resp, -1)
+	if d.pinned != nil && d.pinned.ETag != "" {
+		d.pinned.ETag = resp.Header.Get("ETag")
+	}
+}
+
+// versionOf returns the version `resp` is a part of, empty when it tells nothing about it.
+func versionOf(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// checkVersion records the version of the first response to a request of the url of the task and makes
+// sure the others have the same, the bytes of two versions would be joined into a corrupted file.
+func (d *HTTPDownloader) checkVersion(resp *http.Response, index int64) error {
+	tag := versionOf(resp)
+	if tag == "" {
+		return nil
+	}
+	d.version.mu.Lock()
+	defer d.version.mu.Unlock()
+	if d.version.tag == "" {
+		d.version.tag, d.version.url = tag, resp.Request.URL.String()
+		return nil
+	}
+	if tag != d.version.tag {
+		return fmt.Errorf("%w: part %d is %s from %s, not %s from %s", errVersionMismatch, index, tag, resp.Request.URL, d.version.tag, d.version.url)
+	}
+	return nil
+}
+
+// pinVersion makes the parts which came from another version of the file be retried from where the first
+// response came from. It returns false when they already were, the download can only be aborted then.
+func (d *HTTPDownloader) pinVersion() bool {
+	if d.pinned != nil || d.version.url == "" {
+		return false
+	}
+	// checkVersion keeps checking the retries
+	d.pinned = &PinnedTarget{URL: d.version.url}
+	return true
+}
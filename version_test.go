@@ -0,0 +1,60 @@
+package hget
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVersionMismatch(t *testing.T) {
+	versions := map[string]string{"/a": strings.Repeat("a", 1000), "/b": strings.Repeat("b", 1000)}
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file" {
+			// an A/B CDN sending every other request to another version
+			if atomic.AddInt32(&requests, 1)%2 == 1 {
+				http.Redirect(w, r, "/a", http.StatusFound)
+			} else {
+				http.Redirect(w, r, "/b", http.StatusFound)
+			}
+			return
+		}
+		w.Header().Set("ETag", `"`+r.URL.Path+`"`)
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(versions[r.URL.Path]))
+	}))
+	defer srv.Close()
+
+	d := &HTTPDownloader{url: srv.URL + "/file", par: 2, len: 1000}
+	dir := t.TempDir()
+	first := Part{Index: 0, Path: filepath.Join(dir, "file.part000000"), RangeTo: 499}
+	second := Part{Index: 1, Path: filepath.Join(dir, "file.part000001"), RangeFrom: 500, RangeTo: 1000}
+	if _, _, err := d.fetchPart(d.client(), first, make(chan bool)); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	written, _, err := d.fetchPart(d.client(), second, make(chan bool))
+	if !errors.Is(err, errVersionMismatch) || written != 0 {
+		t.Fatalf("the part of version b should be refused before writing, got %v after %d bytes", err, written)
+	}
+
+	if !d.pinVersion() || d.pinned.URL != srv.URL+"/a" {
+		t.Fatalf("the parts should be pinned to version a, got %+v", d.pinned)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := d.fetchPart(d.client(), second, make(chan bool)); err != nil {
+			t.Fatalf("err should be nil once pinned, got %v", err)
+		}
+		second.Path += "0"
+	}
+	if stored, _ := ioutil.ReadFile(filepath.Join(dir, "file.part000001")); string(stored) != versions["/a"][500:] {
+		t.Fatalf("expected the second half of version a, got %q", stored)
+	}
+	if d.pinVersion() {
+		t.Fatalf("a pinned download can only be aborted")
+	}
+}
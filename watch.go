@@ -0,0 +1,250 @@
+package hget
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var watchDest = ""
+
+// pollInterval is how often watch and feed look for something new, when not their own default
+var pollInterval time.Duration
+
+// watchParsers read the downloads out of the files dropped into a watched folder, by extension
+var watchParsers = map[string]func(raw []byte) ([]DownloadRequest, error){
+	".url":      requestsOf(urlsOfShortcut),
+	".txt":      requestsOf(urlsOfList),
+	".metalink": metalinkRequests,
+	".meta4":    metalinkRequests,
+}
+
+// Watch downloads the urls of every .url, .txt or .metalink file dropped into `dir`, like the download
+// station of a NAS. Handled files are renamed to .done or .failed, finished downloads are moved to watchDest.
+func Watch(dir string) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sig)
+
+	interval := pollInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	Printf("Watching %s for .url, .txt and .metalink files\n", dir)
+	for {
+		stop, err := watchOnce(dir, sig)
+		if err != nil || stop {
+			return err
+		}
+		select {
+		case <-sig:
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// watchOnce handles the files currently in `dir`, it returns true when hget should stop watching.
+func watchOnce(dir string, sig chan os.Signal) (bool, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		parse, ok := watchParsers[strings.ToLower(filepath.Ext(entry.Name()))]
+		if !ok || !entry.Mode().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		requests, err := parse(raw)
+		if err != nil {
+			Errorf("%s: %v\n", path, err)
+			os.Rename(path, path+".failed")
+			continue
+		}
+
+		Printf("Queued %d urls from %s\n", len(requests), path)
+		failed := false
+		for _, req := range requests {
+			interrupted, err := req.download()
+			if interrupted {
+				// the file is picked up again and resumed on the next run
+				return true, nil
+			}
+			if err != nil {
+				Errorf("%s: %v\n", req.URL, err)
+				failed = true
+			}
+		}
+
+		if failed {
+			os.Rename(path, path+".failed")
+		} else {
+			os.Rename(path, path+".done")
+		}
+		select {
+		case <-sig:
+			return true, nil
+		default:
+		}
+	}
+	return false, nil
+}
+
+// downloadQueued downloads `url` and moves it to watchDest, it returns true when the download got interrupted.
+func downloadQueued(url string) (interrupted bool, err error) {
+	started, out := time.Now(), outputOf(url)
+	defer func() { batchReport.Add(url, out, started, interrupted, err) }()
+
+	// an interrupted download is told apart by its task being kept
+	if err := Download(url); err != nil && !errors.Is(err, ErrInterrupted) {
+		return false, err
+	}
+	if ExistDir(FolderOf(url)) {
+		return true, nil
+	}
+	if watchDest != "" && !IsDevice(out) {
+		from := out
+		out = filepath.Join(watchDest, filepath.Base(out))
+		return false, moveFile(from, out)
+	}
+	return false, nil
+}
+
+// moveFile renames `from` to `to`, copying it when they are on different file systems.
+func moveFile(from string, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	Printf("Copying %s of %s to %s\n", humanBytes(stat.Size()), filepath.Base(from), filepath.Dir(to))
+	if _, err := io.CopyBuffer(dst, src, copyBuffer()); err != nil {
+		dst.Close()
+		os.Remove(to)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// urlsOfList reads one url per line, skipping blank lines and # comments.
+func urlsOfList(raw []byte) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+	return urls, scanner.Err()
+}
+
+// urlsOfShortcut reads the URL= line of an internet shortcut, or a bare url.
+func urlsOfShortcut(raw []byte) ([]string, error) {
+	lines, err := urlsOfList(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(strings.ToUpper(line), "URL=") {
+			return []string{line[len("URL="):]}, nil
+		}
+	}
+	if len(lines) == 1 && !strings.HasPrefix(lines[0], "[") {
+		return lines, nil
+	}
+	return nil, fmt.Errorf("no url in shortcut")
+}
+
+// requestsOf turns a parser of urls into a parser of downloads.
+func requestsOf(parse func(raw []byte) ([]string, error)) func(raw []byte) ([]DownloadRequest, error) {
+	return func(raw []byte) ([]DownloadRequest, error) {
+		urls, err := parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		requests := make([]DownloadRequest, len(urls))
+		for i, url := range urls {
+			requests[i] = DownloadRequest{URL: url}
+		}
+		return requests, nil
+	}
+}
+
+// metalinkRequests returns a download for every file of a metalink, version 3 or 4, from its first
+// http url with the others as mirrors.
+func metalinkRequests(raw []byte) ([]DownloadRequest, error) {
+	var doc struct {
+		Files []struct {
+			URLs   []string `xml:"url"`
+			URLsV3 []string `xml:"resources>url"`
+		} `xml:"file"`
+		FilesV3 []struct {
+			URLs []string `xml:"resources>url"`
+		} `xml:"files>file"`
+	}
+	if err := xml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	var files [][]string
+	for _, f := range doc.Files {
+		files = append(files, append(f.URLs, f.URLsV3...))
+	}
+	for _, f := range doc.FilesV3 {
+		files = append(files, f.URLs)
+	}
+
+	var requests []DownloadRequest
+	for _, urls := range files {
+		var req DownloadRequest
+		for _, url := range urls {
+			url = strings.TrimSpace(url)
+			if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+				continue
+			}
+			if req.URL == "" {
+				req.URL = url
+			} else {
+				req.Mirrors = append(req.Mirrors, url)
+			}
+		}
+		if req.URL != "" {
+			requests = append(requests, req)
+		}
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("no http url in metalink")
+	}
+	return requests, nil
+}
@@ -0,0 +1,102 @@
+package hget
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWatchParsers(t *testing.T) {
+	cases := []struct {
+		parse func([]byte) ([]string, error)
+		raw   string
+		want  []string
+	}{
+		{urlsOfList, "# mirrors\nhttp://a.org/1.iso\n\n  http://b.org/2.iso  \n", []string{"http://a.org/1.iso", "http://b.org/2.iso"}},
+		{urlsOfShortcut, "[InternetShortcut]\r\nURL=http://a.org/1.iso\r\n", []string{"http://a.org/1.iso"}},
+		{urlsOfShortcut, "http://a.org/1.iso\n", []string{"http://a.org/1.iso"}},
+	}
+	for i, c := range cases {
+		got, err := c.parse([]byte(c.raw))
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("case %d: expected %v, got %v", i, c.want, got)
+		}
+	}
+
+	if _, err := urlsOfShortcut([]byte("[InternetShortcut]\nIconIndex=0\n")); err == nil {
+		t.Fatalf("shortcut without url should be refused")
+	}
+}
+
+func TestMetalinkRequests(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want []DownloadRequest
+	}{
+		{`<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="1.iso"><url>ftp://c.org/1.iso</url><url>http://a.org/1.iso</url><url>http://b.org/1.iso</url></file></metalink>`,
+			[]DownloadRequest{{URL: "http://a.org/1.iso", Mirrors: []string{"http://b.org/1.iso"}}}},
+		{`<metalink version="3.0"><files><file name="2.iso"><resources><url type="http">http://a.org/2.iso</url></resources></file></files></metalink>`,
+			[]DownloadRequest{{URL: "http://a.org/2.iso"}}},
+	}
+	for i, c := range cases {
+		got, err := metalinkRequests([]byte(c.raw))
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("case %d: expected %+v, got %+v", i, c.want, got)
+		}
+	}
+}
+
+func TestWatchMarksBrokenFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hget-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	broken := filepath.Join(dir, "broken.metalink")
+	if err := ioutil.WriteFile(broken, []byte("<metalink>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ignored := filepath.Join(dir, "notes.md")
+	if err := ioutil.WriteFile(ignored, []byte("http://a.org/1.iso"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stop, err := watchOnce(dir, make(chan os.Signal))
+	if err != nil || stop {
+		t.Fatalf("expected to keep watching, got %v %v", stop, err)
+	}
+	if !ExistDir(broken + ".failed") {
+		t.Fatalf("broken file should be renamed to .failed")
+	}
+	if !ExistDir(ignored) {
+		t.Fatalf("files of other types should be left alone")
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hget-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	from, to := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	if err := ioutil.WriteFile(from, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveFile(from, to); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(to); string(data) != "data" || ExistDir(from) {
+		t.Fatalf("file was not moved")
+	}
+}
@@ -0,0 +1,52 @@
+package hget
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// dashboard is the web page hget daemon serves on /, to list, add, watch, pause and cancel downloads
+//
+//go:embed ui/index.html
+var dashboard []byte
+
+// serveDashboard serves the web page, it asks for the token itself and calls the REST endpoints with it.
+func serveDashboard(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'unsafe-inline'; script-src 'unsafe-inline'")
+	w.Write(dashboard)
+}
+
+// serveEvents streams the progress events of the downloads of `user` as server-sent events, those of the
+// task of the `task` query parameter only if set, until the client goes away.
+func (d *Daemon) serveEvents(w http.ResponseWriter, r *http.Request, user string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	events := d.events.subscribe(user, r.URL.Query().Get("task"))
+	defer d.events.unsubscribe(events)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-events.ch:
+			data, _ := json.Marshal(struct {
+				Task string `json:"task"`
+				URL  string `json:"url"`
+				progressEvent
+			}{e.task, e.url, e.progressEvent})
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package hget
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDaemonDashboard(t *testing.T) {
+	defer func(data string) { dataPath = data }(dataPath)
+	dataPath = t.TempDir()
+	d, err := NewDaemon("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(d)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("the dashboard should be served without the token, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	do := func(method string, path string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	if resp := do(http.MethodPost, "/tasks/1.iso/pause"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("a download which is not running can not be paused, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodPost, "/tasks/1.iso"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("only pause can be posted to a task, got %d", resp.StatusCode)
+	}
+
+	resp = do(http.MethodGet, "/events")
+	defer resp.Body.Close()
+	part := int64(2)
+	d.events.publish(taskEvent{progressEvent: progressEvent{Event: "progress", Part: &part, Bytes: 42}, task: "1.iso", url: "http://a.org/1.iso"})
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "data: ") {
+		t.Fatalf("an event should be streamed, got %q, %v", line, err)
+	}
+	var e struct {
+		Task  string `json:"task"`
+		Part  int64  `json:"part"`
+		Bytes int64  `json:"bytes"`
+	}
+	if err := json.Unmarshal([]byte(line[len("data: "):]), &e); err != nil || e.Task != "1.iso" || e.Part != 2 || e.Bytes != 42 {
+		t.Fatalf("unexpected event %q, %v", line, err)
+	}
+}
@@ -0,0 +1,89 @@
+package hget
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/units"
+)
+
+var rangeSpec = ""
+
+// byteWindow is the part of the file -range downloads, from From to To excluded, of a file of Length bytes.
+type byteWindow struct {
+	From   int64
+	To     int64
+	Length int64
+}
+
+// parseWindow parses a -range such as 100MB-200MB, 1GiB- up to the end or -512KiB from the start, of
+// a file of `length` bytes. An end past the file stops at its end.
+func parseWindow(spec string, length int64) (*byteWindow, error) {
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid range %q, expected from-to such as 100MB-200MB", spec)
+	}
+	w := &byteWindow{To: length, Length: length}
+	var err error
+	if spec[:i] != "" {
+		if w.From, err = parseOffset(spec[:i]); err != nil {
+			return nil, err
+		}
+	}
+	if spec[i+1:] != "" {
+		if w.To, err = parseOffset(spec[i+1:]); err != nil {
+			return nil, err
+		}
+		if w.To > length {
+			w.To = length
+		}
+	}
+	if w.From >= w.To {
+		return nil, fmt.Errorf("range %q holds no byte of the %s file", spec, humanBytes(length))
+	}
+	return w, nil
+}
+
+// parseOffset parses an offset in bytes, with or without a unit.
+func parseOffset(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n >= 0 {
+		return n, nil
+	}
+	n, err := units.ParseStrictBytes(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid offset %q in range", s)
+	}
+	return n, nil
+}
+
+// size returns how many bytes the window holds.
+func (w *byteWindow) size() int64 {
+	return w.To - w.From
+}
+
+// parts splits the window in `par` parts as partCalculate does the whole file. The last part ends
+// at the length of the file only when the window does, before that its end is included as for the others.
+func (w *byteWindow) parts(par int64, url string) ([]Part, error) {
+	parts, err := partCalculate(par, w.size(), url)
+	if err != nil {
+		return nil, err
+	}
+	for i := range parts {
+		parts[i].RangeFrom += w.From
+		parts[i].RangeTo += w.From
+	}
+	if w.To != w.Length {
+		parts[len(parts)-1].RangeTo--
+	}
+	file, folder := filepath.Base(url), partsFolderOf(url)
+	for i, part := range parts {
+		end := part.RangeTo
+		if i == len(parts)-1 && w.To == w.Length {
+			end--
+		}
+		parts[i].Path = filepath.Join(folder, partName(file, part.Index, part.RangeFrom, end))
+	}
+	return parts, nil
+}
@@ -0,0 +1,59 @@
+package hget
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	cases := map[string]byteWindow{
+		"100-200":    {From: 100, To: 200, Length: 1 << 20},
+		"1KiB-":      {From: 1024, To: 1 << 20, Length: 1 << 20},
+		"-512KiB":    {From: 0, To: 512 << 10, Length: 1 << 20},
+		"1KiB-10MiB": {From: 1024, To: 1 << 20, Length: 1 << 20},
+	}
+	for spec, expected := range cases {
+		w, err := parseWindow(spec, 1<<20)
+		if err != nil || *w != expected {
+			t.Fatalf("%s: expected %+v, got %+v %v", spec, expected, w, err)
+		}
+	}
+	for _, spec := range []string{"100", "200-100", "2MiB-", "a-b", "-0"} {
+		if _, err := parseWindow(spec, 1<<20); err == nil {
+			t.Fatalf("%s should be refused", spec)
+		}
+	}
+
+	parts, _ := (&byteWindow{From: 100, To: 200, Length: 1000}).parts(3, "http://a.org/f")
+	if parts[0].RangeFrom != 100 || parts[0].RangeTo != 132 || parts[2].RangeFrom != 166 || parts[2].RangeTo != 199 {
+		t.Fatalf("the parts should cover bytes 100 to 199, got %+v", parts)
+	}
+	parts, _ = (&byteWindow{From: 100, To: 1000, Length: 1000}).parts(3, "http://a.org/f")
+	if parts[2].RangeTo != 1000 {
+		t.Fatalf("the last part of a window up to the end should end at the length of the file, got %+v", parts)
+	}
+}
+
+func TestDownloadWindow(t *testing.T) {
+	displayProgress = false
+	defer func() { rangeSpec = "" }()
+	content := strings.Repeat("0123456789", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "window.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	url := server.URL + "/window.bin"
+
+	for spec, expected := range map[string]string{"100-350": content[100:350], "990-": content[990:], "-3": content[:3]} {
+		rangeSpec = spec
+		d := NewHTTPDownloader(url, 4, true, "", "")
+		if got := downloadJoined(t, d); got != expected {
+			t.Fatalf("%s: expected %q, got %q", spec, expected, got)
+		}
+		os.RemoveAll(FolderOf(url))
+	}
+}
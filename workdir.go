@@ -0,0 +1,29 @@
+package hget
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// workDir is where the parts are written while downloading when set, such as a scratch disk, they are
+// moved to the folder of the task when its state is saved
+var workDir = ""
+
+// partsFolderOf returns the folder the parts of `url` are written to.
+func partsFolderOf(url string) string {
+	if workDir == "" {
+		return FolderOf(url)
+	}
+	return filepath.Join(workDir, filepath.Base(FolderOf(url)))
+}
+
+// removeTask removes the folder of the task of `url`, and the one of its parts with -work-dir.
+func removeTask(url string) error {
+	if err := os.RemoveAll(FolderOf(url)); err != nil {
+		return err
+	}
+	if parts := partsFolderOf(url); parts != FolderOf(url) {
+		return os.RemoveAll(parts)
+	}
+	return nil
+}
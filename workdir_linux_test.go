@@ -0,0 +1,35 @@
+package hget
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestMoveFileAcrossFileSystems(t *testing.T) {
+	other, err := ioutil.TempDir("/dev/shm", "hget-")
+	if err != nil {
+		t.Skip("no /dev/shm")
+	}
+	defer os.RemoveAll(other)
+	dir := t.TempDir()
+	var here, there syscall.Stat_t
+	if syscall.Stat(dir, &here) != nil || syscall.Stat(other, &there) != nil || here.Dev == there.Dev {
+		t.Skip("/dev/shm is on the file system of the temp folder")
+	}
+
+	from := filepath.Join(other, "file.part000000")
+	to := filepath.Join(dir, "file.part000000")
+	ioutil.WriteFile(from, []byte("part"), 0600)
+	if err := moveFile(from, to); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(to); string(got) != "part" {
+		t.Fatalf("moved %q", got)
+	}
+	if _, err := os.Stat(from); !os.IsNotExist(err) {
+		t.Fatalf("the copied file should be removed, got %v", err)
+	}
+}
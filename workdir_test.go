@@ -0,0 +1,54 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkDir(t *testing.T) {
+	displayProgress = false
+	defer func(data string) { dataPath, output, workDir, keepParts = data, "", "", false }(dataPath)
+	dataPath = t.TempDir()
+	workDir = t.TempDir()
+	content := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "scratch.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	output = filepath.Join(t.TempDir(), "scratch.bin")
+	url := server.URL + "/scratch.bin"
+
+	parts, _ := partCalculate(2, int64(len(content)), url)
+	if filepath.Dir(parts[0].Path) != filepath.Join(workDir, "scratch.bin") {
+		t.Fatalf("parts should be written to the work dir, got %s", parts[0].Path)
+	}
+
+	keepParts = true
+	if err := Download(url); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(output); string(got) != content {
+		t.Fatalf("unexpected content %q", got)
+	}
+	s, err := Read(TaskFromURL(url))
+	if err != nil {
+		t.Fatalf("the state should be kept, got %v", err)
+	}
+	for _, part := range s.Parts {
+		if filepath.Dir(part.Path) != FolderOf(url) {
+			t.Fatalf("part %d should have been moved to the task folder, got %s", part.Index, part.Path)
+		}
+		if _, err := os.Stat(part.Path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(partsFolderOf(url)); !os.IsNotExist(err) {
+		t.Fatalf("the emptied folder of the parts should be removed, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package hget
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/alecthomas/units"
+)
+
+var writeBufferSpec = ""
+
+// writeBuffer is the memory the parts of a download may hold before writing it, none when 0
+var writeBuffer int64
+
+// minPartBuffer is the smallest buffer of a part, smaller flushes would not be worth taking turns
+var minPartBuffer int64 = 256 << 10
+
+// flushing makes the parts write their buffer one at a time, so the disk gets long sequential
+// writes rather than as many interleaved streams as there are connections
+var flushing sync.Mutex
+
+// parseWriteBuffer reads the size of -write-buffer.
+func parseWriteBuffer() (int64, error) {
+	if writeBufferSpec == "" {
+		return 0, nil
+	}
+	size, err := units.ParseStrictBytes(writeBufferSpec)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid -write-buffer %q", writeBufferSpec)
+	}
+	return size, nil
+}
+
+// partFile is the file a part is appended to. With -write-buffer, what is written is held in memory
+// up to the share of the part and written in one go once it is full, or when the file is flushed.
+type partFile struct {
+	*os.File
+	size    int
+	pending []byte
+}
+
+// bufferedFile returns the part file `f`, buffered with its share of -write-buffer. Devices are
+// written at the offset of every part and are not buffered.
+func (d *HTTPDownloader) bufferedFile(f *os.File) *partFile {
+	p := &partFile{File: f}
+	if writeBuffer > 0 && d.device == "" {
+		size := writeBuffer
+		if d.par > 1 {
+			size /= d.par
+		}
+		if size < minPartBuffer {
+			size = minPartBuffer
+		}
+		p.size = int(size)
+	}
+	return p
+}
+
+func (p *partFile) Write(b []byte) (int, error) {
+	if p.size == 0 {
+		return p.writeThrough(b)
+	}
+	if len(p.pending)+len(b) > p.size {
+		if err := p.flushPending(); err != nil {
+			return 0, err
+		}
+	}
+	if len(b) >= p.size {
+		flushing.Lock()
+		defer flushing.Unlock()
+		return p.writeThrough(b)
+	}
+	if p.pending == nil {
+		p.pending = make([]byte, 0, p.size)
+	}
+	p.pending = append(p.pending, b...)
+	return len(b), nil
+}
+
+// WriteAt writes `b` at `off` of a device, which is not buffered.
+func (p *partFile) WriteAt(b []byte, off int64) (int, error) {
+	n, err := p.File.WriteAt(b, off)
+	if err == nil && fsyncMode == fsyncAlways {
+		err = syncFile(p.File)
+	}
+	return n, err
+}
+
+// writeThrough writes `b` to the file, synced with -fsync always.
+func (p *partFile) writeThrough(b []byte) (int, error) {
+	n, err := p.File.Write(b)
+	if err == nil && fsyncMode == fsyncAlways {
+		err = syncFile(p.File)
+	}
+	return n, err
+}
+
+// flushPending writes what is held in memory to the file.
+func (p *partFile) flushPending() error {
+	if len(p.pending) == 0 {
+		return nil
+	}
+	flushing.Lock()
+	defer flushing.Unlock()
+	n, err := p.writeThrough(p.pending)
+	// what a failed write left is kept for the next flush
+	p.pending = append(p.pending[:0], p.pending[n:]...)
+	return err
+}
+
+// Flush writes what is held in memory to the file and, unless -fsync is never, syncs it, so that a
+// part is on the disk before the state saying so.
+func (p *partFile) Flush() error {
+	if err := p.flushPending(); err != nil {
+		return err
+	}
+	if fsyncMode != fsyncNever {
+		return syncFile(p.File)
+	}
+	return nil
+}
+
+// Truncate drops what is held in memory, a truncated part goes back to what was on the disk.
+func (p *partFile) Truncate(size int64) error {
+	p.pending = p.pending[:0]
+	return p.File.Truncate(size)
+}
+
+// Close writes what is held in memory and closes the file.
+func (p *partFile) Close() error {
+	err := p.flushPending()
+	if cerr := p.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
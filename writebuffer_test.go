@@ -0,0 +1,68 @@
+package hget
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPartFile(t *testing.T) {
+	defer func(size int64, min int64) { writeBuffer, minPartBuffer = size, min }(writeBuffer, minPartBuffer)
+	writeBuffer, minPartBuffer = 16, 4
+	path := filepath.Join(t.TempDir(), "part")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	f := (&HTTPDownloader{par: 2}).bufferedFile(file)
+	onDisk := func() string {
+		raw, _ := ioutil.ReadFile(path)
+		return string(raw)
+	}
+
+	f.Write([]byte("abc"))
+	f.Write([]byte("de"))
+	if got := onDisk(); got != "" {
+		t.Fatalf("writes should be held until the share of the part is full, got %q on the disk", got)
+	}
+	f.Write([]byte("fghi"))
+	if got := onDisk(); got != "abcde" {
+		t.Fatalf("a full buffer should be written in one go, got %q", got)
+	}
+	f.Write([]byte("jklmnopq"))
+	if got := onDisk(); got != "abcdefghijklmnopq" {
+		t.Fatalf("a write larger than the buffer should go straight to the disk, got %q", got)
+	}
+	f.Write([]byte("rs"))
+	f.Truncate(5)
+	f.Write([]byte("fg"))
+	if err := f.Close(); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got := onDisk(); got != "abcdefg" {
+		t.Fatalf("truncating should drop what is held, closing write the rest, got %q", got)
+	}
+}
+
+func TestDownloadWriteBuffer(t *testing.T) {
+	displayProgress = false
+	defer func(size int64, min int64) { writeBuffer, minPartBuffer = size, min }(writeBuffer, minPartBuffer)
+	writeBuffer, minPartBuffer = 64, 16
+	content := strings.Repeat("0123456789", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "buffered.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	url := server.URL + "/buffered.bin"
+	defer os.RemoveAll(FolderOf(url))
+
+	d := NewHTTPDownloader(url, 4, true, "", "")
+	if got := downloadJoined(t, d); got != content {
+		t.Fatalf("unexpected content %q", got)
+	}
+}
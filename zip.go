@@ -0,0 +1,182 @@
+package hget
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// zipReadAhead is how much of the archive a read of the central directory fetches at once, it is read
+// a few bytes at a time
+var zipReadAhead int64 = 256 << 10
+
+// remoteZip reads a zip archive with ranges, the central directory first and then only the members
+// asked for, rather than the whole archive.
+type remoteZip struct {
+	d    *HTTPDownloader
+	size int64
+	// the last range fetched
+	buf    []byte
+	bufOff int64
+}
+
+// openRemoteZip reads the central directory of the zip archive at `url`.
+func openRemoteZip(url string, proxy string) (*zip.Reader, *remoteZip, error) {
+	d := &HTTPDownloader{url: url, proxy: proxy, userAgent: chooseUserAgent()}
+	resp, err := d.probe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, nil, fmt.Errorf("%w, the archive has to be downloaded as a whole", ErrRangeNotSupported)
+	}
+	size := sizeOf(resp)
+	if size < 0 {
+		return nil, nil, errors.New("the server does not tell the size of the archive")
+	}
+	r := &remoteZip{d: d, size: size}
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	return archive, r, nil
+}
+
+// ReadAt implements io.ReaderAt for archive/zip.
+func (r *remoteZip) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if off < r.bufOff || off+int64(len(p)) > r.bufOff+int64(len(r.buf)) {
+		to := off + int64(len(p))
+		if to < off+zipReadAhead {
+			to = off + zipReadAhead
+		}
+		if to > r.size {
+			to = r.size
+		}
+		body, err := r.d.fetchRange(off, to)
+		if err != nil {
+			return 0, err
+		}
+		defer body.Close()
+		buf := make([]byte, to-off)
+		if _, err := io.ReadFull(body, buf); err != nil {
+			return 0, err
+		}
+		r.buf, r.bufOff = buf, off
+	}
+	// copy is the one of the joiner in this package
+	n, _ := bytes.NewReader(r.buf[off-r.bufOff:]).Read(p)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// extract writes the member `f` to `w`, its compressed bytes are fetched with a single range.
+func (r *remoteZip) extract(f *zip.File, w io.Writer) (int64, error) {
+	if f.Flags&0x1 != 0 {
+		return 0, fmt.Errorf("%s is encrypted", f.Name)
+	}
+	offset, err := f.DataOffset()
+	if err != nil {
+		return 0, err
+	}
+	var body io.ReadCloser = http.NoBody
+	if f.CompressedSize64 > 0 {
+		if body, err = r.d.fetchRange(offset, offset+int64(f.CompressedSize64)); err != nil {
+			return 0, err
+		}
+	}
+	defer body.Close()
+
+	var reader io.Reader
+	switch f.Method {
+	case zip.Store:
+		reader = body
+	case zip.Deflate:
+		inflated := flate.NewReader(body)
+		defer inflated.Close()
+		reader = inflated
+	default:
+		return 0, fmt.Errorf("%s is compressed with the unsupported method %d", f.Name, f.Method)
+	}
+	sum := crc32.NewIEEE()
+	n, err := io.Copy(io.MultiWriter(w, sum), reader)
+	if err != nil {
+		return n, err
+	}
+	if uint64(n) != f.UncompressedSize64 || sum.Sum32() != f.CRC32 {
+		return n, fmt.Errorf("%s is corrupted, its checksum does not match", f.Name)
+	}
+	return n, nil
+}
+
+// ListZip prints the members of the zip archive at `url`, fetching only its central directory.
+func ListZip(url string, w io.Writer) error {
+	archive, _, err := openRemoteZip(url, proxyServer)
+	if err != nil {
+		return err
+	}
+	for _, f := range archive.File {
+		fmt.Fprintf(w, "%10s  %s  %s\n", humanBytes(int64(f.UncompressedSize64)), f.Modified.Format("2006-01-02 15:04"), f.Name)
+	}
+	return nil
+}
+
+// ExtractZip downloads the member `name` of the zip archive at `url` to `out`, or to the current folder
+// or -dir under its base name, fetching only its central directory and the member.
+func ExtractZip(url string, name string, out string) error {
+	archive, r, err := openRemoteZip(url, proxyServer)
+	if err != nil {
+		return err
+	}
+	for _, f := range archive.File {
+		if f.Name != name {
+			continue
+		}
+		if out == "" {
+			out = filepath.Base(f.Name)
+		}
+		out = inOutputDir(out)
+		file, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		n, err := r.extract(f, file)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(out)
+			return err
+		}
+		Printf("Extracted %s (%s) to %s\n", f.Name, humanBytes(n), out)
+		return nil
+	}
+	return fmt.Errorf("%s is not in the archive", name)
+}
+
+func zipCommand(args []string) error {
+	if len(args) < 2 {
+		return errors.New("expected zip ls URL or zip get URL member")
+	}
+	switch args[0] {
+	case "ls":
+		return ListZip(args[1], os.Stdout)
+	case "get":
+		if len(args) < 3 {
+			return errors.New("the member to get is required")
+		}
+		return ExtractZip(args[1], args[2], output)
+	}
+	return fmt.Errorf("unknown zip command %q", args[0])
+}
@@ -0,0 +1,81 @@
+package hget
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRemoteZip(t *testing.T) {
+	displayProgress = false
+	defer func(ahead int64) { zipReadAhead = ahead }(zipReadAhead)
+	zipReadAhead = 4 << 10
+
+	noise := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(noise)
+	readme := strings.Repeat("read me\n", 1000)
+	var archive bytes.Buffer
+	w := zip.NewWriter(&archive)
+	for _, member := range []struct {
+		name    string
+		method  uint16
+		content []byte
+	}{{"big.bin", zip.Store, noise}, {"docs/readme.txt", zip.Deflate, []byte(readme)}, {"empty", zip.Store, nil}} {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: member.name, Method: member.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(member.content)
+	}
+	w.Close()
+
+	var served int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(&countingWriter{ResponseWriter: w, n: &served}, r, "a.zip", time.Time{}, bytes.NewReader(archive.Bytes()))
+	}))
+	defer server.Close()
+	url := server.URL + "/a.zip"
+
+	var list bytes.Buffer
+	if err := ListZip(url, &list); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if !strings.Contains(list.String(), "docs/readme.txt") || !strings.Contains(list.String(), "1.0 MiB") {
+		t.Fatalf("unexpected listing %q", list.String())
+	}
+
+	out := filepath.Join(t.TempDir(), "readme.txt")
+	if err := ExtractZip(url, "docs/readme.txt", out); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if got, _ := ioutil.ReadFile(out); string(got) != readme {
+		t.Fatalf("the member is different from the original")
+	}
+	if served > int64(archive.Len())/4 {
+		t.Fatalf("only the central directory and the member should be downloaded, got %d of %d bytes", served, archive.Len())
+	}
+	if err := ExtractZip(url, "empty", filepath.Join(t.TempDir(), "empty")); err != nil {
+		t.Fatalf("err should be nil, got %v", err)
+	}
+	if err := ExtractZip(url, "missing", out); err == nil {
+		t.Fatalf("a member not in the archive should fail")
+	}
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	atomic.AddInt64(w.n, int64(len(b)))
+	return w.ResponseWriter.Write(b)
+}